@@ -12,6 +12,8 @@ package ast
 
 import (
 	"bytes"
+	"reflect"
+	"strings"
 
 	"eloquence/token"
 )
@@ -24,6 +26,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // Where the node's first character is
+	End() token.Position // Just past the node's last character
 }
 
 // Statement represents a node that performs an action but does not return a value.
@@ -54,6 +58,20 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if n := len(p.Statements); n > 0 {
+		return p.Statements[n-1].End()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -62,22 +80,143 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// ----------------------------------------------------------------------------------------------
+// POSITIONS
+// ----------------------------------------------------------------------------------------------
+// Every node spans the source from Pos() up to End(), which is just past its last character,
+// so src[node.Pos().Offset:node.End().Offset] is the node's own text. The helpers below let the
+// nodes compute that span from their tokens and children; missing children (nil) are skipped.
+
+// startOf returns the start of the first of toks that is set.
+func startOf(toks ...token.Token) token.Position {
+	for _, tok := range toks {
+		if tok.Type != "" {
+			return tok.Pos()
+		}
+	}
+	return token.Position{}
+}
+
+// posOf returns the start of node, or of tok when node is missing.
+func posOf(tok token.Token, node Node) token.Position {
+	if present(node) {
+		return node.Pos()
+	}
+	return tok.Pos()
+}
+
+// endOf returns the end of the last of nodes that is present, or of tok when none is.
+func endOf(tok token.Token, nodes ...Node) token.Position {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if present(nodes[i]) {
+			return nodes[i].End()
+		}
+	}
+	return tok.End
+}
+
+// closeOf returns the end of a closing token, or end when the node has none.
+func closeOf(closing token.Token, end token.Position) token.Position {
+	if closing.Type != "" {
+		return closing.End
+	}
+	return end
+}
+
+// present reports whether a node is there: neither nil nor a nil pointer.
+func present(node Node) bool {
+	if node == nil {
+		return false
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() != reflect.Pointer || !v.IsNil()
+}
+
+func expressions(list []Expression) []Node {
+	nodes := make([]Node, len(list))
+	for i, e := range list {
+		nodes[i] = e
+	}
+	return nodes
+}
+
+func patterns(list []Pattern) []Node {
+	nodes := make([]Node, len(list))
+	for i, p := range list {
+		nodes[i] = p
+	}
+	return nodes
+}
+
 // ----------------------------------------------------------------------------------------------
 // STATEMENTS
 // ----------------------------------------------------------------------------------------------
 
 // AssignmentStatement represents binding a value to a variable.
-// Syntax: x is 5
+// Syntax: x is 5 / let x is 5 / constant PI is 3.14 / redefine show is takes(x) { ... }
 type AssignmentStatement struct {
-	Token token.Token // The 'IDENT' token
-	Name  *Identifier
-	Value Expression
+	Token    token.Token // The 'IDENT' token
+	Modifier token.Token // The 'let', 'constant' or 'redefine' keyword; zero for a plain assignment
+	Name     *Identifier
+	Type     *Identifier // Declared type ("x as Integer is 5"), nil when omitted
+	Value    Expression
 }
 
 func (as *AssignmentStatement) statementNode()       {}
 func (as *AssignmentStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignmentStatement) Pos() token.Position  { return startOf(as.Modifier, as.Token) }
+func (as *AssignmentStatement) End() token.Position {
+	return endOf(as.Token, as.Name, as.Type, as.Value)
+}
 func (as *AssignmentStatement) String() string {
-	return as.Name.String() + " is " + as.Value.String()
+	return modifier(as.Modifier) + as.Name.String() + annotation(as.Type) + " is " + as.Value.String()
+}
+
+// modifier renders an optional keyword in front of an assignment as "constant ".
+func modifier(tok token.Token) string {
+	if tok.Literal == "" {
+		return ""
+	}
+	return tok.Literal + " "
+}
+
+// annotation renders an optional type annotation as " as Type".
+func annotation(typ *Identifier) string {
+	if typ == nil {
+		return ""
+	}
+	return " as " + typ.Value
+}
+
+// typeAt returns the i-th entry of a list of optional annotations, or nil.
+func typeAt(types []*Identifier, i int) *Identifier {
+	if i < len(types) {
+		return types[i]
+	}
+	return nil
+}
+
+// DestructuringStatement binds several names from one value with a pattern.
+// Syntax: a, b is pair / [first, ...rest] is list / { name, age } is user / a, b is b, a
+// Several values on the right are packed into an array before the pattern is matched.
+type DestructuringStatement struct {
+	Token   token.Token // The first token of the pattern
+	Pattern Pattern
+	Values  []Expression
+}
+
+func (ds *DestructuringStatement) statementNode()       {}
+func (ds *DestructuringStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DestructuringStatement) Pos() token.Position  { return ds.Token.Pos() }
+func (ds *DestructuringStatement) End() token.Position {
+	return endOf(ds.Token, append([]Node{ds.Pattern}, expressions(ds.Values)...)...)
+}
+func (ds *DestructuringStatement) String() string {
+	values := make([]string, len(ds.Values))
+	for i, v := range ds.Values {
+		values[i] = v.String()
+	}
+	return ds.Pattern.String() + " is " + strings.Join(values, ", ")
 }
 
 // ReturnStatement represents exiting a function with a value.
@@ -85,10 +224,13 @@ func (as *AssignmentStatement) String() string {
 type ReturnStatement struct {
 	Token       token.Token
 	ReturnValue Expression
+	Tail        bool // return f(x) in a function, outside try blocks: the call can replace the caller's frame
 }
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos() }
+func (rs *ReturnStatement) End() token.Position  { return endOf(rs.Token, rs.ReturnValue) }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("return ")
@@ -98,6 +240,20 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// YieldStatement hands a value to the consumer of a generator and pauses until the next
+// value is asked for. A function containing one returns a generator when called.
+// Syntax: yield n
+type YieldStatement struct {
+	Token token.Token // The 'yield' token
+	Value Expression
+}
+
+func (ys *YieldStatement) statementNode()       {}
+func (ys *YieldStatement) TokenLiteral() string { return ys.Token.Literal }
+func (ys *YieldStatement) Pos() token.Position  { return ys.Token.Pos() }
+func (ys *YieldStatement) End() token.Position  { return endOf(ys.Token, ys.Value) }
+func (ys *YieldStatement) String() string       { return "yield " + ys.Value.String() }
+
 // ExpressionStatement allows an expression to stand alone as a statement.
 // Example: calls like show(x), or simple arithmetic on a line.
 type ExpressionStatement struct {
@@ -107,6 +263,8 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return posOf(es.Token, es.Expression) }
+func (es *ExpressionStatement) End() token.Position  { return endOf(es.Token, es.Expression) }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -116,12 +274,20 @@ func (es *ExpressionStatement) String() string {
 
 // BlockStatement represents a grouped sequence of statements (used in loops/if).
 type BlockStatement struct {
-	Token      token.Token // The '{' token
+	Token      token.Token // The '{' token, or the first token of a block closed by 'end'
 	Statements []Statement
+	Close      token.Token // The '}' or 'end' closing the block; zero when the next clause or arm ends it
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos() }
+func (bs *BlockStatement) End() token.Position {
+	if n := len(bs.Statements); n > 0 {
+		return closeOf(bs.Close, bs.Statements[n-1].End())
+	}
+	return closeOf(bs.Close, bs.Pos()) // An empty block closed by a clause takes no room
+}
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	for _, s := range bs.Statements {
@@ -131,35 +297,85 @@ func (bs *BlockStatement) String() string {
 }
 
 // PointerAssignmentStatement represents writing to a memory address.
-// Syntax: pointing from ptr is 5
+// Syntax: pointing from ptr is 5, pointing from pointing from pp is 5
 type PointerAssignmentStatement struct {
-	Token token.Token // The 'pointing from' token
-	Name  *Identifier
-	Value Expression
+	Token  token.Token // The 'pointing from' token
+	Target Expression  // The expression producing the pointer
+	Name   *Identifier // The pointer variable when Target is a plain identifier, otherwise nil
+	Value  Expression
 }
 
 func (pas *PointerAssignmentStatement) statementNode()       {}
 func (pas *PointerAssignmentStatement) TokenLiteral() string { return pas.Token.Literal }
+func (pas *PointerAssignmentStatement) Pos() token.Position  { return pas.Token.Pos() }
+func (pas *PointerAssignmentStatement) End() token.Position {
+	return endOf(pas.Token, pas.Target, pas.Value)
+}
 func (pas *PointerAssignmentStatement) String() string {
-	return "pointing from " + pas.Name.String() + " is " + pas.Value.String()
+	return "pointing from " + pas.Target.String() + " is " + pas.Value.String()
 }
 
 // StructDefinitionStatement defines a new custom data type.
-// Syntax: define User as struct { name, age }
+// Syntax: define User as struct { ...Person, name, age is 0 }
 type StructDefinitionStatement struct {
-	Token      token.Token
-	Name       *Identifier
-	Attributes []*Identifier
+	Token          token.Token
+	Name           *Identifier
+	Embeds         []*Identifier // Embedded structs ("...Person") whose fields are promoted
+	Attributes     []*Identifier
+	AttributeTypes []*Identifier // Declared type per attribute; nil entries are unannotated
+	Defaults       []Expression  // Default value per attribute; nil entries are required fields
+	Close          token.Token   // The closing '}' or 'end'
 }
 
 func (sds *StructDefinitionStatement) statementNode()       {}
 func (sds *StructDefinitionStatement) TokenLiteral() string { return sds.Token.Literal }
+func (sds *StructDefinitionStatement) Pos() token.Position  { return sds.Token.Pos() }
+func (sds *StructDefinitionStatement) End() token.Position {
+	return closeOf(sds.Close, endOf(sds.Token, sds.Name))
+}
 func (sds *StructDefinitionStatement) String() string {
-	var out bytes.Buffer
-	out.WriteString("define " + sds.Name.String() + " as struct { ")
+	parts := []string{}
+	for _, e := range sds.Embeds {
+		parts = append(parts, "..."+e.String())
+	}
 	for i, a := range sds.Attributes {
-		out.WriteString(a.String())
-		if i < len(sds.Attributes)-1 {
+		part := a.String() + annotation(typeAt(sds.AttributeTypes, i))
+		if i < len(sds.Defaults) && sds.Defaults[i] != nil {
+			part += " is " + sds.Defaults[i].String()
+		}
+		parts = append(parts, part)
+	}
+	return "define " + sds.Name.String() + " as struct { " + strings.Join(parts, ", ") + " }"
+}
+
+// EnumDefinitionStatement declares a type with a fixed set of variants.
+// Syntax: define Shape as enum { Empty, Circle(radius), Rect(width, height) }
+type EnumDefinitionStatement struct {
+	Token    token.Token // The 'define' token
+	Name     *Identifier
+	Variants []EnumVariant
+	Close    token.Token // The closing '}' or 'end'
+}
+
+// EnumVariant is one variant of an enum; Fields name its associated values (nil for plain variants).
+type EnumVariant struct {
+	Name       *Identifier
+	Fields     []*Identifier
+	FieldTypes []*Identifier // Declared type per field; nil entries are unannotated
+}
+
+func (eds *EnumDefinitionStatement) statementNode()       {}
+func (eds *EnumDefinitionStatement) TokenLiteral() string { return eds.Token.Literal }
+func (eds *EnumDefinitionStatement) Pos() token.Position  { return eds.Token.Pos() }
+func (eds *EnumDefinitionStatement) End() token.Position {
+	return closeOf(eds.Close, endOf(eds.Token, eds.Name))
+}
+func (eds *EnumDefinitionStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("define " + eds.Name.String() + " as enum { ")
+	for i, v := range eds.Variants {
+		out.WriteString(v.String())
+		if i < len(eds.Variants)-1 {
 			out.WriteString(", ")
 		}
 	}
@@ -167,6 +383,22 @@ func (sds *StructDefinitionStatement) String() string {
 	return out.String()
 }
 
+func (v EnumVariant) String() string {
+	if v.Fields == nil {
+		return v.Name.String()
+	}
+	var out bytes.Buffer
+	out.WriteString(v.Name.String() + "(")
+	for i, f := range v.Fields {
+		out.WriteString(f.String() + annotation(typeAt(v.FieldTypes, i)))
+		if i < len(v.Fields)-1 {
+			out.WriteString(", ")
+		}
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
 // LoopStatement represents a conditional loop (while).
 type LoopStatement struct {
 	Token     token.Token // The 'while' token
@@ -176,6 +408,8 @@ type LoopStatement struct {
 
 func (ls *LoopStatement) statementNode()       {}
 func (ls *LoopStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LoopStatement) Pos() token.Position  { return ls.Token.Pos() }
+func (ls *LoopStatement) End() token.Position  { return endOf(ls.Token, ls.Condition, ls.Body) }
 func (ls *LoopStatement) String() string {
 	return ls.Token.Literal + " " + ls.Condition.String() + " " + ls.Body.String()
 }
@@ -191,6 +425,10 @@ type RangeLoopStatement struct {
 
 func (rl *RangeLoopStatement) statementNode()       {}
 func (rl *RangeLoopStatement) TokenLiteral() string { return rl.Token.Literal }
+func (rl *RangeLoopStatement) Pos() token.Position  { return rl.Token.Pos() }
+func (rl *RangeLoopStatement) End() token.Position {
+	return endOf(rl.Token, rl.Iterator, rl.Iterable, rl.Body)
+}
 func (rl *RangeLoopStatement) String() string {
 	return "for " + rl.Iterator.String() + " in " + rl.Iterable.String() + " " + rl.Body.String()
 }
@@ -205,6 +443,10 @@ type TryCatchStatement struct {
 
 func (tc *TryCatchStatement) statementNode()       {}
 func (tc *TryCatchStatement) TokenLiteral() string { return tc.Token.Literal }
+func (tc *TryCatchStatement) Pos() token.Position  { return tc.Token.Pos() }
+func (tc *TryCatchStatement) End() token.Position {
+	return endOf(tc.Token, tc.TryBlock, tc.CatchBlock, tc.FinallyBlock)
+}
 func (tc *TryCatchStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("try " + tc.TryBlock.String())
@@ -225,6 +467,8 @@ type IncludeStatement struct {
 
 func (is *IncludeStatement) statementNode()       {}
 func (is *IncludeStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *IncludeStatement) Pos() token.Position  { return is.Token.Pos() }
+func (is *IncludeStatement) End() token.Position  { return endOf(is.Token, is.Path) }
 func (is *IncludeStatement) String() string {
 	return "include " + is.Path.String()
 }
@@ -240,6 +484,8 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos() }
+func (i *Identifier) End() token.Position  { return i.Token.End }
 func (i *Identifier) String() string       { return i.Value }
 
 type IntegerLiteral struct {
@@ -249,6 +495,8 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos() }
+func (il *IntegerLiteral) End() token.Position  { return il.Token.End }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type FloatLiteral struct {
@@ -258,6 +506,8 @@ type FloatLiteral struct {
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FloatLiteral) End() token.Position  { return fl.Token.End }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
 type StringLiteral struct {
@@ -267,6 +517,8 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos() }
+func (sl *StringLiteral) End() token.Position  { return sl.Token.End }
 func (sl *StringLiteral) String() string       { return `"` + sl.Value + `"` }
 
 type CharLiteral struct {
@@ -276,6 +528,8 @@ type CharLiteral struct {
 
 func (cl *CharLiteral) expressionNode()      {}
 func (cl *CharLiteral) TokenLiteral() string { return cl.Token.Literal }
+func (cl *CharLiteral) Pos() token.Position  { return cl.Token.Pos() }
+func (cl *CharLiteral) End() token.Position  { return cl.Token.End }
 func (cl *CharLiteral) String() string       { return "'" + string(cl.Value) + "'" }
 
 type BooleanLiteral struct {
@@ -285,6 +539,8 @@ type BooleanLiteral struct {
 
 func (bl *BooleanLiteral) expressionNode()      {}
 func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Literal }
+func (bl *BooleanLiteral) Pos() token.Position  { return bl.Token.Pos() }
+func (bl *BooleanLiteral) End() token.Position  { return bl.Token.End }
 func (bl *BooleanLiteral) String() string       { return bl.Token.Literal }
 
 type NilLiteral struct {
@@ -293,6 +549,8 @@ type NilLiteral struct {
 
 func (nl *NilLiteral) expressionNode()      {}
 func (nl *NilLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NilLiteral) Pos() token.Position  { return nl.Token.Pos() }
+func (nl *NilLiteral) End() token.Position  { return nl.Token.End }
 func (nl *NilLiteral) String() string       { return "none" }
 
 type PrefixExpression struct {
@@ -303,6 +561,8 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos() }
+func (pe *PrefixExpression) End() token.Position  { return endOf(pe.Token, pe.Right) }
 func (pe *PrefixExpression) String() string {
 	return "(" + pe.Operator + " " + pe.Right.String() + ")"
 }
@@ -316,10 +576,25 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return posOf(ie.Token, ie.Left) }
+func (ie *InfixExpression) End() token.Position  { return endOf(ie.Token, ie.Right) }
 func (ie *InfixExpression) String() string {
 	return "(" + ie.Left.String() + " " + ie.Operator + " " + ie.Right.String() + ")"
 }
 
+// SpawnExpression runs a call on its own goroutine and evaluates to a task handle.
+// Syntax: task is spawn fetch(url)
+type SpawnExpression struct {
+	Token token.Token // The 'spawn' token
+	Call  *CallExpression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) Pos() token.Position  { return se.Token.Pos() }
+func (se *SpawnExpression) End() token.Position  { return endOf(se.Token, se.Call) }
+func (se *SpawnExpression) String() string       { return "(spawn " + se.Call.String() + ")" }
+
 type PointerReferenceExpression struct {
 	Token token.Token
 	Value Expression
@@ -327,6 +602,8 @@ type PointerReferenceExpression struct {
 
 func (pr *PointerReferenceExpression) expressionNode()      {}
 func (pr *PointerReferenceExpression) TokenLiteral() string { return pr.Token.Literal }
+func (pr *PointerReferenceExpression) Pos() token.Position  { return pr.Token.Pos() }
+func (pr *PointerReferenceExpression) End() token.Position  { return endOf(pr.Token, pr.Value) }
 func (pr *PointerReferenceExpression) String() string {
 	return "(pointing to " + pr.Value.String() + ")"
 }
@@ -338,6 +615,8 @@ type PointerDereferenceExpression struct {
 
 func (pd *PointerDereferenceExpression) expressionNode()      {}
 func (pd *PointerDereferenceExpression) TokenLiteral() string { return pd.Token.Literal }
+func (pd *PointerDereferenceExpression) Pos() token.Position  { return pd.Token.Pos() }
+func (pd *PointerDereferenceExpression) End() token.Position  { return endOf(pd.Token, pd.Value) }
 func (pd *PointerDereferenceExpression) String() string {
 	return "(pointing from " + pd.Value.String() + ")"
 }
@@ -351,6 +630,10 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos() }
+func (ie *IfExpression) End() token.Position {
+	return endOf(ie.Token, ie.Condition, ie.Consequence, ie.Alternative)
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if " + ie.Condition.String() + " " + ie.Consequence.String())
@@ -361,23 +644,32 @@ func (ie *IfExpression) String() string {
 }
 
 type FunctionLiteral struct {
-	Token      token.Token
-	Parameters []*Identifier
-	Body       *BlockStatement
+	Token          token.Token
+	Parameters     []*Identifier
+	ParameterTypes []*Identifier // Declared type per parameter; nil entries are unannotated
+	ReturnType     *Identifier   // Declared result type ("returns Integer"), nil when omitted
+	Body           *BlockStatement
+	Generator      bool // The body yields (outside nested functions), so calls return a generator
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos() }
+func (fl *FunctionLiteral) End() token.Position  { return endOf(fl.Token, fl.Body) }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("takes (")
 	for i, p := range fl.Parameters {
-		out.WriteString(p.String())
+		out.WriteString(p.String() + annotation(typeAt(fl.ParameterTypes, i)))
 		if i < len(fl.Parameters)-1 {
 			out.WriteString(", ")
 		}
 	}
-	out.WriteString(") " + fl.Body.String())
+	out.WriteString(") ")
+	if fl.ReturnType != nil {
+		out.WriteString("returns " + fl.ReturnType.String() + " ")
+	}
+	out.WriteString(fl.Body.String())
 	return out.String()
 }
 
@@ -385,10 +677,15 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Close     token.Token // The closing ')'
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return posOf(ce.Token, ce.Function) }
+func (ce *CallExpression) End() token.Position {
+	return closeOf(ce.Close, endOf(ce.Token, append([]Node{ce.Function}, expressions(ce.Arguments)...)...))
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(ce.Function.String() + "(")
@@ -405,10 +702,15 @@ func (ce *CallExpression) String() string {
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Close    token.Token // The closing ']'
 }
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos() }
+func (al *ArrayLiteral) End() token.Position {
+	return closeOf(al.Close, endOf(al.Token, expressions(al.Elements)...))
+}
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("[")
@@ -422,14 +724,41 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// TupleLiteral is a parenthesised list with at least one comma: (1, 2) or (x,).
+type TupleLiteral struct {
+	Token    token.Token // The '(' token
+	Elements []Expression
+	Close    token.Token // The closing ')'
+}
+
+func (tl *TupleLiteral) expressionNode()      {}
+func (tl *TupleLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TupleLiteral) Pos() token.Position  { return tl.Token.Pos() }
+func (tl *TupleLiteral) End() token.Position {
+	return closeOf(tl.Close, endOf(tl.Token, expressions(tl.Elements)...))
+}
+func (tl *TupleLiteral) String() string {
+	parts := make([]string, len(tl.Elements))
+	for i, el := range tl.Elements {
+		parts[i] = el.String()
+	}
+	if len(parts) == 1 {
+		return "(" + parts[0] + ",)"
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
 type IndexExpression struct {
 	Token token.Token
 	Left  Expression
 	Index Expression
+	Close token.Token // The closing ']'
 }
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return posOf(ie.Token, ie.Left) }
+func (ie *IndexExpression) End() token.Position  { return closeOf(ie.Close, endOf(ie.Token, ie.Index)) }
 func (ie *IndexExpression) String() string {
 	return "(" + ie.Left.String() + "[" + ie.Index.String() + "])"
 }
@@ -437,10 +766,14 @@ func (ie *IndexExpression) String() string {
 type MapLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	Keys  []Expression // Keys in source order (Pairs itself is unordered)
+	Close token.Token  // The closing '}'
 }
 
 func (ml *MapLiteral) expressionNode()      {}
 func (ml *MapLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MapLiteral) Pos() token.Position  { return ml.Token.Pos() }
+func (ml *MapLiteral) End() token.Position  { return closeOf(ml.Close, ml.Token.End) }
 func (ml *MapLiteral) String() string {
 	return "{...}"
 }
@@ -454,10 +787,15 @@ type StructInstantiationExpression struct {
 	Token  token.Token
 	Name   *Identifier
 	Fields []StructField
+	Close  token.Token // The closing '}'
 }
 
 func (sie *StructInstantiationExpression) expressionNode()      {}
 func (sie *StructInstantiationExpression) TokenLiteral() string { return sie.Token.Literal }
+func (sie *StructInstantiationExpression) Pos() token.Position  { return posOf(sie.Token, sie.Name) }
+func (sie *StructInstantiationExpression) End() token.Position {
+	return closeOf(sie.Close, sie.Token.End)
+}
 func (sie *StructInstantiationExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(sie.Name.String() + " { ")
@@ -479,6 +817,216 @@ type FieldAccessExpression struct {
 
 func (fae *FieldAccessExpression) expressionNode()      {}
 func (fae *FieldAccessExpression) TokenLiteral() string { return fae.Token.Literal }
+func (fae *FieldAccessExpression) Pos() token.Position  { return posOf(fae.Token, fae.Object) }
+func (fae *FieldAccessExpression) End() token.Position  { return endOf(fae.Token, fae.Field) }
 func (fae *FieldAccessExpression) String() string {
 	return "(" + fae.Object.String() + "." + fae.Field.String() + ")"
 }
+
+// MatchExpression picks the first arm whose pattern fits the subject.
+// Syntax: match value { when 1, 2 then ... when [first, ...rest] then ... otherwise ... }
+type MatchExpression struct {
+	Token     token.Token
+	Subject   Expression
+	Arms      []*MatchArm
+	Otherwise *BlockStatement // nil when there is no fallback arm
+	Close     token.Token     // The closing '}' or 'end'
+}
+
+// MatchArm is one "when" clause. Any of its Patterns may match; Guard (if set) must also hold.
+type MatchArm struct {
+	Token    token.Token
+	Patterns []Pattern
+	Guard    Expression
+	Body     *BlockStatement
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) Pos() token.Position  { return me.Token.Pos() }
+func (me *MatchExpression) End() token.Position {
+	return closeOf(me.Close, endOf(me.Token, me.Subject))
+}
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("match " + me.Subject.String() + " { ")
+	for _, arm := range me.Arms {
+		out.WriteString(arm.String() + " ")
+	}
+	if me.Otherwise != nil {
+		out.WriteString("otherwise " + me.Otherwise.String() + " ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString("when ")
+	for i, p := range ma.Patterns {
+		out.WriteString(p.String())
+		if i < len(ma.Patterns)-1 {
+			out.WriteString(", ")
+		}
+	}
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" then " + ma.Body.String())
+	return out.String()
+}
+
+// ----------------------------------------------------------------------------------------------
+// PATTERNS
+// ----------------------------------------------------------------------------------------------
+// Patterns describe the shape of a value in match arms. Names inside a pattern bind the
+// matching part of the value; "_" matches anything without binding it.
+// ----------------------------------------------------------------------------------------------
+
+// Pattern is a node that a value can be matched against.
+type Pattern interface {
+	Node
+	patternNode() // Marker method
+}
+
+// LiteralPattern matches values equal to a literal: 1, "yes", 'c', true, none, -5.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) Pos() token.Position  { return lp.Token.Pos() }
+func (lp *LiteralPattern) End() token.Position  { return endOf(lp.Token, lp.Value) }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// BindingPattern matches anything and binds it to Name (unless Name is "_").
+type BindingPattern struct {
+	Token token.Token
+	Name  *Identifier
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Token.Literal }
+func (bp *BindingPattern) Pos() token.Position  { return bp.Token.Pos() }
+func (bp *BindingPattern) End() token.Position  { return endOf(bp.Token, bp.Name) }
+func (bp *BindingPattern) String() string       { return bp.Name.String() }
+
+// IsWildcard reports whether the pattern is "_", which binds nothing.
+func (bp *BindingPattern) IsWildcard() bool { return bp.Name.Value == "_" }
+
+// ArrayPattern matches arrays element by element: [a, b] or [first, ...rest].
+// Without Rest the array must have exactly len(Elements) elements.
+// Destructuring may leave out the brackets (a, b is pair); Token is then the first name.
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Pattern
+	Rest     *Identifier // Collects the remaining elements; nil when there is no "..."
+	Close    token.Token // The closing ']'; zero without brackets
+}
+
+// Bracketed reports whether the pattern was written with its brackets.
+func (ap *ArrayPattern) Bracketed() bool { return ap.Token.Type == token.LBRACKET }
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) Pos() token.Position  { return ap.Token.Pos() }
+func (ap *ArrayPattern) End() token.Position {
+	return closeOf(ap.Close, endOf(ap.Token, append(patterns(ap.Elements), ap.Rest)...))
+}
+func (ap *ArrayPattern) String() string {
+	parts := make([]string, 0, len(ap.Elements)+1)
+	for _, el := range ap.Elements {
+		parts = append(parts, el.String())
+	}
+	if ap.Rest != nil {
+		parts = append(parts, "..."+ap.Rest.String())
+	}
+	if !ap.Bracketed() {
+		return strings.Join(parts, ", ")
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// PatternEntry is a key (map key or struct field) paired with the pattern for its value.
+// A bare name Key ({ name }) is shorthand for binding the entry to a variable of that name.
+type PatternEntry struct {
+	Key   Expression
+	Value Pattern
+}
+
+func (pe PatternEntry) String() string {
+	if b, ok := pe.Value.(*BindingPattern); ok {
+		if key, ok := pe.Key.(*Identifier); ok && key.Value == b.Name.Value {
+			return key.Value
+		}
+	}
+	return pe.Key.String() + ": " + pe.Value.String()
+}
+
+// MapPattern matches maps that contain every listed key: { name, "age": a }.
+// A bare name as key stands for the string key of the same text.
+type MapPattern struct {
+	Token   token.Token
+	Entries []PatternEntry
+	Close   token.Token // The closing '}'
+}
+
+func (mp *MapPattern) patternNode()         {}
+func (mp *MapPattern) TokenLiteral() string { return mp.Token.Literal }
+func (mp *MapPattern) Pos() token.Position  { return mp.Token.Pos() }
+func (mp *MapPattern) End() token.Position  { return closeOf(mp.Close, mp.Token.End) }
+func (mp *MapPattern) String() string       { return "{ " + joinEntries(mp.Entries) + " }" }
+
+// StructPattern matches instances of the named struct: User { name: n, age }.
+type StructPattern struct {
+	Token  token.Token
+	Name   *Identifier
+	Fields []PatternEntry // Keys are *Identifier field names
+	Close  token.Token    // The closing '}'
+}
+
+func (sp *StructPattern) patternNode()         {}
+func (sp *StructPattern) TokenLiteral() string { return sp.Token.Literal }
+func (sp *StructPattern) Pos() token.Position  { return posOf(sp.Token, sp.Name) }
+func (sp *StructPattern) End() token.Position  { return closeOf(sp.Close, sp.Token.End) }
+func (sp *StructPattern) String() string {
+	if len(sp.Fields) == 0 {
+		return sp.Name.String() + " {}"
+	}
+	return sp.Name.String() + " { " + joinEntries(sp.Fields) + " }"
+}
+
+func joinEntries(entries []PatternEntry) string {
+	parts := make([]string, len(entries))
+	for i, e := range entries {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EnumPattern matches one enum variant: Color.Red or Shape.Circle(r).
+type EnumPattern struct {
+	Token   token.Token
+	Enum    *Identifier
+	Variant *Identifier
+	Args    []Pattern   // Patterns for the associated values; nil when written without parentheses
+	Close   token.Token // The closing ')'; zero without parentheses
+}
+
+func (ep *EnumPattern) patternNode()         {}
+func (ep *EnumPattern) TokenLiteral() string { return ep.Token.Literal }
+func (ep *EnumPattern) Pos() token.Position  { return ep.Token.Pos() }
+func (ep *EnumPattern) End() token.Position  { return closeOf(ep.Close, endOf(ep.Token, ep.Variant)) }
+func (ep *EnumPattern) String() string {
+	name := ep.Enum.String() + "." + ep.Variant.String()
+	if ep.Args == nil {
+		return name
+	}
+	parts := make([]string, len(ep.Args))
+	for i, a := range ep.Args {
+		parts[i] = a.String()
+	}
+	return name + "(" + strings.Join(parts, ", ") + ")"
+}
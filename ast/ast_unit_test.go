@@ -8,6 +8,12 @@
 package ast
 
 import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"reflect"
+	"strings"
 	"testing"
 
 	"eloquence/token"
@@ -111,3 +117,169 @@ func TestCallExpression(t *testing.T) {
 		t.Fatalf("expected %s, got %s", expected, node.String())
 	}
 }
+
+// ----------------------------------------------------------------------------
+// JSON
+// ----------------------------------------------------------------------------
+
+// TestJSONKnowsEveryNode makes sure every node type declared in ast.go can be decoded.
+func TestJSONKnowsEveryNode(t *testing.T) {
+	file, err := goparser.ParseFile(gotoken.NewFileSet(), "ast.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*goast.FuncDecl)
+		if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+			continue
+		}
+		star, ok := fn.Recv.List[0].Type.(*goast.StarExpr)
+		if !ok {
+			continue
+		}
+		name := star.X.(*goast.Ident).Name
+		if _, ok := nodeKinds[name]; !ok {
+			t.Errorf("node type %s is missing from nodeKinds", name)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	key := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "a", Line: 1, Column: 6}, Value: "a"}
+	program := &Program{Statements: []Statement{
+		&AssignmentStatement{
+			Token:    token.Token{Type: token.IDENT, Literal: "m", Line: 1, Column: 1},
+			Modifier: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+			Name:     &Identifier{Token: token.Token{Type: token.IDENT, Literal: "m"}, Value: "m"},
+			Value: &MapLiteral{
+				Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 5},
+				Keys:  []Expression{key},
+				Pairs: map[Expression]Expression{key: &CharLiteral{Token: token.Token{Type: token.CHAR, Literal: "é"}, Value: 'é'}},
+			},
+		},
+		&EnumDefinitionStatement{
+			Token: token.Token{Type: token.DEFINE, Literal: "define"},
+			Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "Shape"}, Value: "Shape"},
+			Variants: []EnumVariant{
+				{Name: &Identifier{Token: token.Token{Type: token.IDENT, Literal: "Empty"}, Value: "Empty"}},
+				{Name: &Identifier{Token: token.Token{Type: token.IDENT, Literal: "Unit"}, Value: "Unit"}, Fields: []*Identifier{}},
+			},
+		},
+	}}
+
+	data, err := ToJSON(program)
+	if err != nil {
+		t.Fatalf("ToJSON: %s", err)
+	}
+	decoded, err := ProgramFromJSON(data)
+	if err != nil {
+		t.Fatalf("ProgramFromJSON: %s\n%s", err, data)
+	}
+	again, _ := ToJSON(decoded)
+	if string(again) != string(data) {
+		t.Errorf("encoding the decoded tree gave different JSON:\n%s\nvs\n%s", again, data)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("expected %q, got %q", program.String(), decoded.String())
+	}
+	ml := decoded.Statements[0].(*AssignmentStatement).Value.(*MapLiteral)
+	if value, ok := ml.Pairs[ml.Keys[0]].(*CharLiteral); !ok || value.Value != 'é' {
+		t.Errorf("map value is not found by its key: %#v", ml.Pairs)
+	}
+	variants := decoded.Statements[1].(*EnumDefinitionStatement).Variants
+	if variants[0].Fields != nil || variants[1].Fields == nil {
+		t.Errorf("a variant without fields and one with an empty field list must stay apart")
+	}
+	for _, want := range []string{`"kind": "MapLiteral"`, `"modifier": {`, `"line": 1`, `"values": [`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON is missing %s:\n%s", want, data)
+		}
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind": "Program", "statements": [{"kind": "Nonsense"}]}`, `statements[0]: unknown node kind "Nonsense"`},
+		{`{"kind": "Program", "statements": [{"kind": "Identifier", "value": "x"}]}`, "statements[0]: a Identifier cannot be used as Statement"},
+		{`{"kind": "ReturnStatement", "returnValue": {"kind": "IntegerLiteral", "value": "7"}}`, "returnValue.value: expected a number"},
+		{`{"kind": "MapLiteral", "keys": [], "values": [{"kind": "NilLiteral"}]}`, "values: 0 keys but 1 values"},
+		{`{"kind": "ReturnStatement", "tail": true, "returnValue": {"kind": "IntegerLiteral", "value": 7}}`, "tail: only a returned call can be a tail call"},
+		{`{"kind": "ReturnStatement", "tail": true}`, "tail: only a returned call can be a tail call"},
+		{`null`, "no node in JSON"},
+	}
+	for _, tt := range tests {
+		_, err := FromJSON([]byte(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: expected error %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+	if _, err := ProgramFromJSON([]byte(`{"kind": "NilLiteral"}`)); err == nil || err.Error() != "expected a Program, got NilLiteral" {
+		t.Errorf("expected a Program error, got %v", err)
+	}
+}
+
+// TestWalkKnowsEveryNode makes sure Walk handles every node type, even one missing its children.
+func TestWalkKnowsEveryNode(t *testing.T) {
+	for name, typ := range nodeKinds {
+		node := reflect.New(typ).Interface().(Node)
+		depth := 0
+		Walk(depthVisitor{&depth}, node)
+		if depth != 0 {
+			t.Errorf("%s: every visited node should be followed by Visit(nil), depth ended at %d", name, depth)
+		}
+	}
+}
+
+type depthVisitor struct{ depth *int }
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.depth--
+	} else {
+		*v.depth++
+	}
+	return v
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	// x is f(a, [b])
+	program := &Program{Statements: []Statement{
+		&AssignmentStatement{
+			Name: ident("x"),
+			Value: &CallExpression{
+				Function:  ident("f"),
+				Arguments: []Expression{ident("a"), &ArrayLiteral{Elements: []Expression{ident("b")}}},
+			},
+		},
+	}}
+
+	tests := []struct {
+		prune    string // Type whose children are skipped
+		expected []string
+	}{
+		{"", []string{"*ast.Program", "*ast.AssignmentStatement", "x", "*ast.CallExpression", "f", "a", "*ast.ArrayLiteral", "b"}},
+		{"*ast.ArrayLiteral", []string{"*ast.Program", "*ast.AssignmentStatement", "x", "*ast.CallExpression", "f", "a", "*ast.ArrayLiteral"}},
+		{"*ast.AssignmentStatement", []string{"*ast.Program", "*ast.AssignmentStatement"}},
+	}
+
+	for _, tt := range tests {
+		var visited []string
+		Inspect(program, func(node Node) bool {
+			name := fmt.Sprintf("%T", node)
+			if id, ok := node.(*Identifier); ok {
+				name = id.Value
+			}
+			visited = append(visited, name)
+			return name != tt.prune
+		})
+		if !reflect.DeepEqual(visited, tt.expected) {
+			t.Errorf("pruning %q: expected %v, got %v", tt.prune, tt.expected, visited)
+		}
+	}
+}
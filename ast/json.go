@@ -0,0 +1,345 @@
+// ==============================================================================================
+// FILE: ast/json.go
+// ==============================================================================================
+// PACKAGE: ast (Abstract Syntax Tree)
+// PURPOSE: Converts syntax trees to and from JSON for tools such as visualisers and the web
+//          playground. Every node becomes an object whose "kind" names its type, followed by
+//          its fields in lowerCamel case; tokens keep their type, literal, start and end.
+//          Decoding rebuilds a tree that the evaluator can run like a parsed one.
+// ==============================================================================================
+
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"eloquence/token"
+)
+
+// nodeKinds maps the "kind" of a JSON node to its type. Every node type must be listed here.
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{},
+		// Statements
+		&AssignmentStatement{}, &DestructuringStatement{}, &ReturnStatement{}, &YieldStatement{},
+		&ExpressionStatement{}, &BlockStatement{}, &PointerAssignmentStatement{},
+		&StructDefinitionStatement{}, &EnumDefinitionStatement{}, &LoopStatement{},
+		&RangeLoopStatement{}, &TryCatchStatement{}, &IncludeStatement{},
+		// Expressions
+		&Identifier{}, &IntegerLiteral{}, &FloatLiteral{}, &StringLiteral{}, &CharLiteral{},
+		&BooleanLiteral{}, &NilLiteral{}, &PrefixExpression{}, &InfixExpression{},
+		&SpawnExpression{}, &PointerReferenceExpression{}, &PointerDereferenceExpression{},
+		&IfExpression{}, &FunctionLiteral{}, &CallExpression{}, &ArrayLiteral{}, &TupleLiteral{},
+		&IndexExpression{}, &MapLiteral{}, &StructInstantiationExpression{},
+		&FieldAccessExpression{}, &MatchExpression{},
+		// Patterns
+		&LiteralPattern{}, &BindingPattern{}, &ArrayPattern{}, &MapPattern{}, &StructPattern{},
+		&EnumPattern{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+var (
+	nodeType       = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType      = reflect.TypeOf(token.Token{})
+	mapLiteralType = reflect.TypeOf(MapLiteral{})
+)
+
+// ----------------------------------------------------------------------------------------------
+// ENCODING
+// ----------------------------------------------------------------------------------------------
+
+// ToJSON encodes a tree as indented JSON. Missing nodes (and the zero token of a node without
+// one, such as a plain assignment's Modifier) are null. A MapLiteral lists its "keys" and its
+// "values" in source order.
+func ToJSON(node Node) ([]byte, error) {
+	return json.MarshalIndent(encodeValue(reflect.ValueOf(node)), "", "  ")
+}
+
+// jsonObject is a JSON object that keeps its keys in order, so "kind" always comes first.
+type jsonObject []jsonField
+
+type jsonField struct {
+	name  string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+	out.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		name, _ := json.Marshal(f.name)
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(name)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+	return out.Bytes(), nil
+}
+
+func encodeValue(v reflect.Value) interface{} {
+	if v.Type() == tokenType {
+		if v.IsZero() {
+			return nil
+		}
+		return encodeStruct(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return encodeValue(v.Elem())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		fields := encodeStruct(v.Elem())
+		if v.Type().Implements(nodeType) {
+			fields = append(jsonObject{{"kind", v.Elem().Type().Name()}}, fields...)
+		}
+		return fields
+	case reflect.Struct:
+		return encodeStruct(v)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil // Kept apart from an empty list: an enum variant without fields differs from Circle()
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = encodeValue(v.Index(i))
+		}
+		return items
+	default:
+		return v.Interface()
+	}
+}
+
+func encodeStruct(v reflect.Value) jsonObject {
+	var fields jsonObject
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if v.Type() == mapLiteralType && field.Name == "Pairs" {
+			continue
+		}
+		fields = append(fields, jsonField{jsonName(field.Name), encodeValue(v.Field(i))})
+	}
+	if v.Type() == mapLiteralType {
+		ml := v.Addr().Interface().(*MapLiteral)
+		values := make([]interface{}, len(ml.Keys))
+		for i, key := range ml.Keys {
+			values[i] = encodeValue(reflect.ValueOf(ml.Pairs[key]))
+		}
+		fields = append(fields, jsonField{"values", values})
+	}
+	return fields
+}
+
+// jsonName gives the JSON key of a struct field: its name starting with a lower case letter.
+func jsonName(field string) string {
+	r, size := utf8.DecodeRuneInString(field)
+	return string(unicode.ToLower(r)) + field[size:]
+}
+
+// ----------------------------------------------------------------------------------------------
+// DECODING
+// ----------------------------------------------------------------------------------------------
+
+// FromJSON decodes a tree written by ToJSON.
+func FromJSON(data []byte) (Node, error) {
+	var node Node
+	if err := decodeJSON(data, reflect.ValueOf(&node).Elem()); err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return nil, fmt.Errorf("no node in JSON")
+	}
+	return node, nil
+}
+
+// ProgramFromJSON decodes a program written by ToJSON, ready to be evaluated.
+func ProgramFromJSON(data []byte) (*Program, error) {
+	node, err := FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("expected a Program, got %s", reflect.TypeOf(node).Elem().Name())
+	}
+	return program, nil
+}
+
+func decodeJSON(data []byte, target reflect.Value) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keeps integers exact
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return err
+	}
+	return decodeValue(target, tree, "")
+}
+
+// decodeValue stores the decoded JSON data in target. path names the place of data in the
+// document for error messages.
+func decodeValue(target reflect.Value, data interface{}, path string) error {
+	if data == nil {
+		return nil // Leaves the zero value: a nil node, nil list or the zero token
+	}
+	fail := func(format string, a ...interface{}) error {
+		if path == "" {
+			path = "(root)"
+		}
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, a...))
+	}
+
+	switch target.Kind() {
+	case reflect.Interface:
+		fields, ok := data.(map[string]interface{})
+		if !ok {
+			return fail("expected a node object")
+		}
+		kind, _ := fields["kind"].(string)
+		typ, ok := nodeKinds[kind]
+		if !ok {
+			return fail("unknown node kind %q", kind)
+		}
+		node := reflect.New(typ)
+		if !node.Type().Implements(target.Type()) {
+			return fail("a %s cannot be used as %s", kind, target.Type().Name())
+		}
+		if err := decodeStruct(node.Elem(), fields, path); err != nil {
+			return err
+		}
+		target.Set(node)
+	case reflect.Pointer:
+		fields, ok := data.(map[string]interface{})
+		if !ok {
+			return fail("expected an object")
+		}
+		typ := target.Type().Elem()
+		if target.Type().Implements(nodeType) {
+			if kind, _ := fields["kind"].(string); kind != typ.Name() {
+				return fail("expected a %s, got kind %q", typ.Name(), kind)
+			}
+		}
+		value := reflect.New(typ)
+		if err := decodeStruct(value.Elem(), fields, path); err != nil {
+			return err
+		}
+		target.Set(value)
+	case reflect.Struct:
+		fields, ok := data.(map[string]interface{})
+		if !ok {
+			return fail("expected an object")
+		}
+		return decodeStruct(target, fields, path)
+	case reflect.Slice:
+		items, ok := data.([]interface{})
+		if !ok {
+			return fail("expected a list")
+		}
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := decodeValue(slice.Index(i), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		target.Set(slice)
+	case reflect.String:
+		s, ok := data.(string)
+		if !ok {
+			return fail("expected a string")
+		}
+		target.SetString(s)
+	case reflect.Bool:
+		b, ok := data.(bool)
+		if !ok {
+			return fail("expected true or false")
+		}
+		target.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return fail("expected a number")
+		}
+		i, err := n.Int64()
+		if err != nil || target.OverflowInt(i) {
+			return fail("invalid integer %s", n)
+		}
+		target.SetInt(i)
+	case reflect.Float64:
+		n, ok := data.(json.Number)
+		if !ok {
+			return fail("expected a number")
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return fail("invalid number %s", n)
+		}
+		target.SetFloat(f)
+	default:
+		return fail("cannot decode into %s", target.Type())
+	}
+	return nil
+}
+
+func decodeStruct(target reflect.Value, fields map[string]interface{}, path string) error {
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		if target.Type() == mapLiteralType && field.Name == "Pairs" {
+			continue
+		}
+		name := jsonName(field.Name)
+		if err := decodeValue(target.Field(i), fields[name], join(path, name)); err != nil {
+			return err
+		}
+	}
+	if rs, ok := target.Addr().Interface().(*ReturnStatement); ok && rs.Tail {
+		if _, ok := rs.ReturnValue.(*CallExpression); !ok {
+			return fmt.Errorf("%s: only a returned call can be a tail call", join(path, "tail"))
+		}
+	}
+	if target.Type() != mapLiteralType {
+		return nil
+	}
+
+	// A map literal's values follow its keys; the evaluator looks them up by key
+	ml := target.Addr().Interface().(*MapLiteral)
+	var values []Expression
+	if err := decodeValue(reflect.ValueOf(&values).Elem(), fields["values"], join(path, "values")); err != nil {
+		return err
+	}
+	if len(values) != len(ml.Keys) {
+		return fmt.Errorf("%s: %d keys but %d values", join(path, "values"), len(ml.Keys), len(values))
+	}
+	ml.Pairs = make(map[Expression]Expression, len(ml.Keys))
+	for i, key := range ml.Keys {
+		ml.Pairs[key] = values[i]
+	}
+	return nil
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
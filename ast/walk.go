@@ -0,0 +1,210 @@
+// ==============================================================================================
+// FILE: ast/walk.go
+// ==============================================================================================
+// PACKAGE: ast (Abstract Syntax Tree)
+// PURPOSE: Traverses syntax trees for tools such as linters, formatters and coverage, so they
+//          can visit every node without a type switch of their own. Walk follows the Visitor
+//          pattern; Inspect takes a plain function.
+// ==============================================================================================
+
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is called for each node Walk meets. If it returns a visitor w, Walk
+// visits the children of the node with w, then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a tree depth-first, parents before their children, and children in the order
+// they are written in the source. Nodes that are missing (nil) are skipped.
+func Walk(v Visitor, node Node) {
+	if !present(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	// Statements
+	case *Program:
+		walkStatements(v, n.Statements)
+	case *AssignmentStatement:
+		walkNodes(v, n.Name, n.Type, n.Value)
+	case *DestructuringStatement:
+		Walk(v, n.Pattern)
+		walkExpressions(v, n.Values)
+	case *ReturnStatement:
+		Walk(v, n.ReturnValue)
+	case *YieldStatement:
+		Walk(v, n.Value)
+	case *ExpressionStatement:
+		Walk(v, n.Expression)
+	case *BlockStatement:
+		walkStatements(v, n.Statements)
+	case *PointerAssignmentStatement:
+		walkNodes(v, n.Target, n.Value) // Name, when set, is the Target itself
+	case *StructDefinitionStatement:
+		Walk(v, n.Name)
+		walkIdentifiers(v, n.Embeds)
+		for i, attr := range n.Attributes {
+			Walk(v, attr)
+			if i < len(n.AttributeTypes) {
+				Walk(v, n.AttributeTypes[i])
+			}
+			if i < len(n.Defaults) {
+				Walk(v, n.Defaults[i])
+			}
+		}
+	case *EnumDefinitionStatement:
+		Walk(v, n.Name)
+		for _, variant := range n.Variants {
+			Walk(v, variant.Name)
+			for i, field := range variant.Fields {
+				Walk(v, field)
+				if i < len(variant.FieldTypes) {
+					Walk(v, variant.FieldTypes[i])
+				}
+			}
+		}
+	case *LoopStatement:
+		walkNodes(v, n.Condition, n.Body)
+	case *RangeLoopStatement:
+		walkNodes(v, n.Iterator, n.Iterable, n.Body)
+	case *TryCatchStatement:
+		walkNodes(v, n.TryBlock, n.CatchBlock, n.FinallyBlock)
+	case *IncludeStatement:
+		Walk(v, n.Path)
+
+	// Expressions
+	case *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *CharLiteral, *BooleanLiteral, *NilLiteral:
+		// Leaves
+	case *PrefixExpression:
+		Walk(v, n.Right)
+	case *InfixExpression:
+		walkNodes(v, n.Left, n.Right)
+	case *SpawnExpression:
+		Walk(v, n.Call)
+	case *PointerReferenceExpression:
+		Walk(v, n.Value)
+	case *PointerDereferenceExpression:
+		Walk(v, n.Value)
+	case *IfExpression:
+		walkNodes(v, n.Condition, n.Consequence, n.Alternative)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			Walk(v, param)
+			if i < len(n.ParameterTypes) {
+				Walk(v, n.ParameterTypes[i])
+			}
+		}
+		walkNodes(v, n.ReturnType, n.Body)
+	case *CallExpression:
+		Walk(v, n.Function)
+		walkExpressions(v, n.Arguments)
+	case *ArrayLiteral:
+		walkExpressions(v, n.Elements)
+	case *TupleLiteral:
+		walkExpressions(v, n.Elements)
+	case *IndexExpression:
+		walkNodes(v, n.Left, n.Index)
+	case *MapLiteral:
+		for _, key := range n.Keys {
+			walkNodes(v, key, n.Pairs[key])
+		}
+	case *StructInstantiationExpression:
+		Walk(v, n.Name)
+		for _, field := range n.Fields {
+			walkNodes(v, field.Name, field.Value)
+		}
+	case *FieldAccessExpression:
+		walkNodes(v, n.Object, n.Field)
+	case *MatchExpression:
+		Walk(v, n.Subject)
+		for _, arm := range n.Arms {
+			walkPatterns(v, arm.Patterns)
+			walkNodes(v, arm.Guard, arm.Body)
+		}
+		Walk(v, n.Otherwise)
+
+	// Patterns
+	case *LiteralPattern:
+		Walk(v, n.Value)
+	case *BindingPattern:
+		Walk(v, n.Name)
+	case *ArrayPattern:
+		walkPatterns(v, n.Elements)
+		Walk(v, n.Rest)
+	case *MapPattern:
+		walkEntries(v, n.Entries)
+	case *StructPattern:
+		Walk(v, n.Name)
+		walkEntries(v, n.Fields)
+	case *EnumPattern:
+		walkNodes(v, n.Enum, n.Variant)
+		walkPatterns(v, n.Args)
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkNodes(v Visitor, nodes ...Node) {
+	for _, node := range nodes {
+		Walk(v, node)
+	}
+}
+
+func walkStatements(v Visitor, list []Statement) {
+	for _, s := range list {
+		Walk(v, s)
+	}
+}
+
+func walkExpressions(v Visitor, list []Expression) {
+	for _, e := range list {
+		Walk(v, e)
+	}
+}
+
+func walkIdentifiers(v Visitor, list []*Identifier) {
+	for _, i := range list {
+		Walk(v, i)
+	}
+}
+
+func walkPatterns(v Visitor, list []Pattern) {
+	for _, p := range list {
+		Walk(v, p)
+	}
+}
+
+// walkEntries visits the keys and values of map and struct patterns. The key of a shorthand
+// entry ({ name }) is the name its value binds, so it is visited only once.
+func walkEntries(v Visitor, entries []PatternEntry) {
+	for _, e := range entries {
+		if b, ok := e.Value.(*BindingPattern); !ok || b.Name != e.Key {
+			Walk(v, e.Key)
+		}
+		Walk(v, e.Value)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if node != nil && f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a tree like Walk, calling f for each node. The children of a node are
+// only visited when f returns true for it.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
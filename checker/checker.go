@@ -0,0 +1,929 @@
+// ==============================================================================================
+// FILE: checker/checker.go
+// ==============================================================================================
+// PACKAGE: checker
+// PURPOSE: Implements the static type checker behind `eloquence check --types`.
+//          It infers the type of every expression it can without running the program and
+//          reports values that cannot satisfy their annotations (`age as Integer`,
+//          `returns String`, typed struct fields) as well as operators that would fail at runtime.
+//          Checking is gradual: anything the checker cannot infer is Any and never reported.
+// ==============================================================================================
+
+package checker
+
+import (
+	"fmt"
+
+	"eloquence/ast"
+	"eloquence/object"
+	"eloquence/token"
+)
+
+// Diagnostic is a type problem found without running the program.
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// String formats the diagnostic like a parser error: "line 3:5 - message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d:%d - %s", d.Line, d.Column, d.Message)
+}
+
+// Check infers types across the whole program and returns every problem it can prove.
+func Check(program *ast.Program) []Diagnostic {
+	return run(program).diags
+}
+
+// Lint returns warnings about code that works but is easy to misread: parameters and
+// loop variables that shadow a variable of an enclosing scope. Shadowing with `let` is
+// deliberate and never reported.
+func Lint(program *ast.Program) []Diagnostic {
+	return run(program).warnings
+}
+
+func run(program *ast.Program) *checker {
+	c := &checker{structs: make(map[string]*structInfo), enums: make(map[string]*ast.EnumDefinitionStatement)}
+	c.collect(program.Statements)
+	for _, info := range c.structs {
+		c.dropUnknownFields(info)
+	}
+	for _, info := range c.structs {
+		c.promote(info)
+	}
+	c.statements(program.Statements, newScope(nil, false))
+	return c
+}
+
+// ----------------------------------------------------------------------------------------------
+// TYPES & SCOPES
+// ----------------------------------------------------------------------------------------------
+
+// typ is what the checker knows about a value.
+type typ struct {
+	name string     // Annotation name ("Integer", a struct name), or object.AnyType when unknown
+	fn   *signature // Signature of a function value, when known
+}
+
+var anyType = typ{name: object.AnyType}
+
+func named(name string) typ { return typ{name: name} }
+
+func (t typ) known() bool { return t.name != object.AnyType }
+
+// signature describes a function's annotations. Empty entries mean Any.
+type signature struct {
+	params  []*ast.Identifier
+	types   []string
+	result  string
+	variant string // "Shape.Circle" when this constructs an enum variant (params are its fields)
+}
+
+type structInfo struct {
+	fields   map[string]string // Field name -> declared type ("" when unannotated), promoted fields included
+	order    []string          // Field names in declaration order
+	required map[string]bool   // Fields without a default
+	embeds   []string          // Names of embedded structs
+	open     bool              // Embeds a struct the checker cannot see, so its fields are unknown
+	promoted bool              // Fields of embedded structs have been merged in
+}
+
+// binding is a name in scope. Declared bindings keep their type for every later assignment.
+type binding struct {
+	t        typ
+	declared string
+	constant bool // Declared with `constant`; every later assignment is an error
+	pointed  bool // A pointer to it was taken: writes through the pointer are not seen
+}
+
+type scope struct {
+	vars     map[string]*binding
+	outer    *scope
+	function bool // The scope of a function body: outer bindings may change before it runs
+}
+
+func newScope(outer *scope, function bool) *scope {
+	return &scope{vars: make(map[string]*binding), outer: outer, function: function}
+}
+
+// lookup finds a binding and reports whether the search left the current function.
+func (s *scope) lookup(name string) (b *binding, crossed bool) {
+	for sc := s; sc != nil; sc = sc.outer {
+		if b, ok := sc.vars[name]; ok {
+			return b, crossed
+		}
+		if sc.function {
+			crossed = true
+		}
+	}
+	return nil, false
+}
+
+// frame tracks the function whose body is being checked.
+type frame struct {
+	result  string // Declared result type ("" when unannotated)
+	returns []typ  // Types of the return statements seen so far
+}
+
+type checker struct {
+	diags      []Diagnostic
+	warnings   []Diagnostic // Lint findings; they never make a program invalid
+	structs    map[string]*structInfo
+	enums      map[string]*ast.EnumDefinitionStatement
+	hasInclude bool // Included files may define types the checker cannot see
+	frames     []*frame
+	quiet      int // While > 0, diagnostics are dropped (first pass over loop bodies)
+}
+
+func (c *checker) report(tok token.Token, format string, args ...interface{}) {
+	if c.quiet > 0 {
+		return
+	}
+	c.diags = append(c.diags, Diagnostic{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// warn records a lint warning. Like report, it is silent during the first pass over loops.
+func (c *checker) warn(tok token.Token, format string, args ...interface{}) {
+	if c.quiet > 0 {
+		return
+	}
+	c.warnings = append(c.warnings, Diagnostic{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+// shadows warns when a parameter or loop variable hides a variable of an enclosing scope.
+func (c *checker) shadows(name *ast.Identifier, what string, outer *scope) {
+	if b, _ := outer.lookup(name.Value); b != nil {
+		c.warn(name.Token, "%s %s shadows a variable of an enclosing scope", what, name.Value)
+	}
+}
+
+// conforms is the static counterpart of object.Conforms: unknown values always conform.
+func (c *checker) conforms(actual typ, declared string) bool {
+	switch {
+	case declared == "" || declared == object.AnyType || !actual.known():
+		return true
+	case declared == "Number":
+		return actual.name == "Integer" || actual.name == "Float" || actual.name == "Number"
+	}
+	return c.includes(actual.name, declared)
+}
+
+// checkAnnotation reports annotations naming neither a builtin type nor a struct of the program.
+// It returns the declared type, or "" when there is none or it is unknown (nothing to check against).
+func (c *checker) checkAnnotation(annotation *ast.Identifier) string {
+	if annotation == nil {
+		return ""
+	}
+	if !c.isType(annotation.Value) {
+		c.report(annotation.Token, "unknown type: %s", annotation.Value)
+		return ""
+	}
+	return annotation.Value
+}
+
+func (c *checker) isType(name string) bool {
+	return object.IsBuiltinType(name) || c.structs[name] != nil || c.enums[name] != nil || c.hasInclude
+}
+
+func typeAt(types []*ast.Identifier, i int) *ast.Identifier {
+	if i < len(types) {
+		return types[i]
+	}
+	return nil
+}
+
+func nameOf(annotation *ast.Identifier) string {
+	if annotation == nil {
+		return ""
+	}
+	return annotation.Value
+}
+
+// ----------------------------------------------------------------------------------------------
+// DECLARATIONS
+// ----------------------------------------------------------------------------------------------
+
+// collect registers every struct definition up front, wherever it appears.
+func (c *checker) collect(stmts []ast.Statement) {
+	for _, s := range stmts {
+		switch s := s.(type) {
+		case *ast.StructDefinitionStatement:
+			info := &structInfo{fields: make(map[string]string), required: make(map[string]bool)}
+			for _, e := range s.Embeds {
+				info.embeds = append(info.embeds, e.Value)
+			}
+			for i, a := range s.Attributes {
+				info.fields[a.Value] = nameOf(typeAt(s.AttributeTypes, i))
+				info.order = append(info.order, a.Value)
+				if i >= len(s.Defaults) || s.Defaults[i] == nil {
+					info.required[a.Value] = true
+				}
+			}
+			c.structs[s.Name.Value] = info
+		case *ast.EnumDefinitionStatement:
+			c.enums[s.Name.Value] = s
+		case *ast.IncludeStatement:
+			c.hasInclude = true
+		case *ast.BlockStatement:
+			c.collect(s.Statements)
+		case *ast.LoopStatement:
+			c.collect(s.Body.Statements)
+		case *ast.RangeLoopStatement:
+			c.collect(s.Body.Statements)
+		case *ast.TryCatchStatement:
+			for _, b := range []*ast.BlockStatement{s.TryBlock, s.CatchBlock, s.FinallyBlock} {
+				if b != nil {
+					c.collect(b.Statements)
+				}
+			}
+		}
+	}
+}
+
+// dropUnknownFields stops checking fields whose annotation names no known type.
+// It runs once every struct has been collected; the annotation itself is reported with the definition.
+func (c *checker) dropUnknownFields(info *structInfo) {
+	for name, declared := range info.fields {
+		if declared != "" && !c.isType(declared) {
+			info.fields[name] = ""
+		}
+	}
+}
+
+// promote merges the fields of embedded structs into a struct, mirroring evalStructDefinition:
+// a field the struct declares itself wins over a promoted one.
+func (c *checker) promote(info *structInfo) {
+	if info.promoted {
+		return
+	}
+	info.promoted = true // Also guards against embedding cycles
+	var promoted []string
+	for _, name := range info.embeds {
+		embedded := c.structs[name]
+		if embedded == nil {
+			info.open = true
+			continue
+		}
+		c.promote(embedded)
+		info.open = info.open || embedded.open
+		for _, f := range embedded.order {
+			if _, own := info.fields[f]; own {
+				continue
+			}
+			info.fields[f] = embedded.fields[f]
+			info.required[f] = embedded.required[f]
+			promoted = append(promoted, f)
+		}
+	}
+	info.order = append(promoted, info.order...)
+}
+
+// includes reports whether a struct is the named struct or embeds it (see object.StructDefinition.Includes).
+func (c *checker) includes(name, target string) bool {
+	if name == target {
+		return true
+	}
+	if info := c.structs[name]; info != nil {
+		for _, e := range info.embeds {
+			if e != name && c.includes(e, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ----------------------------------------------------------------------------------------------
+// STATEMENTS
+// ----------------------------------------------------------------------------------------------
+
+func (c *checker) statements(stmts []ast.Statement, s *scope) {
+	for _, stmt := range stmts {
+		c.statement(stmt, s)
+	}
+}
+
+func (c *checker) block(b *ast.BlockStatement, s *scope) {
+	if b != nil {
+		c.statements(b.Statements, newScope(s, false))
+	}
+}
+
+// loop checks a loop's condition and body twice: the first, silent pass widens the types of
+// variables the body reassigns, so the second pass sees what they may hold on later iterations.
+func (c *checker) loop(cond ast.Expression, b *ast.BlockStatement, s *scope, iterator *ast.Identifier) {
+	for pass := 0; pass < 2; pass++ {
+		if pass == 0 {
+			c.quiet++
+		}
+		if cond != nil {
+			c.expr(cond, s)
+		}
+		body := newScope(s, false)
+		if iterator != nil {
+			c.shadows(iterator, "loop variable", s)
+			body.vars[iterator.Value] = &binding{t: anyType}
+		}
+		c.statements(b.Statements, body)
+		if pass == 0 {
+			c.quiet--
+		}
+	}
+}
+
+func (c *checker) statement(stmt ast.Statement, s *scope) {
+	switch stmt := stmt.(type) {
+	case *ast.AssignmentStatement:
+		c.assignment(stmt, s)
+	case *ast.ReturnStatement:
+		c.returnStatement(stmt, s)
+	case *ast.YieldStatement:
+		c.expr(stmt.Value, s)
+	case *ast.ExpressionStatement:
+		c.expr(stmt.Expression, s)
+	case *ast.BlockStatement:
+		c.block(stmt, s)
+	case *ast.LoopStatement:
+		c.loop(stmt.Condition, stmt.Body, s, nil)
+	case *ast.RangeLoopStatement:
+		c.expr(stmt.Iterable, s)
+		c.loop(nil, stmt.Body, s, stmt.Iterator)
+	case *ast.TryCatchStatement:
+		c.block(stmt.TryBlock, s)
+		c.block(stmt.CatchBlock, s)
+		c.block(stmt.FinallyBlock, s)
+	case *ast.StructDefinitionStatement:
+		for _, t := range stmt.AttributeTypes {
+			c.checkAnnotation(t)
+		}
+	case *ast.EnumDefinitionStatement:
+		for _, v := range stmt.Variants {
+			for _, t := range v.FieldTypes {
+				c.checkAnnotation(t)
+			}
+		}
+	case *ast.PointerAssignmentStatement:
+		c.expr(stmt.Target, s)
+		c.expr(stmt.Value, s)
+	case *ast.DestructuringStatement:
+		c.destructuring(stmt, s)
+	}
+}
+
+// destructuring binds the names of a pattern as Any. Names declared with a type keep it:
+// the value they receive is unknown, so it is never reported.
+func (c *checker) destructuring(stmt *ast.DestructuringStatement, s *scope) {
+	for _, v := range stmt.Values {
+		c.expr(v, s)
+	}
+	bound := newScope(s, false)
+	c.pattern(stmt.Pattern, bound)
+	for name, b := range bound.vars {
+		if existing, _ := s.lookup(name); existing != nil && existing.declared != "" {
+			continue
+		}
+		s.vars[name] = b
+	}
+}
+
+func (c *checker) assignment(stmt *ast.AssignmentStatement, s *scope) {
+	name := stmt.Name.Value
+	visible, _ := s.lookup(name)
+	existing := visible
+	fresh := stmt.Modifier.Type == token.LET || stmt.Modifier.Type == token.CONSTANT
+	if stmt.Modifier.Type == token.LET && s.vars[name] == nil {
+		existing = nil // let never touches an outer binding
+	}
+	_, isBuiltin := object.GetBuiltin(name)
+	switch {
+	case existing != nil && existing.constant:
+		c.report(stmt.Name.Token, "cannot reassign constant %s", name)
+	case stmt.Modifier.Type == token.REDEFINE && !isBuiltin:
+		c.report(stmt.Name.Token, "%s is not a builtin, so there is nothing to redefine", name)
+	case visible == nil && isBuiltin && stmt.Modifier.Type == token.CONSTANT:
+		c.report(stmt.Name.Token, "cannot declare builtin %s as a constant", name)
+	case visible == nil && isBuiltin && stmt.Modifier.Type != token.REDEFINE:
+		c.report(stmt.Name.Token, "cannot assign to builtin %s; use 'redefine %s is ...' to replace it", name, name)
+	}
+	declared := ""
+	if existing != nil && !fresh {
+		declared = existing.declared
+	}
+	if stmt.Type != nil {
+		declared = c.checkAnnotation(stmt.Type)
+	}
+
+	// Functions are bound before their body is checked so they can call themselves
+	var t typ
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		sig := c.signature(fl)
+		t = typ{name: "Function", fn: sig}
+		c.bind(s, existing, stmt, t, declared)
+		c.functionBody(fl, sig, s)
+	} else {
+		t = c.expr(stmt.Value, s)
+	}
+
+	if !c.conforms(t, declared) {
+		c.report(stmt.Name.Token, "type error: variable '%s' expects %s, got %s", name, declared, t.name)
+	}
+	c.bind(s, existing, stmt, t, declared)
+}
+
+// bind records the value assigned to a name.
+// A plain assignment to a name from an enclosing scope may or may not run,
+// so the binding keeps the new type only if it agrees with the old one.
+func (c *checker) bind(s *scope, existing *binding, stmt *ast.AssignmentStatement, t typ, declared string) {
+	if declared != "" && declared != object.AnyType {
+		t = typ{name: declared, fn: t.fn}
+	}
+	switch {
+	case stmt.Modifier.Type == token.CONSTANT || stmt.Modifier.Type == token.LET:
+		s.vars[stmt.Name.Value] = &binding{t: t, declared: declared, constant: stmt.Modifier.Type == token.CONSTANT}
+	case stmt.Type != nil || existing == nil:
+		s.vars[stmt.Name.Value] = &binding{t: t, declared: declared}
+	case s.vars[stmt.Name.Value] == existing:
+		existing.t = t
+	case existing.t.name != t.name:
+		existing.t = typ{name: object.AnyType}
+		if existing.declared != "" {
+			existing.t.name = existing.declared
+		}
+	}
+}
+
+func (c *checker) returnStatement(stmt *ast.ReturnStatement, s *scope) {
+	t := named("None")
+	if stmt.ReturnValue != nil {
+		t = c.expr(stmt.ReturnValue, s)
+	}
+	if len(c.frames) == 0 {
+		return
+	}
+	f := c.frames[len(c.frames)-1]
+	f.returns = append(f.returns, t)
+	if !c.conforms(t, f.result) {
+		c.report(stmt.Token, "type error: return value expects %s, got %s", f.result, t.name)
+	}
+}
+
+// ----------------------------------------------------------------------------------------------
+// FUNCTIONS
+// ----------------------------------------------------------------------------------------------
+
+func (c *checker) signature(fl *ast.FunctionLiteral) *signature {
+	sig := &signature{params: fl.Parameters}
+	for i := range fl.Parameters {
+		sig.types = append(sig.types, c.checkAnnotation(typeAt(fl.ParameterTypes, i)))
+	}
+	sig.result = c.checkAnnotation(fl.ReturnType)
+	return sig
+}
+
+// functionBody checks a body with typed parameters in scope.
+// Without a declared result, a body that always ends in returns of one type infers it.
+func (c *checker) functionBody(fl *ast.FunctionLiteral, sig *signature, outer *scope) {
+	body := newScope(outer, true)
+	for i, p := range fl.Parameters {
+		c.shadows(p, "parameter", outer)
+		t := anyType
+		if sig.types[i] != "" {
+			t = named(sig.types[i])
+		}
+		body.vars[p.Value] = &binding{t: t, declared: sig.types[i]}
+	}
+
+	// A generator's calls return the generator; its own returns only end it
+	if fl.Generator {
+		c.frames = append(c.frames, &frame{})
+		c.statements(fl.Body.Statements, body)
+		c.frames = c.frames[:len(c.frames)-1]
+		if !c.conforms(named("Generator"), sig.result) {
+			c.report(fl.ReturnType.Token, "type error: return value expects %s, got Generator", sig.result)
+		}
+		sig.result = "Generator"
+		return
+	}
+
+	f := &frame{result: sig.result}
+	c.frames = append(c.frames, f)
+	c.statements(fl.Body.Statements, body)
+	c.frames = c.frames[:len(c.frames)-1]
+
+	if sig.result != "" || len(fl.Body.Statements) == 0 || len(f.returns) == 0 {
+		return
+	}
+	if _, ok := fl.Body.Statements[len(fl.Body.Statements)-1].(*ast.ReturnStatement); !ok {
+		return
+	}
+	for _, t := range f.returns {
+		if !t.known() || t.name != f.returns[0].name {
+			return
+		}
+	}
+	sig.result = f.returns[0].name
+}
+
+// builtinResults lists the result types of builtins that always return the same type.
+var builtinResults = map[string]string{
+	"show": "None", "count": "Integer", "append": "Array", "ask": "String",
+	"upper": "String", "lower": "String", "split": "Array", "join": "String",
+	"str": "String", "ord": "Integer", "chr": "Char", "new": "Pointer",
+	"collect": "Array", "take": "Generator", "skip": "Generator", "map": "Generator", "filter": "Generator",
+	"wait_all": "Array", "channel": "Channel", "send": "None", "close": "None",
+}
+
+func (c *checker) call(call *ast.CallExpression, s *scope) typ {
+	if call.Token.Type == token.TEMPLATE {
+		// An interpolated value, passed to the builtin str even where str is a variable
+		for _, a := range call.Arguments {
+			c.expr(a, s)
+		}
+		return named("String")
+	}
+	callee := c.expr(call.Function, s)
+	args := make([]typ, len(call.Arguments))
+	for i, a := range call.Arguments {
+		args[i] = c.expr(a, s)
+	}
+
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		if b, _ := s.lookup(ident.Value); b == nil {
+			if result, ok := builtinResults[ident.Value]; ok {
+				return named(result)
+			}
+		}
+	}
+	if callee.known() && callee.name != "Function" {
+		c.report(call.Token, "not a function: %s", callee.name)
+		return anyType
+	}
+	if callee.fn == nil {
+		return anyType
+	}
+
+	for i, arg := range args {
+		if i >= len(callee.fn.types) || c.conforms(arg, callee.fn.types[i]) {
+			continue
+		}
+		what := "parameter '" + callee.fn.params[i].Value + "'"
+		if callee.fn.variant != "" {
+			what = "field '" + callee.fn.params[i].Value + "' of " + callee.fn.variant
+		}
+		c.report(call.Token, "type error: %s expects %s, got %s", what, callee.fn.types[i], arg.name)
+	}
+	if callee.fn.result == "" {
+		return anyType
+	}
+	return named(callee.fn.result)
+}
+
+// ----------------------------------------------------------------------------------------------
+// EXPRESSIONS
+// ----------------------------------------------------------------------------------------------
+
+func (c *checker) expr(e ast.Expression, s *scope) typ {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return named("Integer")
+	case *ast.FloatLiteral:
+		return named("Float")
+	case *ast.StringLiteral:
+		return named("String")
+	case *ast.CharLiteral:
+		return named("Char")
+	case *ast.BooleanLiteral:
+		return named("Boolean")
+	case *ast.NilLiteral:
+		return named("None")
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			c.expr(el, s)
+		}
+		return named("Array")
+	case *ast.TupleLiteral:
+		for _, el := range e.Elements {
+			c.expr(el, s)
+		}
+		return named("Tuple")
+	case *ast.MapLiteral:
+		for _, k := range e.Keys {
+			c.expr(k, s)
+			c.expr(e.Pairs[k], s)
+		}
+		return named("Map")
+	case *ast.Identifier:
+		b, crossed := s.lookup(e.Value)
+		if b == nil {
+			if _, ok := builtinResults[e.Value]; ok {
+				return named("Function")
+			}
+			return anyType
+		}
+		// Inside a function, unannotated outer variables may have changed before the call
+		if crossed && b.declared == "" && b.t.fn == nil {
+			return anyType
+		}
+		if b.pointed && b.declared == "" {
+			return anyType
+		}
+		return b.t
+	case *ast.PrefixExpression:
+		right := c.expr(e.Right, s)
+		if e.Operator == "not" || e.Operator == "!" {
+			return named("Boolean")
+		}
+		if right.name == "Integer" || right.name == "Float" {
+			return right
+		}
+		return anyType
+	case *ast.InfixExpression:
+		return c.infix(e, s)
+	case *ast.CallExpression:
+		return c.call(e, s)
+	case *ast.FunctionLiteral:
+		sig := c.signature(e)
+		c.functionBody(e, sig, s)
+		return typ{name: "Function", fn: sig}
+	case *ast.IfExpression:
+		c.expr(e.Condition, s)
+		c.block(e.Consequence, s)
+		c.block(e.Alternative, s)
+		return anyType
+	case *ast.MatchExpression:
+		c.expr(e.Subject, s)
+		for _, arm := range e.Arms {
+			armScope := newScope(s, false)
+			for _, p := range arm.Patterns {
+				c.pattern(p, armScope)
+			}
+			if arm.Guard != nil {
+				c.expr(arm.Guard, armScope)
+			}
+			c.statements(arm.Body.Statements, armScope)
+		}
+		c.block(e.Otherwise, s)
+		return anyType
+	case *ast.IndexExpression:
+		c.expr(e.Left, s)
+		c.expr(e.Index, s)
+		return anyType
+	case *ast.FieldAccessExpression:
+		return c.fieldAccess(e, s)
+	case *ast.StructInstantiationExpression:
+		return c.instantiation(e, s)
+	case *ast.PointerReferenceExpression:
+		c.expr(e.Value, s)
+		if id, ok := e.Value.(*ast.Identifier); ok {
+			if b, _ := s.lookup(id.Value); b != nil {
+				b.pointed = true // Any value may be stored through the pointer
+			}
+		}
+		return named("Pointer")
+	case *ast.SpawnExpression:
+		c.call(e.Call, s)
+		return named("Task")
+	case *ast.PointerDereferenceExpression:
+		c.expr(e.Value, s)
+		return anyType
+	}
+	return anyType
+}
+
+// pattern binds the names a match pattern introduces and reports fields and variants that
+// cannot exist. Bound values are Any, except struct fields with a declared type.
+func (c *checker) pattern(p ast.Pattern, s *scope) {
+	switch p := p.(type) {
+	case *ast.BindingPattern:
+		if !p.IsWildcard() {
+			s.vars[p.Name.Value] = &binding{t: anyType}
+		}
+	case *ast.ArrayPattern:
+		for _, el := range p.Elements {
+			c.pattern(el, s)
+		}
+		if p.Rest != nil && p.Rest.Value != "_" {
+			s.vars[p.Rest.Value] = &binding{t: named("Array")}
+		}
+	case *ast.MapPattern:
+		for _, e := range p.Entries {
+			c.pattern(e.Value, s)
+		}
+	case *ast.StructPattern:
+		info := c.structs[p.Name.Value]
+		for _, f := range p.Fields {
+			c.pattern(f.Value, s)
+			if info == nil {
+				continue
+			}
+			declared, ok := info.fields[f.Key.String()]
+			if !ok {
+				c.report(f.Key.(*ast.Identifier).Token, "struct %s has no field %s", p.Name.Value, f.Key.String())
+				continue
+			}
+			if b, ok := f.Value.(*ast.BindingPattern); ok && declared != "" && !b.IsWildcard() {
+				s.vars[b.Name.Value] = &binding{t: named(declared)}
+			}
+		}
+	case *ast.EnumPattern:
+		if b, _ := s.lookup(p.Enum.Value); b == nil && c.enums[p.Enum.Value] != nil {
+			c.enumMember(c.enums[p.Enum.Value], p.Variant)
+		}
+		for _, a := range p.Args {
+			c.pattern(a, s)
+		}
+	}
+}
+
+// operators lists what each builtin type supports, mirroring evalInfixExpression.
+// The value is the result type of the operation.
+var operators = map[string]map[string]string{
+	"Integer": numericOperators("Integer", true),
+	"Float":   numericOperators("Float", false),
+	"String":  withOrdering(map[string]string{"adds": "String"}),
+	"Char":    withOrdering(map[string]string{}),
+	"Array":   withOrdering(map[string]string{}),
+	"Tuple":   withOrdering(map[string]string{}),
+	"Boolean": {"equals": "Boolean", "not_equals": "Boolean", "and": "Boolean", "or": "Boolean"},
+	"Map":     {"equals": "Boolean", "not_equals": "Boolean"},
+	"Pointer": {"equals": "Boolean", "not_equals": "Boolean"},
+	"None":    {"equals": "Boolean", "not_equals": "Boolean"},
+}
+
+// withOrdering adds the equality and ordering comparisons to a type's operators.
+func withOrdering(ops map[string]string) map[string]string {
+	for _, op := range []string{"equals", "not_equals", "greater", "less", "greater_equal", "less_equal"} {
+		ops[op] = "Boolean"
+	}
+	return ops
+}
+
+func numericOperators(name string, modulo bool) map[string]string {
+	ops := map[string]string{"adds": name, "subtracts": name, "minus": name, "times": name, "divides": name,
+		"equals": "Boolean", "not_equals": "Boolean", "greater": "Boolean", "less": "Boolean",
+		"greater_equal": "Boolean", "less_equal": "Boolean"}
+	if modulo {
+		ops["modulo"] = name
+	}
+	return ops
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "equals", "not_equals", "greater", "less", "greater_equal", "less_equal", "and", "or":
+		return true
+	}
+	return false
+}
+
+func isNumeric(t typ) bool {
+	return t.name == "Integer" || t.name == "Float" || t.name == "Number"
+}
+
+func isText(t typ) bool { return t.name == "String" || t.name == "Char" }
+
+func (c *checker) infix(e *ast.InfixExpression, s *scope) typ {
+	left := c.expr(e.Left, s)
+	right := c.expr(e.Right, s)
+	if e.Token.Type == token.TEMPLATE {
+		return named("String") // Interpolated strings desugar into a chain of `adds`
+	}
+
+	if !left.known() || !right.known() {
+		if isComparison(e.Operator) {
+			return named("Boolean")
+		}
+		return anyType
+	}
+
+	// Number is either numeric type, so only a non-numeric operand is a certain mismatch
+	if left.name == "Number" || right.name == "Number" {
+		if isNumeric(left) && isNumeric(right) {
+			if isComparison(e.Operator) {
+				return named("Boolean")
+			}
+			return named("Number")
+		}
+		if left.name != "None" && right.name != "None" {
+			c.report(e.Token, "type mismatch: %s %s %s", left.name, e.Operator, right.name)
+		}
+		return anyType
+	}
+
+	equality := e.Operator == "equals" || e.Operator == "not_equals"
+	switch {
+	case e.Operator == "adds" && isText(left) && isText(right) && (left.name == "Char" || right.name == "Char"):
+		return named("String")
+	case isText(left) && isText(right) && operators["Char"][e.Operator] != "":
+		// A char compares with a string as a one-character string
+		return named("Boolean")
+	case equality && c.structs[left.name] != nil && c.structs[right.name] != nil:
+		// Struct instances compare field by field; instances of different structs are unequal
+		return named("Boolean")
+	case left.name != right.name:
+		if (left.name == "None" || right.name == "None") && equality {
+			return named("Boolean")
+		}
+		c.report(e.Token, "type mismatch: %s %s %s", left.name, e.Operator, right.name)
+		return anyType
+	}
+
+	if c.enums[left.name] != nil && equality {
+		return named("Boolean")
+	}
+	result, ok := operators[left.name][e.Operator]
+	if !ok {
+		c.report(e.Token, "unknown operator: %s %s %s", left.name, e.Operator, right.name)
+		return anyType
+	}
+	return named(result)
+}
+
+func (c *checker) fieldAccess(e *ast.FieldAccessExpression, s *scope) typ {
+	if ident, ok := e.Object.(*ast.Identifier); ok {
+		if b, _ := s.lookup(ident.Value); b == nil && c.enums[ident.Value] != nil {
+			return c.enumMember(c.enums[ident.Value], e.Field)
+		}
+	}
+
+	obj := c.expr(e.Object, s)
+	if !obj.known() {
+		return anyType
+	}
+	info, ok := c.structs[obj.name]
+	if !ok {
+		if object.IsBuiltinType(obj.name) {
+			c.report(e.Token, "not a struct instance: %s", obj.name)
+		}
+		return anyType
+	}
+	declared, ok := info.fields[e.Field.Value]
+	if !ok {
+		c.report(e.Field.Token, "struct %s has no field %s", obj.name, e.Field.Value)
+		return anyType
+	}
+	if declared == "" {
+		return anyType
+	}
+	return named(declared)
+}
+
+// enumMember types Color.Red (a value of the enum) and Shape.Circle (a constructor for one).
+func (c *checker) enumMember(def *ast.EnumDefinitionStatement, name *ast.Identifier) typ {
+	for _, v := range def.Variants {
+		if v.Name.Value != name.Value {
+			continue
+		}
+		if v.Fields == nil {
+			return named(def.Name.Value)
+		}
+		sig := &signature{params: v.Fields, result: def.Name.Value, variant: def.Name.Value + "." + v.Name.Value}
+		for i := range v.Fields {
+			declared := nameOf(typeAt(v.FieldTypes, i))
+			if declared != "" && !c.isType(declared) {
+				declared = ""
+			}
+			sig.types = append(sig.types, declared)
+		}
+		return typ{name: "Function", fn: sig}
+	}
+	c.report(name.Token, "enum %s has no variant %s", def.Name.Value, name.Value)
+	return anyType
+}
+
+func (c *checker) instantiation(e *ast.StructInstantiationExpression, s *scope) typ {
+	info := c.structs[e.Name.Value]
+	given := make(map[string]bool)
+	for _, f := range e.Fields {
+		t := c.expr(f.Value, s)
+		given[f.Name.Value] = true
+		if info == nil || info.open {
+			continue
+		}
+		declared, ok := info.fields[f.Name.Value]
+		if !ok {
+			if embedded := c.structs[f.Name.Value]; embedded != nil && c.includes(e.Name.Value, f.Name.Value) {
+				// A whole embedded instance supplies that struct's fields
+				for name := range embedded.fields {
+					given[name] = true
+				}
+				continue
+			}
+			c.report(f.Name.Token, "struct %s has no field %s", e.Name.Value, f.Name.Value)
+			continue
+		}
+		if !c.conforms(t, declared) {
+			c.report(f.Name.Token, "type error: field '%s' of %s expects %s, got %s",
+				f.Name.Value, e.Name.Value, declared, t.name)
+		}
+	}
+	if info != nil && !info.open {
+		for _, name := range info.order {
+			if info.required[name] && !given[name] {
+				c.report(e.Name.Token, "struct %s requires field %s", e.Name.Value, name)
+			}
+		}
+	}
+	return named(e.Name.Value)
+}
@@ -0,0 +1,163 @@
+// ==============================================================================================
+// FILE: checker/checker_unit_test.go
+// ==============================================================================================
+// PURPOSE: Unit tests for the static type checker.
+//          Each program is checked without running it and the reported diagnostics are compared.
+// ==============================================================================================
+
+package checker
+
+import (
+	"testing"
+
+	"eloquence/lexer"
+	"eloquence/parser"
+)
+
+func check(t *testing.T, input string) []string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors %v", input, p.Errors())
+	}
+	var messages []string
+	for _, d := range Check(program) {
+		messages = append(messages, d.String())
+	}
+	return messages
+}
+
+func TestCheckReportsProvableErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x as Integer is \"one\"", "line 1:1 - type error: variable 'x' expects Integer, got String"},
+		{"x as Integer is 1\nif x greater 0 { x is true }", "line 2:18 - type error: variable 'x' expects Integer, got Boolean"},
+		{"f is takes(n as Integer) { n }\nf(\"2\")", "line 2:2 - type error: parameter 'n' expects Integer, got String"},
+		{"f is takes() returns String { return 1 }", "line 1:31 - type error: return value expects String, got Integer"},
+		{"define P as struct { x as Float }\np is P { x: 1 }", "line 2:10 - type error: field 'x' of P expects Float, got Integer"},
+		{"define P as struct { x }\np is P { x: 1 }\nshow(p.y)", "line 3:8 - struct P has no field y"},
+		{"n is count([1])\nm is n adds \"a\"", "line 2:8 - type mismatch: Integer adds String"},
+		{"s is \"a\" times 2", "line 1:10 - type mismatch: String times Integer"},
+		{"b is true adds false", "line 1:11 - unknown operator: Boolean adds Boolean"},
+		{"x is 3\nx()", "line 2:2 - not a function: Integer"},
+		{"x as Colour is 1", "line 1:6 - unknown type: Colour"},
+		{"f is takes(n) { return str(n) }\ny is f(1) minus 1", "line 2:11 - type mismatch: String minus Integer"},
+		{"define Color as enum { Red }\nc is Color.Rde", "line 2:12 - enum Color has no variant Rde"},
+		{"define Color as enum { Red }\nc as Color is Color.Red\nc is 1", "line 3:1 - type error: variable 'c' expects Color, got Integer"},
+		{"define S as enum { C(r as Float) }\ns is S.C(1)", "line 2:9 - type error: field 'r' of S.C expects Float, got Integer"},
+		{"x as Integer is 1\nx, y is [2, 3]\nz is x adds \"s\"", "line 3:8 - type mismatch: Integer adds String"},
+		{"define P as struct { x }\nmatch 1 { when P { y } then y }", "line 2:20 - struct P has no field y"},
+		{"define P as struct { name, age is 0 }\np is P { age: 1 }", "line 2:6 - struct P requires field name"},
+		{"define P as struct { name }\np is P { name: \"a\", nme: \"b\" }", "line 2:21 - struct P has no field nme"},
+		{"define P as struct { name as String }\ndefine E as struct { ...P, pay }\ne is E { name: \"a\", pay: 1 }\nx is e.name minus 1", "line 4:13 - type mismatch: String minus Integer"},
+		{"m is {\"a\": 1}\nb is m less m", "line 2:8 - unknown operator: Map less Map"},
+		{"t is (1, 2)\nb is t equals [1, 2]", "line 2:8 - type mismatch: Tuple equals Array"},
+		{"constant PI is 3.14\nif true { PI is 3 }", "line 2:11 - cannot reassign constant PI"},
+		{"count is 0", "line 1:1 - cannot assign to builtin count; use 'redefine count is ...' to replace it"},
+		{"x as Integer is 1\nif true { let x is \"s\" }\nif true { x is \"t\" }", "line 3:11 - type error: variable 'x' expects Integer, got String"},
+		{"x as Integer is 1\np is pointing to x\ny is x adds \"t\"", "line 3:8 - type mismatch: Integer adds String"},
+		{"constant N is 1\nif true { let N is 2 }\nlet N is 3", "line 3:5 - cannot reassign constant N"},
+		{"redefine total is 0", "line 1:10 - total is not a builtin, so there is nothing to redefine"},
+		{"define S as enum { A }\nmatch 1 { when S.B then 1 }", "line 2:18 - enum S has no variant B"},
+		{"g is takes() { yield 1 }\nx is g() adds 1", "line 2:10 - type mismatch: Generator adds Integer"},
+		{"g is takes() returns Integer { yield 1 }", "line 1:22 - type error: return value expects Integer, got Generator"},
+		{"xs is collect(take([1, 2], 1))\ny is xs minus 1", "line 2:9 - type mismatch: Array minus Integer"},
+		{"f is takes(n as Integer) { n }\nt is spawn f(\"s\")", "line 2:13 - type error: parameter 'n' expects Integer, got String"},
+		{"f is takes() { 1 }\nt is spawn f()\nx is t adds 1", "line 3:8 - type mismatch: Task adds Integer"},
+		{"define P as struct { x as String }\nmatch 1 { when P { x } then x minus 1 }", "line 2:31 - type mismatch: String minus Integer"},
+	}
+
+	for _, tt := range tests {
+		got := check(t, tt.input)
+		if len(got) != 1 || got[0] != tt.expected {
+			t.Errorf("%q:\nexpected [%s]\ngot      %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCheckAcceptsValidAndUnknownCode(t *testing.T) {
+	tests := []string{
+		// Unannotated code is never reported
+		"f is takes(a, b) { return a adds b }\nf(1, \"x\")",
+		// Reassigning an unannotated variable changes its type
+		"x is 1\nx is \"one\"\ny is x adds \"!\"",
+		// A loop body that changes a variable's type widens it for the whole loop
+		"i is 0\nwhile i less 3 { show(i adds 1)\n i is \"done\" }",
+		// Outer variables may have changed by the time a function runs
+		"x is 1\nf is takes() { return x adds \"s\" }\nx is \"a\"",
+		// Number accepts both numeric types
+		"area is takes(w as Number, h as Number) returns Number { return w times h }\na is area(2, 1.5) adds 1",
+		// Recursive functions see their own signature
+		"fact is takes(n as Integer) returns Integer {\n if n less 2 { return 1 }\n return n times fact(n minus 1)\n}",
+		// Char joins strings; none compares with anything
+		"s is 'a' adds \"b\"\nt is 1 equals none",
+		// Interpolation always produces a string
+		"n is 3\ns is \"n = {n}\" adds \"!\"",
+		"redefine str is 5\ns is \"n = {str}\" adds \"!\"",
+		// Types from included files are unknown to the checker
+		"include \"shapes.eq\"\nc as Circle is make_circle()",
+		// Enum variants compare with each other
+		"define Color as enum { Red, Blue }\nsame is Color.Red equals Color.Blue",
+		// Names bound by match patterns are unknown and stay inside their arm
+		"match [1] { when [a, ...rest] then a adds count(rest) }\nx is 1\nmatch 2 { when x then x adds \"s\" }",
+		// Destructured names are unknown; declared names keep their type
+		"a, b is 1, 2\nc is a adds \"s\"\nx as Integer is 1\nx, y is [2, 3]\nz is x adds 1",
+		// Defaulted fields may be omitted; embedding structs stand in for their embedded struct
+		"define P as struct { name, age as Integer is 0 }\ndefine E as struct { ...P, pay }\nf is takes(p as P) { p.name }\nf(E { name: \"a\", pay: 1 })\ng is E { P: P { name: \"b\" }, pay: 2 }\nsame is g equals P { name: \"b\" }",
+		// Composite values compare structurally; strings, arrays and tuples also order
+		"a is [1] equals [1]\nb is \"x\" less \"y\"\nc is 'x' equals \"x\"\nd is (1, 2) greater (1, 1)\ne is {\"k\": 1} not_equals {}",
+		// Constants may be shadowed by parameters; builtins may be redefined explicitly
+		"constant N is 1\nf is takes(N) { N }\nredefine show is takes(x) { x }\nshow(1)",
+		// Pointers to fields, elements and cells compare by location
+		"define U as struct { age as Integer }\nu is U { age: 1 }\np is pointing to u.age\nsame is p equals new(1)\npointing from p is 2\nxs is [p]\npointing from xs[0] is 3\n" +
+			"pointing from pointing from pointing to p is 4",
+		// A variable may hold anything once a pointer to it is taken
+		"x is 1\np is pointing to x\npointing from p is \"s\"\ny is x adds \"t\"",
+		// A generator's returns only end it
+		"g is takes(n as Integer) returns Generator {\n yield n\n return \"done\"\n}\nfor v in map(g(1), str) { show(v) }",
+		// Structs may be used before their definition
+		"f is takes(p as Point) { p.x }\ndefine Point as struct { x }",
+	}
+
+	for _, input := range tests {
+		if got := check(t, input); len(got) != 0 {
+			t.Errorf("%q: expected no diagnostics, got %q", input, got)
+		}
+	}
+}
+
+func TestLintWarnsAboutShadowing(t *testing.T) {
+	input := `n is 1
+f is takes(n, m) { return n adds m }
+for n in [1, 2] { show(n) }
+while n less 3 { for m in [n] { show(m) } }
+if true { let n is 2 }
+g is takes(k) { for k in [k] { k } }`
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	expected := []string{
+		"line 2:12 - parameter n shadows a variable of an enclosing scope",
+		"line 3:5 - loop variable n shadows a variable of an enclosing scope",
+		"line 6:21 - loop variable k shadows a variable of an enclosing scope",
+	}
+	warnings := Lint(program)
+	if len(warnings) != len(expected) {
+		t.Fatalf("expected %d warnings, got %q", len(expected), warnings)
+	}
+	for i, want := range expected {
+		if got := warnings[i].String(); got != want {
+			t.Errorf("warning %d: expected %q, got %q", i, want, got)
+		}
+	}
+	if diags := Check(program); len(diags) != 0 {
+		t.Errorf("shadowing is not an error, got %q", diags)
+	}
+}
@@ -0,0 +1,568 @@
+// ==============================================================================================
+// FILE: commands.go
+// ==============================================================================================
+// PURPOSE: Implementations of the CLI subcommands dispatched from main.go.
+//          Every command returns the process exit code instead of exiting itself.
+// ==============================================================================================
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+
+	"eloquence/ast"
+	"eloquence/checker"
+	"eloquence/coverage"
+	"eloquence/evaluator"
+	"eloquence/formatter"
+	"eloquence/lexer"
+	"eloquence/object"
+	"eloquence/parser"
+	"eloquence/profiler"
+	"eloquence/repl"
+	"eloquence/testrunner"
+	"eloquence/token"
+	"eloquence/tracer"
+)
+
+// ----------------------------------------------------------------------------------------------
+// SOURCE LOADING
+// ----------------------------------------------------------------------------------------------
+
+// source is a program loaded from a file, the -e flag or stdin.
+type source struct {
+	name string // Display name used in diagnostics
+	code string
+	args []string // Remaining arguments, handed to the script as `args`
+}
+
+// loadSource resolves where the program comes from:
+// -e 'code', a file path, "-" for stdin, or stdin when it is not a terminal.
+func loadSource(expr string, rest []string) (*source, error) {
+	if expr != "" {
+		return &source{name: "-e", code: expr, args: rest}, nil
+	}
+
+	if len(rest) == 0 || rest[0] == "-" {
+		if len(rest) == 0 && isTerminal(os.Stdin) {
+			return nil, errors.New("no program given (pass a file, -e 'code' or pipe code on stdin)")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		if len(rest) > 0 {
+			rest = rest[1:]
+		}
+		return &source{name: "<stdin>", code: string(data), args: rest}, nil
+	}
+
+	data, err := os.ReadFile(rest[0])
+	if err != nil {
+		return nil, err
+	}
+	return &source{name: rest[0], code: string(data), args: rest[1:]}, nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// parseSource parses a program, printing any syntax errors to stderr.
+func parseSource(src *source) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src.code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(src.name, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+func printParserErrors(name string, errs []string) {
+	fmt.Fprintf(os.Stderr, "Parser Errors in %s:\n", name)
+	for _, msg := range errs {
+		fmt.Fprintf(os.Stderr, "\t%s\n", msg)
+	}
+}
+
+// newFlagSet creates a flag set whose usage line matches the command table.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		for _, c := range commands {
+			if c.name == name {
+				fmt.Fprintf(fs.Output(), "Usage: eloquence %s\n", c.usage)
+			}
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses command flags, mapping -h to success and bad flags to a usage failure.
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitFailure, false
+	}
+	return exitOK, true
+}
+
+// ----------------------------------------------------------------------------------------------
+// COMMANDS
+// ----------------------------------------------------------------------------------------------
+
+func cmdRun(args []string) int {
+	fs := newFlagSet("run")
+	expr := fs.String("e", "", "run the given code instead of a file")
+	maxDepth := fs.Int("max-depth", evaluator.MaxCallDepth, "how many (non-tail) calls may run at once")
+	profile := fs.Bool("profile", false, "profile the program and print a summary to stderr")
+	profileOut := fs.String("profile-out", "", "write the profile to this file (.folded: folded stacks, .pb.gz/.pprof: pprof, otherwise text)")
+	cover := fs.Bool("cover", false, "record statement and branch coverage and print a summary to stderr")
+	coverProfile := fs.String("coverprofile", "", "write the coverage profile to this file")
+	trace := fs.Bool("trace", false, "log every statement, call and assignment to stderr")
+	traceOut := fs.String("trace-out", "", "write the trace to this file instead of stderr")
+	traceFunc := fs.String("trace-func", "", "only trace functions whose name matches this regular expression")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	evaluator.MaxCallDepth = *maxDepth
+
+	src, err := loadSource(*expr, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading program: %s\n", err)
+		return exitFailure
+	}
+	program, ok := parseSource(src)
+	if !ok {
+		return exitParseError
+	}
+
+	env := object.NewEnvironment()
+	env.Set("args", stringArray(src.args))
+
+	var hooks []evaluator.Hook
+	var prof *profiler.Profiler
+	if *profile || *profileOut != "" {
+		prof = profiler.New(src.name)
+		hooks = append(hooks, prof)
+	}
+	var cov *coverage.Coverage
+	if *cover || *coverProfile != "" {
+		cov = coverage.New()
+		cov.Add(src.name, program)
+		hooks = append(hooks, cov)
+	}
+	if *trace || *traceOut != "" || *traceFunc != "" {
+		opts := tracer.Options{Out: os.Stderr}
+		if *traceFunc != "" {
+			re, err := regexp.Compile(*traceFunc)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid -trace-func pattern: %s\n", err)
+				return exitFailure
+			}
+			opts.Filter = re
+		}
+		if *traceOut != "" {
+			f, err := os.Create(*traceOut)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating trace file: %s\n", err)
+				return exitFailure
+			}
+			defer f.Close()
+			w := bufio.NewWriter(f)
+			defer w.Flush()
+			opts.Out = w
+		}
+		hooks = append(hooks, tracer.New(opts))
+	}
+	if len(hooks) != 0 {
+		evaluator.SetHook(evaluator.Hooks(hooks...))
+	}
+	evaluated := evaluator.Eval(program, env)
+	evaluator.SetHook(nil)
+	if prof != nil {
+		prof.Stop()
+		if err := writeProfile(prof, *profileOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing profile: %s\n", err)
+			return exitFailure
+		}
+	}
+	if cov != nil {
+		if err := writeCoverage(cov.Blocks(), *coverProfile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing coverage profile: %s\n", err)
+			return exitFailure
+		}
+	}
+	if code, ok := object.ExitCode(evaluated); ok {
+		return code
+	}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, errObj.Inspect())
+		if errObj.Line != 0 {
+			fmt.Fprintf(os.Stderr, "    at %s:%d:%d\n", src.name, errObj.Line, errObj.Column)
+		}
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+// writeProfile writes a profile to file, in the format its extension asks for,
+// or as a text summary on stderr when no file is given.
+func writeProfile(prof *profiler.Profiler, file string) error {
+	if file == "" {
+		return prof.WriteText(os.Stderr)
+	}
+	var buf bytes.Buffer
+	var err error
+	switch {
+	case strings.HasSuffix(file, ".folded"):
+		err = prof.WriteFolded(&buf)
+	case strings.HasSuffix(file, ".pb.gz"), strings.HasSuffix(file, ".pprof"):
+		err = prof.WritePprof(&buf)
+	default:
+		err = prof.WriteText(&buf)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0o644)
+}
+
+// writeCoverage writes a coverage profile to file, or a text summary to stderr when no file is given.
+func writeCoverage(blocks []coverage.Block, file string) error {
+	if file == "" {
+		return coverage.WriteText(os.Stderr, blocks)
+	}
+	var buf bytes.Buffer
+	if err := coverage.WriteProfile(&buf, blocks); err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0o644)
+}
+
+func cmdRepl(args []string) int {
+	fs := newFlagSet("repl")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	name := os.Getenv("USER")
+	if currentUser, err := user.Current(); err == nil {
+		name = currentUser.Username
+	}
+	if name == "" {
+		name = "there"
+	}
+
+	fmt.Printf("Hello %s! Welcome to the Eloquence programming language.\n", name)
+	fmt.Println("Type .help for commands")
+
+	return repl.Start(os.Stdin, os.Stdout)
+}
+
+func cmdCheck(args []string) int {
+	fs := newFlagSet("check")
+	expr := fs.String("e", "", "check the given code instead of files")
+	types := fs.Bool("types", false, "also infer and check types without running the program")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	sources, err := loadSources(*expr, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading program: %s\n", err)
+		return exitFailure
+	}
+
+	status := exitOK
+	for _, src := range sources {
+		program, ok := parseSource(src)
+		if !ok {
+			status = exitParseError
+			continue
+		}
+		if warnings := checker.Lint(program); len(warnings) != 0 {
+			fmt.Fprintf(os.Stderr, "Warnings in %s:\n", src.name)
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "\t%s\n", w)
+			}
+		}
+		if *types {
+			if diags := checker.Check(program); len(diags) != 0 {
+				fmt.Fprintf(os.Stderr, "Type Errors in %s:\n", src.name)
+				for _, d := range diags {
+					fmt.Fprintf(os.Stderr, "\t%s\n", d)
+				}
+				if status == exitOK {
+					status = exitFailure
+				}
+				continue
+			}
+		}
+		fmt.Printf("%s: ok\n", src.name)
+	}
+	return status
+}
+
+func cmdFmt(args []string) int {
+	fs := newFlagSet("fmt")
+	write := fs.Bool("w", false, "write the result back to the source file instead of stdout")
+	list := fs.Bool("l", false, "list files whose formatting differs from the canonical style")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	sources, err := loadSources("", fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading program: %s\n", err)
+		return exitFailure
+	}
+
+	status := exitOK
+	for _, src := range sources {
+		formatted, errs := formatter.Source(src.code)
+		if errs != nil {
+			printParserErrors(src.name, errs)
+			status = exitParseError
+			continue
+		}
+		changed := formatted != src.code
+		if *list {
+			if changed {
+				fmt.Println(src.name)
+			}
+			continue
+		}
+		if *write && src.name != "<stdin>" {
+			if changed {
+				if err := os.WriteFile(src.name, []byte(formatted), 0o644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing %s: %s\n", src.name, err)
+					status = exitFailure
+				}
+			}
+			continue
+		}
+		fmt.Print(formatted)
+	}
+	return status
+}
+
+// loadSources loads every file argument (or a single -e / stdin program).
+func loadSources(expr string, files []string) ([]*source, error) {
+	if expr != "" || len(files) == 0 {
+		src, err := loadSource(expr, files)
+		if err != nil {
+			return nil, err
+		}
+		return []*source{src}, nil
+	}
+	var sources []*source
+	for _, f := range files {
+		src, err := loadSource("", []string{f})
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// cmdTest discovers and runs *_test.eq files.
+func cmdTest(args []string) int {
+	fs := newFlagSet("test")
+	run := fs.String("run", "", "only run tests whose name matches this regular expression")
+	junit := fs.String("junit", "", "write a JUnit XML report to this file")
+	verbose := fs.Bool("v", false, "print passing tests as well as failing ones")
+	cover := fs.Bool("cover", false, "record the coverage of the files the tests include and print a summary")
+	coverProfile := fs.String("coverprofile", "", "write the coverage profile to this file")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	opts := testrunner.Options{Verbose: *verbose, Out: os.Stdout}
+	if *run != "" {
+		re, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -run pattern: %s\n", err)
+			return exitFailure
+		}
+		opts.Filter = re
+	}
+
+	files, err := testrunner.Discover(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding tests: %s\n", err)
+		return exitFailure
+	}
+
+	// Test files are left out of their own coverage: only the files they include are recorded
+	var cov *coverage.Coverage
+	if *cover || *coverProfile != "" {
+		cov = coverage.New()
+		evaluator.SetHook(cov)
+	}
+	report := testrunner.Run(files, opts)
+	evaluator.SetHook(nil)
+	if cov != nil {
+		if err := writeCoverage(cov.Blocks(), *coverProfile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing coverage profile: %s\n", err)
+			return exitFailure
+		}
+	}
+
+	if *junit != "" {
+		var buf bytes.Buffer
+		if err := testrunner.WriteJUnit(&buf, report); err == nil {
+			err = os.WriteFile(*junit, buf.Bytes(), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JUnit report: %s\n", err)
+			return exitFailure
+		}
+	}
+
+	if !report.Passed() {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// cmdCover merges coverage profiles and reports them as text, HTML or a merged profile.
+func cmdCover(args []string) int {
+	fs := newFlagSet("cover")
+	htmlOut := fs.String("html", "", "write an HTML report of the annotated sources to this file")
+	out := fs.String("o", "", "write the merged coverage profile to this file")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "No coverage profiles given")
+		fs.Usage()
+		return exitFailure
+	}
+
+	var runs [][]coverage.Block
+	for _, file := range fs.Args() {
+		f, err := os.Open(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading coverage profile: %s\n", err)
+			return exitFailure
+		}
+		blocks, err := coverage.ReadProfile(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading coverage profile %s: %s\n", file, err)
+			return exitFailure
+		}
+		runs = append(runs, blocks)
+	}
+	merged := coverage.Merge(runs...)
+
+	if *out != "" {
+		var buf bytes.Buffer
+		err := coverage.WriteProfile(&buf, merged)
+		if err == nil {
+			err = os.WriteFile(*out, buf.Bytes(), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing coverage profile: %s\n", err)
+			return exitFailure
+		}
+	}
+	if *htmlOut != "" {
+		var buf bytes.Buffer
+		err := coverage.WriteHTML(&buf, merged, nil)
+		if err == nil {
+			err = os.WriteFile(*htmlOut, buf.Bytes(), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing HTML report: %s\n", err)
+			return exitFailure
+		}
+	}
+	if *out == "" && *htmlOut == "" {
+		if err := coverage.WriteText(os.Stdout, merged); err != nil {
+			return exitFailure
+		}
+	}
+	return exitOK
+}
+
+func cmdTokens(args []string) int {
+	fs := newFlagSet("tokens")
+	expr := fs.String("e", "", "tokenize the given code instead of a file")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	src, err := loadSource(*expr, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading program: %s\n", err)
+		return exitFailure
+	}
+
+	status := exitOK
+	l := lexer.New(src.code)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Printf("%d:%d\t%-14s %q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+		if tok.Type == token.ILLEGAL {
+			status = exitParseError
+		}
+	}
+	return status
+}
+
+func cmdAST(args []string) int {
+	fs := newFlagSet("ast")
+	expr := fs.String("e", "", "parse the given code instead of a file")
+	asJSON := fs.Bool("json", false, "print the whole tree as JSON, with node kinds and positions")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	src, err := loadSource(*expr, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading program: %s\n", err)
+		return exitFailure
+	}
+	program, ok := parseSource(src)
+	if !ok {
+		return exitParseError
+	}
+
+	if *asJSON {
+		data, err := ast.ToJSON(program)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding syntax tree: %s\n", err)
+			return exitFailure
+		}
+		fmt.Println(string(data))
+		return exitOK
+	}
+	for _, stmt := range program.Statements {
+		fmt.Printf("%T\t%s\n", stmt, stmt.String())
+	}
+	return exitOK
+}
+
+func stringArray(values []string) *object.Array {
+	elements := make([]object.Object, len(values))
+	for i, v := range values {
+		elements[i] = &object.String{Value: v}
+	}
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,271 @@
+// ==============================================================================================
+// FILE: coverage/coverage.go
+// ==============================================================================================
+// PACKAGE: coverage
+// PURPOSE: Implements statement and branch coverage behind `run -cover` and `test -cover`.
+//          A Coverage is installed as the evaluator's hook. It counts how often every statement
+//          ran and every if/else branch was taken, by the source position of the node, and
+//          reads and writes those counts as coverage profiles that can be merged.
+// ==============================================================================================
+
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/object"
+	"eloquence/token"
+)
+
+// Kind tells what a Block counts.
+type Kind string
+
+const (
+	Statement Kind = "stmt" // A statement ran
+	Then      Kind = "then" // The condition of an if held
+	Else      Kind = "else" // The condition of an if did not hold (with or without an else block)
+)
+
+// Block is one counted place in a source file.
+type Block struct {
+	File   string
+	Line   int
+	Column int
+	Kind   Kind
+	Count  int
+}
+
+// String gives the block's place as written in profiles: "file:line.column kind".
+func (b Block) String() string {
+	return fmt.Sprintf("%s:%d.%d %s", b.File, b.Line, b.Column, b.Kind)
+}
+
+type blockKey struct {
+	file         string
+	line, column int
+	kind         Kind
+}
+
+// Coverage records coverage while installed as an evaluator.Hook. Programs are added before
+// they run; statements of programs that were never added are not counted.
+type Coverage struct {
+	mu         sync.Mutex
+	blocks     map[blockKey]*Block
+	statements map[ast.Statement]*Block
+	conditions map[ast.Expression][2]*Block // The then and else blocks of an if, by its condition
+}
+
+// New creates an empty coverage recorder.
+func New() *Coverage {
+	return &Coverage{
+		blocks:     make(map[blockKey]*Block),
+		statements: make(map[ast.Statement]*Block),
+		conditions: make(map[ast.Expression][2]*Block),
+	}
+}
+
+// Add registers the statements and branches of a program parsed from file, so they appear in
+// the coverage even when they never run. Adding a program of the same file again (as happens
+// when a file is included more than once) counts into the same blocks.
+func (c *Coverage) Add(file string, program *ast.Program) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BlockStatement:
+			// A block only holds statements, which are counted themselves
+		case *ast.IfExpression:
+			then := c.block(file, node.Pos(), Then)
+			c.conditions[node.Condition] = [2]*Block{then, c.block(file, node.Pos(), Else)}
+		case ast.Statement:
+			c.statements[node] = c.block(file, node.Pos(), Statement)
+		}
+		return true
+	})
+}
+
+func (c *Coverage) block(file string, pos token.Position, kind Kind) *Block {
+	key := blockKey{file, pos.Line, pos.Column, kind}
+	b, ok := c.blocks[key]
+	if !ok {
+		b = &Block{File: file, Line: pos.Line, Column: pos.Column, Kind: kind}
+		c.blocks[key] = b
+	}
+	return b
+}
+
+// ----------------------------------------------------------------------------------------------
+// HOOK
+// ----------------------------------------------------------------------------------------------
+
+var _ evaluator.LoadHook = (*Coverage)(nil)
+
+func (c *Coverage) Enter(node ast.Node, env *object.Environment) {
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	if b := c.statements[stmt]; b != nil {
+		b.Count++
+	}
+	c.mu.Unlock()
+}
+
+// Leave counts the branch an if takes once its condition is known.
+func (c *Coverage) Leave(node ast.Node, env *object.Environment, result object.Object) {
+	cond, ok := node.(ast.Expression)
+	if !ok || result == nil || result.Type() == object.ERROR_OBJ {
+		return
+	}
+	c.mu.Lock()
+	if branches, ok := c.conditions[cond]; ok {
+		if evaluator.IsTruthy(result) {
+			branches[0].Count++
+		} else {
+			branches[1].Count++
+		}
+	}
+	c.mu.Unlock()
+}
+
+func (c *Coverage) Call(fn *object.Function, args []object.Object, env, caller *object.Environment) {}
+
+func (c *Coverage) Return(fn *object.Function, result object.Object, env *object.Environment) {}
+
+// Load adds the programs loaded by include.
+func (c *Coverage) Load(file string, program *ast.Program) {
+	c.Add(file, program)
+}
+
+// Blocks returns the counts recorded so far, ordered by file and position.
+func (c *Coverage) Blocks() []Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]Block, 0, len(c.blocks))
+	for _, b := range c.blocks {
+		out = append(out, *b)
+	}
+	sortBlocks(out)
+	return out
+}
+
+// ----------------------------------------------------------------------------------------------
+// PROFILES
+// ----------------------------------------------------------------------------------------------
+
+// profileHeader starts every coverage profile. Each following line is one block:
+// "file:line.column kind count", for example "lib.eq:12.5 stmt 3".
+const profileHeader = "mode: count"
+
+// WriteProfile writes blocks as a coverage profile.
+func WriteProfile(w io.Writer, blocks []Block) error {
+	var b strings.Builder
+	b.WriteString(profileHeader + "\n")
+	for _, block := range blocks {
+		fmt.Fprintf(&b, "%s %d\n", block, block.Count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ReadProfile reads a coverage profile written by WriteProfile.
+func ReadProfile(r io.Reader) ([]Block, error) {
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || scanner.Text() != profileHeader {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("not a coverage profile: missing %q", profileHeader)
+	}
+
+	var blocks []Block
+	for n := 2; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		block, err := parseBlock(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, scanner.Err()
+}
+
+func parseBlock(line string) (Block, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return Block{}, fmt.Errorf("expected \"file:line.column kind count\", got %q", line)
+	}
+	// The file name may itself contain spaces or colons, so the line is read from the right
+	count, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil {
+		return Block{}, fmt.Errorf("invalid count %q", fields[len(fields)-1])
+	}
+	kind := Kind(fields[len(fields)-2])
+	if kind != Statement && kind != Then && kind != Else {
+		return Block{}, fmt.Errorf("unknown block kind %q", kind)
+	}
+	place := strings.Join(fields[:len(fields)-2], " ")
+	colon := strings.LastIndex(place, ":")
+	dot := strings.LastIndex(place, ".")
+	if colon < 0 || dot < colon {
+		return Block{}, fmt.Errorf("invalid position %q", place)
+	}
+	lineNo, err1 := strconv.Atoi(place[colon+1 : dot])
+	column, err2 := strconv.Atoi(place[dot+1:])
+	if err1 != nil || err2 != nil {
+		return Block{}, fmt.Errorf("invalid position %q", place)
+	}
+	return Block{File: place[:colon], Line: lineNo, Column: column, Kind: kind, Count: count}, nil
+}
+
+// Merge adds up the counts of several runs. Blocks are matched by file, position and kind.
+func Merge(runs ...[]Block) []Block {
+	merged := make(map[blockKey]*Block)
+	for _, blocks := range runs {
+		for _, b := range blocks {
+			key := blockKey{b.File, b.Line, b.Column, b.Kind}
+			if m, ok := merged[key]; ok {
+				m.Count += b.Count
+			} else {
+				copied := b
+				merged[key] = &copied
+			}
+		}
+	}
+	out := make([]Block, 0, len(merged))
+	for _, b := range merged {
+		out = append(out, *b)
+	}
+	sortBlocks(out)
+	return out
+}
+
+var kindOrder = map[Kind]int{Statement: 0, Then: 1, Else: 2}
+
+func sortBlocks(blocks []Block) {
+	sort.Slice(blocks, func(i, j int) bool {
+		a, b := blocks[i], blocks[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return kindOrder[a.Kind] < kindOrder[b.Kind]
+	})
+}
@@ -0,0 +1,178 @@
+// ==============================================================================================
+// FILE: coverage/coverage_unit_test.go
+// ==============================================================================================
+// PURPOSE: Unit tests for statement and branch coverage.
+//          Verifies counting, included files, profile round trips, merging and the reports.
+// ==============================================================================================
+
+package coverage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/lexer"
+	"eloquence/object"
+	"eloquence/parser"
+)
+
+const sample = `sign is takes(n) {
+    if n less 0 { return -1 }
+    if n equals 0 {
+        return 0
+    } else {
+        return 1
+    }
+}
+sign(5)
+sign(7)
+`
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func run(t *testing.T, cov *Coverage, program *ast.Program) {
+	t.Helper()
+	evaluator.SetHook(cov)
+	defer evaluator.SetHook(nil)
+	if result := evaluator.Eval(program, object.NewEnvironment()); result != nil && result.Type() == object.ERROR_OBJ {
+		t.Fatalf("runtime error: %s", result.Inspect())
+	}
+}
+
+func TestCoverageCounts(t *testing.T) {
+	cov := New()
+	program := parse(t, sample)
+	cov.Add("sample.eq", program)
+	run(t, cov, program)
+
+	blocks := cov.Blocks()
+	got := map[string]int{}
+	for _, b := range blocks {
+		got[b.String()] = b.Count
+	}
+	expected := map[string]int{
+		"sample.eq:1.1 stmt":  1,
+		"sample.eq:2.5 stmt":  2,
+		"sample.eq:2.5 then":  0, // n is never negative
+		"sample.eq:2.5 else":  2, // An if without else still has a branch for a false condition
+		"sample.eq:2.19 stmt": 0,
+		"sample.eq:3.5 stmt":  2,
+		"sample.eq:3.5 then":  0,
+		"sample.eq:3.5 else":  2,
+		"sample.eq:4.9 stmt":  0,
+		"sample.eq:6.9 stmt":  2,
+		"sample.eq:9.1 stmt":  1,
+		"sample.eq:10.1 stmt": 1,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestCoverageOfIncludedFiles(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.eq")
+	if err := os.WriteFile(lib, []byte("double is takes(n) { n times 2 }\nunused is takes() { 1 }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	evaluator.ParserFunc = func(input string) *ast.Program { return parse(t, input) }
+	defer func() { evaluator.ParserFunc = nil }()
+
+	cov := New()
+	program := parse(t, "include \""+lib+"\"\ndouble(2)\n")
+	run(t, cov, program) // The test program itself is not added: only the library is covered
+	run(t, cov, program)
+
+	var got []string
+	for _, b := range cov.Blocks() {
+		if b.File != lib {
+			t.Errorf("unexpected block outside the included file: %v", b)
+		}
+		got = append(got, fmt.Sprintf("%s %d", b, b.Count))
+	}
+	expected := []string{lib + ":1.1 stmt 2", lib + ":1.22 stmt 2", lib + ":2.1 stmt 2", lib + ":2.21 stmt 0"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestProfileRoundTripAndMerge(t *testing.T) {
+	first := []Block{{"a.eq", 1, 1, Statement, 1}, {"a.eq", 2, 5, Then, 0}, {"my lib.eq", 3, 1, Statement, 0}}
+	second := []Block{{"a.eq", 2, 5, Then, 2}, {"my lib.eq", 3, 1, Statement, 1}, {"b.eq", 1, 1, Statement, 4}}
+
+	var buf bytes.Buffer
+	if err := WriteProfile(&buf, first); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadProfile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, first) {
+		t.Errorf("round trip: expected %v, got %v", first, read)
+	}
+
+	merged := Merge(read, second)
+	expected := []Block{
+		{"a.eq", 1, 1, Statement, 1}, {"a.eq", 2, 5, Then, 2},
+		{"b.eq", 1, 1, Statement, 4}, {"my lib.eq", 3, 1, Statement, 1},
+	}
+	if !reflect.DeepEqual(merged, expected) {
+		t.Errorf("merge: expected %v, got %v", expected, merged)
+	}
+
+	for _, bad := range []string{"", "mode: set\n", "mode: count\na.eq:1.1 loop 1\n", "mode: count\na.eq 1\n"} {
+		if _, err := ReadProfile(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error reading %q", bad)
+		}
+	}
+}
+
+func TestReports(t *testing.T) {
+	blocks := []Block{
+		{"a.eq", 1, 1, Statement, 3}, {"a.eq", 2, 5, Statement, 3}, {"a.eq", 2, 5, Then, 3},
+		{"a.eq", 2, 5, Else, 0}, {"a.eq", 3, 9, Statement, 0},
+	}
+
+	var text bytes.Buffer
+	if err := WriteText(&text, blocks); err != nil {
+		t.Fatal(err)
+	}
+	expected := "a.eq: 66.7% of statements (2/3), 50.0% of branches (1/2)\n" +
+		"    2:5 if condition never failed\n" +
+		"    3:9 statement never ran\n"
+	if text.String() != expected {
+		t.Errorf("expected text report:\n%s\ngot:\n%s", expected, text.String())
+	}
+
+	var page bytes.Buffer
+	source := func(string) ([]byte, error) { return []byte("x is 1\nif x less 2 {\n    show(\"<small>\")\n}\n"), nil }
+	if err := WriteHTML(&page, blocks, source); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<span class="line covered"><span class="num">1</span><span class="count">3</span>x is 1</span>`,
+		`<span class="line partial"><span class="num">2</span>`,
+		`<span class="line missed"><span class="num">3</span><span class="count"></span>    show(&#34;&lt;small&gt;&#34;)</span>`,
+		`<span class="line"><span class="num">4</span>`,
+	} {
+		if !strings.Contains(page.String(), want) {
+			t.Errorf("HTML report is missing %s:\n%s", want, page.String())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// ==============================================================================================
+// FILE: coverage/report.go
+// ==============================================================================================
+// PACKAGE: coverage
+// PURPOSE: Renders coverage as a text summary per file (with the lines that never ran and the
+//          branches never taken) and as an HTML page showing the annotated source.
+// ==============================================================================================
+
+package coverage
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FileSummary is the coverage of one file.
+type FileSummary struct {
+	File                string
+	Statements, Covered int // Statements, and how many of them ran
+	Branches, Taken     int // Branches, and how many of them were taken
+	Missed              []Block
+}
+
+// Summarize groups blocks by file.
+func Summarize(blocks []Block) []FileSummary {
+	byFile := make(map[string]*FileSummary)
+	var files []string
+	for _, b := range blocks {
+		s, ok := byFile[b.File]
+		if !ok {
+			s = &FileSummary{File: b.File}
+			byFile[b.File] = s
+			files = append(files, b.File)
+		}
+		if b.Kind == Statement {
+			s.Statements++
+			if b.Count > 0 {
+				s.Covered++
+			}
+		} else {
+			s.Branches++
+			if b.Count > 0 {
+				s.Taken++
+			}
+		}
+		if b.Count == 0 {
+			s.Missed = append(s.Missed, b)
+		}
+	}
+	sort.Strings(files)
+	out := make([]FileSummary, len(files))
+	for i, f := range files {
+		out[i] = *byFile[f]
+	}
+	return out
+}
+
+// WriteText writes the coverage of every file, the statements that never ran and the
+// branches that were never taken.
+func WriteText(w io.Writer, blocks []Block) error {
+	var b strings.Builder
+	var statements, covered int
+	summaries := Summarize(blocks)
+	for _, s := range summaries {
+		fmt.Fprintf(&b, "%s: %s of statements (%d/%d), %s of branches (%d/%d)\n",
+			s.File, percent(s.Covered, s.Statements), s.Covered, s.Statements,
+			percent(s.Taken, s.Branches), s.Taken, s.Branches)
+		for _, m := range s.Missed {
+			switch m.Kind {
+			case Statement:
+				fmt.Fprintf(&b, "    %d:%d statement never ran\n", m.Line, m.Column)
+			case Then:
+				fmt.Fprintf(&b, "    %d:%d if condition never held\n", m.Line, m.Column)
+			case Else:
+				fmt.Fprintf(&b, "    %d:%d if condition never failed\n", m.Line, m.Column)
+			}
+		}
+		statements += s.Statements
+		covered += s.Covered
+	}
+	if len(summaries) > 1 {
+		fmt.Fprintf(&b, "total: %s of statements (%d/%d)\n", percent(covered, statements), covered, statements)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
+
+// htmlStyle colours lines whose statements all ran green, lines with a statement that never ran
+// red, and lines whose statements ran but with a branch never taken yellow.
+const htmlStyle = `body { font-family: sans-serif; margin: 2em; }
+pre { font-family: monospace; line-height: 1.3; }
+.line { display: block; }
+.num, .count { display: inline-block; width: 4em; text-align: right; color: #888; margin-right: 1em; }
+.covered { background: #d7f5d7; }
+.missed { background: #f9d0d0; }
+.partial { background: #fbefc0; }`
+
+// WriteHTML writes a page showing the source of every file with each line marked by its
+// coverage and the number of times its statements ran. Sources are read with readFile
+// (os.ReadFile when nil); a file that cannot be read is listed without its source.
+func WriteHTML(w io.Writer, blocks []Block, readFile func(string) ([]byte, error)) error {
+	if readFile == nil {
+		readFile = os.ReadFile
+	}
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Eloquence coverage</title>\n")
+	fmt.Fprintf(&b, "<style>\n%s\n</style>\n</head>\n<body>\n", htmlStyle)
+
+	byFile := make(map[string][]Block)
+	for _, block := range blocks {
+		byFile[block.File] = append(byFile[block.File], block)
+	}
+	for _, s := range Summarize(blocks) {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n<p>%s of statements (%d/%d), %s of branches (%d/%d)</p>\n",
+			html.EscapeString(s.File), percent(s.Covered, s.Statements), s.Covered, s.Statements,
+			percent(s.Taken, s.Branches), s.Taken, s.Branches)
+		source, err := readFile(s.File)
+		if err != nil {
+			fmt.Fprintf(&b, "<p>Source not available: %s</p>\n", html.EscapeString(err.Error()))
+			continue
+		}
+		writeSource(&b, string(source), byFile[s.File])
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// lineCoverage is what the blocks starting on one line say about it.
+type lineCoverage struct {
+	count     int // Most runs of a statement on the line
+	missed    bool
+	untaken   bool
+	hasBlocks bool
+}
+
+func writeSource(b *strings.Builder, source string, blocks []Block) {
+	lines := make(map[int]*lineCoverage)
+	for _, block := range blocks {
+		lc, ok := lines[block.Line]
+		if !ok {
+			lc = &lineCoverage{}
+			lines[block.Line] = lc
+		}
+		lc.hasBlocks = true
+		switch {
+		case block.Kind == Statement && block.Count == 0:
+			lc.missed = true
+		case block.Kind == Statement:
+			lc.count = max(lc.count, block.Count)
+		case block.Count == 0:
+			lc.untaken = true
+		}
+	}
+
+	b.WriteString("<pre>\n")
+	for i, text := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		n := i + 1
+		class, count := "line", ""
+		if lc, ok := lines[n]; ok && lc.hasBlocks {
+			switch {
+			case lc.missed:
+				class += " missed"
+			case lc.untaken:
+				class += " partial"
+			default:
+				class += " covered"
+			}
+			if lc.count > 0 {
+				count = fmt.Sprint(lc.count)
+			}
+		}
+		fmt.Fprintf(b, "<span class=\"%s\"><span class=\"num\">%d</span><span class=\"count\">%s</span>%s</span>",
+			class, n, count, html.EscapeString(text))
+	}
+	b.WriteString("</pre>\n")
+}
@@ -0,0 +1,165 @@
+// ==============================================================================================
+// FILE: evaluator/calls.go
+// ==============================================================================================
+// PACKAGE: evaluator
+// PURPOSE: Calls functions. A call in tail position (`return f(x)`) is not made by the function
+//          being left: it is handed back to its caller, which makes it in a loop, so tail
+//          recursion runs in constant Go stack. Other calls are counted, and a call deeper than
+//          MaxCallDepth fails with a catchable error instead of exhausting the Go stack.
+// ==============================================================================================
+
+package evaluator
+
+import (
+	"eloquence/ast"
+	"eloquence/object"
+)
+
+// MaxCallDepth is how many function calls may be running at once.
+// Tail calls take the place of the call they return from and do not add to the depth.
+var MaxCallDepth = 10000
+
+// applyFunction calls fn for code outside the evaluator (builtins such as map, spawn).
+// depth is how deep the code that called the builtin runs (0 for a new task), so recursion
+// through builtins still stops at MaxCallDepth.
+func applyFunction(fn object.Object, args []object.Object, depth int) object.Object {
+	return call(fn, args, depth, nil)
+}
+
+// callFunction calls fn from the scope caller.
+func callFunction(fn object.Object, args []object.Object, caller *object.Environment) object.Object {
+	return call(fn, args, caller.CallDepth(), caller)
+}
+
+// call makes a call depth calls deep from the scope caller (nil when the caller is not
+// Eloquence code).
+func call(fn object.Object, args []object.Object, depth int, caller *object.Environment) object.Object {
+	var left []*object.Function // Functions left by a tail call, whose return type still applies
+	var site *object.TailCall   // The tail call being made, if any
+
+	for {
+		f, ok := fn.(*object.Function)
+		if !ok {
+			return finishCall(applyNative(fn, args, depth), left, site)
+		}
+		if depth >= MaxCallDepth {
+			return finishCall(newError("maximum recursion depth exceeded (%d calls)", MaxCallDepth), left, site)
+		}
+
+		result := evalFunctionBody(f, args, depth+1, caller)
+		tail, ok := result.(*object.TailCall)
+		if !ok {
+			return finishCall(result, append(left, f), site)
+		}
+		if f.ReturnType != "" && !containsFunction(left, f) {
+			left = append(left, f) // Recursing through the same function checks its type once
+		}
+		fn, args, site = tail.Function, tail.Arguments, tail
+	}
+}
+
+// evalFunctionBody binds the arguments in a new scope and runs the body of fn.
+// A body ending in a tail call returns the object.TailCall for the caller to make.
+func evalFunctionBody(fn *object.Function, args []object.Object, depth int, caller *object.Environment) object.Object {
+	env := object.NewEnclosedEnvironment(fn.Env)
+	env.SetCallDepth(depth)
+	for i, param := range fn.Parameters {
+		if i >= len(args) {
+			continue
+		}
+		// Annotated parameters are checked at the call and keep their type inside the body
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != "" {
+			if err := checkType(args[i], fn.ParameterTypes[i], fn.Env, "parameter '"+param.Value+"'"); err != nil {
+				return err
+			}
+			env.Declare(param.Value, fn.ParameterTypes[i])
+		}
+		env.Set(param.Value, args[i])
+	}
+
+	h := hook.Load()
+	if h != nil {
+		(*h).Call(fn, args, env, caller)
+	}
+	var evaluated object.Object
+	if fn.Generator {
+		evaluated = newGenerator(fn.Body, env) // The body runs as values are asked for
+	} else {
+		evaluated = Eval(fn.Body, env)
+	}
+	if rv, ok := evaluated.(*object.ReturnValue); ok {
+		evaluated = rv.Value
+	}
+	if h != nil {
+		(*h).Return(fn, evaluated, env)
+	}
+	return evaluated
+}
+
+// finishCall checks the result of a call against the return types of the functions it returns
+// from, innermost first, and places errors without a position at the tail call that raised them.
+func finishCall(result object.Object, functions []*object.Function, site *object.TailCall) object.Object {
+	if !isError(result) {
+		checked := result
+		if checked == nil {
+			checked = NULL // A body without statements returns none
+		}
+		for i := len(functions) - 1; i >= 0; i-- {
+			fn := functions[i]
+			if fn.ReturnType == "" {
+				continue
+			}
+			if err := checkType(checked, fn.ReturnType, fn.Env, "return value"); err != nil {
+				result = err
+				break
+			}
+		}
+	}
+	if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 && site != nil {
+		errObj.Line = site.Line
+		errObj.Column = site.Column
+	}
+	return result
+}
+
+func applyNative(fn object.Object, args []object.Object, depth int) object.Object {
+	switch fn := fn.(type) {
+	case *object.Builtin:
+		if fn.FnAt != nil {
+			return fn.FnAt(depth, args...)
+		}
+		return fn.Fn(args...)
+	case *object.EnumVariant:
+		return newEnumValue(fn, args)
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func containsFunction(functions []*object.Function, fn *object.Function) bool {
+	for _, f := range functions {
+		if f == fn {
+			return true
+		}
+	}
+	return false
+}
+
+// evalTailCall evaluates the function and arguments of `return f(x)` and leaves the call itself
+// to the caller of the running function.
+func evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	fn := Eval(call.Function, env)
+	if isError(fn) {
+		return fn
+	}
+	args := evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	return &object.ReturnValue{Value: &object.TailCall{
+		Function:  fn,
+		Arguments: args,
+		Line:      call.Token.Line,
+		Column:    call.Token.Column,
+	}}
+}
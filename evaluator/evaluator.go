@@ -12,9 +12,11 @@ package evaluator
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"eloquence/ast"
 	"eloquence/object"
+	"eloquence/token"
 )
 
 // ParserFunc is a hook to allow the evaluator to call the parser
@@ -28,8 +30,24 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
+func init() {
+	// Builtins such as assert_throws need to call back into user-defined functions.
+	object.ApplyFunction = applyFunction
+}
+
 // Eval is the heart of the interpreter. It recursively evaluates AST nodes.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	h := hook.Load()
+	if h == nil {
+		return eval(node, env)
+	}
+	(*h).Enter(node, env)
+	result := eval(node, env)
+	(*h).Leave(node, env, result)
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// --- Root ---
@@ -38,12 +56,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	// --- Statements ---
 	case *ast.AssignmentStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
-			return val
-		}
-		env.Set(node.Name.Value, val)
-		return val
+		return evalAssignment(node, env)
+
+	case *ast.DestructuringStatement:
+		return evalDestructuring(node, env)
 
 	case *ast.BlockStatement:
 		return evalBlockStatement(node, env)
@@ -58,15 +74,24 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalPointerAssignment(node, env)
 
 	case *ast.ReturnStatement:
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok && node.Tail {
+			return evalTailCall(call, env)
+		}
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.YieldStatement:
+		return evalYield(node, env)
+
 	case *ast.StructDefinitionStatement:
 		return evalStructDefinition(node, env)
 
+	case *ast.EnumDefinitionStatement:
+		return evalEnumDefinition(node, env)
+
 	case *ast.TryCatchStatement:
 		return evalTryCatchStatement(node, env)
 
@@ -80,18 +105,37 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunction(fn, args)
+		result := callFunction(fn, args, env)
+		// Attach the call site to errors that do not know where they came from yet
+		if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+			errObj.Line = node.Token.Line
+			errObj.Column = node.Token.Column
+		}
+		return result
+
+	case *ast.SpawnExpression:
+		return evalSpawn(node, env)
 
 	case *ast.FieldAccessExpression:
 		return evalFieldAccess(node, env)
 
 	case *ast.FunctionLiteral:
 		// Capture the current environment for closure support
-		return &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env}
+		fn := &object.Function{Parameters: node.Parameters, Body: node.Body, Env: env, Generator: node.Generator}
+		for i := range node.Parameters {
+			fn.ParameterTypes = append(fn.ParameterTypes, typeName(node.ParameterTypes, i))
+		}
+		if node.ReturnType != nil {
+			fn.ReturnType = node.ReturnType.Value
+		}
+		return fn
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
 		if isError(left) {
@@ -138,6 +182,13 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.Array{Elements: elements}
 
+	case *ast.TupleLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Tuple{Elements: elements}
+
 	case *ast.BooleanLiteral:
 		return nativeBool(node.Value)
 
@@ -158,6 +209,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
+
+	case *ast.CharLiteral:
+		return &object.Char{Value: node.Value}
 	// Range Loop
 	case *ast.RangeLoopStatement:
 		return evalRangeLoop(node, env)
@@ -230,15 +284,18 @@ func evalTryCatchStatement(node *ast.TryCatchStatement, env *object.Environment)
 	tryEnv := object.NewEnclosedEnvironment(env)
 	result := evalBlockStatement(node.TryBlock, tryEnv)
 
-	if isError(result) {
+	// exit() is not an error the program can recover from, so it is not caught
+	if _, exiting := object.ExitCode(result); isError(result) && !exiting {
 		if node.CatchBlock != nil {
 			catchEnv := object.NewEnclosedEnvironment(env)
 			// Future: Bind the error object to a variable here
-			return evalBlockStatement(node.CatchBlock, catchEnv)
+			result = evalBlockStatement(node.CatchBlock, catchEnv)
+		} else {
+			result = NULL
 		}
-		return NULL
 	}
 
+	// finally runs however the try block ended, including a return or a closed generator
 	if node.FinallyBlock != nil {
 		evalBlockStatement(node.FinallyBlock, object.NewEnclosedEnvironment(env))
 	}
@@ -246,18 +303,203 @@ func evalTryCatchStatement(node *ast.TryCatchStatement, env *object.Environment)
 	return result
 }
 
+func evalAssignment(node *ast.AssignmentStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	// A function literal is named after the variable it is first assigned to, for profiles and traces
+	if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+		if _, literal := node.Value.(*ast.FunctionLiteral); literal {
+			fn.Name = node.Name.Value
+		}
+	}
+	switch node.Modifier.Type {
+	case token.LET:
+		if err := guardBuiltin(node.Name, env); err != nil {
+			return err
+		}
+		return bind(node.Name, node.Type, val, env, true, env.Let)
+	case token.CONSTANT:
+		if _, ok := object.GetBuiltin(node.Name.Value); ok && env.Resolve(node.Name.Value) == nil {
+			return positioned(newError("cannot declare builtin %s as a constant", node.Name.Value), node.Name)
+		}
+		return bind(node.Name, node.Type, val, env, true, env.SetConstant)
+	case token.REDEFINE:
+		if _, ok := object.GetBuiltin(node.Name.Value); !ok {
+			return positioned(newError("%s is not a builtin, so there is nothing to redefine", node.Name.Value), node.Name)
+		}
+		return bind(node.Name, node.Type, val, env, false, env.Assign)
+	}
+	return assign(node.Name, node.Type, val, env)
+}
+
+// assign updates the nearest binding of a name (or creates one in the current scope),
+// enforcing the name's declared type. A new annotation (typ) (re)declares the binding;
+// otherwise an earlier declaration still applies.
+// Constants cannot be reassigned, and builtins can only be replaced with `redefine`.
+func assign(ident, typ *ast.Identifier, val object.Object, env *object.Environment) object.Object {
+	if err := guardBuiltin(ident, env); err != nil {
+		return err
+	}
+	return bind(ident, typ, val, env, false, env.Assign)
+}
+
+// guardBuiltin refuses to bind the name of a builtin that the program has not redefined.
+func guardBuiltin(ident *ast.Identifier, env *object.Environment) *object.Error {
+	if env.Resolve(ident.Value) != nil {
+		return nil
+	}
+	if _, ok := object.GetBuiltin(ident.Value); ok {
+		return positioned(newError("cannot assign to builtin %s; use 'redefine %s is ...' to replace it",
+			ident.Value, ident.Value), ident)
+	}
+	return nil
+}
+
+// bind checks a value against the name's declared type and stores it with store.
+// A fresh binding (let, constant) does not inherit the type declared for an outer binding.
+func bind(ident, typ *ast.Identifier, val object.Object, env *object.Environment, fresh bool,
+	store func(string, object.Object) error) object.Object {
+	name := ident.Value
+	var declared string
+	var typed bool
+	if owner := env.Resolve(name); owner != nil && !fresh {
+		declared, typed = owner.DeclaredType(name)
+	}
+	if typ != nil {
+		declared, typed = typ.Value, true
+	}
+	if typed {
+		if err := checkType(val, declared, env, "variable '"+name+"'"); err != nil {
+			err.Line, err.Column = ident.Token.Line, ident.Token.Column
+			return err
+		}
+	}
+
+	if err := store(name, val); err != nil {
+		return positioned(newError("%s", err.Error()), ident)
+	}
+	if typed {
+		// The declaration belongs to the scope the value was stored in
+		env.Resolve(name).Declare(name, declared)
+	}
+	return val
+}
+
+// evalStructDefinition builds a struct type. Fields of embedded structs are promoted into it
+// (with their types and defaults); a field the struct declares itself overrides a promoted one.
 func evalStructDefinition(node *ast.StructDefinitionStatement, env *object.Environment) object.Object {
 	def := &object.StructDefinition{
-		Name:   node.Name.Value,
-		Fields: []string{},
+		Name:       node.Name.Value,
+		Fields:     []string{},
+		FieldTypes: make(map[string]string),
+		Defaults:   make(map[string]object.FieldDefault),
 	}
-	for _, f := range node.Attributes {
-		def.Fields = append(def.Fields, f.Value)
+	origin := make(map[string]string) // Field -> the embedded struct it was promoted from
+
+	for _, e := range node.Embeds {
+		obj, ok := env.Get(e.Value)
+		if !ok {
+			return positioned(newError("unknown struct: %s", e.Value), e)
+		}
+		embedded, ok := obj.(*object.StructDefinition)
+		if !ok {
+			return positioned(newError("%s is not a struct", e.Value), e)
+		}
+		for _, f := range embedded.Fields {
+			if from, ok := origin[f]; ok {
+				return positioned(newError("struct %s: field %s is promoted from both %s and %s",
+					def.Name, f, from, embedded.Name), e)
+			}
+			origin[f] = embedded.Name
+			def.Fields = append(def.Fields, f)
+			if t, ok := embedded.FieldTypes[f]; ok {
+				def.FieldTypes[f] = t
+			}
+			if d, ok := embedded.Defaults[f]; ok {
+				def.Defaults[f] = d
+			}
+		}
+		def.Embedded = append(def.Embedded, embedded)
+	}
+
+	declared := make(map[string]bool)
+	for i, f := range node.Attributes {
+		if declared[f.Value] {
+			return positioned(newError("struct %s declares field %s twice", def.Name, f.Value), f)
+		}
+		declared[f.Value] = true
+		if _, promoted := origin[f.Value]; !promoted {
+			def.Fields = append(def.Fields, f.Value)
+		}
+		delete(def.FieldTypes, f.Value)
+		delete(def.Defaults, f.Value)
+		if t := typeName(node.AttributeTypes, i); t != "" {
+			def.FieldTypes[f.Value] = t
+		}
+		if i < len(node.Defaults) && node.Defaults[i] != nil {
+			def.Defaults[f.Value] = object.FieldDefault{Value: node.Defaults[i], Env: env}
+		}
+	}
+	env.Set(node.Name.Value, def)
+	return NULL
+}
+
+// positioned attaches the position of an identifier to an error raised about it.
+func positioned(err *object.Error, ident *ast.Identifier) *object.Error {
+	err.Line, err.Column = ident.Token.Line, ident.Token.Column
+	return err
+}
+
+func evalEnumDefinition(node *ast.EnumDefinitionStatement, env *object.Environment) object.Object {
+	def := &object.EnumDefinition{Name: node.Name.Value}
+	for _, v := range node.Variants {
+		variant := &object.EnumVariant{Enum: def, Name: v.Name.Value}
+		if v.Fields == nil {
+			variant.Value = &object.EnumValue{Variant: variant}
+		} else {
+			variant.Fields = []string{}
+			variant.FieldTypes = make(map[string]string)
+			for i, f := range v.Fields {
+				variant.Fields = append(variant.Fields, f.Value)
+				if t := typeName(v.FieldTypes, i); t != "" {
+					variant.FieldTypes[f.Value] = t
+				}
+			}
+		}
+		def.Variants = append(def.Variants, variant)
 	}
 	env.Set(node.Name.Value, def)
 	return NULL
 }
 
+// newEnumValue builds a variant that carries associated values: Shape.Circle(2).
+func newEnumValue(variant *object.EnumVariant, args []object.Object) object.Object {
+	name := variant.Enum.Name + "." + variant.Name
+	if len(args) != len(variant.Fields) {
+		return newError("%s expects %d values, got %d", name, len(variant.Fields), len(args))
+	}
+	for i, f := range variant.Fields {
+		if declared, ok := variant.FieldTypes[f]; ok && !object.Conforms(args[i], declared) {
+			return newError("type error: field '%s' of %s expects %s, got %s", f, name, declared, object.TypeName(args[i]))
+		}
+	}
+	return &object.EnumValue{Variant: variant, Values: args}
+}
+
+// enumMember resolves Color.Red: a plain variant's value, or the constructor of one with fields.
+func enumMember(def *object.EnumDefinition, name string) object.Object {
+	variant, ok := def.Variant(name)
+	if !ok {
+		return newError("enum %s has no variant %s", def.Name, name)
+	}
+	if variant.Value != nil {
+		return variant.Value
+	}
+	return variant
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	cond := Eval(ie.Condition, env)
 	if isError(cond) {
@@ -286,6 +528,17 @@ func evalPrefixExpression(op string, right object.Object) object.Object {
 }
 
 func evalInfixExpression(op string, left, right object.Object) object.Object {
+	// Chars join with strings (and with each other) into a new string
+	if op == "adds" && isText(left) && isText(right) &&
+		(left.Type() == object.CHAR_OBJ || right.Type() == object.CHAR_OBJ) {
+		return &object.String{Value: left.Inspect() + right.Inspect()}
+	}
+
+	// A char compares with a string as the one-character string it is
+	if isText(left) && isText(right) && left.Type() != right.Type() {
+		return evalComparison(op, left, right)
+	}
+
 	// Handle NULL comparisons gracefully (e.g., node.next equals none)
 	if left.Type() != right.Type() {
 		if left.Type() == object.NULL_OBJ || right.Type() == object.NULL_OBJ {
@@ -308,6 +561,8 @@ func evalInfixExpression(op string, left, right object.Object) object.Object {
 		return evalStringInfix(op, left.(*object.String), right.(*object.String))
 	case object.BOOLEAN_OBJ:
 		return evalBooleanInfix(op, left.(*object.Boolean), right.(*object.Boolean))
+	case object.CHAR_OBJ:
+		return evalCharInfix(op, left.(*object.Char), right.(*object.Char))
 	case object.NULL_OBJ:
 		if op == "equals" {
 			return TRUE
@@ -315,44 +570,106 @@ func evalInfixExpression(op string, left, right object.Object) object.Object {
 		if op == "not_equals" {
 			return FALSE
 		}
+	case object.ARRAY_OBJ, object.TUPLE_OBJ:
+		return evalComparison(op, left, right)
+	case object.MAP_OBJ, object.ENUM_OBJ, object.STRUCT_INST_OBJ, object.POINTER_OBJ:
+		if op == "equals" {
+			return nativeBool(object.Equal(left, right))
+		}
+		if op == "not_equals" {
+			return nativeBool(!object.Equal(left, right))
+		}
 	}
 	return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
-	switch fn := fn.(type) {
-	case *object.Function:
-		env := object.NewEnclosedEnvironment(fn.Env)
-		for i, param := range fn.Parameters {
-			if i < len(args) {
-				env.Set(param.Value, args[i])
-			}
+// evalComparison compares values structurally (equals, not_equals) and by object.Compare
+// for the ordering operators. Arrays order element by element, so [1, 2] less [1, 3].
+func evalComparison(op string, left, right object.Object) object.Object {
+	switch op {
+	case "equals":
+		return nativeBool(object.Equal(left, right) || sameText(left, right))
+	case "not_equals":
+		return nativeBool(!object.Equal(left, right) && !sameText(left, right))
+	case "greater", "less", "greater_equal", "less_equal":
+		c, ok := object.Compare(left, right)
+		if !ok {
+			return newError("cannot compare %s with %s", left.Inspect(), right.Inspect())
 		}
-		evaluated := Eval(fn.Body, env)
-		if rv, ok := evaluated.(*object.ReturnValue); ok {
-			return rv.Value
+		switch op {
+		case "greater":
+			return nativeBool(c > 0)
+		case "less":
+			return nativeBool(c < 0)
+		case "greater_equal":
+			return nativeBool(c >= 0)
+		default:
+			return nativeBool(c <= 0)
 		}
-		return evaluated
-	case *object.Builtin:
-		return fn.Fn(args...)
-	default:
-		return newError("not a function: %s", fn.Type())
 	}
+	return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
 }
 
-func evalPointerReference(node *ast.PointerReferenceExpression, env *object.Environment) object.Object {
-	ident, ok := node.Value.(*ast.Identifier)
-	if !ok {
-		return newError("can only point to identifier")
-	}
+// sameText reports whether a char and a string hold the same text ('a' equals "a").
+func sameText(left, right object.Object) bool {
+	return isText(left) && isText(right) && left.Inspect() == right.Inspect()
+}
 
-	// Resolve exact environment where the variable lives to allow mutation
-	targetEnv := env.Resolve(ident.Value)
-	if targetEnv == nil {
-		return newError("identifier not found: %s", ident.Value)
+// evalPointerReference takes a pointer to a variable, a struct field (pointing to user.age),
+// an array element (pointing to xs[0]) or a map entry (pointing to counts["a"]).
+// Field, element and entry pointers hold on to their container, not to the names leading to it.
+func evalPointerReference(node *ast.PointerReferenceExpression, env *object.Environment) object.Object {
+	switch target := node.Value.(type) {
+	case *ast.Identifier:
+		// Resolve exact environment where the variable lives to allow mutation
+		targetEnv := env.Resolve(target.Value)
+		if targetEnv == nil {
+			return newError("identifier not found: %s", target.Value)
+		}
+		return &object.Pointer{Name: target.Value, Env: targetEnv, Version: targetEnv.Version(target.Value)}
+	case *ast.FieldAccessExpression:
+		left := Eval(target.Object, env)
+		if isError(left) {
+			return left
+		}
+		strct, ok := left.(*object.StructInstance)
+		if !ok {
+			return newError("cannot point to a field of %s", left.Type())
+		}
+		if _, ok := strct.Field(target.Field.Value); !ok {
+			return positioned(newError("struct %s has no field %s", strct.Definition.Name, target.Field.Value), target.Field)
+		}
+		name := target.Object.String() + "." + target.Field.Value
+		return object.NewPointer(name, object.FieldLocation{Instance: strct, Field: target.Field.Value})
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isError(index) {
+			return index
+		}
+		name := target.Left.String() + "[" + target.Index.String() + "]"
+		switch left := left.(type) {
+		case *object.Array:
+			i, ok := index.(*object.Integer)
+			if !ok {
+				return newError("array index must be Integer, got %s", index.Type())
+			}
+			if i.Value < 0 || i.Value >= int64(left.Len()) {
+				return newError("cannot point to %s: index out of range", name)
+			}
+			return object.NewPointer(name, object.ElementLocation{Array: left, Index: int(i.Value)})
+		case *object.Map:
+			if _, ok := object.HashKeyOf(index); !ok {
+				return newError("unusable as map key: %s", index.Type())
+			}
+			return object.NewPointer(name, object.EntryLocation{Map: left, Key: index})
+		}
+		return newError("cannot point into %s", left.Type())
 	}
-
-	return &object.Pointer{Name: ident.Value, Env: targetEnv}
+	return newError("can only point to variables, struct fields, array elements and map entries")
 }
 
 func evalPointerDereference(node *ast.PointerDereferenceExpression, env *object.Environment) object.Object {
@@ -362,23 +679,34 @@ func evalPointerDereference(node *ast.PointerDereferenceExpression, env *object.
 	}
 	ptr, ok := val.(*object.Pointer)
 	if !ok {
+		if val.Type() == object.NULL_OBJ {
+			return newError("cannot dereference none")
+		}
 		return newError("cannot dereference non-pointer")
 	}
-	targetVal, ok := ptr.Env.Get(ptr.Name)
-	if !ok {
-		return newError("dangling pointer: %s", ptr.Name)
+	targetVal, err := ptr.Load()
+	if err != nil {
+		return newError("%s", err)
+	}
+	if targetVal == nil {
+		return NULL // A map entry that does not exist yet
 	}
 	return targetVal
 }
 
+// evalPointerAssignment writes through the pointer that node.Target produces. Declared types
+// of the variable or struct field pointed to still apply.
 func evalPointerAssignment(node *ast.PointerAssignmentStatement, env *object.Environment) object.Object {
-	ptrObj, ok := env.Get(node.Name.Value)
-	if !ok {
-		return newError("identifier not found: %s", node.Name.Value)
+	ptrObj := Eval(node.Target, env)
+	if isError(ptrObj) {
+		return ptrObj
 	}
 	p, ok := ptrObj.(*object.Pointer)
 	if !ok {
-		return newError("'%s' is not a pointer", node.Name.Value)
+		if ptrObj.Type() == object.NULL_OBJ {
+			return newError("cannot write through none")
+		}
+		return newError("'%s' is not a pointer", node.Target.String())
 	}
 
 	val := Eval(node.Value, env)
@@ -386,47 +714,138 @@ func evalPointerAssignment(node *ast.PointerAssignmentStatement, env *object.Env
 		return val
 	}
 
-	// Mutate the original variable in its home environment
-	p.Env.Set(p.Name, val)
+	if declared, ok := p.DeclaredType(); ok {
+		what := "variable '" + p.Name + "'"
+		if field, ok := p.Target.(object.FieldLocation); ok {
+			what = "field '" + field.Field + "' of " + field.Instance.Definition.Name
+		}
+		if err := checkType(val, declared, env, what); err != nil {
+			return err
+		}
+	}
+
+	// Mutate the original variable, field, element, entry or cell
+	if err := p.Store(val); err != nil {
+		if node.Name != nil {
+			return positioned(newError("%s", err), node.Name)
+		}
+		return newError("%s", err)
+	}
 	return val
 }
 
+// evalStructInstantiation creates an instance. Every field must be given unless it has a
+// default, and only fields of the struct may be given. Naming an embedded struct as a field
+// (Employee { Person: p, salary: 1 }) copies that struct's fields from an existing instance.
 func evalStructInstantiation(node *ast.StructInstantiationExpression, env *object.Environment) object.Object {
 	obj, ok := env.Get(node.Name.Value)
 	if !ok {
-		return newError("unknown struct: %s", node.Name.Value)
+		return positioned(newError("unknown struct: %s", node.Name.Value), node.Name)
 	}
 	def, ok := obj.(*object.StructDefinition)
 	if !ok {
-		return newError("%s is not a struct", node.Name.Value)
+		return positioned(newError("%s is not a struct", node.Name.Value), node.Name)
 	}
 
 	fields := make(map[string]object.Object)
-	// Initialize defaults
-	for _, f := range def.Fields {
-		fields[f] = NULL
-	}
-	// Set provided values
+	given := make(map[string]bool)
+	var parts []*object.StructInstance // Embedded instances given whole
+
 	for _, f := range node.Fields {
+		name := f.Name.Value
+		if given[name] {
+			return positioned(newError("field %s given twice", name), f.Name)
+		}
+		given[name] = true
+
 		val := Eval(f.Value, env)
 		if isError(val) {
 			return val
 		}
-		fields[f.Name.Value] = val
+		if embedded := embeddedStruct(def, name); embedded != nil && !def.HasField(name) {
+			inst, ok := val.(*object.StructInstance)
+			if !ok || !inst.Definition.Includes(name) {
+				return positioned(newError("type error: field '%s' of %s expects %s, got %s",
+					name, def.Name, name, object.TypeName(val)), f.Name)
+			}
+			parts = append(parts, inst)
+			continue
+		}
+		if !def.HasField(name) {
+			return positioned(newError("struct %s has no field %s", def.Name, name), f.Name)
+		}
+		if declared, ok := def.FieldTypes[name]; ok {
+			if err := checkType(val, declared, env, "field '"+name+"' of "+def.Name); err != nil {
+				return positioned(err, f.Name)
+			}
+		}
+		fields[name] = val
+	}
+
+	for _, inst := range parts {
+		values := inst.FieldValues()
+		for _, name := range inst.Definition.Fields {
+			if _, set := fields[name]; !set && def.HasField(name) {
+				fields[name] = values[name]
+			}
+		}
+	}
+
+	// Omitted fields take their default; fields without one are required
+	for _, name := range def.Fields {
+		if _, set := fields[name]; set {
+			continue
+		}
+		d, ok := def.Defaults[name]
+		if !ok {
+			return positioned(newError("struct %s requires field %s", def.Name, name), node.Name)
+		}
+		val := Eval(d.Value, d.Env)
+		if isError(val) {
+			return val
+		}
+		if declared, ok := def.FieldTypes[name]; ok {
+			if err := checkType(val, declared, env, "field '"+name+"' of "+def.Name); err != nil {
+				// The default is at fault, not the instantiation that left the field out
+				pos := d.Value.Pos()
+				err.Line, err.Column = pos.Line, pos.Column
+				return err
+			}
+		}
+		fields[name] = val
 	}
 	return &object.StructInstance{Definition: def, Fields: fields}
 }
 
+// embeddedStruct returns the struct def embeds under the given name, if any.
+func embeddedStruct(def *object.StructDefinition, name string) *object.StructDefinition {
+	for _, e := range def.Embedded {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
 func evalFieldAccess(node *ast.FieldAccessExpression, env *object.Environment) object.Object {
 	left := Eval(node.Object, env)
 	if isError(left) {
 		return left
 	}
+	switch left := left.(type) {
+	case *object.EnumDefinition:
+		return enumMember(left, node.Field.Value)
+	case *object.EnumValue:
+		if val, ok := left.Field(node.Field.Value); ok {
+			return val
+		}
+		return newError("%s has no field %s", left.Variant.Enum.Name+"."+left.Variant.Name, node.Field.Value)
+	}
 	strct, ok := left.(*object.StructInstance)
 	if !ok {
 		return newError("not a struct instance: %s", left.Type())
 	}
-	val, ok := strct.Fields[node.Field.Value]
+	val, ok := strct.Field(node.Field.Value)
 	if !ok {
 		return newError("struct %s has no field %s", strct.Definition.Name, node.Field.Value)
 	}
@@ -434,6 +853,12 @@ func evalFieldAccess(node *ast.FieldAccessExpression, env *object.Environment) o
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	// An interpolated string calls the builtin str, whatever the program calls str
+	if node.Token.Type == token.TEMPLATE {
+		if builtin, ok := object.GetBuiltin(node.Value); ok {
+			return builtin
+		}
+	}
 	// 1. Check variables
 	if val, ok := env.Get(node.Value); ok {
 		return val
@@ -520,10 +945,36 @@ func evalStringInfix(op string, l, r *object.String) object.Object {
 		return nativeBool(l.Value == r.Value)
 	case "not_equals":
 		return nativeBool(l.Value != r.Value)
+	case "greater", "less", "greater_equal", "less_equal":
+		return evalComparison(op, l, r)
 	}
 	return newError("unknown operator: STRING %s STRING", op)
 }
 
+// evalCharInfix compares chars by their Unicode code point.
+func evalCharInfix(op string, l, r *object.Char) object.Object {
+	switch op {
+	case "equals":
+		return nativeBool(l.Value == r.Value)
+	case "not_equals":
+		return nativeBool(l.Value != r.Value)
+	case "greater":
+		return nativeBool(l.Value > r.Value)
+	case "less":
+		return nativeBool(l.Value < r.Value)
+	case "greater_equal":
+		return nativeBool(l.Value >= r.Value)
+	case "less_equal":
+		return nativeBool(l.Value <= r.Value)
+	}
+	return newError("unknown operator: CHAR %s CHAR", op)
+}
+
+// isText reports whether an object is a String or a Char.
+func isText(obj object.Object) bool {
+	return obj.Type() == object.STRING_OBJ || obj.Type() == object.CHAR_OBJ
+}
+
 func evalBooleanInfix(op string, l, r *object.Boolean) object.Object {
 	switch op {
 	case "equals":
@@ -540,7 +991,13 @@ func evalBooleanInfix(op string, l, r *object.Boolean) object.Object {
 
 func evalIndexExpression(left, index object.Object) object.Object {
 	if left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ {
-		return evalArrayIndex(left.(*object.Array), index.(*object.Integer))
+		if el, ok := left.(*object.Array).At(int(index.(*object.Integer).Value)); ok {
+			return el
+		}
+		return NULL
+	}
+	if left.Type() == object.TUPLE_OBJ && index.Type() == object.INTEGER_OBJ {
+		return evalArrayIndex(left.(*object.Tuple).Elements, index.(*object.Integer))
 	}
 	if left.Type() == object.MAP_OBJ {
 		return evalMapIndex(left.(*object.Map), index)
@@ -548,21 +1005,21 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	return newError("index operator not supported: %s", left.Type())
 }
 
-func evalArrayIndex(array *object.Array, index *object.Integer) object.Object {
+func evalArrayIndex(elements []object.Object, index *object.Integer) object.Object {
 	idx := index.Value
-	max := int64(len(array.Elements) - 1)
+	max := int64(len(elements) - 1)
 	if idx < 0 || idx > max {
 		return NULL
 	}
-	return array.Elements[idx]
+	return elements[idx]
 }
 
 func evalMapIndex(m *object.Map, index object.Object) object.Object {
-	key, ok := index.(object.Hashable)
+	key, ok := object.HashKeyOf(index)
 	if !ok {
 		return newError("unusable as map key: %s", index.Type())
 	}
-	pair, ok := m.Pairs[key.HashKey()]
+	pair, ok := m.Get(key)
 	if !ok {
 		return NULL
 	}
@@ -571,12 +1028,13 @@ func evalMapIndex(m *object.Map, index object.Object) object.Object {
 
 func evalMapLiteral(node *ast.MapLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
+		valNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.HashKeyOf(key)
 		if !ok {
 			return newError("unusable as map key: %s", key.Type())
 		}
@@ -584,7 +1042,7 @@ func evalMapLiteral(node *ast.MapLiteral, env *object.Environment) object.Object
 		if isError(val) {
 			return val
 		}
-		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: val}
+		pairs[hashKey] = object.HashPair{Key: key, Value: val}
 	}
 	return &object.Map{Pairs: pairs}
 }
@@ -608,6 +1066,11 @@ func nativeBool(b bool) *object.Boolean {
 	return FALSE
 }
 
+// IsTruthy reports whether a condition with this value holds: every value but none and false does.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case NULL, FALSE:
@@ -617,6 +1080,32 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// ----------------------------------------------------------------------------------------------
+// TYPE ANNOTATIONS
+// ----------------------------------------------------------------------------------------------
+
+// checkType verifies a value against a declared type at a call or assignment boundary.
+// It returns nil when the value conforms. `what` names the boundary in the error message.
+func checkType(val object.Object, declared string, env *object.Environment, what string) *object.Error {
+	if object.Conforms(val, declared) {
+		return nil
+	}
+	if !object.IsBuiltinType(declared) {
+		if def, ok := env.Get(declared); !ok || (def.Type() != object.STRUCT_DEF_OBJ && def.Type() != object.ENUM_DEF_OBJ) {
+			return newError("unknown type: %s", declared)
+		}
+	}
+	return newError("type error: %s expects %s, got %s", what, declared, object.TypeName(val))
+}
+
+// typeName returns the i-th annotation of a parallel annotation list, or "" when there is none.
+func typeName(types []*ast.Identifier, i int) string {
+	if i < len(types) && types[i] != nil {
+		return types[i].Value
+	}
+	return ""
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -634,13 +1123,27 @@ func evalRangeLoop(node *ast.RangeLoopStatement, env *object.Environment) object
 		return iterable
 	}
 
-	// We currently support looping over Arrays
-	arr, ok := iterable.(*object.Array)
-	if !ok {
+	// Arrays, tuples and generators provide their own iterator; enums walk their variants
+	var it object.Iterator
+	if def, ok := iterable.(*object.EnumDefinition); ok {
+		var variants []object.Object
+		for _, v := range def.Variants {
+			variants = append(variants, enumMember(def, v.Name))
+		}
+		it = object.IterateElements(variants)
+	} else if it, ok = object.Iterate(iterable); !ok {
 		return newError("object is not iterable: %s", iterable.Type())
 	}
 
-	for _, element := range arr.Elements {
+	for {
+		element, ok := it.Next()
+		if !ok {
+			return NULL
+		}
+		if isError(element) {
+			return element
+		}
+
 		// Create a temporary scope for the loop body
 		loopEnv := object.NewEnclosedEnvironment(env)
 		// Set the iterator variable (e.g., 'item' in 'for item in list')
@@ -648,16 +1151,23 @@ func evalRangeLoop(node *ast.RangeLoopStatement, env *object.Environment) object
 
 		rt := Eval(node.Body, loopEnv)
 
-		// Handle interrupts (Return or Error inside loop)
+		// Handle interrupts (Return or Error inside loop); a generator gets to clean up
 		if rt != nil && (rt.Type() == object.RETURN_VALUE_OBJ || rt.Type() == object.ERROR_OBJ) {
+			it.Close()
 			return rt
 		}
 	}
-	return NULL
 }
 
 func evalInclude(node *ast.IncludeStatement, env *object.Environment) object.Object {
-	filename := node.Path.(*ast.StringLiteral).Value
+	path, ok := node.Path.(*ast.StringLiteral)
+	if !ok {
+		return newError("include expects a plain string path")
+	}
+	filename := path.Value
+	if dir := env.Dir(); dir != "" && !filepath.IsAbs(filename) {
+		filename = filepath.Join(dir, filename)
+	}
 
 	// 1. Read the file
 	data, err := os.ReadFile(filename)
@@ -670,6 +1180,11 @@ func evalInclude(node *ast.IncludeStatement, env *object.Environment) object.Obj
 		return newError("parser not configured for imports")
 	}
 	program := ParserFunc(string(data))
+	if h := hook.Load(); h != nil {
+		if lh, ok := (*h).(LoadHook); ok {
+			lh.Load(filename, program)
+		}
+	}
 
 	// 3. Evaluate it in the CURRENT environment (so imported vars are available)
 	return Eval(program, env)
@@ -9,8 +9,11 @@
 package evaluator
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"eloquence/ast"
 	"eloquence/lexer"
 	"eloquence/object"
 	"eloquence/parser"
@@ -133,6 +136,10 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if 1 greater 2 { 10 }", nil},
 		{"if 1 greater 2 { 10 } else { 20 }", 20},
 		{"if 1 less 2 { 10 } else { 20 }", 10},
+		{"if 1 greater 2 { 10 } else if 2 greater 1 { 20 } else { 30 }", 20},
+		{"if 1 greater 2 { 10 } else if 2 greater 3 { 20 } else { 30 }", 30},
+		{"if 1 less 2\n 10\nelse\n 20\nend", 10},
+		{"if 1 greater 2\n 10\nelse if false\n 20\nend", nil},
 	}
 
 	for _, tt := range tests {
@@ -198,3 +205,924 @@ func TestErrorHandling(t *testing.T) {
 		}
 	}
 }
+
+func TestCharValues(t *testing.T) {
+	// Literals evaluate to Char objects
+	obj := testEval("'a'")
+	char, ok := obj.(*object.Char)
+	if !ok || char.Value != 'a' {
+		t.Fatalf("expected Char 'a', got %T (%+v)", obj, obj)
+	}
+
+	// Comparison and ordering by code point
+	booleans := []struct {
+		input    string
+		expected bool
+	}{
+		{"'a' equals 'a'", true},
+		{"'a' not_equals 'b'", true},
+		{"'a' less 'b'", true},
+		{"'z' greater 'a'", true},
+		{"'A' less 'a'", true},
+		{"'c' less_equal 'c'", true},
+		{"'a' equals none", false},
+		{`m is {'a': true, "a": false}
+		m['a']`, true}, // Chars and strings are distinct map keys
+		{"chr(ord('x')) equals 'x'", true},
+		{`'\n' equals chr(10)`, true},
+	}
+	for _, tt := range booleans {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+
+	// Concatenation with strings produces strings
+	strs := []struct {
+		input    string
+		expected string
+	}{
+		{`'a' adds "bc"`, "abc"},
+		{`"ab" adds 'c'`, "abc"},
+		{`'o' adds 'k'`, "ok"},
+		{`str('q')`, "q"},
+	}
+	for _, tt := range strs {
+		obj := testEval(tt.input)
+		str, ok := obj.(*object.String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("%s: expected String %q, got %T (%+v)", tt.input, tt.expected, obj, obj)
+		}
+	}
+
+	// Conversions
+	testIntegerObject(t, testEval("ord('A')"), 65)
+	testIntegerObject(t, testEval(`ord('\'')`), 39)
+	testIntegerObject(t, testEval(`ord("é")`), 233)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"'a' times 'b'", "unknown operator: CHAR times CHAR"},
+		{"'a' adds 1", "type mismatch: CHAR adds INTEGER"},
+		{"ord(1)", "argument to `ord` must be CHAR, got INTEGER"},
+		{`ord("ab")`, "must be a single character"},
+		{"chr(-1)", "chr: -1 is not a valid code point"},
+		{`chr("a")`, "argument to `chr` must be INTEGER, got STRING"},
+	}
+	for _, tt := range errors {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok || !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("%s: expected error containing %q, got %+v", tt.input, tt.expected, errObj)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`name is "Ada"
+		"Hello {name}!"`, "Hello Ada!"},
+		{`"{1 adds 2} = {3}"`, "3 = 3"},
+		{`xs is [1, 2]
+		"{count(xs)} items: {xs}"`, "2 items: [1, 2]"},
+		{`"\{literal}"`, "{literal}"},
+		{`"\u{48}\x69"`, "Hi"},
+		{"`a\\n{b}`", `a\n{b}`},
+		// Interpolation always uses the builtin str, even where the program replaced it
+		{`redefine str is takes(x) { "?" }
+		"n = {1}"`, "n = 1"},
+		{`f is takes(str) { "{str}!" }
+		f(2)`, "2!"},
+	}
+	for _, tt := range tests {
+		obj := testEval(tt.input)
+		str, ok := obj.(*object.String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("%s: expected String %q, got %T (%+v)", tt.input, tt.expected, obj, obj)
+		}
+	}
+
+	testIntegerObject(t, testEval("0xFF adds 0b1 adds 1_000"), 1256)
+}
+
+func TestAssertionBuiltins(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string // empty when the assertion should pass
+	}{
+		{`assert(1 less 2)`, ""},
+		{`assert(false)`, "assertion failed"},
+		{`assert(none, "must be set")`, "assertion failed: must be set"},
+		{`assert_equals([1, 2], [1, 2])`, ""},
+		{`assert_equals("1", 1)`, `assertion failed: expected "1", got 1`},
+		{`assert_throws(takes() { 1 divides 0 })`, ""},
+		{`assert_throws(takes() { 1 divides 0 }, "zero")`, ""},
+		{`assert_throws(takes() { 1 })`, "assertion failed: expected an error to be thrown, got 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, isErr := evaluated.(*object.Error)
+		if tt.expectedMessage == "" {
+			if isErr {
+				t.Errorf("%s: unexpected error %q", tt.input, errObj.Message)
+			}
+			continue
+		}
+		if !isErr {
+			t.Errorf("%s: expected error, got %T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("%s: wrong message. expected=%q, got=%q", tt.input, tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Line != 1 {
+			t.Errorf("%s: expected error to carry the call position, got line %d", tt.input, errObj.Line)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		{"x as Integer is 5\nx is x adds 1\nx", "6"},
+		{"x as Integer is \"five\"", "type error: variable 'x' expects Integer, got String"},
+		{"x as Integer is 5\nx is \"six\"", "type error: variable 'x' expects Integer, got String"},
+		{"x as Integer is 5\nif true { x is 1.5 }", "type error: variable 'x' expects Integer, got Float"},
+		{"x as Number is 5\nx is 1.5\nx", "1.5"},
+		{"x as Any is 5\nx is \"s\"\nx", "s"},
+		{"x as Colour is 5", "unknown type: Colour"},
+		{"f is takes(n as Integer) { n times 2 }\nf(4)", "8"},
+		{"f is takes(n as Integer) { n times 2 }\nf(\"4\")", "type error: parameter 'n' expects Integer, got String"},
+		{"f is takes(n as Integer) { n is \"s\" }\nf(1)", "type error: variable 'n' expects Integer, got String"},
+		{"f is takes(n) returns String { return str(n) }\nf(4)", "4"},
+		{"f is takes(n) returns String { return n }\nf(4)", "type error: return value expects String, got Integer"},
+		{"f is takes() returns None { }\nf()", "none"},
+		{"define P as struct { name as String, age }\np is P { name: \"Ann\", age: true }\np.name", "Ann"},
+		{"define P as struct { name as String }\nP { name: 1 }", "type error: field 'name' of P expects String, got Integer"},
+		{"define P as struct { x }\nf is takes(p as P) { p.x }\nf(P { x: 3 })", "3"},
+		{"define P as struct { x }\nf is takes(p as P) { p.x }\nf(3)", "type error: parameter 'p' expects P, got Integer"},
+		{"x as Integer is 1\np is pointing to x\npointing from p is \"s\"", "type error: variable 'x' expects Integer, got String"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%q: got nil", tt.input)
+			continue
+		}
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEnums(t *testing.T) {
+	enums := "define Color as enum { Red, Green, Blue }\n" +
+		"define Shape as enum { Empty, Circle(radius as Number), Rect(w, h) }\n"
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		{"Color.Red", "Color.Red"},
+		{"Color.Red equals Color.Red", "true"},
+		{"Color.Red equals Color.Green", "false"},
+		{"Color.Red not_equals Color.Blue", "true"},
+		{"Color.Purple", "enum Color has no variant Purple"},
+		{"names is []\np is pointing to names\nfor c in Color { pointing from p is append(names, c) }\nnames", "[Color.Red, Color.Green, Color.Blue]"},
+		{"m is { Color.Red: \"stop\", Color.Green: \"go\" }\nm[Color.Green]", "go"},
+		{"Shape.Circle(2)", "Shape.Circle(2)"},
+		{"Shape.Rect(2, 3).h", "3"},
+		{"Shape.Circle(2) equals Shape.Circle(2)", "true"},
+		{"Shape.Circle(2) equals Shape.Circle(3)", "false"},
+		{"m is { Shape.Circle(1): \"unit\" }\nm[Shape.Circle(1)]", "unit"},
+		{"Shape.Rect(1)", "Shape.Rect expects 2 values, got 1"},
+		{"Shape.Circle(\"big\")", "type error: field 'radius' of Shape.Circle expects Number, got String"},
+		{"Shape.Empty.radius", "Shape.Empty has no field radius"},
+		{"f is takes(c as Color) { c }\nf(Color.Blue)", "Color.Blue"},
+		{"f is takes(c as Color) { c }\nf(Shape.Empty)", "type error: parameter 'c' expects Color, got Shape"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(enums + tt.input)
+		if evaluated == nil {
+			t.Errorf("%q: got nil", tt.input)
+			continue
+		}
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	defs := "define User as struct { name, age }\n" +
+		"define Point as struct { x, y }\n" +
+		"define Shape as enum { Empty, Circle(radius), Rect(w, h) }\n"
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		// Literals, alternatives and the fallback arm
+		{"match 2 { when 1, 2 then \"small\" otherwise \"big\" }", "small"},
+		{"match 7 { when 1, 2 then \"small\" otherwise \"big\" }", "big"},
+		{"match \"hi\" { when \"hi\" then 1 when \"bye\" then 2 }", "1"},
+		{"match 'c' { when 'a' then 1 when 'c' then 3 }", "3"},
+		{"match none { when none then \"nothing\" }", "nothing"},
+		{"match -1 { when -1 then \"minus one\" }", "minus one"},
+		{"match 5 { when 1 then 1 }", "none"},
+		// Bindings and guards
+		{"match 5 { when n if n greater 3 then n times 2 when n then n }", "10"},
+		{"match 2 { when n if n greater 3 then n times 2 when n then n }", "2"},
+		{"match 9 { when _ then \"anything\" }", "anything"},
+		{"n is 1\nmatch 2 { when n then n }\nn", "1"},
+		// Struct patterns
+		{"match User { name: \"Ann\", age: 30 } { when User { name: n } then n }", "Ann"},
+		{"match User { name: \"Ann\", age: 30 } { when User { name, age } then name adds str(age) }", "Ann30"},
+		{"match User { name: \"Bo\", age: 3 } { when User { age } if age greater 17 then \"adult\" otherwise \"minor\" }", "minor"},
+		{"match Point { x: 0, y: 4 } { when User { name } then 1 when Point { x: 0, y } then y }", "4"},
+		{"match Point { x: 0, y: 4 } { when User { nme } then 1 }", "struct User has no field nme"},
+		{"match 1 { when Person { name } then 1 }", "unknown struct: Person"},
+		// Array patterns
+		{"match [1, 2, 3] { when [first, ...rest] then rest }", "[2, 3]"},
+		{"match [1] { when [first, ...rest] then rest }", "[]"},
+		{"match [] { when [first, ...rest] then 1 when [] then \"empty\" }", "empty"},
+		{"match [1, 2] { when [a] then 1 when [a, b] then a adds b }", "3"},
+		{"match [1, [2, 3]] { when [a, [b, c]] then a adds b adds c }", "6"},
+		{"match [0, 5] { when [1, x] then x when [0, x] then x times 10 }", "50"},
+		{"match \"ab\" { when [a, b] then 1 otherwise 2 }", "2"},
+		// Map patterns
+		{"match { \"kind\": \"dot\", \"x\": 4 } { when { kind: \"dot\", x } then x }", "4"},
+		{"match { \"x\": 4 } { when { kind } then kind otherwise \"no kind\" }", "no kind"},
+		{"match { 1: \"one\" } { when { 1: word } then word }", "one"},
+		// Enum patterns
+		{"match Shape.Circle(2) { when Shape.Empty then 0 when Shape.Circle(r) then r }", "2"},
+		{"match Shape.Rect(2, 3) { when Shape.Rect(w, h) then w times h }", "6"},
+		{"match Shape.Rect(2, 3) { when Shape.Rect then \"rect\" }", "rect"},
+		{"match Shape.Empty { when Shape.Circle(_) then 1 when Shape.Empty then 0 }", "0"},
+		{"match Shape.Empty { when Shape.Square then 1 }", "enum Shape has no variant Square"},
+		{"match Shape.Empty { when Shape.Circle(a, b) then 1 }", "Shape.Circle expects 1 values, got 2"},
+		// The end form, comma-separated arms and use as a value
+		{"f is takes(v) {\n return match v\n when 0 then \"zero\"\n otherwise \"other\"\n end\n}\nf(0) adds f(1)", "zeroother"},
+		{"x is match 3 when 3 then \"three\", otherwise \"no\" end\nx", "three"},
+		// Returning from inside an arm leaves the enclosing function
+		{"f is takes(v) { match v { when 1 then return \"early\" }\n return \"late\" }\nf(1) adds f(2)", "earlylate"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(defs + tt.input)
+		if evaluated == nil {
+			t.Errorf("%q: got nil", tt.input)
+			continue
+		}
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	defs := "define User as struct { name, age }\n"
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		{"pair is takes() { return [1, 2] }\na, b is pair()\na adds b", "3"},
+		{"a is 1\nb is 2\na, b is b, a\n[a, b]", "[2, 1]"},
+		{"[first, ...rest] is [1, 2, 3]\n[first, rest]", "[1, [2, 3]]"},
+		{"head, ...tail is [\"x\"]\ntail", "[]"},
+		{"[a, [b, c]] is [1, [2, 3]]\na adds b adds c", "6"},
+		{"[_, second] is [1, 2]\nsecond", "2"},
+		{"{ name, age } is User { name: \"Ann\", age: 30 }\nname adds str(age)", "Ann30"},
+		{"{ name, age } is { \"name\": \"Bo\", \"age\": 3 }\nname adds str(age)", "Bo3"},
+		{"{ name: n } is User { name: \"Cy\", age: 1 }\nn", "Cy"},
+		{"User { age } is User { name: \"Di\", age: 9 }\nage", "9"},
+		{"x, y is 1, \"a\"\ny", "a"},
+		// Mismatches are errors and bind nothing
+		{"a, b is [1, 2, 3]", "cannot destructure a, b: expected 2 elements, got 3"},
+		{"a, b is 1, 2, 3", "cannot destructure a, b: expected 2 elements, got 3"},
+		{"[first, ...rest] is []", "cannot destructure [first, ...rest]: expected at least 1 elements, got 0"},
+		{"a, b is 5", "cannot destructure a, b: expected Array, got Integer"},
+		{"{ email } is User { name: \"Ed\", age: 2 }", "cannot destructure { email }: User has no field email"},
+		{"{ email } is { \"name\": \"Ed\" }", "cannot destructure { email }: missing key email"},
+		{"a is 0\ntry { a, b is [1] } catch { a }", "0"},
+		// Declared types still apply to every name bound
+		{"x as Integer is 1\nx, y is \"no\", 2", "type error: variable 'x' expects Integer, got String"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(defs + tt.input)
+		if evaluated == nil {
+			t.Errorf("%q: got nil", tt.input)
+			continue
+		}
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDestructuringErrorPosition(t *testing.T) {
+	evaluated := testEval("x is 1\n  a, b is [1, 2, 3]")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("expected an error, got %T (%+v)", evaluated, evaluated)
+	}
+	if errObj.Line != 2 || errObj.Column != 3 {
+		t.Errorf("expected error at 2:3, got %d:%d", errObj.Line, errObj.Column)
+	}
+}
+
+func TestStructDefinitions(t *testing.T) {
+	defs := "define Point as struct { x is 0, y is 0 }\n" +
+		"define Person as struct { name as String, age as Integer is 0, tags is [] }\n" +
+		"define Employee as struct { ...Person, salary }\n"
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		// Defaults and required fields
+		{"Point { y: 2 }", "Point{x: 0, y: 2}"},
+		{"Point {}", "Point{x: 0, y: 0}"},
+		{"Person { name: \"Ann\" }", "Person{name: Ann, age: 0, tags: []}"},
+		{"Person { age: 3 }", "struct Person requires field name"},
+		{"a is Person { name: \"A\" }\nb is Person { name: \"B\" }\nappend(a.tags, 1)\nb.tags", "[]"},
+		{"define Bad as struct { n as Integer is \"zero\" }\nBad {}", "type error: field 'n' of Bad expects Integer, got String"},
+		// Unknown and repeated fields
+		{"Point { x: 1, z: 2 }", "struct Point has no field z"},
+		{"Point { x: 1, x: 2 }", "field x given twice"},
+		{"define D as struct { a, a }", "struct D declares field a twice"},
+		// Embedding promotes fields
+		{"e is Employee { name: \"Ann\", salary: 10 }\ne.name adds str(e.age)", "Ann0"},
+		{"Employee { name: \"Ann\", salary: 10 }", "Employee{name: Ann, age: 0, tags: [], salary: 10}"},
+		{"p is Person { name: \"Bo\", age: 4 }\nEmployee { Person: p, salary: 1 }", "Employee{name: Bo, age: 4, tags: [], salary: 1}"},
+		{"Employee { Person: Point {}, salary: 1 }", "type error: field 'Person' of Employee expects Person, got Point"},
+		{"Employee { salary: 1 }", "struct Employee requires field name"},
+		{"f is takes(p as Person) { p.name }\nf(Employee { name: \"Cy\", salary: 1 })", "Cy"},
+		{"match Employee { name: \"Di\", salary: 1 } { when Person { name } then name }", "Di"},
+		{"define Named as struct { name }\ndefine Both as struct { ...Person, ...Named }", "struct Both: field name is promoted from both Person and Named"},
+		{"define Manager as struct { ...Employee, name as Integer }\nManager { name: 1, salary: 2 }.name", "1"},
+		{"define X as struct { ...Nothing }", "unknown struct: Nothing"},
+		// Structural equality
+		{"Point { x: 1 } equals Point { x: 1, y: 0 }", "true"},
+		{"Point { x: 1 } equals Point { x: 2 }", "false"},
+		{"Point { x: 1 } not_equals Point { x: 2 }", "true"},
+		{"Person { name: \"A\", tags: [1] } equals Person { name: \"A\", tags: [1] }", "true"},
+		{"Point {} equals Person { name: \"A\" }", "false"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(defs + tt.input)
+		if evaluated == nil {
+			t.Errorf("%q: got nil", tt.input)
+			continue
+		}
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	// Field type errors point at the field given, or at the default that does not fit
+	positions := []struct {
+		input        string
+		line, column int
+	}{
+		{"Person {\n  name: 1\n}", 5, 3},
+		{"define Bad as struct {\n  n as Integer is \"zero\"\n}\nBad {}", 5, 19},
+	}
+	for _, tt := range positions {
+		evaluated := testEval(defs + tt.input)
+		if errObj, ok := evaluated.(*object.Error); !ok || errObj.Line != tt.line || errObj.Column != tt.column {
+			t.Errorf("%q: expected an error at %d:%d, got %#v", tt.input, tt.line, tt.column, evaluated)
+		}
+	}
+}
+
+func TestCompositeComparisons(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		// Structural equality
+		{"[1, [2, 3]] equals [1, [2, 3]]", "true"},
+		{"[1, 2] equals [2, 1]", "false"},
+		{"[1, 2] not_equals [1, 2, 3]", "true"},
+		{"{\"a\": [1], \"b\": 2} equals {\"b\": 2, \"a\": [1]}", "true"},
+		{"{\"a\": 1} equals {\"a\": 2}", "false"},
+		{"'a' equals \"a\"", "true"},
+		{"\"ab\" not_equals 'a'", "true"},
+		{"(1, \"x\") equals (1, \"x\")", "true"},
+		{"[1] equals (1,)", "type mismatch: ARRAY equals TUPLE"},
+		// Ordering
+		{"\"apple\" less \"banana\"", "true"},
+		{"\"b\" greater_equal 'b'", "true"},
+		{"[1, 2] less [1, 3]", "true"},
+		{"[1, 2] greater [1]", "true"},
+		{"[2] less_equal [1, 9]", "false"},
+		{"[[1, 2]] less [[1, 2, 0]]", "true"},
+		{"(1, 2) greater (1, 1)", "true"},
+		{"[1] less [\"a\"]", "cannot compare [1] with [a]"},
+		{"{\"a\": 1} less {\"a\": 2}", "unknown operator: MAP less MAP"},
+		// Tuples
+		{"t is (1, \"x\", 'c')\nt[1]", "x"},
+		{"count((1, 2, 3))", "3"},
+		{"(7,)", "(7,)"},
+		{"a, b is (1, 2)\na adds b", "3"},
+		// Tuples as map keys
+		{"grid is {(0, 0): \"origin\", (1, 2): \"x\"}\ngrid[(1, 2)]", "x"},
+		{"m is {(1, (2, 'c')): 5}\nm[(1, (2, 'c'))]", "5"},
+		{"m is {[1]: 2}", "unusable as map key: ARRAY"},
+		{"m is {(1, [2]): 2}", "unusable as map key: TUPLE"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConstantsAndBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		{"constant PI is 3.14\nPI times 2.0", "6.28"},
+		{"constant PI as Float is 3.14\nPI", "3.14"},
+		{"constant PI is 3.14\nPI is 3", "cannot reassign constant PI"},
+		{"constant PI is 3.14\nconstant PI is 3", "cannot reassign constant PI"},
+		{"constant PI is 3.14\nif true { PI is 3 }", "cannot reassign constant PI"},
+		{"constant PI is 3.14\nPI, e is 3, 2.7", "cannot reassign constant PI"},
+		{"constant N is 1\np is pointing to N\npointing from p is 2", "cannot reassign constant N through a pointer"},
+		{"constant N is 1\nf is takes(N) { N adds 1 }\nf(5)", "6"},
+		{"constant N is 1\nfor N in [7] { N }", "none"},
+		{"constant C as Integer is \"one\"", "type error: variable 'C' expects Integer, got String"},
+		// Builtins
+		{"count is 3", "cannot assign to builtin count; use 'redefine count is ...' to replace it"},
+		{"str, n is 1, 2", "cannot assign to builtin str; use 'redefine str is ...' to replace it"},
+		{"constant show is 1", "cannot declare builtin show as a constant"},
+		{"redefine count is takes(x) { 42 }\ncount([1, 2])", "42"},
+		{"redefine count is takes(x) { 42 }\ncount is 7\ncount", "7"},
+		{"redefine total is 1", "total is not a builtin, so there is nothing to redefine"},
+		{"f is takes(count) { count adds 1 }\nf(1)", "2"},
+		// Frozen values are usable as map keys
+		{"freeze([1, 2])", "[1, 2]"},
+		{"m is {freeze([1, [2]]): \"a\"}\nm[freeze([1, [2]])]", "a"},
+		{"define P as struct { x }\nm is {freeze(P { x: [1] }): 1}\nm[freeze(P { x: [1] })]", "1"},
+		{"m is {freeze({\"a\": 1, \"b\": 2}): 3}\nm[freeze({\"b\": 2, \"a\": 1})]", "3"},
+		{"m is {freeze([1]): 1}\nm[[1]]", "unusable as map key: ARRAY"},
+		{"freeze(5)", "5"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestScopingSemantics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		// Assignment updates the nearest existing binding
+		{"total is 0\nif true { total is total adds 1 }\ntotal", "1"},
+		{"n is 0\nfor i in [1, 2, 3] { n is n adds i }\nn", "6"},
+		{"x is 1\ntry { x is 2 } catch { x is 3 }\nx", "2"},
+		{"x is 1\nmatch 5 { when v then x is v }\nx", "5"},
+		{"x is 1\nif true { if true { x is 7 } }\nx", "7"},
+		{"a, b is 0, 0\nif true { a, b is 1, 2 }\na adds b", "3"},
+		// Names first assigned in a block stay local to it
+		{"if true { fresh is 1 }\nfresh", "identifier not found: fresh"},
+		// Closures update the variables they captured
+		{"count_up is takes() { calls is calls adds 1 }\ncalls is 0\ncount_up()\ncount_up()\ncalls", "2"},
+		{"make is takes() {\n n is 0\n return takes() { n is n adds 1 }\n}\nc is make()\nc()\nc()", "2"},
+		// Parameters and loop variables belong to their own scope
+		{"x is 1\nf is takes(x) { x is x adds 10 }\nf(5)\nx", "1"},
+		{"i is 100\nfor i in [1, 2] { i is i times 2 }\ni", "100"},
+		// let shadows deliberately
+		{"x is 1\nif true { let x is 2\n x is x adds 1 }\nx", "1"},
+		{"x is 1\nf is takes() { let x is \"local\"\n x }\nf() adds str(x)", "local1"},
+		{"let x is 1\nlet x is 2\nx", "2"},
+		{"constant N is 1\nif true { let N is 2\n N }", "2"},
+		{"constant N is 1\nlet N is 2", "cannot reassign constant N"},
+		{"let count is 0", "cannot assign to builtin count; use 'redefine count is ...' to replace it"},
+		// Declared types follow the binding they belong to
+		{"x as Integer is 1\nif true { x is \"s\" }", "type error: variable 'x' expects Integer, got String"},
+		{"x as Integer is 1\nif true { let x is \"s\" }\nx", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestPointerReferences(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		// Variables
+		{"x is 1\np is pointing to x\npointing from p is 2\nx", "2"},
+		{"x is 1\np is pointing to x\nlet x is 2\npointing from p", "dangling pointer: x was declared again after the pointer was taken"},
+		{"x is 1\np is pointing to x\nif true { let x is 5 }\npointing from p is 3\nx", "3"},
+		// Struct fields
+		{"define U as struct { age }\nu is U { age: 1 }\np is pointing to u.age\npointing from p is 2\nu.age", "2"},
+		{"define U as struct { age }\nu is U { age: 1 }\np is pointing to u.age\nu is U { age: 9 }\npointing from p", "1"},
+		{"define U as struct { age as Integer }\nu is U { age: 1 }\np is pointing to u.age\npointing from p is \"x\"", "type error: field 'age' of U expects Integer, got String"},
+		{"define U as struct { age }\nu is U { age: 1 }\npointing to u.name", "struct U has no field name"},
+		{"define U as struct { age }\nu is freeze(U { age: 1 })\np is pointing to u.age\npointing from p is 2", "cannot modify frozen U"},
+		{"define U as struct { age }\nu is U { age: 1 }\npointing to u.age", "pointing to u.age"},
+		// Array elements and map entries
+		{"xs is [1, 2, 3]\np is pointing to xs[1]\npointing from p is 20\nxs", "[1, 20, 3]"},
+		{"xs is [1]\npointing to xs[1]", "cannot point to xs[1]: index out of range"},
+		{"t is (1, 2)\npointing to t[0]", "cannot point into TUPLE"},
+		{"m is {\"a\": 1}\np is pointing to m[\"b\"]\npointing from p", "none"},
+		{"m is {\"a\": 1}\np is pointing to m[\"b\"]\npointing from p is 2\nm[\"b\"]", "2"},
+		{"m is {}\npointing to m[[1]]", "unusable as map key: ARRAY"},
+		// Heap cells, none and chains
+		{"c is new(10)\nd is c\npointing from d is 11\npointing from c", "11"},
+		{"new([1])", "pointing to new cell"},
+		{"c is new(1)\npp is pointing to c\npointing from pointing from pp is 5\npointing from c", "5"},
+		{"define N as struct { next }\nn is N { next: new(0) }\npointing from n.next is 3\npointing from n.next", "3"},
+		{"p is none\npointing from p", "cannot dereference none"},
+		{"p is none\npointing from p is 1", "cannot write through none"},
+		{"x is 1\npointing from x is 2", "'x' is not a pointer"},
+		{"pointing to 3", "can only point to variables, struct fields, array elements and map entries"},
+		// Equality compares locations
+		{"x is 1\np is pointing to x\np equals pointing to x", "true"},
+		{"x is 1\ny is 1\np is pointing to x\np equals pointing to y", "false"},
+		{"xs is [1, 1]\np is pointing to xs[0]\np equals pointing to xs[0]", "true"},
+		{"xs is [1, 1]\np is pointing to xs[0]\np not_equals pointing to xs[1]", "true"},
+		{"m is {}\np is pointing to m[\"k\"]\np equals pointing to m[\"k\"]", "true"},
+		{"new(1) equals new(1)", "false"},
+		{"c is new(1)\nc equals c", "true"},
+		{"new(1) equals none", "false"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	naturals := "naturals is takes() {\n n is 0\n while true {\n  yield n\n  n is n adds 1\n }\n}\n"
+	countdown := "log is []\ncountdown is takes(from) {\n try {\n  while from greater 0 {\n   yield from\n   from is from minus 1\n  }\n } finally {\n  log is append(log, \"closed\")\n }\n}\n"
+
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		{naturals + "naturals()", "generator"},
+		{naturals + "collect(take(naturals(), 4))", "[0, 1, 2, 3]"},
+		{naturals + "collect(take(skip(naturals(), 3), 2))", "[3, 4]"},
+		{naturals + "odd is takes(n) { n modulo 2 equals 1 }\ncollect(take(map(filter(naturals(), odd), takes(n) { n times n }), 3))", "[1, 9, 25]"},
+		{"collect(map([1, 2], str))", "[1, 2]"},
+		{"collect(skip((1, 2, 3), 5))", "[]"},
+		// for-in walks generators lazily
+		{naturals + "total is 0\nfor n in take(naturals(), 5) { total is total adds n }\ntotal", "10"},
+		{naturals + "first is takes() { for n in naturals() { if n greater 2 { return n } } }\nfirst()", "3"},
+		// The body runs only as values are asked for
+		{"ran is false\ng is takes() { ran is true\n yield 1 }\ngen is g()\nran", "false"},
+		// Finally blocks run when the generator ends, and when a loop leaves it early
+		{countdown + "collect(countdown(2))\nlog", "[closed]"},
+		{countdown + "f is takes() { for n in countdown(5) { return n } }\nf()\nlog", "[closed]"},
+		{countdown + "collect(take(countdown(5), 2))\nlog", "[closed]"},
+		{countdown + "g is countdown(3)\ncollect(take(g, 1))\ncollect(g)", "[]"},
+		{countdown + "g is countdown(3)\nfor n in g { n }\ncount(log)", "1"},
+		{countdown + "countdown(5)\nlog", "[]"},
+		// Closures: each call has its own state, and sees the variables it captured
+		{"counter is takes(step) { return takes() { n is 0\n while true { n is n adds step\n yield n } } }\nby2 is counter(2)\nr is (collect(take(by2(), 3)), collect(take(by2(), 2)))\nr", "([2, 4, 6], [2, 4])"},
+		{"g is takes() { yield 1\n return 99\n yield 2 }\ncollect(g())", "[1]"},
+		{"g is takes(n as Integer) returns Generator { yield n }\ncollect(g(1))", "[1]"},
+		{"g is takes() returns Integer { yield 1 }\ng()", "type error: return value expects Integer, got Generator"},
+		// Errors
+		{"g is takes() { yield 1\n yield 1 divides 0 }\ntotal is 0\nfor n in g() { total is total adds n }", "division by zero"},
+		{"g is takes() { yield 1\n yield 1 divides 0 }\ncollect(g())", "division by zero"},
+		{"collect(map([1], takes(x) { x adds \"s\" }))", "type mismatch: INTEGER adds STRING"},
+		{"take(5, 1)", "first argument to `take` must be iterable, got INTEGER"},
+		{"skip([1], -1)", "second argument to `skip` must be a non-negative INTEGER, got -1"},
+		{"filter([1], 2)", "second argument to `filter` must be a function, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		{"square is takes(n) { n times n }\nt is spawn square(4)\nwait(t)", "16"},
+		{"square is takes(n) { n times n }\nwait_all([spawn square(1), spawn square(2), spawn square(3)])", "[1, 4, 9]"},
+		{"t is spawn count([1, 2])\nwait(t)", "2"},
+		{"f is takes() { }\nwait(spawn f())", "none"},
+		{"t is spawn str(1)\nwait(t)\nt", "task (done)"},
+		// Failures surface when the task is waited for
+		{"f is takes(n as Integer) { n }\nt is spawn f(\"s\")\nwait(t)", "type error: parameter 'n' expects Integer, got String"},
+		{"f is takes(n) { 1 divides n }\nwait_all([spawn f(1), spawn f(0)])", "division by zero"},
+		{"x is 3\nspawn x()", "cannot spawn INTEGER: not a function"},
+		{"wait(3)", "argument to `wait` must be TASK, got INTEGER"},
+		// Channels
+		{"ch is channel(2)\nsend(ch, 1)\nsend(ch, 2)\nclose(ch)\ncollect(ch)", "[1, 2]"},
+		{"ch is channel()\nspawn send(ch, \"hi\")\nreceive(ch)", "hi"},
+		{"ch is channel(1)\nclose(ch)\nreceive(ch)", "none"},
+		{"ch is channel(1)\nclose(ch)\nsend(ch, 1)", "send on a closed channel"},
+		{"ch is channel()\nclose(ch)\nclose(ch)", "channel is already closed"},
+		{"channel(-1)", "capacity of a channel must be a non-negative INTEGER, got -1"},
+		{"produce is takes(out) {\n for i in [1, 2, 3] { send(out, i) }\n close(out)\n}\nch is channel()\nspawn produce(ch)\ntotal is 0\nfor n in ch { total is total adds n }\ntotal", "6"},
+		// Tasks share the scopes they were spawned from
+		{"results is channel(3)\nwork is takes(n) { send(results, n times 10) }\nwait_all([spawn work(1), spawn work(2), spawn work(3)])\nclose(results)\ntotal is 0\nfor r in results { total is total adds r }\ntotal", "60"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestSharedValuesAcrossTasks has tasks read and write one map, array, struct instance and
+// cell at the same time. Run it with -race: composite values must lock themselves.
+func TestSharedValuesAcrossTasks(t *testing.T) {
+	input := `
+define Counter as struct { hits }
+counts is {}
+slots is [0, 0, 0, 0, 0, 0, 0, 0]
+counter is Counter { hits: 0 }
+cell is new(0)
+worker is takes(id) {
+	for i in [0, 1, 2, 3, 4, 5, 6, 7] {
+		pointing from pointing to counts[str(id) adds "-" adds str(i)] is i
+		pointing from pointing to slots[i] is id
+		pointing from pointing to counter.hits is i
+		pointing from cell is id
+		seen is str(counts) adds str(slots) adds str(counter)
+		for s in slots { seen is s }
+		same is (slots equals [id]) or (counts equals {})
+	}
+	return id
+}
+wait_all([spawn worker(1), spawn worker(2), spawn worker(3), spawn worker(4)])
+freeze(counts)
+count(slots) adds counter.hits adds pointing from cell times 0`
+
+	evaluated := testEval(input)
+	testIntegerObject(t, evaluated, 15) // 8 slots, and the last write to hits is 7
+
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+	counts, _ := env.Get("counts")
+	if m, ok := counts.(*object.Map); !ok || m.Len() != 32 {
+		t.Errorf("expected 32 entries written by 4 tasks, got %s", counts.Inspect())
+	}
+}
+
+// TestGeneratorSharedAcrossTasks has two tasks pull from one generator. Run it with -race:
+// every value must be handed to exactly one of them.
+func TestGeneratorSharedAcrossTasks(t *testing.T) {
+	generators := `
+numbers is takes(n) {
+	i is 0
+	while i less n {
+		yield i
+		i is i adds 1
+	}
+}
+pull is takes(g) {
+	sum is 0
+	for v in g { sum is sum adds v }
+	return sum
+}
+`
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{generators + "g is numbers(200)\nfirst is spawn pull(g)\nsecond is spawn pull(g)\nwait(first) adds wait(second)", 19900},
+		{generators + "g is map(numbers(200), takes(x) { x times 2 })\nfirst is spawn pull(g)\nsecond is spawn pull(g)\nwait(first) adds wait(second)", 39800},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestTailCallsAndRecursionDepth(t *testing.T) {
+	loop := "loop is takes(n, total) {\n if n equals 0 { return total }\n return loop(n minus 1, total adds n)\n}\n"
+	deep := "deep is takes(n) {\n if n equals 0 { return 0 }\n return 1 adds deep(n minus 1)\n}\n"
+	tests := []struct {
+		input    string
+		expected string // Error message, or the Inspect() of the result
+	}{
+		// Tail recursion goes far deeper than the call depth limit
+		{loop + "loop(100000, 0)", "5000050000"},
+		{"even is takes(n) { if n equals 0 { return true }\n return odd(n minus 1) }\nodd is takes(n) { if n equals 0 { return false }\n return even(n minus 1) }\neven(50001)", "false"},
+		{"f is takes(n) { return str(n) }\nf(4)", "4"},
+		{deep + "deep(500)", "500"},
+		// Too deep: a catchable error
+		{deep + "deep(20000)", "maximum recursion depth exceeded (10000 calls)"},
+		{deep + "r is 0\ntry { r is deep(20000) } catch { r is -1 }\nr", "-1"},
+		// Builtins that call functions back count as deep as the code calling them
+		{"walk is takes(n) { return collect(map([n], takes(x) { return walk(x adds 1) })) }\nr is 0\ntry { walk(0) } catch { r is -1 }\nr", "-1"},
+		{"walk is takes(n) { return collect(filter([n], takes(x) { walk(x adds 1) })) }\nwalk(0)", "maximum recursion depth exceeded (10000 calls)"},
+		{"walk is takes() { assert_throws(walk) }\nwalk()", "assertion failed: expected an error to be thrown, got none"},
+		// Return types are checked for every function a tail call leaves
+		{"f is takes(n) returns Integer { return g(n) }\ng is takes(n) { return str(n) }\nf(1)", "type error: return value expects Integer, got String"},
+		{"f is takes(n) returns Integer { if n equals 0 { return 0 }\n return f(n minus 1) }\nf(50000)", "0"},
+		// A return inside try is not a tail call, so the error is still caught
+		{"boom is takes() { 1 divides 0 }\nf is takes() { try { return boom() } catch { return \"caught\" } }\nf()", "caught"},
+		{"f is takes() { return 3() }\nf()", "not a function: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		got := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			got = errObj.Message
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	evaluated := testEval("f is takes() {\n return g(1)\n}\ng is takes(n as String) { n }\nf()")
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Line != 2 || errObj.Column != 10 {
+		t.Errorf("expected an error at the tail call (2:10), got %#v", evaluated)
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     int
+		finished string // Value of "done" once the program ended (or "unset")
+	}{
+		{"done is 1\nexit(3)\ndone is 2", 3, "1"},
+		{"done is 0\nexit()", 0, "0"},
+		// exit() is not caught by try, but finally still runs
+		{"done is 0\ntry { exit(4) } catch { done is -1 } finally { done is 9 }\ndone is 2", 4, "9"},
+		{"done is 0\nf is takes() { exit(5) }\ncollect(map([1, 2], takes(x) { f() }))\ndone is 2", 5, "0"},
+		{"done is 0\nf is takes() { exit(7) }\nwait(spawn f())\ndone is 2", 7, "0"},
+		{"done is 0\nassert_throws(takes() { exit(6) })\ndone is 2", 6, "0"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		evaluated := Eval(program, env)
+		code, ok := object.ExitCode(evaluated)
+		if !ok || code != tt.code {
+			t.Errorf("%q: expected exit(%d), got %#v", tt.input, tt.code, evaluated)
+			continue
+		}
+		if done, _ := env.Get("done"); done == nil || done.Inspect() != tt.finished {
+			t.Errorf("%q: expected done to be %s, got %v", tt.input, tt.finished, done)
+		}
+	}
+}
+
+// recordingHook records the calls and returns it sees.
+type recordingHook struct {
+	events []string
+	nodes  int
+}
+
+func (h *recordingHook) Enter(node ast.Node, env *object.Environment) { h.nodes++ }
+func (h *recordingHook) Leave(node ast.Node, env *object.Environment, result object.Object) {
+}
+func (h *recordingHook) Call(fn *object.Function, args []object.Object, env, caller *object.Environment) {
+	h.events = append(h.events, fmt.Sprintf("call %s(%s)", fn.Name, args[0].Inspect()))
+}
+func (h *recordingHook) Return(fn *object.Function, result object.Object, env *object.Environment) {
+	h.events = append(h.events, "return "+fn.Name+" "+result.Inspect())
+}
+
+func TestHook(t *testing.T) {
+	h := &recordingHook{}
+	SetHook(h)
+	result := testEval("inc is takes(n) { n adds 1 }\nf is takes(n) { return inc(n) }\nf(1)")
+	if old := SetHook(nil); old != h {
+		t.Errorf("SetHook should return the hook it replaces")
+	}
+	testIntegerObject(t, result, 2)
+
+	// The tail call ends f before inc starts
+	expected := []string{"call f(1)", "return f tail call", "call inc(1)", "return inc 2"}
+	if fmt.Sprint(h.events) != fmt.Sprint(expected) {
+		t.Errorf("expected events %v, got %v", expected, h.events)
+	}
+	if h.nodes == 0 {
+		t.Errorf("expected the hook to see the evaluated nodes")
+	}
+}
+
+// TestJSONRoundTripEvaluates runs programs decoded from the JSON of their syntax tree.
+func TestJSONRoundTripEvaluates(t *testing.T) {
+	defs := "define User as struct { name, age as Integer }\n" +
+		"define Shape as enum { Empty, Circle(radius), Rect(w, h) }\n"
+	tests := []string{
+		"let x as Integer is 5\nconstant LIMIT is 2.5\ny_of is takes(n) { return n }\nx, y is y_of(x), 'c'\n[x, y, LIMIT]",
+		"add is takes(a, b) { return a adds b }\nadd(1, 2) times -3",
+		"fact is takes(n, acc) { if n less 2 { return acc } else { return fact(n minus 1, acc times n) } }\nfact(10, 1)",
+		"u is User { name: \"Ann\", age: 30 }\nm is { \"k\": u.name, 1: (1, 2) }\n[m[\"k\"], m[1], u.age]",
+		"match Shape.Rect(2, 3) { when Shape.Empty then 0 when Shape.Rect(w, h) if w greater 1 then w times h otherwise -1 }",
+		"match { \"x\": [1, 2, 3] } { when { x: [first, ...rest] } then rest }",
+		"{ name } is User { name: \"Bo\", age: 3 }\nname",
+		"total is 0\nfor s in [1, 2, 3] { total is total adds s }\nwhile total greater 4 { total is total minus 4 }\ntotal",
+		"xs is [1, 2]\np is pointing to xs[0]\npointing from p is 9\n[xs, pointing from p]",
+		"r is 0\ntry { r is 1 divides 0 } catch { r is \"caught\" } finally { r is r adds \"!\" }\nr",
+		"gen is takes() { n is 0\n while true { yield n\n n is n adds 1 } }\ncollect(take(gen(), 3))",
+		"task is spawn takes(a) { return a times 2 }(21)\nwait(task)",
+		"[not (true and false), none equals none, 3.5 divides 2.0]",
+	}
+	for _, input := range tests {
+		input = defs + input
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			t.Errorf("%q: parser errors: %v", input, p.Errors())
+			continue
+		}
+		data, err := ast.ToJSON(program)
+		if err != nil {
+			t.Errorf("%q: ToJSON: %s", input, err)
+			continue
+		}
+		decoded, err := ast.ProgramFromJSON(data)
+		if err != nil {
+			t.Errorf("%q: ProgramFromJSON: %s", input, err)
+			continue
+		}
+		if decoded.String() != program.String() {
+			t.Errorf("%q: decoded program reads %q", input, decoded.String())
+		}
+		expected := Eval(program, object.NewEnvironment()).Inspect()
+		if got := Eval(decoded, object.NewEnvironment()).Inspect(); got != expected {
+			t.Errorf("%q: expected %s, decoded program gave %s", input, expected, got)
+		}
+	}
+}
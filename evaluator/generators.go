@@ -0,0 +1,94 @@
+// ==============================================================================================
+// FILE: evaluator/generators.go
+// ==============================================================================================
+// PACKAGE: evaluator
+// PURPOSE: Runs generator functions (functions whose body contains yield).
+//          Calling one returns a lazy object.Generator; the body only runs as values are asked
+//          for, pausing at each yield until the consumer wants the next value.
+// ==============================================================================================
+
+package evaluator
+
+import (
+	"eloquence/ast"
+	"eloquence/object"
+)
+
+// newGenerator wraps the body of a generator call, with its parameters already bound in env.
+//
+// The body runs on its own goroutine, started by the first Next. Each yield hands one value
+// over and waits to be resumed, so the body and its consumer never run at the same time.
+// Closing the generator early resumes the body with a stop signal: the pending yield then
+// behaves like a return, which unwinds the body and runs the finally blocks it is inside of.
+// The object.Generator never runs next and stop at the same time, so tasks sharing it take turns.
+func newGenerator(body *ast.BlockStatement, env *object.Environment) *object.Generator {
+	values := make(chan object.Object) // Yielded values; a final error; closed when the body ends
+	resume := make(chan bool)          // true asks for the next value, false stops the body
+	started, finished, stopping := false, false, false
+
+	env.SetYielder(func(val object.Object) bool {
+		if stopping {
+			return false // A yield in a finally block while closing
+		}
+		values <- val
+		return <-resume
+	})
+
+	run := func() {
+		defer close(values)
+		if result := Eval(body, env); isError(result) {
+			values <- result
+		}
+	}
+
+	next := func() (object.Object, bool) {
+		if finished {
+			return nil, false
+		}
+		if !started {
+			started = true
+			go run()
+		} else {
+			resume <- true
+		}
+		val, ok := <-values
+		if !ok || isError(val) {
+			finished = true
+			if ok {
+				<-values // Wait for the body to end after its error
+			}
+		}
+		return val, ok
+	}
+
+	stop := func() {
+		if !started || finished {
+			finished = true
+			return
+		}
+		finished, stopping = true, true
+		resume <- false
+		for range values {
+			// Drain a final error; the body has ended once values is closed
+		}
+	}
+
+	return &object.Generator{NextFn: next, CloseFn: stop}
+}
+
+// evalYield hands a value to the consumer of the running generator. When the generator has
+// been closed, the yield returns from the generator body instead.
+func evalYield(node *ast.YieldStatement, env *object.Environment) object.Object {
+	val := Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	yield := env.Yielder()
+	if yield == nil {
+		return newError("yield outside a generator")
+	}
+	if !yield(val) {
+		return &object.ReturnValue{Value: NULL}
+	}
+	return NULL
+}
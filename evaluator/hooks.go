@@ -0,0 +1,95 @@
+// ==============================================================================================
+// FILE: evaluator/hooks.go
+// ==============================================================================================
+// PACKAGE: evaluator
+// PURPOSE: The hook point for tools that watch a program run (profiling, coverage, tracing).
+//          A Hook sees every node as it is evaluated and every function call as it starts and
+//          ends. With no hook installed the evaluator pays for a single nil check per node.
+// ==============================================================================================
+
+package evaluator
+
+import (
+	"sync/atomic"
+
+	"eloquence/ast"
+	"eloquence/object"
+)
+
+// Hook observes a running program. Tasks started with spawn run at the same time as the rest
+// of the program, so a Hook must be safe for concurrent use.
+type Hook interface {
+	// Enter is called before node is evaluated in env, Leave after it with the result.
+	Enter(node ast.Node, env *object.Environment)
+	Leave(node ast.Node, env *object.Environment, result object.Object)
+
+	// Call is called when fn starts, once its arguments are bound in env, the scope of the call.
+	// caller is the scope the call was made from; it is nil for calls made by builtins and spawn.
+	Call(fn *object.Function, args []object.Object, env, caller *object.Environment)
+
+	// Return is called when the call running in env ends. A call that ends with a tail call
+	// returns an *object.TailCall, and the tail call follows as a call of its own.
+	Return(fn *object.Function, result object.Object, env *object.Environment)
+}
+
+// A LoadHook is a Hook that is also told about every program `include` loads, before it runs.
+type LoadHook interface {
+	Hook
+	Load(file string, program *ast.Program)
+}
+
+var hook atomic.Pointer[Hook]
+
+// SetHook installs h for every evaluation that follows (nil removes it) and returns the hook
+// it replaces.
+func SetHook(h Hook) Hook {
+	var old *Hook
+	if h == nil {
+		old = hook.Swap(nil)
+	} else {
+		old = hook.Swap(&h)
+	}
+	if old == nil {
+		return nil
+	}
+	return *old
+}
+
+// Hooks combines several hooks into one that calls each of them in turn.
+func Hooks(hooks ...Hook) Hook {
+	return multiHook(hooks)
+}
+
+type multiHook []Hook
+
+func (m multiHook) Enter(node ast.Node, env *object.Environment) {
+	for _, h := range m {
+		h.Enter(node, env)
+	}
+}
+
+func (m multiHook) Leave(node ast.Node, env *object.Environment, result object.Object) {
+	for _, h := range m {
+		h.Leave(node, env, result)
+	}
+}
+
+func (m multiHook) Call(fn *object.Function, args []object.Object, env, caller *object.Environment) {
+	for _, h := range m {
+		h.Call(fn, args, env, caller)
+	}
+}
+
+func (m multiHook) Return(fn *object.Function, result object.Object, env *object.Environment) {
+	for _, h := range m {
+		h.Return(fn, result, env)
+	}
+}
+
+func (m multiHook) Load(file string, program *ast.Program) {
+	for _, h := range m {
+		if lh, ok := h.(LoadHook); ok {
+			lh.Load(file, program)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// ==============================================================================================
+// FILE: evaluator/patterns.go
+// ==============================================================================================
+// PACKAGE: evaluator
+// PURPOSE: Evaluates match expressions and matches values against patterns.
+//          Matching a pattern both tests the shape of a value and binds the names inside
+//          the pattern to the matching parts of it.
+// ==============================================================================================
+
+package evaluator
+
+import (
+	"fmt"
+
+	"eloquence/ast"
+	"eloquence/object"
+	"eloquence/token"
+)
+
+// ----------------------------------------------------------------------------------------------
+// MATCH EXPRESSIONS
+// ----------------------------------------------------------------------------------------------
+
+// evalMatchExpression runs the first arm with a pattern that fits the subject and whose guard holds.
+// Each attempt gets a fresh scope, so bindings from a failed pattern never leak into the next arm.
+// Without a matching arm or an otherwise arm the result is none.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		for _, pattern := range arm.Patterns {
+			armEnv := object.NewEnclosedEnvironment(env)
+			mismatch, err := matchPattern(pattern, subject, armEnv)
+			if err != nil {
+				return err
+			}
+			if mismatch != "" {
+				continue
+			}
+			if arm.Guard != nil {
+				guard := Eval(arm.Guard, armEnv)
+				if isError(guard) {
+					return guard
+				}
+				if !isTruthy(guard) {
+					continue
+				}
+			}
+			return Eval(arm.Body, armEnv)
+		}
+	}
+
+	if me.Otherwise != nil {
+		return Eval(me.Otherwise, object.NewEnclosedEnvironment(env))
+	}
+	return NULL
+}
+
+// ----------------------------------------------------------------------------------------------
+// DESTRUCTURING
+// ----------------------------------------------------------------------------------------------
+
+// evalDestructuring binds the names of a pattern from one value ("a, b is pair") or from
+// several values packed into an array ("a, b is b, a"). All values are evaluated before any
+// name is bound, so swapping works. A value of the wrong shape is an error that binds nothing.
+func evalDestructuring(node *ast.DestructuringStatement, env *object.Environment) object.Object {
+	values := evalExpressions(node.Values, env)
+	if len(values) == 1 && isError(values[0]) {
+		return values[0]
+	}
+	val := values[0]
+	if len(values) > 1 {
+		val = &object.Array{Elements: values}
+	}
+
+	scratch := object.NewEnclosedEnvironment(env)
+	mismatch, err := matchPattern(node.Pattern, val, scratch)
+	if err != nil {
+		return err
+	}
+	if mismatch != "" {
+		errObj := newError("cannot destructure %s: %s", node.Pattern.String(), mismatch)
+		errObj.Line, errObj.Column = node.Token.Line, node.Token.Column
+		return errObj
+	}
+
+	for _, name := range patternNames(node.Pattern) {
+		bound, _ := scratch.Get(name.Value)
+		if result := assign(name, nil, bound, env); isError(result) {
+			return result
+		}
+	}
+	return val
+}
+
+// patternNames lists the names a pattern binds, in source order.
+func patternNames(pattern ast.Pattern) []*ast.Identifier {
+	var names []*ast.Identifier
+	switch p := pattern.(type) {
+	case *ast.BindingPattern:
+		if !p.IsWildcard() {
+			names = append(names, p.Name)
+		}
+	case *ast.ArrayPattern:
+		for _, el := range p.Elements {
+			names = append(names, patternNames(el)...)
+		}
+		if p.Rest != nil && p.Rest.Value != "_" {
+			names = append(names, p.Rest)
+		}
+	case *ast.MapPattern:
+		for _, e := range p.Entries {
+			names = append(names, patternNames(e.Value)...)
+		}
+	case *ast.StructPattern:
+		for _, f := range p.Fields {
+			names = append(names, patternNames(f.Value)...)
+		}
+	case *ast.EnumPattern:
+		for _, a := range p.Args {
+			names = append(names, patternNames(a)...)
+		}
+	}
+	return names
+}
+
+// ----------------------------------------------------------------------------------------------
+// PATTERN MATCHING
+// ----------------------------------------------------------------------------------------------
+
+// matchPattern matches val against a pattern, binding names into env as it goes.
+// It returns a description of the first mismatch ("" when the value matches) and an error
+// when the pattern itself is invalid, such as a struct pattern naming an unknown field.
+func matchPattern(pattern ast.Pattern, val object.Object, env *object.Environment) (string, *object.Error) {
+	switch p := pattern.(type) {
+	case *ast.BindingPattern:
+		if !p.IsWildcard() {
+			env.Set(p.Name.Value, val)
+		}
+		return "", nil
+
+	case *ast.LiteralPattern:
+		lit := Eval(p.Value, env)
+		if errObj, ok := lit.(*object.Error); ok {
+			return "", errObj
+		}
+		if !object.Equal(lit, val) {
+			return fmt.Sprintf("expected %s, got %s", lit.Inspect(), val.Inspect()), nil
+		}
+		return "", nil
+
+	case *ast.ArrayPattern:
+		return matchArray(p, val, env)
+
+	case *ast.MapPattern:
+		return matchMap(p, val, env)
+
+	case *ast.StructPattern:
+		return matchStruct(p, val, env)
+
+	case *ast.EnumPattern:
+		return matchEnum(p, val, env)
+	}
+	return "", newError("invalid pattern: %s", pattern.String())
+}
+
+// matchArray matches arrays and tuples element by element; a rest name always binds an array.
+func matchArray(p *ast.ArrayPattern, val object.Object, env *object.Environment) (string, *object.Error) {
+	var elements []object.Object
+	switch val := val.(type) {
+	case *object.Array:
+		elements = val.Values()
+	case *object.Tuple:
+		elements = val.Elements
+	default:
+		return "expected Array, got " + object.TypeName(val), nil
+	}
+	n := len(p.Elements)
+	if p.Rest == nil && len(elements) != n {
+		return fmt.Sprintf("expected %d elements, got %d", n, len(elements)), nil
+	}
+	if len(elements) < n {
+		return fmt.Sprintf("expected at least %d elements, got %d", n, len(elements)), nil
+	}
+
+	for i, el := range p.Elements {
+		if mismatch, err := matchPattern(el, elements[i], env); mismatch != "" || err != nil {
+			return mismatch, err
+		}
+	}
+	if p.Rest != nil && p.Rest.Value != "_" {
+		rest := make([]object.Object, len(elements)-n)
+		copy(rest, elements[n:])
+		env.Set(p.Rest.Value, &object.Array{Elements: rest})
+	}
+	return "", nil
+}
+
+// matchMap matches maps by key and struct instances by field name ({ name, age } is user).
+func matchMap(p *ast.MapPattern, val object.Object, env *object.Environment) (string, *object.Error) {
+	if inst, ok := val.(*object.StructInstance); ok {
+		return matchFields(p, inst, env)
+	}
+	m, ok := val.(*object.Map)
+	if !ok {
+		return "expected Map, got " + object.TypeName(val), nil
+	}
+
+	for _, entry := range p.Entries {
+		var key object.Object
+		if ident, ok := entry.Key.(*ast.Identifier); ok {
+			key = &object.String{Value: ident.Value}
+		} else {
+			key = Eval(entry.Key, env)
+		}
+		hashKey, ok := object.HashKeyOf(key)
+		if !ok {
+			return "", patternError(entry.Key, "unusable as map key: %s", key.Type())
+		}
+		pair, ok := m.Get(hashKey)
+		if !ok {
+			return "missing key " + key.Inspect(), nil
+		}
+		if mismatch, err := matchPattern(entry.Value, pair.Value, env); mismatch != "" || err != nil {
+			return mismatch, err
+		}
+	}
+	return "", nil
+}
+
+func matchFields(p *ast.MapPattern, inst *object.StructInstance, env *object.Environment) (string, *object.Error) {
+	for _, entry := range p.Entries {
+		var name string
+		switch key := entry.Key.(type) {
+		case *ast.Identifier:
+			name = key.Value
+		case *ast.StringLiteral:
+			name = key.Value
+		default:
+			return "struct fields have names, not " + key.String(), nil
+		}
+		field, ok := inst.Field(name)
+		if !ok {
+			return inst.Definition.Name + " has no field " + name, nil
+		}
+		if mismatch, err := matchPattern(entry.Value, field, env); mismatch != "" || err != nil {
+			return mismatch, err
+		}
+	}
+	return "", nil
+}
+
+// matchStruct matches instances of exactly the named StructDefinition.
+func matchStruct(p *ast.StructPattern, val object.Object, env *object.Environment) (string, *object.Error) {
+	obj, ok := env.Get(p.Name.Value)
+	if !ok {
+		return "", patternError(p.Name, "unknown struct: %s", p.Name.Value)
+	}
+	def, ok := obj.(*object.StructDefinition)
+	if !ok {
+		return "", patternError(p.Name, "%s is not a struct", p.Name.Value)
+	}
+	for _, field := range p.Fields {
+		if !def.HasField(field.Key.String()) {
+			return "", patternError(field.Key, "struct %s has no field %s", def.Name, field.Key.String())
+		}
+	}
+
+	inst, ok := val.(*object.StructInstance)
+	if !ok || !inst.Definition.Includes(def.Name) {
+		return "expected " + def.Name + ", got " + object.TypeName(val), nil
+	}
+	for _, field := range p.Fields {
+		value, _ := inst.Field(field.Key.String())
+		if mismatch, err := matchPattern(field.Value, value, env); mismatch != "" || err != nil {
+			return mismatch, err
+		}
+	}
+	return "", nil
+}
+
+// matchEnum matches one variant. Without parentheses the associated values are not inspected.
+func matchEnum(p *ast.EnumPattern, val object.Object, env *object.Environment) (string, *object.Error) {
+	obj, ok := env.Get(p.Enum.Value)
+	if !ok {
+		return "", patternError(p.Enum, "unknown enum: %s", p.Enum.Value)
+	}
+	def, ok := obj.(*object.EnumDefinition)
+	if !ok {
+		return "", patternError(p.Enum, "%s is not an enum", p.Enum.Value)
+	}
+	variant, ok := def.Variant(p.Variant.Value)
+	if !ok {
+		return "", patternError(p.Variant, "enum %s has no variant %s", def.Name, p.Variant.Value)
+	}
+	if p.Args != nil && len(p.Args) != len(variant.Fields) {
+		return "", patternError(p.Variant, "%s.%s expects %d values, got %d",
+			def.Name, variant.Name, len(variant.Fields), len(p.Args))
+	}
+
+	ev, ok := val.(*object.EnumValue)
+	if !ok || ev.Variant != variant {
+		return "expected " + def.Name + "." + variant.Name + ", got " + val.Inspect(), nil
+	}
+	for i, arg := range p.Args {
+		if mismatch, err := matchPattern(arg, ev.Values[i], env); mismatch != "" || err != nil {
+			return mismatch, err
+		}
+	}
+	return "", nil
+}
+
+// patternError reports an invalid pattern at the position of the offending part of it.
+func patternError(node ast.Node, format string, a ...interface{}) *object.Error {
+	err := newError(format, a...)
+	if tok, ok := nodeToken(node); ok {
+		err.Line, err.Column = tok.Line, tok.Column
+	}
+	return err
+}
+
+func nodeToken(node ast.Node) (token.Token, bool) {
+	switch n := node.(type) {
+	case *ast.Identifier:
+		return n.Token, true
+	case *ast.StringLiteral:
+		return n.Token, true
+	case *ast.IntegerLiteral:
+		return n.Token, true
+	}
+	return token.Token{}, false
+}
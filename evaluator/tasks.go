@@ -0,0 +1,47 @@
+// ==============================================================================================
+// FILE: evaluator/tasks.go
+// ==============================================================================================
+// PACKAGE: evaluator
+// PURPOSE: Runs `spawn f(args)`: the function and its arguments are evaluated right away,
+//          then the call itself runs on its own goroutine and a task handle is returned.
+//          Environments, arrays, maps and struct instances lock themselves, so the call may
+//          share scopes and values with its spawner.
+// ==============================================================================================
+
+package evaluator
+
+import (
+	"eloquence/ast"
+	"eloquence/object"
+)
+
+func evalSpawn(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	fn := Eval(node.Call.Function, env)
+	if isError(fn) {
+		return fn
+	}
+	switch fn.(type) {
+	case *object.Function, *object.Builtin, *object.EnumVariant:
+	default:
+		return newError("cannot spawn %s: not a function", fn.Type())
+	}
+	args := evalExpressions(node.Call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	task := object.NewTask()
+	go func() {
+		result := applyFunction(fn, args, 0)
+		if result == nil {
+			result = NULL // A body without statements returns none
+		}
+		// Attach the spawn site to errors that do not know where they came from yet
+		if errObj, ok := result.(*object.Error); ok && errObj.Line == 0 {
+			errObj.Line = node.Call.Token.Line
+			errObj.Column = node.Call.Token.Column
+		}
+		task.Finish(result)
+	}()
+	return task
+}
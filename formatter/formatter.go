@@ -0,0 +1,589 @@
+// ==============================================================================================
+// FILE: formatter/formatter.go
+// ==============================================================================================
+// PACKAGE: formatter
+// PURPOSE: Prints an AST back out as canonical Eloquence source code (used by `eloquence fmt`).
+//          Unlike ast.Node.String(), the output is valid, re-parsable source: blocks keep
+//          their braces, strings are re-escaped and parentheses are only added where the
+//          operator precedence requires them. Comments recorded by the Lexer are preserved.
+// ==============================================================================================
+
+package formatter
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"eloquence/ast"
+	"eloquence/lexer"
+	"eloquence/parser"
+	"eloquence/token"
+)
+
+const (
+	indentUnit = "    " // Four spaces, matching the style of the examples in SYNTAX.md
+	lineWidth  = 80     // Collections longer than this are split over several lines
+)
+
+// precedence mirrors the parser's binding powers for infix operators, keyed by operator text.
+var precedence = map[string]int{
+	"equals": 2, "not_equals": 2,
+	"less": 3, "greater": 3, "less_equal": 3, "greater_equal": 3, "and": 3, "or": 3,
+	"adds": 4, "subtracts": 4, "minus": 4, "-": 4,
+	"times": 5, "divides": 5, "modulo": 5,
+}
+
+const (
+	lowestPrec = 1
+	prefixPrec = 6
+)
+
+// Source parses and formats a complete source file.
+// If the source does not parse, the parser errors are returned and the output is empty.
+func Source(src string) (string, []string) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", p.Errors()
+	}
+	return Format(program, l.Comments()), nil
+}
+
+// Format renders a program, interleaving the given comments before the statements they precede.
+func Format(program *ast.Program, comments []token.Token) string {
+	f := &printer{out: &bytes.Buffer{}, comments: comments}
+	f.statements(program.Statements)
+	f.flushComments(int(^uint(0) >> 1))
+	return strings.TrimLeft(f.out.String(), "\n")
+}
+
+// printer accumulates formatted output.
+type printer struct {
+	out      *bytes.Buffer
+	indent   int
+	comments []token.Token // Comments not yet printed
+	lastLine int           // Source line of the previously printed statement
+}
+
+func (f *printer) line(s string) {
+	f.out.WriteString(strings.Repeat(indentUnit, f.indent))
+	f.out.WriteString(s)
+	f.out.WriteString("\n")
+}
+
+// flushComments prints every pending comment that starts on or before the given source line.
+func (f *printer) flushComments(line int) {
+	for len(f.comments) > 0 && f.comments[0].Line <= line {
+		c := f.comments[0]
+		f.comments = f.comments[1:]
+		f.blankLineBefore(c.Line)
+		// Only the first line is re-indented; block comment bodies are kept verbatim
+		lines := strings.Split(c.Literal, "\n")
+		f.line(strings.TrimSpace(lines[0]))
+		for _, text := range lines[1:] {
+			f.out.WriteString(strings.TrimRight(text, " \t\r") + "\n")
+		}
+		f.lastLine = c.Line + strings.Count(c.Literal, "\n")
+	}
+}
+
+// blankLineBefore keeps a single blank line where the original source had one or more.
+func (f *printer) blankLineBefore(line int) {
+	if f.lastLine != 0 && line > f.lastLine+1 {
+		f.out.WriteString("\n")
+	}
+}
+
+func (f *printer) statements(stmts []ast.Statement) {
+	for _, s := range stmts {
+		line := statementLine(s)
+		f.flushComments(line)
+		f.blankLineBefore(line)
+		before := f.out.Len()
+		f.statement(s)
+		if line != 0 {
+			// Without end positions, assume the statement spans as many lines as it printed
+			f.lastLine = line + bytes.Count(f.out.Bytes()[before:], []byte("\n")) - 1
+		}
+	}
+}
+
+func (f *printer) block(b *ast.BlockStatement) {
+	f.indent++
+	f.lastLine = 0
+	if b != nil {
+		f.statements(b.Statements)
+	}
+	f.indent--
+}
+
+// ----------------------------------------------------------------------------------------------
+// STATEMENTS
+// ----------------------------------------------------------------------------------------------
+
+func (f *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.AssignmentStatement:
+		prefix := ""
+		if s.Modifier.Literal != "" {
+			prefix = s.Modifier.Literal + " "
+		}
+		f.open(prefix+s.Name.Value+annotation(s.Type)+" is ", s.Value)
+	case *ast.PointerAssignmentStatement:
+		f.open("pointing from "+f.expr(s.Target, prefixPrec)+" is ", s.Value)
+	case *ast.DestructuringStatement:
+		f.line(f.pattern(s.Pattern) + " is " + f.list(s.Values))
+	case *ast.ReturnStatement:
+		if s.ReturnValue == nil {
+			f.line("return")
+			return
+		}
+		f.open("return ", s.ReturnValue)
+	case *ast.YieldStatement:
+		f.open("yield ", s.Value)
+	case *ast.ExpressionStatement:
+		f.open("", s.Expression)
+	case *ast.IncludeStatement:
+		f.line("include " + f.expr(s.Path, lowestPrec))
+	case *ast.StructDefinitionStatement:
+		names := []string{}
+		for _, e := range s.Embeds {
+			names = append(names, "..."+e.Value)
+		}
+		for i, a := range s.Attributes {
+			field := a.Value + annotation(typeAt(s.AttributeTypes, i))
+			if i < len(s.Defaults) && s.Defaults[i] != nil {
+				field += " is " + f.expr(s.Defaults[i], lowestPrec)
+			}
+			names = append(names, field)
+		}
+		f.line("define " + s.Name.Value + " as struct { " + strings.Join(names, ", ") + " }")
+	case *ast.EnumDefinitionStatement:
+		f.line(s.String())
+	case *ast.LoopStatement:
+		style := styleOf(s.Body)
+		f.line(s.Token.Literal + " " + f.expr(s.Condition, lowestPrec) + style.open)
+		f.block(s.Body)
+		f.line(style.close)
+	case *ast.RangeLoopStatement:
+		style := styleOf(s.Body)
+		f.line("for " + s.Iterator.Value + " in " + f.expr(s.Iterable, lowestPrec) + style.open)
+		f.block(s.Body)
+		f.line(style.close)
+	case *ast.TryCatchStatement:
+		style := styleOf(s.TryBlock)
+		f.line("try" + style.open)
+		f.block(s.TryBlock)
+		if s.CatchBlock != nil {
+			f.line(style.clause("catch"))
+			f.block(s.CatchBlock)
+		}
+		if s.FinallyBlock != nil {
+			f.line(style.clause("finally"))
+			f.block(s.FinallyBlock)
+		}
+		f.line(style.close)
+	case *ast.BlockStatement:
+		f.line("{")
+		f.block(s)
+		f.line("}")
+	}
+}
+
+// blockStyle holds the delimiters of one of the two block forms: "{ ... }" or "... end".
+type blockStyle struct {
+	open  string // Appended to the header
+	close string // Line closing the construct
+	brace bool
+}
+
+var (
+	braceStyle = blockStyle{open: " {", close: "}", brace: true}
+	endStyle   = blockStyle{open: "", close: "end"}
+)
+
+// styleOf keeps the form the source used; the first block of a construct decides for all of it.
+func styleOf(b *ast.BlockStatement) blockStyle {
+	if b != nil && b.Token.Type != token.LBRACE {
+		return endStyle
+	}
+	return braceStyle
+}
+
+// clause renders the line that separates two blocks of a construct ("} else {" or "else").
+func (s blockStyle) clause(keyword string) string {
+	if s.brace {
+		return "} " + keyword + " {"
+	}
+	return keyword
+}
+
+// open prints a statement whose trailing expression may contain blocks (functions, ifs).
+// Multi-line expressions are rendered by exprLines so their bodies get indented.
+func (f *printer) open(prefix string, e ast.Expression) {
+	lines := f.exprLines(e)
+	lines[0] = strings.Repeat(indentUnit, f.indent) + prefix + strings.TrimLeft(lines[0], " ")
+	for _, l := range lines {
+		f.out.WriteString(l)
+		f.out.WriteString("\n")
+	}
+}
+
+// exprLines renders expressions that own blocks. Everything else fits on one line.
+func (f *printer) exprLines(e ast.Expression) []string {
+	switch e := e.(type) {
+	case *ast.FunctionLiteral:
+		style := styleOf(e.Body)
+		return f.blockLines(f.functionHeader(e)+style.open, []*ast.BlockStatement{e.Body}, nil, style.close)
+	case *ast.IfExpression:
+		return f.ifLines(e)
+	case *ast.MatchExpression:
+		return f.matchLines(e)
+	}
+	return []string{strings.Repeat(indentUnit, f.indent) + f.expr(e, lowestPrec)}
+}
+
+func (f *printer) ifLines(e *ast.IfExpression) []string {
+	style := styleOf(e.Consequence)
+	header := "if " + f.expr(e.Condition, lowestPrec) + style.open
+	if e.Alternative == nil {
+		return f.blockLines(header, []*ast.BlockStatement{e.Consequence}, nil, style.close)
+	}
+	// An else block holding a single if is printed as an "else if" chain
+	if len(e.Alternative.Statements) == 1 {
+		if es, ok := e.Alternative.Statements[0].(*ast.ExpressionStatement); ok {
+			if nested, ok := es.Expression.(*ast.IfExpression); ok {
+				lines := f.blockLines(header, []*ast.BlockStatement{e.Consequence}, nil, style.close)
+				lines = lines[:len(lines)-1] // drop the closer; the nested if prints its own
+				rest := f.ifLines(nested)
+				elseText := "else "
+				if style.brace {
+					elseText = "} else "
+				}
+				rest[0] = strings.Repeat(indentUnit, f.indent) + elseText + strings.TrimLeft(rest[0], " ")
+				return append(lines, rest...)
+			}
+		}
+	}
+	return f.blockLines(header, []*ast.BlockStatement{e.Consequence, e.Alternative}, []string{style.clause("else")}, style.close)
+}
+
+// matchLines renders a match in brace form, one arm per line when the arm body is a single line.
+func (f *printer) matchLines(e *ast.MatchExpression) []string {
+	pad := strings.Repeat(indentUnit, f.indent)
+	lines := []string{pad + "match " + f.expr(e.Subject, lowestPrec) + " {"}
+	f.indent++
+	for _, arm := range e.Arms {
+		patterns := []string{}
+		for _, p := range arm.Patterns {
+			patterns = append(patterns, f.pattern(p))
+		}
+		header := "when " + strings.Join(patterns, ", ")
+		if arm.Guard != nil {
+			header += " if " + f.expr(arm.Guard, lowestPrec)
+		}
+		lines = append(lines, f.armLines(header+" then", arm.Body)...)
+	}
+	if e.Otherwise != nil {
+		lines = append(lines, f.armLines("otherwise", e.Otherwise)...)
+	}
+	f.indent--
+	return append(lines, pad+"}")
+}
+
+func (f *printer) armLines(header string, body *ast.BlockStatement) []string {
+	lines := f.blockLines(header, []*ast.BlockStatement{body}, nil, "")
+	lines = lines[:len(lines)-1] // arms have no closer of their own
+	if len(lines) == 2 {
+		return []string{lines[0] + " " + strings.TrimLeft(lines[1], " ")}
+	}
+	return lines
+}
+
+// pattern renders a match pattern; literals are re-quoted like any other literal.
+func (f *printer) pattern(p ast.Pattern) string {
+	switch p := p.(type) {
+	case *ast.LiteralPattern:
+		return f.expr(p.Value, prefixPrec)
+	case *ast.BindingPattern:
+		return p.Name.Value
+	case *ast.ArrayPattern:
+		parts := []string{}
+		for _, el := range p.Elements {
+			parts = append(parts, f.pattern(el))
+		}
+		if p.Rest != nil {
+			parts = append(parts, "..."+p.Rest.Value)
+		}
+		if !p.Bracketed() {
+			return strings.Join(parts, ", ")
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *ast.MapPattern:
+		return f.patternEntries("", p.Entries)
+	case *ast.StructPattern:
+		return f.patternEntries(p.Name.Value+" ", p.Fields)
+	case *ast.EnumPattern:
+		name := p.Enum.Value + "." + p.Variant.Value
+		if p.Args == nil {
+			return name
+		}
+		args := []string{}
+		for _, a := range p.Args {
+			args = append(args, f.pattern(a))
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	}
+	return p.String()
+}
+
+func (f *printer) patternEntries(prefix string, entries []ast.PatternEntry) string {
+	if len(entries) == 0 {
+		return prefix + "{}"
+	}
+	parts := []string{}
+	for _, e := range entries {
+		key := f.expr(e.Key, lowestPrec)
+		if b, ok := e.Value.(*ast.BindingPattern); ok && b.Name.Value == key {
+			parts = append(parts, key)
+			continue
+		}
+		parts = append(parts, key+": "+f.pattern(e.Value))
+	}
+	return prefix + "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// blockLines renders "header { body } separator { body } ... closer" at the current indentation.
+func (f *printer) blockLines(header string, blocks []*ast.BlockStatement, separators []string, closer string) []string {
+	pad := strings.Repeat(indentUnit, f.indent)
+	saved := f.out
+	savedLast := f.lastLine
+	f.out = &bytes.Buffer{}
+
+	f.out.WriteString(pad + header + "\n")
+	for i, b := range blocks {
+		if i > 0 {
+			f.out.WriteString(pad + separators[i-1] + "\n")
+		}
+		f.block(b)
+	}
+	f.out.WriteString(pad + closer)
+
+	text := f.out.String()
+	f.out = saved
+	f.lastLine = savedLast
+	return strings.Split(text, "\n")
+}
+
+func (f *printer) functionHeader(fl *ast.FunctionLiteral) string {
+	params := []string{}
+	for i, p := range fl.Parameters {
+		params = append(params, p.Value+annotation(typeAt(fl.ParameterTypes, i)))
+	}
+	header := "takes(" + strings.Join(params, ", ") + ")"
+	if fl.ReturnType != nil {
+		header += " returns " + fl.ReturnType.Value
+	}
+	return header
+}
+
+// annotation renders an optional type annotation as " as Type".
+func annotation(typ *ast.Identifier) string {
+	if typ == nil {
+		return ""
+	}
+	return " as " + typ.Value
+}
+
+// typeAt returns the i-th entry of a parallel list of optional annotations, or nil.
+func typeAt(types []*ast.Identifier, i int) *ast.Identifier {
+	if i < len(types) {
+		return types[i]
+	}
+	return nil
+}
+
+// ----------------------------------------------------------------------------------------------
+// EXPRESSIONS
+// ----------------------------------------------------------------------------------------------
+
+// expr renders an expression on a single line, parenthesising it when its own
+// precedence is lower than the context it appears in.
+func (f *printer) expr(e ast.Expression, ctx int) string {
+	switch e := e.(type) {
+	case nil:
+		return ""
+	case *ast.Identifier:
+		return e.Value
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.BooleanLiteral:
+		return e.TokenLiteral()
+	case *ast.NilLiteral:
+		return "none"
+	case *ast.StringLiteral:
+		if e.Token.Type == token.RAW_STRING {
+			return "`" + e.Value + "`"
+		}
+		return quoteString(e.Value)
+	case *ast.CharLiteral:
+		return quoteChar(e.Value)
+	case *ast.PrefixExpression:
+		op := e.Operator
+		if unicode.IsLetter([]rune(op)[0]) {
+			op += " "
+		}
+		return wrap(op+f.expr(e.Right, prefixPrec), prefixPrec, ctx)
+	case *ast.InfixExpression:
+		if e.Token.Type == token.TEMPLATE {
+			// Interpolated strings are desugared by the parser; print them as written
+			return `"` + e.Token.Literal + `"`
+		}
+		prec := precedence[e.Operator]
+		// Operators are left associative, so a right operand of equal precedence needs parentheses
+		s := f.expr(e.Left, prec) + " " + e.Operator + " " + f.expr(e.Right, prec+1)
+		return wrap(s, prec, ctx)
+	case *ast.PointerReferenceExpression:
+		return wrap("pointing to "+f.expr(e.Value, prefixPrec), prefixPrec, ctx)
+	case *ast.SpawnExpression:
+		return wrap("spawn "+f.expr(e.Call, prefixPrec), prefixPrec, ctx)
+	case *ast.PointerDereferenceExpression:
+		return wrap("pointing from "+f.expr(e.Value, prefixPrec), prefixPrec, ctx)
+	case *ast.CallExpression:
+		return f.expr(e.Function, prefixPrec+1) + "(" + f.list(e.Arguments) + ")"
+	case *ast.IndexExpression:
+		return f.expr(e.Left, prefixPrec+1) + "[" + f.expr(e.Index, lowestPrec) + "]"
+	case *ast.FieldAccessExpression:
+		return f.expr(e.Object, prefixPrec+1) + "." + e.Field.Value
+	case *ast.ArrayLiteral:
+		return "[" + f.list(e.Elements) + "]"
+	case *ast.TupleLiteral:
+		if len(e.Elements) == 1 {
+			return "(" + f.expr(e.Elements[0], lowestPrec) + ",)"
+		}
+		return "(" + f.list(e.Elements) + ")"
+	case *ast.MapLiteral:
+		pairs := []string{}
+		for _, k := range e.Keys {
+			pairs = append(pairs, f.expr(k, lowestPrec)+": "+f.expr(e.Pairs[k], lowestPrec))
+		}
+		return f.braced("", pairs)
+	case *ast.StructInstantiationExpression:
+		fields := []string{}
+		for _, field := range e.Fields {
+			fields = append(fields, field.Name.Value+": "+f.expr(field.Value, lowestPrec))
+		}
+		return f.braced(e.Name.Value+" ", fields)
+	case *ast.FunctionLiteral, *ast.IfExpression, *ast.MatchExpression:
+		// Block expressions nested inside other expressions: render them as indented lines
+		lines := f.exprLines(e)
+		lines[0] = strings.TrimLeft(lines[0], " ")
+		return strings.Join(lines, "\n")
+	}
+	return e.String()
+}
+
+func (f *printer) list(exps []ast.Expression) string {
+	parts := []string{}
+	for _, e := range exps {
+		parts = append(parts, f.expr(e, lowestPrec))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// braced renders "{ a, b }", splitting long contents over several indented lines.
+func (f *printer) braced(prefix string, items []string) string {
+	if len(items) == 0 {
+		return prefix + "{}"
+	}
+	single := prefix + "{ " + strings.Join(items, ", ") + " }"
+	if len(single)+len(indentUnit)*f.indent <= lineWidth && !strings.Contains(single, "\n") {
+		return single
+	}
+	pad := strings.Repeat(indentUnit, f.indent+1)
+	return prefix + "{\n" + pad + strings.Join(items, ",\n"+pad) + "\n" + strings.Repeat(indentUnit, f.indent) + "}"
+}
+
+func wrap(s string, prec, ctx int) string {
+	if prec < ctx {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// quoteString re-escapes a string value so that the lexer reads back the same text.
+func quoteString(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		case '"':
+			out.WriteString(`\"`)
+		case '{':
+			out.WriteString(`\{`)
+		case '\\':
+			out.WriteString(`\\`)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+func quoteChar(r rune) string {
+	switch r {
+	case '\n':
+		return `'\n'`
+	case '\t':
+		return `'\t'`
+	case '\r':
+		return `'\r'`
+	case 0:
+		return `'\0'`
+	case '\'':
+		return `'\''`
+	case '\\':
+		return `'\\'`
+	}
+	return "'" + string(r) + "'"
+}
+
+// statementLine returns the source line a statement starts on (0 if unknown).
+func statementLine(s ast.Statement) int {
+	switch s := s.(type) {
+	case *ast.AssignmentStatement:
+		return s.Token.Line
+	case *ast.ReturnStatement:
+		return s.Token.Line
+	case *ast.YieldStatement:
+		return s.Token.Line
+	case *ast.ExpressionStatement:
+		return s.Token.Line
+	case *ast.PointerAssignmentStatement:
+		return s.Token.Line
+	case *ast.DestructuringStatement:
+		return s.Token.Line
+	case *ast.StructDefinitionStatement:
+		return s.Token.Line
+	case *ast.EnumDefinitionStatement:
+		return s.Token.Line
+	case *ast.LoopStatement:
+		return s.Token.Line
+	case *ast.RangeLoopStatement:
+		return s.Token.Line
+	case *ast.TryCatchStatement:
+		return s.Token.Line
+	case *ast.IncludeStatement:
+		return s.Token.Line
+	case *ast.BlockStatement:
+		return s.Token.Line
+	}
+	return 0
+}
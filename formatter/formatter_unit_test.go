@@ -0,0 +1,106 @@
+// ==============================================================================================
+// FILE: formatter/formatter_unit_test.go
+// ==============================================================================================
+// PURPOSE: Unit tests for the source formatter.
+//          Verifies canonical output, comment preservation and idempotency.
+// ==============================================================================================
+
+package formatter
+
+import (
+	"testing"
+)
+
+func TestFormat_Canonical(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x   is  5", "x is 5\n"},
+		{"y is (1 adds 2) times 3", "y is (1 adds 2) times 3\n"},
+		{"y is 1 adds (2 times 3)", "y is 1 adds 2 times 3\n"},
+		{"z is 10 minus (4 minus 3)", "z is 10 minus (4 minus 3)\n"},
+		{`s is "a\n\"b\""`, "s is \"a\\n\\\"b\\\"\"\n"},
+		{"if x less 1 { show(x) } else { show(2) }", "if x less 1 {\n    show(x)\n} else {\n    show(2)\n}\n"},
+		{"f is takes(a, b) { return a adds b }", "f is takes(a, b) {\n    return a adds b\n}\n"},
+		{"f is takes(a) returns Integer\nreturn a end", "f is takes(a) returns Integer\n    return a\nend\n"},
+		{"if a\nx\nelse if b\ny\nelse\nz\nend", "if a\n    x\nelse if b\n    y\nelse\n    z\nend\n"},
+		{"while a\nshow(a)\nend", "while a\n    show(a)\nend\n"},
+		{"n  as  Integer is 1\ndefine P as struct {a as String,b}", "n as Integer is 1\ndefine P as struct { a as String, b }\n"},
+		{"define S as enum {A,B(x,y as Integer)}", "define S as enum { A, B(x, y as Integer) }\n"},
+		{"f is takes(a as Integer,b) returns Integer { return a }", "f is takes(a as Integer, b) returns Integer {\n    return a\n}\n"},
+		{"try\nx\ncatch\ny\nend", "try\n    x\ncatch\n    y\nend\n"},
+		{"m is {\"a\": 1, \"b\": [1,2]}", "m is { \"a\": 1, \"b\": [1, 2] }\n"},
+		{"define P as struct {x,y}\np is P { x: 1, y: 2 }", "define P as struct { x, y }\np is P { x: 1, y: 2 }\n"},
+		{"define E as struct {...Person,pay as Float is 1.5,tags is []}", "define E as struct { ...Person, pay as Float is 1.5, tags is [] }\n"},
+		{"t is ( 1,\"a\" )\nu is (t ,)\nv is (1 adds 2)", "t is (1, \"a\")\nu is (t,)\nv is 1 adds 2\n"},
+		{"constant  PI as Float is 3.14\nredefine show is takes(x) {x}\nlet  n is 1", "constant PI as Float is 3.14\nredefine show is takes(x) {\n    x\n}\nlet n is 1\n"},
+		{"p is pointing to x\npointing from p is 3", "p is pointing to x\npointing from p is 3\n"},
+		{"g is takes(n) { yield  n\nyield n adds 1 }", "g is takes(n) {\n    yield n\n    yield n adds 1\n}\n"},
+		{"t is spawn  work(1,2)\nr is wait(t)", "t is spawn work(1, 2)\nr is wait(t)\n"},
+		{"q is pointing to u.age\npointing from  pointing from pp is xs[0]\npointing from n.next is 1", "q is pointing to u.age\npointing from pointing from pp is xs[0]\npointing from n.next is 1\n"},
+		{"n is 0xFF adds 1_000 adds 1e-9", "n is 0xFF adds 1_000 adds 1e-9\n"},
+		{`s is "Hi {name}, {count(xs) adds 1}"`, "s is \"Hi {name}, {count(xs) adds 1}\"\n"},
+		{"s is `raw \\n\n{x}`", "s is `raw \\n\n{x}`\n"},
+		{`s is "\{"`, "s is \"\\{\"\n"},
+		{`c is '\''`, "c is '\\''\n"},
+		{"x is match v when 1,2 then \"a\", when [h,...t] if h greater 0 then t otherwise none end",
+			"x is match v {\n    when 1, 2 then \"a\"\n    when [h, ...t] if h greater 0 then t\n    otherwise none\n}\n"},
+		{"a,b is b,a\nhead,...tail is xs\n[x,[y,_]] is v\n{name,\"k\":v} is m", "a, b is b, a\nhead, ...tail is xs\n[x, [y, _]] is v\n{ name, \"k\": v } is m\n"},
+		{"match p { when P {x:0,y} then show(y)\ny when {\"k\":v,w} then v when S.C(_) then 1 }",
+			"match p {\n    when P { x: 0, y } then\n        show(y)\n        y\n    when { \"k\": v, w } then v\n    when S.C(_) then 1\n}\n"},
+	}
+
+	for _, tt := range tests {
+		out, errs := Source(tt.input)
+		if errs != nil {
+			t.Fatalf("%q: unexpected parser errors %v", tt.input, errs)
+		}
+		if out != tt.expected {
+			t.Errorf("%q: wrong output.\nexpected=%q\ngot=     %q", tt.input, tt.expected, out)
+		}
+	}
+}
+
+func TestFormat_PreservesComments(t *testing.T) {
+	input := `// header
+x is 1
+
+/* block
+   comment */
+while x less 3 {
+    // inside
+    x is x adds 1
+}
+`
+	out, errs := Source(input)
+	if errs != nil {
+		t.Fatalf("unexpected parser errors %v", errs)
+	}
+	if out != input {
+		t.Errorf("comments were not preserved.\nexpected=%q\ngot=     %q", input, out)
+	}
+}
+
+func TestFormat_Idempotent(t *testing.T) {
+	input := `
+fib is takes(n) { if n less 2 { return n }
+return fib(n minus 1) adds fib(n minus 2) }
+for i in [1, 2, 3] { show(fib(i)) }
+try { show(1) } catch { show(2) } finally { show(3) }`
+
+	first, errs := Source(input)
+	if errs != nil {
+		t.Fatalf("unexpected parser errors %v", errs)
+	}
+	second, _ := Source(first)
+	if first != second {
+		t.Errorf("formatting is not idempotent.\nfirst=%q\nsecond=%q", first, second)
+	}
+}
+
+func TestFormat_ParseErrors(t *testing.T) {
+	if _, errs := Source("x is ("); errs == nil {
+		t.Errorf("expected parser errors for invalid input")
+	}
+}
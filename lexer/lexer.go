@@ -10,6 +10,7 @@
 package lexer
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -21,11 +22,15 @@ import (
 // It iterates through the input string and produces a stream of tokens.
 type Lexer struct {
 	input        string
-	position     int  // Current position in input (points to current char)
-	readPosition int  // Current reading position in input (after current char)
-	ch           rune // Current char under examination
-	line         int  // Line number for error reporting
-	column       int  // Column number for error reporting
+	position     int            // Current position in input (points to current char)
+	readPosition int            // Current reading position in input (after current char)
+	ch           rune           // Current char under examination
+	line         int            // Line number for error reporting
+	column       int            // Column number for error reporting
+	end          token.Position // Where the current char is, as token ends are reported
+	base         token.Position // Where the input starts in a larger source (see NewAt)
+
+	comments []token.Token // Comments skipped so far (used by tools such as the formatter)
 }
 
 // New initializes a new Lexer with the given input string.
@@ -34,14 +39,32 @@ func New(input string) *Lexer {
 		input:  input,
 		line:   1,
 		column: 0,
+		end:    token.Position{Offset: 0, Line: 1, Column: 1},
 	}
 	l.readChar()
 	return l
 }
 
+// NewAt initializes a lexer for a piece of a larger source, such as the code inside a string
+// interpolation, that starts at start. The tokens carry their positions in the larger source.
+func NewAt(input string, start token.Position) *Lexer {
+	l := New(input)
+	l.base = start
+	return l
+}
+
 // readChar reads the next character and advances the position indices.
 // It handles ASCII and UTF-8 characters.
 func (l *Lexer) readChar() {
+	// A newline ends its line, while line and column count it as the start of the next one
+	if l.position < l.readPosition {
+		if l.ch == '\n' {
+			l.end.Line++
+			l.end.Column = 1
+		} else {
+			l.end.Column++
+		}
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII code for NUL (signifies EOF)
 		l.position = l.readPosition
@@ -58,6 +81,7 @@ func (l *Lexer) readChar() {
 			l.column++
 		}
 	}
+	l.end.Offset = l.position
 }
 
 // peekChar returns the next character without advancing the lexer's position.
@@ -70,25 +94,46 @@ func (l *Lexer) peekChar() rune {
 	return r
 }
 
-// NextToken inspects the current character and returns the corresponding Token.
+// NextToken returns the next token of the input, with the byte offset it starts at and the
+// place just past its end.
+func (l *Lexer) NextToken() token.Token {
+	tok := l.scan()
+	tok.End = l.end
+	if l.base.IsValid() {
+		start := l.shift(tok.Pos())
+		tok.Line, tok.Column, tok.Offset = start.Line, start.Column, start.Offset
+		tok.End = l.shift(tok.End)
+	}
+	return tok
+}
+
+// shift moves a position of the input to its place in the source the input was taken from.
+func (l *Lexer) shift(p token.Position) token.Position {
+	if p.Line == 1 {
+		p.Column += l.base.Column - 1
+	}
+	p.Line += l.base.Line - 1
+	p.Offset += l.base.Offset
+	return p
+}
+
+// scan inspects the current character and returns the corresponding Token.
 // It handles whitespace skipping, comment ignoring, and delegates to specific
 // reader methods for identifiers, numbers, and strings.
-func (l *Lexer) NextToken() token.Token {
+func (l *Lexer) scan() token.Token {
 	l.skipWhitespace()
 
 	// Check for comments (Single line // and Multi line /* */)
 	if l.ch == '/' {
 		if l.peekChar() == '/' {
 			l.skipSingleLineComment()
-			return l.NextToken()
+			return l.scan()
 		}
 		if l.peekChar() == '*' {
-			l.readChar()
-			l.readChar()
 			if !l.skipMultiLineComment() {
 				return l.newToken(token.ILLEGAL, "unterminated comment")
 			}
-			return l.NextToken()
+			return l.scan()
 		}
 	}
 
@@ -120,26 +165,24 @@ func (l *Lexer) NextToken() token.Token {
 		if unicode.IsDigit(l.peekChar()) {
 			return l.readNumberToken()
 		}
+		if l.peekChar() == '.' && l.readPosition+1 < len(l.input) && l.input[l.readPosition+1] == '.' {
+			tok = l.newToken(token.ELLIPSIS, "...")
+			l.readChar()
+			l.readChar()
+			break
+		}
 		tok = l.newToken(token.DOT, string(l.ch))
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
-		tok.Line = l.line
-		tok.Column = l.column
+		return l.readStringToken()
+	case '`':
+		return l.readRawStringToken()
 	case '\'':
-		tok.Type = token.CHAR
-		tok.Literal = l.readCharLiteral()
-		tok.Line = l.line
-		tok.Column = l.column
+		return l.readCharToken()
 	case 0:
-		tok.Literal = ""
-		tok.Type = token.EOF
-		tok.Line = l.line
-		tok.Column = l.column
+		tok = l.newToken(token.EOF, "")
 	default:
 		if isLetter(l.ch) {
-			tok.Line = l.line
-			tok.Column = l.column
+			tok = l.newToken(token.IDENT, "")
 			tok.Literal = l.readIdentifier()
 			// Resolve whether the identifier is a keyword (e.g. "if") or a user variable
 			tok.Type = token.LookupIdent(tok.Literal)
@@ -147,7 +190,7 @@ func (l *Lexer) NextToken() token.Token {
 		} else if unicode.IsDigit(l.ch) {
 			return l.readNumberToken()
 		} else {
-			tok = l.newToken(token.ILLEGAL, string(l.ch))
+			tok = l.newToken(token.ILLEGAL, fmt.Sprintf("unexpected character %q", l.ch))
 		}
 	}
 
@@ -162,9 +205,15 @@ func (l *Lexer) newToken(tokenType token.TokenType, literal string) token.Token
 		Literal: literal,
 		Line:    l.line,
 		Column:  l.column,
+		Offset:  l.position,
 	}
 }
 
+// here returns the position of the current char, where a token starting at it is reported.
+func (l *Lexer) here() token.Position {
+	return token.Position{Offset: l.position, Line: l.line, Column: l.column}
+}
+
 // readIdentifier reads in an identifier and advances the lexer's position
 // until it encounters a non-letter-character.
 // It also handles multi-word keywords like "pointing to".
@@ -182,6 +231,7 @@ func (l *Lexer) readIdentifier() string {
 		savedCh := l.ch
 		savedLine := l.line
 		savedCol := l.column
+		savedEnd := l.end
 
 		// Look ahead skipping whitespace
 		for l.ch == ' ' || l.ch == '\t' {
@@ -209,94 +259,53 @@ func (l *Lexer) readIdentifier() string {
 		l.ch = savedCh
 		l.line = savedLine
 		l.column = savedCol
+		l.end = savedEnd
 	}
 
 	return literal
 }
 
-// readNumberToken reads a number (integer or float) from the input.
-func (l *Lexer) readNumberToken() token.Token {
-	line := l.line
-	column := l.column
-	position := l.position
-	isFloat := false
-
-	for unicode.IsDigit(l.ch) {
-		l.readChar()
-	}
-
-	if l.ch == '.' && unicode.IsDigit(l.peekChar()) {
-		isFloat = true
+// skipWhitespace skips over whitespace characters.
+func (l *Lexer) skipWhitespace() {
+	for unicode.IsSpace(l.ch) {
 		l.readChar()
-		for unicode.IsDigit(l.ch) {
-			l.readChar()
-		}
-	}
-
-	literal := l.input[position:l.position]
-	if isFloat {
-		return token.Token{Type: token.FLOAT, Literal: literal, Line: line, Column: column}
 	}
-	return token.Token{Type: token.INT, Literal: literal, Line: line, Column: column}
 }
 
-// readString reads a string literal enclosed in double quotes.
-func (l *Lexer) readString() string {
-	var out strings.Builder
-	for {
-		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
-		}
-		if l.ch == '\\' {
-			l.readChar()
-			switch l.ch {
-			case 'n':
-				out.WriteRune('\n')
-			case 't':
-				out.WriteRune('\t')
-			case 'r':
-				out.WriteRune('\r')
-			case '"':
-				out.WriteRune('"')
-			case '\\':
-				out.WriteRune('\\')
-			default:
-				out.WriteRune(l.ch)
-			}
-		} else {
-			out.WriteRune(l.ch)
-		}
-	}
-	return out.String()
+// Comments returns every comment the lexer has skipped so far, in source order.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
-// readCharLiteral reads a single character literal enclosed in single quotes.
-func (l *Lexer) readCharLiteral() string {
-	l.readChar() // skip opening '
-	char := l.ch
-	l.readChar() // skip char
-	l.readChar() // skip closing '
-	return string(char)
-}
-
-// skipWhitespace skips over whitespace characters.
-func (l *Lexer) skipWhitespace() {
-	for unicode.IsSpace(l.ch) {
-		l.readChar()
-	}
+// Fork returns an independent copy of the lexer at its current position.
+// The parser uses it to look arbitrarily far ahead without consuming tokens.
+func (l *Lexer) Fork() *Lexer {
+	fork := *l
+	fork.comments = nil
+	return &fork
 }
 
 // skipSingleLineComment consumes characters until a newline is found.
 func (l *Lexer) skipSingleLineComment() {
+	tok := l.newToken(token.COMMENT, "")
+	position := l.position
 	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+	tok.Literal = strings.TrimRight(l.input[position:l.position], " \t\r")
+	tok.End = l.end // The trimmed blanks are single bytes on the comment's line
+	tok.End.Offset -= l.position - (position + len(tok.Literal))
+	tok.End.Column -= l.position - (position + len(tok.Literal))
+	l.comments = append(l.comments, tok)
 	l.skipWhitespace()
 }
 
 // skipMultiLineComment consumes characters until "*/" is found.
 func (l *Lexer) skipMultiLineComment() bool {
+	tok := l.newToken(token.COMMENT, "")
+	position := l.position
+	l.readChar() // skip '/'
+	l.readChar() // skip '*'
 	for {
 		if l.ch == 0 {
 			return false
@@ -304,6 +313,9 @@ func (l *Lexer) skipMultiLineComment() bool {
 		if l.ch == '*' && l.peekChar() == '/' {
 			l.readChar()
 			l.readChar()
+			tok.Literal = l.input[position:l.position]
+			tok.End = l.end
+			l.comments = append(l.comments, tok)
 			return true
 		}
 		l.readChar()
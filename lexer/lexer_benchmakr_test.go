@@ -8,6 +8,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"eloquence/token"
@@ -27,3 +28,16 @@ func BenchmarkLexerNextToken(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkLexerLongLine measures scanning one very long line, whose cost must stay linear in
+// its length.
+func BenchmarkLexerLongLine(b *testing.B) {
+	input := "x is [" + strings.Repeat("12345, ", 20000) + "0]"
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l := New(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
@@ -25,3 +25,24 @@ func TestSanityLexer(t *testing.T) {
 		// No specific assertions here; the test passes if this loop finishes without panic.
 	}
 }
+
+func TestSanityUnterminatedLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`x is "no closing quote`, "unterminated string"},
+		{"x is 1 /* no closing", "unterminated comment"},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		var last token.Token
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			last = tok
+		}
+		if last.Type != token.ILLEGAL || last.Literal != tt.expected {
+			t.Errorf("input %q: expected ILLEGAL %q, got %s %q", tt.input, tt.expected, last.Type, last.Literal)
+		}
+	}
+}
@@ -227,3 +227,230 @@ func runLexerTest(t *testing.T, input string, expectedTokens []struct {
 		}
 	}
 }
+
+// TestCharLiterals checks escapes and the errors reported for malformed char literals.
+func TestCharLiterals(t *testing.T) {
+	input := `'a' '\n' '\'' '\\' '\t' '"' 'é' 'ab' '' '\q' 'x`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.CHAR, "a"},
+		{token.CHAR, "\n"},
+		{token.CHAR, "'"},
+		{token.CHAR, `\`},
+		{token.CHAR, "\t"},
+		{token.CHAR, `"`},
+		{token.CHAR, "é"},
+		{token.ILLEGAL, "char literal must contain exactly one character, got 'ab'"},
+		{token.ILLEGAL, "empty char literal"},
+		{token.ILLEGAL, `unknown escape sequence \q`},
+		{token.ILLEGAL, "unterminated char literal"},
+		{token.EOF, ""},
+	}
+	runLexerTest(t, input, expected)
+
+	// Positions point at the opening quote
+	l := New("x is\n  'ab'")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.ILLEGAL && (tok.Line != 2 || tok.Column != 3) {
+			t.Errorf("ILLEGAL token at %d:%d, want 2:3", tok.Line, tok.Column)
+		}
+	}
+}
+
+// TestNumberLiterals checks the integer and float spellings and the errors for malformed ones.
+func TestNumberLiterals(t *testing.T) {
+	input := `0xFF 0o17 0B101 1_000_000 3.14 .5 1e-9 6.02E+23 1_0.5 0x 0b102 1__0 1_ 12abc 1e 0o8`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INT, "0xFF"},
+		{token.INT, "0o17"},
+		{token.INT, "0B101"},
+		{token.INT, "1_000_000"},
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "6.02E+23"},
+		{token.FLOAT, "1_0.5"},
+		{token.ILLEGAL, "hexadecimal literal 0x has no digits"},
+		{token.ILLEGAL, "invalid digit '2' in binary literal 0b102"},
+		{token.ILLEGAL, "'_' must separate successive digits in number literal 1__0"},
+		{token.ILLEGAL, "'_' must separate successive digits in number literal 1_"},
+		{token.ILLEGAL, "invalid character 'a' in number literal 12abc"},
+		{token.ILLEGAL, "exponent has no digits in number literal 1e"},
+		{token.ILLEGAL, "invalid digit '8' in octal literal 0o8"},
+		{token.EOF, ""},
+	}
+	runLexerTest(t, input, expected)
+}
+
+// TestEllipsis checks that three dots form one token while single dots stay accessors.
+func TestEllipsis(t *testing.T) {
+	input := `[first, ...rest] p.x ..5`
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LBRACKET, "["},
+		{token.IDENT, "first"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.IDENT, "p"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.DOT, "."},
+		{token.FLOAT, ".5"},
+		{token.EOF, ""},
+	}
+	runLexerTest(t, input, expected)
+}
+
+// TestStringLiterals checks escapes, raw strings, interpolation and malformed strings.
+func TestStringLiterals(t *testing.T) {
+	input := "\"a\\tb\" \"\\u{1F600}\\x41\" \"\\{x}\" \"Hi {name}!\" \"{f(\"}\")}\" `raw\\n\n{x}` \"\\q\" \"\\u{110000}\" \"\\x4\" \"open"
+
+	expected := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING, "a\tb"},
+		{token.STRING, "😀A"},
+		{token.STRING, "{x}"},
+		{token.TEMPLATE, "Hi {name}!"},
+		{token.TEMPLATE, `{f("}")}`}, // Quotes and braces inside the expression
+		{token.RAW_STRING, "raw\\n\n{x}"},
+		{token.ILLEGAL, `unknown escape sequence \q`},
+		{token.ILLEGAL, `escape sequence \u{110000} is not a valid Unicode code point`},
+		{token.ILLEGAL, `escape sequence \x must be followed by two hexadecimal digits`},
+		{token.ILLEGAL, "unterminated string"},
+		{token.EOF, ""},
+	}
+	runLexerTest(t, input, expected)
+
+	// Errors point at the literal (or the bad escape inside it)
+	positions := []struct {
+		input        string
+		line, column int
+	}{
+		{"x is\n  \"open", 2, 3},
+		{"x is \"ok \\q\"", 1, 10},
+		{"x is\n0b2", 2, 1},
+		{"`never closed\n\n", 1, 1},
+		{"x is \"a {b\"\n", 1, 9}, // An interpolation is reported at its brace
+	}
+	for _, tt := range positions {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Type == token.ILLEGAL && (tok.Line != tt.line || tok.Column != tt.column) {
+				t.Errorf("%q: ILLEGAL %q at %d:%d, want %d:%d", tt.input, tok.Literal, tok.Line, tok.Column, tt.line, tt.column)
+			}
+		}
+	}
+}
+
+// TestUnterminatedInterpolation checks that a brace never closed on its line is reported
+// there, instead of running on into the strings and lines that follow.
+func TestUnterminatedInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.TokenType
+	}{
+		{
+			"open is \"{\"\nclose is \"}\"\nshow(open, close)",
+			[]token.TokenType{token.IDENT, token.IS, token.ILLEGAL,
+				token.IDENT, token.IS, token.STRING,
+				token.IDENT, token.LPAREN, token.IDENT, token.COMMA, token.IDENT, token.RPAREN, token.EOF},
+		},
+		{
+			"show(\"{\")\nshow(\"}\")",
+			[]token.TokenType{token.IDENT, token.LPAREN, token.ILLEGAL,
+				token.IDENT, token.LPAREN, token.STRING, token.RPAREN, token.EOF},
+		},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected {
+				t.Fatalf("%q: token %d: expected %s, got %s %q", tt.input, i, expected, tok.Type, tok.Literal)
+			}
+			if tok.Type == token.ILLEGAL && (tok.Literal != "unterminated interpolation" || tok.Line != 1) {
+				t.Errorf("%q: unexpected ILLEGAL %q at line %d", tt.input, tok.Literal, tok.Line)
+			}
+		}
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	parts := SplitTemplate(`Hi {name}, \{not} {a["k"]}\u{21}`)
+	expected := []TemplatePart{
+		{Text: "Hi "},
+		{Text: "name", IsExpr: true, Offset: 4},
+		{Text: ", {not} "},
+		{Text: `a["k"]`, IsExpr: true, Offset: 19},
+		{Text: "!"},
+	}
+	if len(parts) != len(expected) {
+		t.Fatalf("expected %d parts, got %d: %+v", len(expected), len(parts), parts)
+	}
+	for i := range expected {
+		if parts[i] != expected[i] {
+			t.Errorf("part %d: expected %+v, got %+v", i, expected[i], parts[i])
+		}
+	}
+}
+
+func TestTokenSpans(t *testing.T) {
+	input := "x is \"héllo\" // note\ny is pointing to  x\n`a\nb` 'é'"
+	tests := []struct {
+		text      string // The source text the token covers
+		line, col int
+		endLine   int
+		endColumn int
+	}{
+		{"x", 1, 1, 1, 2},
+		{"is", 1, 3, 1, 5},
+		{`"héllo"`, 1, 6, 1, 13},
+		{"y", 2, 1, 2, 2},
+		{"is", 2, 3, 2, 5},
+		{"pointing to", 2, 6, 2, 17},
+		{"x", 2, 19, 2, 20},
+		{"`a\nb`", 3, 1, 4, 3},
+		{"'é'", 4, 4, 4, 7},
+	}
+
+	l := New(input)
+	for _, tt := range tests {
+		tok := l.NextToken()
+		if got := input[tok.Offset:tok.End.Offset]; got != tt.text {
+			t.Errorf("expected a token covering %q, got %q (%s)", tt.text, got, tok.Type)
+		}
+		if tok.Line != tt.line || tok.Column != tt.col || tok.End.Line != tt.endLine || tok.End.Column != tt.endColumn {
+			t.Errorf("%q: expected %d:%d-%d:%d, got %d:%d-%d:%d", tt.text, tt.line, tt.col, tt.endLine, tt.endColumn,
+				tok.Line, tok.Column, tok.End.Line, tok.End.Column)
+		}
+	}
+	if tok := l.NextToken(); tok.Type != token.EOF || tok.Offset != len(input) {
+		t.Errorf("expected EOF at offset %d, got %s at %d", len(input), tok.Type, tok.Offset)
+	}
+	if comments := l.Comments(); len(comments) != 1 || input[comments[0].Offset:comments[0].End.Offset] != "// note" {
+		t.Errorf("expected the comment to cover \"// note\", got %+v", comments)
+	}
+
+	// A lexer for part of a larger source reports positions in that source
+	sub := NewAt("a adds\nb", token.Position{Offset: 10, Line: 3, Column: 7})
+	for _, want := range []token.Position{{Offset: 10, Line: 3, Column: 7}, {Offset: 12, Line: 3, Column: 9}, {Offset: 17, Line: 4, Column: 1}} {
+		if tok := sub.NextToken(); tok.Pos() != want {
+			t.Errorf("%q: expected %+v, got %+v", tok.Literal, want, tok.Pos())
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// ==============================================================================================
+// FILE: lexer/literals.go
+// ==============================================================================================
+// PACKAGE: lexer
+// PURPOSE: Scanning of number, string and char literals.
+//          Malformed literals become ILLEGAL tokens whose literal describes the problem and
+//          whose position points at the start of the literal (or at the bad escape sequence).
+// ==============================================================================================
+
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"eloquence/token"
+)
+
+// illegal builds an ILLEGAL token carrying an error message.
+func illegal(at token.Position, msg string) token.Token {
+	return token.Token{Type: token.ILLEGAL, Literal: msg, Line: at.Line, Column: at.Column, Offset: at.Offset}
+}
+
+// ----------------------------------------------------------------------------------------------
+// NUMBERS
+// ----------------------------------------------------------------------------------------------
+
+// readNumberToken reads an integer or float literal.
+// Supported forms: 42, 1_000_000, 0xFF, 0o17, 0b1010, 3.14, .5, 1e-9 and 6.02E23.
+// The token keeps the source spelling; the parser converts it to a value.
+func (l *Lexer) readNumberToken() token.Token {
+	at := l.here()
+	position := l.position
+	prefixed := l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar())
+	seenDot := false
+
+	// Consume everything that could belong to the literal, then validate it as a whole,
+	// so that "12abc" is reported as one bad literal instead of a number and an identifier.
+	for {
+		if isLetter(l.ch) || unicode.IsDigit(l.ch) {
+			if !prefixed && (l.ch == 'e' || l.ch == 'E') && (l.peekChar() == '+' || l.peekChar() == '-') {
+				l.readChar() // The exponent sign belongs to the literal
+			}
+			l.readChar()
+			continue
+		}
+		if l.ch == '.' && !seenDot && !prefixed && unicode.IsDigit(l.peekChar()) {
+			seenDot = true
+			l.readChar()
+			continue
+		}
+		break
+	}
+
+	literal := l.input[position:l.position]
+	tokType, msg := classifyNumber(literal)
+	if msg != "" {
+		return illegal(at, msg)
+	}
+	return token.Token{Type: tokType, Literal: literal, Line: at.Line, Column: at.Column, Offset: at.Offset}
+}
+
+// classifyNumber checks a number literal and reports whether it is an INT or a FLOAT.
+// A non-empty message describes why the literal is malformed.
+func classifyNumber(lit string) (token.TokenType, string) {
+	if len(lit) > 1 && lit[0] == '0' {
+		if base, kind := numberBase(lit[1]); base != 0 {
+			return token.INT, checkDigits(lit, lit[2:], base, kind)
+		}
+	}
+
+	mantissa, exponent, hasExponent := lit, "", false
+	if i := strings.IndexAny(lit, "eE"); i >= 0 {
+		mantissa, exponent, hasExponent = lit[:i], lit[i+1:], true
+	}
+	whole, fraction, hasDot := strings.Cut(mantissa, ".")
+
+	if whole != "" || !hasDot {
+		if msg := checkDigits(lit, whole, 10, "decimal"); msg != "" {
+			return "", msg
+		}
+	}
+	if hasDot {
+		if msg := checkDigits(lit, fraction, 10, "decimal"); msg != "" {
+			return "", msg
+		}
+	}
+	if hasExponent {
+		exponent = strings.TrimLeft(exponent, "+-")
+		if exponent == "" {
+			return "", fmt.Sprintf("exponent has no digits in number literal %s", lit)
+		}
+		if msg := checkDigits(lit, exponent, 10, "decimal"); msg != "" {
+			return "", msg
+		}
+	}
+
+	if hasDot || hasExponent {
+		return token.FLOAT, ""
+	}
+	return token.INT, ""
+}
+
+// numberBase returns the base selected by the letter after a leading 0 (0x, 0o, 0b).
+func numberBase(prefix byte) (int, string) {
+	switch prefix {
+	case 'x', 'X':
+		return 16, "hexadecimal"
+	case 'o', 'O':
+		return 8, "octal"
+	case 'b', 'B':
+		return 2, "binary"
+	}
+	return 0, ""
+}
+
+// checkDigits validates one run of digits, where '_' may only separate two digits.
+func checkDigits(lit, digits string, base int, kind string) string {
+	if digits == "" {
+		return fmt.Sprintf("%s literal %s has no digits", kind, lit)
+	}
+	for i, r := range digits {
+		if r == '_' {
+			if i == 0 || i == len(digits)-1 || digits[i-1] == '_' {
+				return fmt.Sprintf("'_' must separate successive digits in number literal %s", lit)
+			}
+			continue
+		}
+		if !isDigitInBase(r, base) {
+			if base == 10 {
+				return fmt.Sprintf("invalid character %q in number literal %s", r, lit)
+			}
+			return fmt.Sprintf("invalid digit %q in %s literal %s", r, kind, lit)
+		}
+	}
+	return ""
+}
+
+func isDigitInBase(r rune, base int) bool {
+	switch {
+	case r >= '0' && r <= '9':
+		return int(r-'0') < base
+	case r >= 'a' && r <= 'f':
+		return base == 16
+	case r >= 'A' && r <= 'F':
+		return base == 16
+	}
+	return false
+}
+
+func isHexDigit(r rune) bool {
+	return isDigitInBase(r, 16)
+}
+
+// ----------------------------------------------------------------------------------------------
+// STRINGS & CHARS
+// ----------------------------------------------------------------------------------------------
+
+// readStringToken reads a double-quoted string literal.
+// A string containing {expression} parts becomes a TEMPLATE token whose literal is the raw
+// source between the quotes; the parser splits it with SplitTemplate and desugars it.
+func (l *Lexer) readStringToken() token.Token {
+	at := l.here()
+	start := l.readPosition
+	interpolated := false
+	var problem *token.Token // First bad escape, reported once the whole string is consumed
+
+	for l.readChar(); l.ch != '"'; l.readChar() {
+		switch l.ch {
+		case 0:
+			return illegal(at, "unterminated string")
+		case '\\':
+			if tok, ok := l.readEscape(); !ok && problem == nil {
+				problem = &tok
+			}
+		case '{':
+			interpolated = true
+			end := matchBrace(l.input, l.position)
+			if end < 0 {
+				// The rest of the line cannot be trusted: skip it rather than guess where the string ends
+				tok := illegal(l.here(), "unterminated interpolation")
+				for l.ch != 0 && l.ch != '\n' {
+					l.readChar()
+				}
+				return tok
+			}
+			for l.position < end {
+				l.readChar()
+			}
+		}
+	}
+	raw := l.input[start:l.position]
+	l.readChar() // skip closing "
+
+	switch {
+	case problem != nil:
+		return *problem
+	case interpolated:
+		return token.Token{Type: token.TEMPLATE, Literal: raw, Line: at.Line, Column: at.Column, Offset: at.Offset}
+	}
+	return token.Token{Type: token.STRING, Literal: unescapeString(raw), Line: at.Line, Column: at.Column, Offset: at.Offset}
+}
+
+// readRawStringToken reads a `raw string`: no escapes, no interpolation, and it may span lines.
+// Carriage returns are dropped so that files with Windows line endings give the same value.
+func (l *Lexer) readRawStringToken() token.Token {
+	at := l.here()
+	start := l.readPosition
+	for l.readChar(); l.ch != '`'; l.readChar() {
+		if l.ch == 0 {
+			return illegal(at, "unterminated raw string")
+		}
+	}
+	raw := l.input[start:l.position]
+	l.readChar() // skip closing `
+	return token.Token{Type: token.RAW_STRING, Literal: strings.ReplaceAll(raw, "\r", ""), Line: at.Line, Column: at.Column, Offset: at.Offset}
+}
+
+// readCharToken reads a character literal enclosed in single quotes, such as 'a' or '\n'.
+// Empty, unterminated and multi-character literals produce an ILLEGAL token describing the problem.
+func (l *Lexer) readCharToken() token.Token {
+	at := l.here()
+	start := l.readPosition
+	var problem *token.Token
+
+	for l.readChar(); l.ch != '\''; l.readChar() {
+		if l.ch == 0 || l.ch == '\n' {
+			return illegal(at, "unterminated char literal")
+		}
+		if l.ch == '\\' {
+			if tok, ok := l.readEscape(); !ok && problem == nil {
+				problem = &tok
+			}
+		}
+	}
+	raw := l.input[start:l.position]
+	l.readChar() // skip closing '
+
+	if problem != nil {
+		return *problem
+	}
+	chars := []rune(unescapeString(raw))
+	switch {
+	case len(chars) == 0:
+		return illegal(at, "empty char literal")
+	case len(chars) > 1:
+		return illegal(at, fmt.Sprintf("char literal must contain exactly one character, got '%s'", raw))
+	}
+	return token.Token{Type: token.CHAR, Literal: string(chars), Line: at.Line, Column: at.Column, Offset: at.Offset}
+}
+
+// readEscape checks the escape sequence starting at the current backslash and moves to its
+// last character. Supported: \n \t \r \0 \\ \' \" \{ \} \xNN and \u{X...}.
+// A malformed sequence returns an ILLEGAL token positioned at the backslash.
+func (l *Lexer) readEscape() (token.Token, bool) {
+	at := l.here()
+	bad := func(msg string) (token.Token, bool) {
+		return illegal(at, msg), false
+	}
+
+	l.readChar()
+	switch l.ch {
+	case 'n', 't', 'r', '0', '\\', '\'', '"', '{', '}', 0:
+		return token.Token{}, true
+	case 'x':
+		for i := 0; i < 2; i++ {
+			if !isHexDigit(l.peekChar()) {
+				return bad(`escape sequence \x must be followed by two hexadecimal digits`)
+			}
+			l.readChar()
+		}
+		return token.Token{}, true
+	case 'u':
+		if l.peekChar() != '{' {
+			return bad(`escape sequence \u must be followed by {hex digits}, e.g. \u{1F600}`)
+		}
+		l.readChar()
+		var digits strings.Builder
+		for isHexDigit(l.peekChar()) {
+			l.readChar()
+			digits.WriteRune(l.ch)
+		}
+		if l.peekChar() != '}' || digits.Len() == 0 || digits.Len() > 6 {
+			return bad(`escape sequence \u{...} must contain 1 to 6 hexadecimal digits`)
+		}
+		l.readChar()
+		if v, _ := strconv.ParseUint(digits.String(), 16, 32); !utf8.ValidRune(rune(v)) {
+			return bad(fmt.Sprintf(`escape sequence \u{%s} is not a valid Unicode code point`, digits.String()))
+		}
+		return token.Token{}, true
+	}
+	return bad(fmt.Sprintf(`unknown escape sequence \%c`, l.ch))
+}
+
+// unescapeString decodes the escape sequences of an already validated literal body.
+func unescapeString(raw string) string {
+	if !strings.ContainsRune(raw, '\\') {
+		return raw
+	}
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 >= len(raw) {
+			out.WriteByte(raw[i])
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '0':
+			out.WriteByte(0)
+		case 'x':
+			v, _ := strconv.ParseUint(raw[i+1:i+3], 16, 8)
+			out.WriteRune(rune(v))
+			i += 2
+		case 'u':
+			end := i + strings.IndexByte(raw[i:], '}')
+			v, _ := strconv.ParseUint(raw[i+2:end], 16, 32)
+			out.WriteRune(rune(v))
+			i = end
+		default:
+			out.WriteByte(raw[i])
+		}
+	}
+	return out.String()
+}
+
+// ----------------------------------------------------------------------------------------------
+// STRING INTERPOLATION
+// ----------------------------------------------------------------------------------------------
+
+// TemplatePart is one piece of an interpolated string.
+type TemplatePart struct {
+	Text   string // Unescaped text, or the source code of the expression
+	IsExpr bool
+	Offset int // Byte offset of the expression's source in the literal
+}
+
+// SplitTemplate splits the literal of a TEMPLATE token into text and {expression} parts.
+// "Hello {name}!" gives the text "Hello ", the expression "name" and the text "!".
+func SplitTemplate(raw string) []TemplatePart {
+	var parts []TemplatePart
+	start := 0
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\\':
+			i++
+			if i < len(raw) && raw[i] == 'u' {
+				i += strings.IndexByte(raw[i:], '}') // \u{...} is not an interpolation
+			}
+		case '{':
+			end := matchBrace(raw, i)
+			if end < 0 {
+				end = len(raw)
+			}
+			parts = append(parts, TemplatePart{Text: unescapeString(raw[start:i])})
+			parts = append(parts, TemplatePart{Text: raw[i+1 : min(end, len(raw))], IsExpr: true, Offset: i + 1})
+			i, start = end, end+1
+		}
+	}
+	if start < len(raw) {
+		parts = append(parts, TemplatePart{Text: unescapeString(raw[start:])})
+	}
+	return parts
+}
+
+// matchBrace returns the index of the '}' closing the '{' at s[open], skipping nested braces
+// and quoted strings or chars inside the expression. It returns -1 if the brace is not closed
+// on the same line, so that a stray brace cannot swallow the strings and lines after it.
+func matchBrace(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			return -1
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		case '"', '\'':
+			quote := s[i]
+			for i++; i < len(s) && s[i] != quote && s[i] != '\n'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(s) || s[i] == '\n' {
+				return -1
+			}
+		}
+	}
+	return -1
+}
@@ -1,21 +1,59 @@
 // ==============================================================================================
 // FILE: main.go
 // ==============================================================================================
+// PACKAGE: main
+// PURPOSE: Entry point of the `eloquence` command line tool.
+//          It dispatches to subcommands (run, repl, check, fmt, test, cover, tokens, ast) and keeps
+//          the classic shortcuts working: no arguments starts the REPL and a bare file runs it.
+// ==============================================================================================
+
 package main
 
 import (
 	"fmt"
 	"os"
-	"os/user"
+	"strings"
 
 	"eloquence/ast"
 	"eloquence/evaluator"
 	"eloquence/lexer"
-	"eloquence/object"
 	"eloquence/parser"
-	"eloquence/repl"
 )
 
+// Exit codes shared by every subcommand.
+// A script can also choose its own code with the exit(n) builtin.
+const (
+	exitOK           = 0
+	exitFailure      = 1 // Usage errors, unreadable files, failing tests
+	exitParseError   = 2
+	exitRuntimeError = 3
+)
+
+// command describes a subcommand of the CLI.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) int
+}
+
+// commands is ordered as it appears in the help text.
+// It is filled in init() because the commands themselves read it to print their usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "run [-e code] [-max-depth n] [-profile] [-profile-out file] [-cover] [-coverprofile file] [-trace] [-trace-out file] [-trace-func regexp] [file.eq | -] [args...]", "Run a program (from a file, -e or stdin)", cmdRun},
+		{"repl", "repl", "Start the interactive shell", cmdRepl},
+		{"check", "check [--types] [files...]", "Parse programs, report syntax (and type) errors and warn about shadowing, without running them", cmdCheck},
+		{"fmt", "fmt [-w] [-l] [files...]", "Format programs in the canonical style", cmdFmt},
+		{"test", "test [-run regexp] [-junit file] [-v] [-cover] [-coverprofile file] [paths...]", "Run *_test.eq files", cmdTest},
+		{"cover", "cover [-html file] [-o file] profiles...", "Merge coverage profiles and report them as text or HTML", cmdCover},
+		{"tokens", "tokens [-e code] [file.eq]", "Print the tokens produced by the lexer", cmdTokens},
+		{"ast", "ast [-e code] [-json] [file.eq]", "Print the syntax tree produced by the parser", cmdAST},
+	}
+}
+
 func main() {
 	// CONFIGURE IMPORTS:
 	// Allow evaluator to use the parser logic
@@ -25,49 +63,54 @@ func main() {
 		return p.ParseProgram()
 	}
 
-	// 1. Script Mode: go run main.go myfile.eq
-	if len(os.Args) > 1 {
-		runFile(os.Args[1])
-		return
-	}
-
-	// 2. REPL Mode
-	currentUser, err := user.Current()
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Printf("Hello %s! Welcome to the Eloquence programming language.\n", currentUser.Username)
-	fmt.Println("Type .help for commands")
-
-	repl.Start(os.Stdin, os.Stdout)
+	os.Exit(dispatch(os.Args[1:]))
 }
 
-func runFile(filename string) {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading file: %s\n", err)
-		os.Exit(1)
+// dispatch picks the subcommand for the given arguments and returns its exit code.
+func dispatch(args []string) int {
+	// 1. REPL Mode: eloquence
+	if len(args) == 0 {
+		return cmdRepl(nil)
 	}
 
-	input := string(data)
-	l := lexer.New(input)
-	p := parser.New(l)
-	program := p.ParseProgram()
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(os.Stdout)
+		return exitOK
+	}
 
-	if len(p.Errors()) != 0 {
-		fmt.Println("Parser Errors:")
-		for _, msg := range p.Errors() {
-			fmt.Printf("\t%s\n", msg)
+	// 2. Subcommands: eloquence <command> [flags] [args...]
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
 		}
-		os.Exit(1)
 	}
 
-	env := object.NewEnvironment()
-	evaluated := evaluator.Eval(program, env)
+	// 3. Script Mode: eloquence myfile.eq [args...] or eloquence -e 'code'
+	if strings.HasPrefix(args[0], "-") || strings.HasSuffix(args[0], ".eq") || fileExists(args[0]) {
+		return cmdRun(args)
+	}
 
-	if evaluated != nil && evaluated.Type() == object.ERROR_OBJ {
-		fmt.Println(evaluated.Inspect())
-		os.Exit(1)
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+	printUsage(os.Stderr)
+	return exitFailure
+}
+
+func printUsage(out *os.File) {
+	fmt.Fprintln(out, "Usage: eloquence <command> [arguments]")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nDetailed usage:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  eloquence %s\n", c.usage)
 	}
+	fmt.Fprintln(out, "\nWith no command, eloquence starts the REPL. `eloquence file.eq` is short for `eloquence run file.eq`.")
+	fmt.Fprintln(out, "\nExit codes: 0 success, 1 failure, 2 parse error, 3 runtime error, or the value passed to exit(n).")
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
 }
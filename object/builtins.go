@@ -8,8 +8,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"unicode/utf8"
 )
 
+// ApplyFunction is a hook set by the evaluator so builtins can call user-defined functions
+// (e.g. assert_throws) without causing a circular import dependency. depth is the call depth
+// of the code that called the builtin, so recursion through builtins is still limited.
+var ApplyFunction func(fn Object, args []Object, depth int) Object
+
 // Builtins is the list of available native functions
 var Builtins = []struct {
 	Name    string
@@ -35,6 +41,8 @@ var Builtins = []struct {
 			}
 			switch arg := args[0].(type) {
 			case *Array:
+				return &Integer{Value: int64(arg.Len())}
+			case *Tuple:
 				return &Integer{Value: int64(len(arg.Elements))}
 			case *String:
 				return &Integer{Value: int64(len(arg.Value))}
@@ -52,17 +60,200 @@ var Builtins = []struct {
 			if args[0].Type() != ARRAY_OBJ {
 				return newBuiltinError("first argument to `append` must be ARRAY, got %s", args[0].Type())
 			}
-			arr := args[0].(*Array)
-			length := len(arr.Elements)
-
-			// FIX for S1019: redundant capacity argument removed
-			newElements := make([]Object, length+1)
-			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
-
+			newElements := append(args[0].(*Array).Values(), args[1])
 			return &Array{Elements: newElements}
 		}},
 	},
+	{
+		"freeze", // freeze(value) makes an array, map or struct instance (and everything in it) read-only
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			Freeze(args[0])
+			return args[0]
+		}},
+	},
+	{
+		"new", // new(value) stores value in a fresh cell and returns a pointer to it
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return NewPointer("new cell", &Cell{Value: args[0]})
+		}},
+	},
+	{
+		"collect", // collect(sequence) walks an array, tuple or generator into a new array
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			it, ok := Iterate(args[0])
+			if !ok {
+				return newBuiltinError("argument to `collect` must be iterable, got %s", args[0].Type())
+			}
+			elements := []Object{}
+			for {
+				val, ok := it.Next()
+				if !ok {
+					return &Array{Elements: elements}
+				}
+				if val.Type() == ERROR_OBJ {
+					return val
+				}
+				elements = append(elements, val)
+			}
+		}},
+	},
+	{
+		"take", // take(sequence, n) lazily produces the first n values
+		&Builtin{Fn: func(args ...Object) Object {
+			it, n, err := sequenceAndCount("take", args)
+			if err != nil {
+				return err
+			}
+			return TakeValues(it, n)
+		}},
+	},
+	{
+		"skip", // skip(sequence, n) lazily produces everything after the first n values
+		&Builtin{Fn: func(args ...Object) Object {
+			it, n, err := sequenceAndCount("skip", args)
+			if err != nil {
+				return err
+			}
+			return SkipValues(it, n)
+		}},
+	},
+	{
+		"map", // map(sequence, fn) lazily produces fn(value) for every value
+		&Builtin{FnAt: func(depth int, args ...Object) Object {
+			it, fn, err := sequenceAndFunction("map", args, depth)
+			if err != nil {
+				return err
+			}
+			return MapValues(it, fn)
+		}},
+	},
+	{
+		"filter", // filter(sequence, fn) lazily produces the values for which fn is true
+		&Builtin{FnAt: func(depth int, args ...Object) Object {
+			it, fn, err := sequenceAndFunction("filter", args, depth)
+			if err != nil {
+				return err
+			}
+			return FilterValues(it, fn)
+		}},
+	},
+	{
+		"wait", // wait(task) blocks until a spawned call finishes and returns its result
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			task, ok := args[0].(*Task)
+			if !ok {
+				return newBuiltinError("argument to `wait` must be TASK, got %s", args[0].Type())
+			}
+			return task.Wait()
+		}},
+	},
+	{
+		"wait_all", // wait_all(tasks) waits for every task and returns their results in order
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			it, ok := Iterate(args[0])
+			if !ok {
+				return newBuiltinError("argument to `wait_all` must be iterable, got %s", args[0].Type())
+			}
+			results := []Object{}
+			var failed Object
+			for val, ok := it.Next(); ok; val, ok = it.Next() {
+				task, isTask := val.(*Task)
+				if !isTask {
+					return newBuiltinError("`wait_all` expects tasks, got %s", val.Type())
+				}
+				// Every task is waited for, even after one has failed
+				result := task.Wait()
+				if result.Type() == ERROR_OBJ && failed == nil {
+					failed = result
+				}
+				results = append(results, result)
+			}
+			if failed != nil {
+				return failed
+			}
+			return &Array{Elements: results}
+		}},
+	},
+	{
+		"channel", // channel(capacity?) creates a channel, unbuffered by default
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			capacity := int64(0)
+			if len(args) == 1 {
+				n, ok := args[0].(*Integer)
+				if !ok || n.Value < 0 {
+					return newBuiltinError("capacity of a channel must be a non-negative INTEGER, got %s", args[0].Inspect())
+				}
+				capacity = n.Value
+			}
+			return NewChannel(int(capacity))
+		}},
+	},
+	{
+		"send", // send(channel, value) passes value to a receiver
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			ch, ok := args[0].(*Channel)
+			if !ok {
+				return newBuiltinError("first argument to `send` must be CHANNEL, got %s", args[0].Type())
+			}
+			if err := ch.Send(args[1]); err != nil {
+				return newBuiltinError("%s", err)
+			}
+			return &Null{}
+		}},
+	},
+	{
+		"receive", // receive(channel) waits for the next value; none once the channel is closed
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ch, ok := args[0].(*Channel)
+			if !ok {
+				return newBuiltinError("argument to `receive` must be CHANNEL, got %s", args[0].Type())
+			}
+			if val, ok := ch.Receive(); ok {
+				return val
+			}
+			return &Null{}
+		}},
+	},
+	{
+		"close", // close(channel) tells receivers no more values will come
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ch, ok := args[0].(*Channel)
+			if !ok {
+				return newBuiltinError("argument to `close` must be CHANNEL, got %s", args[0].Type())
+			}
+			if err := ch.Close(); err != nil {
+				return newBuiltinError("%s", err)
+			}
+			return &Null{}
+		}},
+	},
 	{
 		"ask",
 		&Builtin{Fn: func(args ...Object) Object {
@@ -134,7 +325,7 @@ var Builtins = []struct {
 			}
 
 			var parts []string
-			for _, el := range arr.Elements {
+			for _, el := range arr.Values() {
 				// Convert every element to string for joining
 				if strVal, ok := el.(*String); ok {
 					parts = append(parts, strVal.Value)
@@ -154,6 +345,114 @@ var Builtins = []struct {
 			return &String{Value: args[0].Inspect()}
 		}},
 	},
+	{
+		"ord", // ord(c) returns the Unicode code point of a Char (or a one-character String)
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *Char:
+				return &Integer{Value: int64(arg.Value)}
+			case *String:
+				if runes := []rune(arg.Value); len(runes) == 1 {
+					return &Integer{Value: int64(runes[0])}
+				}
+				return newBuiltinError("argument to `ord` must be a single character, got %q", arg.Value)
+			}
+			return newBuiltinError("argument to `ord` must be CHAR, got %s", args[0].Type())
+		}},
+	},
+	{
+		"chr", // chr(n) returns the Char with the given Unicode code point
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, ok := args[0].(*Integer)
+			if !ok {
+				return newBuiltinError("argument to `chr` must be INTEGER, got %s", args[0].Type())
+			}
+			if n.Value < 0 || n.Value > utf8.MaxRune || !utf8.ValidRune(rune(n.Value)) {
+				return newBuiltinError("chr: %d is not a valid code point", n.Value)
+			}
+			return &Char{Value: rune(n.Value)}
+		}},
+	},
+	{
+		"exit", // exit(code?) stops the program with the given status code (default 0)
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			code := 0
+			if len(args) == 1 {
+				n, ok := args[0].(*Integer)
+				if !ok {
+					return newBuiltinError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+				}
+				code = int(n.Value)
+			}
+			return NewExit(code)
+		}},
+	},
+	{
+		"assert", // assert(condition, message?) fails unless the condition is truthy
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if isTruthy(args[0]) {
+				return &Null{}
+			}
+			if len(args) == 2 {
+				return newBuiltinError("assertion failed: %s", args[1].Inspect())
+			}
+			return newBuiltinError("assertion failed")
+		}},
+	},
+	{
+		"assert_equals", // assert_equals(expected, actual, message?)
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 2 || len(args) > 3 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+			}
+			if Equal(args[0], args[1]) {
+				return &Null{}
+			}
+			msg := fmt.Sprintf("expected %s, got %s", describe(args[0]), describe(args[1]))
+			if len(args) == 3 {
+				msg = args[2].Inspect() + ": " + msg
+			}
+			return newBuiltinError("assertion failed: %s", msg)
+		}},
+	},
+	{
+		"assert_throws", // assert_throws(func, substring?) calls func and expects an error
+		&Builtin{FnAt: func(depth int, args ...Object) Object {
+			if len(args) < 1 || len(args) > 2 {
+				return newBuiltinError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if ApplyFunction == nil {
+				return newBuiltinError("assert_throws is not available: evaluator not configured")
+			}
+			result := ApplyFunction(args[0], []Object{}, depth)
+			errObj, ok := result.(*Error)
+			if ok && errObj.Exit {
+				return errObj // exit() ends the program even inside assert_throws
+			}
+			if !ok {
+				return newBuiltinError("assertion failed: expected an error to be thrown, got %s", describe(result))
+			}
+			if len(args) == 2 {
+				want := args[1].Inspect()
+				if !strings.Contains(errObj.Message, want) {
+					return newBuiltinError("assertion failed: expected error containing %q, got %q", want, errObj.Message)
+				}
+			}
+			return &Null{}
+		}},
+	},
 }
 
 // GetBuiltin is a helper to find a function by name
@@ -166,6 +465,65 @@ func GetBuiltin(name string) (*Builtin, bool) {
 	return nil, false
 }
 
+// sequenceAndCount reads the (sequence, n) arguments of take and skip.
+func sequenceAndCount(name string, args []Object) (Iterator, int64, *Error) {
+	if len(args) != 2 {
+		return nil, 0, newBuiltinError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	it, ok := Iterate(args[0])
+	if !ok {
+		return nil, 0, newBuiltinError("first argument to `%s` must be iterable, got %s", name, args[0].Type())
+	}
+	n, ok := args[1].(*Integer)
+	if !ok || n.Value < 0 {
+		return nil, 0, newBuiltinError("second argument to `%s` must be a non-negative INTEGER, got %s", name, args[1].Inspect())
+	}
+	return it, n.Value, nil
+}
+
+// sequenceAndFunction reads the (sequence, fn) arguments of map and filter. fn is called at the
+// depth of the code that called map or filter.
+func sequenceAndFunction(name string, args []Object, depth int) (Iterator, func(Object) Object, *Error) {
+	if len(args) != 2 {
+		return nil, nil, newBuiltinError("wrong number of arguments. got=%d, want=2", len(args))
+	}
+	it, ok := Iterate(args[0])
+	if !ok {
+		return nil, nil, newBuiltinError("first argument to `%s` must be iterable, got %s", name, args[0].Type())
+	}
+	if !Conforms(args[1], "Function") {
+		return nil, nil, newBuiltinError("second argument to `%s` must be a function, got %s", name, args[1].Type())
+	}
+	if ApplyFunction == nil {
+		return nil, nil, newBuiltinError("%s is not available: evaluator not configured", name)
+	}
+	fn := args[1]
+	return it, func(val Object) Object { return ApplyFunction(fn, []Object{val}, depth) }, nil
+}
+
+// isTruthy mirrors the evaluator's truthiness rules: only none and false are falsy.
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	}
+	return obj != nil
+}
+
+// describe renders a value for assertion messages, quoting strings so that
+// "1" and 1 are distinguishable.
+func describe(obj Object) string {
+	if obj == nil {
+		return "nothing"
+	}
+	if s, ok := obj.(*String); ok {
+		return fmt.Sprintf("%q", s.Value)
+	}
+	return obj.Inspect()
+}
+
 // Helper function to create errors inside the object package
 func newBuiltinError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
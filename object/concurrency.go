@@ -0,0 +1,96 @@
+// ==============================================================================================
+// FILE: object/concurrency.go
+// ==============================================================================================
+// PACKAGE: object
+// PURPOSE: Defines the values behind concurrent programs: the Task handle returned by
+//          `spawn`, and the Channel that tasks use to pass values to each other.
+// ==============================================================================================
+
+package object
+
+import "fmt"
+
+// Task is a function call running on its own goroutine, started with `spawn f(x)`.
+type Task struct {
+	done   chan struct{} // Closed once the call has finished
+	result Object
+}
+
+// NewTask creates the handle of a call that has not finished yet.
+func NewTask() *Task {
+	return &Task{done: make(chan struct{})}
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string {
+	select {
+	case <-t.done:
+		return "task (done)"
+	default:
+		return "task (running)"
+	}
+}
+
+// Finish records the result of the call and wakes everyone waiting for it.
+func (t *Task) Finish(result Object) {
+	t.result = result
+	close(t.done)
+}
+
+// Wait blocks until the call has finished and returns its result, which is an *Error
+// when the call failed.
+func (t *Task) Wait() Object {
+	<-t.done
+	return t.result
+}
+
+// Channel passes values between tasks. Sending blocks until a receiver takes the value,
+// or, for a buffered channel, until there is room.
+type Channel struct {
+	ch chan Object
+}
+
+// NewChannel creates a channel holding up to capacity values that nobody has received yet.
+func NewChannel(capacity int) *Channel {
+	return &Channel{ch: make(chan Object, capacity)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
+
+// Send passes a value into the channel. Sending on a closed channel is an error.
+func (c *Channel) Send(val Object) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("send on a closed channel")
+		}
+	}()
+	c.ch <- val
+	return nil
+}
+
+// Receive takes the next value, and reports false once the channel is closed and empty.
+func (c *Channel) Receive() (Object, bool) {
+	val, ok := <-c.ch
+	return val, ok
+}
+
+// Close ends the channel: receivers get the values already sent, then nothing more.
+func (c *Channel) Close() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("channel is already closed")
+		}
+	}()
+	close(c.ch)
+	return nil
+}
+
+// channelIterator lets `for msg in channel` receive until the channel is closed.
+// Leaving the loop early does not close the channel; other receivers may still use it.
+type channelIterator struct {
+	channel *Channel
+}
+
+func (it channelIterator) Next() (Object, bool) { return it.channel.Receive() }
+func (it channelIterator) Close()               {}
@@ -4,19 +4,33 @@
 // PACKAGE: object
 // PURPOSE: Implements the memory environment (symbol table) for the interpreter.
 //          It handles variable storage, lexical scoping chains, and shadowing logic.
+//          Every scope has its own lock, so tasks started with `spawn` can share scopes safely.
 // ==============================================================================================
 
 package object
 
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
 type Environment struct {
-	store map[string]Object // Storage for the current scope
-	outer *Environment      // Link to the enclosing (outer) scope
+	mu        sync.RWMutex      // Guards the maps and yield below; outer never changes
+	store     map[string]Object // Storage for the current scope
+	types     map[string]string // Declared types of bindings in this scope (`x as Integer is 1`)
+	constants map[string]bool   // Bindings of this scope declared with `constant`
+	versions  map[string]int    // Bumped when a name of this scope is declared again with let or constant
+	yield     func(Object) bool // Set on the scope of a running generator call (see SetYielder)
+	depth     int               // On the scope of a function call: how many calls are running, this one included
+	dir       string            // Directory relative include paths are read from (see SetDir)
+	outer     *Environment      // Link to the enclosing (outer) scope
 }
 
 // NewEnvironment creates a fresh global environment.
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, types: make(map[string]string), constants: make(map[string]bool), versions: make(map[string]int), outer: nil}
 }
 
 // NewEnclosedEnvironment creates a new local scope linked to an outer scope.
@@ -28,31 +42,224 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 }
 
 // Get retrieves a value associated with a name.
-// It searches the current scope first, then recursively checks outer scopes.
+// It searches the current scope first, then checks outer scopes.
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	if !ok && e.outer != nil {
-		obj, ok = e.outer.Get(name)
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		obj, ok := env.store[name]
+		env.mu.RUnlock()
+		if ok {
+			return obj, true
+		}
 	}
-	return obj, ok
+	return nil, false
 }
 
 // Set stores a value in the CURRENT scope.
 // If the variable exists in an outer scope, this creates a new "shadow" variable
 // in the current scope, preserving the outer variable's original value.
 func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	e.store[name] = val
 	return val
 }
 
+// Assign updates the nearest existing binding of name, so assigning inside a block or a
+// closure changes the outer variable. A name bound nowhere yet is created in the CURRENT scope.
+// Constants are refused. Program assignments and pointer writes go through Assign;
+// Set is reserved for the interpreter's own bindings (parameters, loop variables).
+func (e *Environment) Assign(name string, val Object) error {
+	owner := e.Resolve(name)
+	if owner == nil {
+		owner = e
+	}
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if owner.constants[name] {
+		return fmt.Errorf("cannot reassign constant %s", name)
+	}
+	owner.store[name] = val
+	return nil
+}
+
+// Let binds name in the CURRENT scope, shadowing any outer binding (`let x is 1`).
+// Only a constant of this same scope is refused.
+func (e *Environment) Let(name string, val Object) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.constants[name] {
+		return fmt.Errorf("cannot reassign constant %s", name)
+	}
+	e.redeclare(name)
+	e.store[name] = val
+	delete(e.types, name)
+	return nil
+}
+
+// SetConstant binds name in the CURRENT scope and marks it as a constant.
+// A constant cannot replace another constant visible from this scope.
+func (e *Environment) SetConstant(name string, val Object) error {
+	if e.IsConstant(name) {
+		return fmt.Errorf("cannot reassign constant %s", name)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.redeclare(name)
+	e.store[name] = val
+	delete(e.types, name)
+	e.constants[name] = true
+	return nil
+}
+
+// redeclare marks an existing binding of the CURRENT scope as replaced by a new one.
+// The caller holds the lock.
+func (e *Environment) redeclare(name string) {
+	if _, ok := e.store[name]; ok {
+		e.versions[name]++
+	}
+}
+
+// Version identifies the binding of name in the CURRENT scope. It changes when the name is
+// declared again with let or constant, so pointers to the old binding can tell it is gone.
+func (e *Environment) Version(name string) int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.versions[name]
+}
+
+// SetYielder makes this scope the body of a running generator. Yield statements inside it
+// hand their values to y, which reports false once the generator has been closed.
+func (e *Environment) SetYielder(y func(Object) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.yield = y
+}
+
+// Yielder returns the yield function of the nearest enclosing generator body, or nil.
+func (e *Environment) Yielder() func(Object) bool {
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		y := env.yield
+		env.mu.RUnlock()
+		if y != nil {
+			return y
+		}
+	}
+	return nil
+}
+
+// SetDir makes include statements run in this scope read relative paths from dir, the
+// directory of the file being run, rather than from the working directory.
+func (e *Environment) SetDir(dir string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dir = dir
+}
+
+// Dir returns the include directory of the nearest scope that has one, or "".
+func (e *Environment) Dir() string {
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		dir := env.dir
+		env.mu.RUnlock()
+		if dir != "" {
+			return dir
+		}
+	}
+	return ""
+}
+
+// SetCallDepth marks this scope as the body of a function call, depth calls deep.
+func (e *Environment) SetCallDepth(depth int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.depth = depth
+}
+
+// CallScope returns the scope of the innermost function call running at this point of the
+// program, or nil outside any function.
+func (e *Environment) CallScope() *Environment {
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		depth := env.depth
+		env.mu.RUnlock()
+		if depth > 0 {
+			return env
+		}
+	}
+	return nil
+}
+
+// CallDepth returns how many function calls are running at this point of the program:
+// the depth of the nearest enclosing call scope, or 0 outside any function.
+func (e *Environment) CallDepth() int {
+	scope := e.CallScope()
+	if scope == nil {
+		return 0
+	}
+	scope.mu.RLock()
+	defer scope.mu.RUnlock()
+	return scope.depth
+}
+
+// IsConstant reports whether name resolves to a binding declared with `constant`.
+func (e *Environment) IsConstant(name string) bool {
+	owner := e.Resolve(name)
+	if owner == nil {
+		return false
+	}
+	owner.mu.RLock()
+	defer owner.mu.RUnlock()
+	return owner.constants[name]
+}
+
+// Declare records the type a binding in the CURRENT scope must keep.
+// Later assignments to the name in this scope are checked against it.
+func (e *Environment) Declare(name, typeName string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.types[name] = typeName
+}
+
+// DeclaredType returns the declared type of a binding in the CURRENT scope, if any.
+// Use Resolve first to find the scope that owns a binding.
+func (e *Environment) DeclaredType(name string) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	t, ok := e.types[name]
+	return t, ok
+}
+
 // Resolve finds the specific environment instance where a variable is defined.
 // This is used by Pointers to bypass shadowing and modify variables in their original scope.
 func (e *Environment) Resolve(name string) *Environment {
-	if _, ok := e.store[name]; ok {
-		return e
-	}
-	if e.outer != nil {
-		return e.outer.Resolve(name)
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		_, ok := env.store[name]
+		env.mu.RUnlock()
+		if ok {
+			return env
+		}
 	}
 	return nil
 }
+
+// Names returns every name visible from this scope (including outer scopes), sorted.
+// It is used by tooling such as REPL completion and the .env command.
+func (e *Environment) Names() []string {
+	seen := make(map[string]bool)
+	for env := e; env != nil; env = env.outer {
+		env.mu.RLock()
+		for name := range env.store {
+			seen[name] = true
+		}
+		env.mu.RUnlock()
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -7,7 +7,11 @@
 
 package object
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
 
 func TestEnvironment_GetSet(t *testing.T) {
 	env := NewEnvironment()
@@ -63,3 +67,100 @@ func TestEnclosedEnvironments(t *testing.T) {
 		t.Errorf("failed to traverse up to outer scope")
 	}
 }
+
+func TestEnvironment_Constants(t *testing.T) {
+	outer := NewEnvironment()
+	if err := outer.SetConstant("PI", &Float{Value: 3.14}); err != nil {
+		t.Fatalf("declaring a constant failed: %v", err)
+	}
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.IsConstant("PI") {
+		t.Errorf("constant is not visible from an inner scope")
+	}
+	if err := outer.Assign("PI", &Integer{Value: 3}); err == nil {
+		t.Errorf("expected reassigning a constant to fail")
+	}
+	if err := inner.Assign("PI", &Integer{Value: 3}); err == nil {
+		t.Errorf("expected shadowing a constant to fail")
+	}
+	if val, _ := outer.Get("PI"); val.(*Float).Value != 3.14 {
+		t.Errorf("constant changed to %s", val.Inspect())
+	}
+
+	// Set is the interpreter's own binding and may shadow (e.g. a parameter named PI)
+	inner.Set("PI", &Integer{Value: 1})
+	if val, _ := inner.Get("PI"); val.Inspect() != "1" {
+		t.Errorf("Set did not bind the parameter, got %s", val.Inspect())
+	}
+	if err := inner.Assign("x", &Integer{Value: 1}); err != nil || inner.IsConstant("x") {
+		t.Errorf("plain assignment failed or became constant: %v", err)
+	}
+}
+
+func TestEnvironment_AssignUpdatesNearestBinding(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("total", &Integer{Value: 0})
+	middle := NewEnclosedEnvironment(global)
+	middle.Set("step", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(middle)
+
+	// 1. Existing names are updated where they live
+	if err := inner.Assign("total", &Integer{Value: 5}); err != nil {
+		t.Fatalf("assign failed: %v", err)
+	}
+	if err := inner.Assign("step", &Integer{Value: 2}); err != nil {
+		t.Fatalf("assign failed: %v", err)
+	}
+	if val, _ := global.Get("total"); val.Inspect() != "5" {
+		t.Errorf("outer variable not updated, got %s", val.Inspect())
+	}
+	if val, _ := middle.Get("step"); val.Inspect() != "2" {
+		t.Errorf("middle variable not updated, got %s", val.Inspect())
+	}
+
+	// 2. New names are created in the current scope
+	inner.Assign("fresh", &Integer{Value: 1})
+	if inner.Resolve("fresh") != inner {
+		t.Errorf("new variable was not created in the current scope")
+	}
+
+	// 3. Let shadows instead of updating
+	if err := inner.Let("total", &Integer{Value: 99}); err != nil {
+		t.Fatalf("let failed: %v", err)
+	}
+	if val, _ := global.Get("total"); val.Inspect() != "5" {
+		t.Errorf("let changed the outer variable to %s", val.Inspect())
+	}
+	if val, _ := inner.Get("total"); val.Inspect() != "99" {
+		t.Errorf("let did not bind in the current scope, got %s", val.Inspect())
+	}
+}
+
+func TestEnvironment_ConcurrentAccess(t *testing.T) {
+	// Run with -race: scopes shared by spawned tasks are read and written from many goroutines
+	global := NewEnvironment()
+	global.Set("shared", &Integer{Value: 0})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			local := NewEnclosedEnvironment(global)
+			name := fmt.Sprintf("v%d", i)
+			for j := 0; j < 100; j++ {
+				global.Assign("shared", &Integer{Value: int64(j)})
+				global.Set(name, &Integer{Value: int64(j)})
+				local.Let("tmp", &Integer{Value: int64(j)})
+				local.Get("shared")
+				global.Names()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if len(global.Names()) != 9 {
+		t.Errorf("expected 9 names, got %v", global.Names())
+	}
+}
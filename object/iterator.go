@@ -0,0 +1,200 @@
+// ==============================================================================================
+// FILE: object/iterator.go
+// ==============================================================================================
+// PACKAGE: object
+// PURPOSE: Defines the iterator protocol shared by for-in loops and the sequence builtins,
+//          the lazy Generator value, and the lazy sequence helpers (take, skip, map, filter).
+// ==============================================================================================
+
+package object
+
+import "sync"
+
+// Iterator walks a sequence one value at a time. Arrays, tuples, generators and channels all provide one.
+type Iterator interface {
+	// Next returns the next value, or false once the sequence is exhausted.
+	// An *Error value reports a failure inside the sequence and ends it.
+	Next() (Object, bool)
+	// Close ends the sequence early. A generator runs the finally blocks it is inside of.
+	Close()
+}
+
+// Iterate returns an iterator over an array, tuple, generator or channel, and false for other values.
+func Iterate(obj Object) (Iterator, bool) {
+	switch obj := obj.(type) {
+	case *Array:
+		return &arrayIterator{array: obj}, true
+	case *Tuple:
+		return IterateElements(obj.Elements), true
+	case *Generator:
+		return obj, true
+	case *Channel:
+		return channelIterator{channel: obj}, true
+	}
+	return nil, false
+}
+
+// IterateElements returns an iterator over a fixed list of values.
+func IterateElements(elements []Object) Iterator {
+	return &elementIterator{elements: elements}
+}
+
+type elementIterator struct {
+	elements []Object
+	pos      int
+}
+
+func (it *elementIterator) Next() (Object, bool) {
+	if it.pos >= len(it.elements) {
+		return nil, false
+	}
+	it.pos++
+	return it.elements[it.pos-1], true
+}
+
+func (it *elementIterator) Close() { it.pos = len(it.elements) }
+
+// arrayIterator walks an array, reading each element when it is reached, so it sees what
+// was written through pointers since the loop started.
+type arrayIterator struct {
+	array  *Array
+	pos    int
+	closed bool
+}
+
+func (it *arrayIterator) Next() (Object, bool) {
+	if it.closed {
+		return nil, false
+	}
+	val, ok := it.array.At(it.pos)
+	if !ok {
+		return nil, false
+	}
+	it.pos++
+	return val, true
+}
+
+func (it *arrayIterator) Close() { it.closed = true }
+
+// ----------------------------------------------------------------------------------------------
+// GENERATORS
+// ----------------------------------------------------------------------------------------------
+
+// Generator is a lazy sequence: each value is produced when it is asked for.
+// Calling a function that contains yield returns one, and so do take, skip, map and filter.
+// A generator is used up as it is walked; walking it again continues where it stopped.
+// Tasks sharing a generator take turns: each value goes to one of them.
+type Generator struct {
+	NextFn  func() (Object, bool) // Produces the next value (see Iterator.Next)
+	CloseFn func()                // Releases the source early; may be nil
+	mu      sync.Mutex            // Held while a value is produced or the generator closes
+	done    bool
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// Next produces the next value. Once the sequence ends, or fails, the generator is closed.
+func (g *Generator) Next() (Object, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return nil, false
+	}
+	val, ok := g.NextFn()
+	if !ok || val.Type() == ERROR_OBJ {
+		g.close()
+	}
+	return val, ok
+}
+
+// Close ends the generator. Closing it again, or after it finished, does nothing.
+func (g *Generator) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.close()
+}
+
+func (g *Generator) close() {
+	if g.done {
+		return
+	}
+	g.done = true
+	if g.CloseFn != nil {
+		g.CloseFn()
+	}
+}
+
+// ----------------------------------------------------------------------------------------------
+// LAZY SEQUENCE HELPERS
+// ----------------------------------------------------------------------------------------------
+
+// TakeValues produces the first n values of source, then closes it.
+func TakeValues(source Iterator, n int64) *Generator {
+	var taken int64
+	return &Generator{
+		NextFn: func() (Object, bool) {
+			if taken >= n {
+				return nil, false
+			}
+			taken++
+			return source.Next()
+		},
+		CloseFn: source.Close,
+	}
+}
+
+// SkipValues drops the first n values of source and produces the rest.
+func SkipValues(source Iterator, n int64) *Generator {
+	skipped := false
+	return &Generator{
+		NextFn: func() (Object, bool) {
+			for ; !skipped && n > 0; n-- {
+				val, ok := source.Next()
+				if !ok || val.Type() == ERROR_OBJ {
+					return val, ok
+				}
+			}
+			skipped = true
+			return source.Next()
+		},
+		CloseFn: source.Close,
+	}
+}
+
+// MapValues produces fn(value) for each value of source. An *Error from fn ends the sequence.
+func MapValues(source Iterator, fn func(Object) Object) *Generator {
+	return &Generator{
+		NextFn: func() (Object, bool) {
+			val, ok := source.Next()
+			if !ok || val.Type() == ERROR_OBJ {
+				return val, ok
+			}
+			return fn(val), true
+		},
+		CloseFn: source.Close,
+	}
+}
+
+// FilterValues produces the values of source for which keep returns a truthy value.
+// An *Error from keep ends the sequence.
+func FilterValues(source Iterator, keep func(Object) Object) *Generator {
+	return &Generator{
+		NextFn: func() (Object, bool) {
+			for {
+				val, ok := source.Next()
+				if !ok || val.Type() == ERROR_OBJ {
+					return val, ok
+				}
+				verdict := keep(val)
+				if verdict.Type() == ERROR_OBJ {
+					return verdict, true
+				}
+				if isTruthy(verdict) {
+					return val, true
+				}
+			}
+		},
+		CloseFn: source.Close,
+	}
+}
@@ -10,10 +10,11 @@
 package object
 
 import (
-	"bytes"
+	"cmp"
 	"fmt"
 	"hash/fnv"
 	"strings"
+	"sync"
 
 	"eloquence/ast"
 )
@@ -32,19 +33,29 @@ const (
 
 	// Internal Control Flow Types
 	RETURN_VALUE_OBJ = "RETURN_VALUE" // Wraps a return value to bubble up through the AST
+	TAIL_CALL_OBJ    = "TAIL_CALL"    // A call in return position, left for the caller to make
 	ERROR_OBJ        = "ERROR"        // Wraps a runtime error message
 
 	// Composite Types
-	FUNCTION_OBJ = "FUNCTION"
-	ARRAY_OBJ    = "ARRAY"
-	MAP_OBJ      = "MAP"
+	FUNCTION_OBJ  = "FUNCTION"
+	ARRAY_OBJ     = "ARRAY"
+	TUPLE_OBJ     = "TUPLE"
+	MAP_OBJ       = "MAP"
+	GENERATOR_OBJ = "GENERATOR" // A lazy sequence (functions with yield, take, map, ...)
 
 	// Memory Management
 	POINTER_OBJ = "POINTER"
 
+	// Concurrency
+	TASK_OBJ    = "TASK"    // A spawned call (spawn f(x))
+	CHANNEL_OBJ = "CHANNEL" // Passes values between tasks
+
 	// User-Defined Types
 	STRUCT_DEF_OBJ  = "STRUCT_DEFINITION" // The blueprint (class)
 	STRUCT_INST_OBJ = "STRUCT_INSTANCE"   // The concrete object (instance)
+	ENUM_DEF_OBJ    = "ENUM_DEFINITION"   // An enum type and its variants
+	ENUM_VARIANT    = "ENUM_VARIANT"      // A variant with associated values, before it gets them
+	ENUM_OBJ        = "ENUM"              // A variant value (Color.Red, Shape.Circle(2))
 
 	// Builtin Functions
 	BUILTIN_OBJ = "BUILTIN" // Builtin functions
@@ -111,21 +122,55 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+// TailCall is what `return f(x)` produces in tail position instead of calling f: the function
+// being left hands the call back to its caller, which makes it in a loop. Tail recursion
+// therefore runs in constant Go stack. A TailCall never reaches the program itself.
+type TailCall struct {
+	Function     Object
+	Arguments    []Object
+	Line, Column int // Where the call was written, for errors raised by it
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call" }
+
 type Error struct {
 	Message string
+	Line    int  // Source line of the call that raised the error (0 if unknown)
+	Column  int  // Source column of the call that raised the error (0 if unknown)
+	Exit    bool // Raised by exit(): unwinds the whole program and cannot be caught
+	Code    int  // The exit code, when Exit is set
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
+// NewExit creates the signal raised by exit(code). It unwinds like an error, so whatever runs
+// the program can flush its output before ending with the code.
+func NewExit(code int) *Error {
+	return &Error{Message: fmt.Sprintf("exited with code %d", code), Exit: true, Code: code}
+}
+
+// ExitCode reports whether obj is the signal raised by exit(), and its code.
+func ExitCode(obj Object) (int, bool) {
+	if e, ok := obj.(*Error); ok && e.Exit {
+		return e.Code, true
+	}
+	return 0, false
+}
+
 // ==============================================================================================
 // COMPLEX OBJECTS
 // ==============================================================================================
 
 type Function struct {
-	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment // Closure: Holds the environment at definition time
+	Parameters     []*ast.Identifier
+	ParameterTypes []string // Declared type per parameter ("" when unannotated)
+	ReturnType     string   // Declared result type ("" when unannotated)
+	Body           *ast.BlockStatement
+	Env            *Environment // Closure: Holds the environment at definition time
+	Generator      bool         // The body yields: calling the function returns a Generator
+	Name           string       // The name the function literal was assigned to ("" when anonymous)
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -133,21 +178,111 @@ func (f *Function) Inspect() string {
 	return "takes(...) { ... }"
 }
 
+// Array is a list of values. Spawned tasks may share an array, so once it can be seen by
+// other code its elements are read through Len, At and Values, and written through pointers.
 type Array struct {
 	Elements []Object
+	Frozen   bool // Set by freeze(); frozen arrays are read-only and hashable
+	mu       sync.RWMutex
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
-func (a *Array) Inspect() string {
-	var out bytes.Buffer
-	parts := []string{}
-	for _, el := range a.Elements {
-		parts = append(parts, el.Inspect())
+func (a *Array) Inspect() string  { return inspect(a, nil) }
+
+// Len returns the number of elements.
+func (a *Array) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.Elements)
+}
+
+// At returns the element at index i, and false when i is out of range.
+func (a *Array) At(i int) (Object, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if i < 0 || i >= len(a.Elements) {
+		return nil, false
+	}
+	return a.Elements[i], true
+}
+
+// Values returns a copy of the elements.
+func (a *Array) Values() []Object {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]Object(nil), a.Elements...)
+}
+
+// Tuple is a fixed, immutable sequence of values: (1, "a").
+// Tuples of hashable values are hashable themselves and can be used as map keys.
+type Tuple struct {
+	Elements []Object
+}
+
+func (t *Tuple) Type() ObjectType { return TUPLE_OBJ }
+func (t *Tuple) Inspect() string  { return inspect(t, nil) }
+
+// inspect shows a value inside the containers being shown, in showing. A container met again
+// contains itself, and is shown abbreviated: [...], {...} or Name{...}.
+func inspect(obj Object, showing map[Object]bool) string {
+	if isContainer(obj) {
+		if showing[obj] {
+			switch obj := obj.(type) {
+			case *Array:
+				return "[...]"
+			case *Map:
+				return "{...}"
+			case *StructInstance:
+				return obj.Definition.Name + "{...}"
+			}
+		}
+		if showing == nil {
+			showing = make(map[Object]bool)
+		}
+		showing[obj] = true
+		defer delete(showing, obj)
 	}
-	out.WriteString("[")
-	out.WriteString(strings.Join(parts, ", "))
-	out.WriteString("]")
-	return out.String()
+
+	switch obj := obj.(type) {
+	case *Array:
+		return "[" + strings.Join(inspectAll(obj.Values(), showing), ", ") + "]"
+	case *Tuple:
+		parts := inspectAll(obj.Elements, showing)
+		if len(parts) == 1 {
+			return "(" + parts[0] + ",)"
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	case *Map:
+		pairs := []string{}
+		for _, pair := range obj.Entries() {
+			pairs = append(pairs, inspect(pair.Key, showing)+": "+inspect(pair.Value, showing))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *StructInstance:
+		parts := []string{}
+		fields := obj.FieldValues()
+		for _, k := range obj.Definition.Fields {
+			if v, ok := fields[k]; ok {
+				parts = append(parts, k+": "+inspect(v, showing))
+			}
+		}
+		return obj.Definition.Name + "{" + strings.Join(parts, ", ") + "}"
+	case *EnumValue:
+		name := obj.Variant.Enum.Name + "." + obj.Variant.Name
+		if obj.Variant.Fields == nil {
+			return name
+		}
+		return name + "(" + strings.Join(inspectAll(obj.Values, showing), ", ") + ")"
+	}
+	return obj.Inspect()
+}
+
+func inspectAll(objs []Object, showing map[Object]bool) []string {
+	parts := make([]string, len(objs))
+	for i, obj := range objs {
+		parts[i] = inspect(obj, showing)
+	}
+	return parts
 }
 
 // ==============================================================================================
@@ -190,45 +325,589 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: STRING_OBJ, Value: h.Sum64()}
 }
 
+func (c *Char) HashKey() HashKey {
+	return HashKey{Type: CHAR_OBJ, Value: uint64(c.Value)}
+}
+
+// HashKey hashes the variant's qualified name and its associated values.
+func (e *EnumValue) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(e.Variant.Enum.Name + "." + e.Variant.Name))
+	for _, v := range e.Values {
+		if hashable, ok := v.(Hashable); ok {
+			key := hashable.HashKey()
+			fmt.Fprintf(h, "|%s:%d", key.Type, key.Value)
+		} else {
+			h.Write([]byte("|" + v.Inspect()))
+		}
+	}
+	return HashKey{Type: ENUM_OBJ, Value: h.Sum64()}
+}
+
+// HashKey combines the keys of the tuple's elements. Callers must check HashKeyOf first:
+// a tuple holding an array or a map has no stable key.
+func (t *Tuple) HashKey() HashKey {
+	h := fnv.New64a()
+	for _, el := range t.Elements {
+		key, _ := HashKeyOf(el)
+		fmt.Fprintf(h, "|%s:%d", key.Type, key.Value)
+	}
+	return HashKey{Type: TUPLE_OBJ, Value: h.Sum64()}
+}
+
+// HashKeyOf returns the map key of obj, and false when obj cannot be a map key.
+// Tuples are only usable as keys when every element is. Arrays, maps and struct instances
+// can change, so they are only usable once frozen (and then hash by content). A value that
+// contains itself has no content to hash and is not usable either.
+func HashKeyOf(obj Object) (HashKey, bool) {
+	return hashKeyOf(obj, nil)
+}
+
+// hashKeyOf is HashKeyOf for a value inside the containers being hashed, in hashing.
+func hashKeyOf(obj Object, hashing map[Object]bool) (HashKey, bool) {
+	if isContainer(obj) {
+		if hashing[obj] {
+			return HashKey{}, false
+		}
+		if hashing == nil {
+			hashing = make(map[Object]bool)
+		}
+		hashing[obj] = true
+		defer delete(hashing, obj)
+	}
+
+	switch obj := obj.(type) {
+	case *Tuple:
+		for _, el := range obj.Elements {
+			if _, ok := hashKeyOf(el, hashing); !ok {
+				return HashKey{}, false
+			}
+		}
+	case *Array:
+		if !IsFrozen(obj) {
+			return HashKey{}, false
+		}
+		return hashElements(ARRAY_OBJ, "", obj.Values(), hashing)
+	case *StructInstance:
+		if !IsFrozen(obj) {
+			return HashKey{}, false
+		}
+		fields := obj.FieldValues()
+		values := make([]Object, len(obj.Definition.Fields))
+		for i, name := range obj.Definition.Fields {
+			values[i] = fields[name]
+		}
+		return hashElements(STRUCT_INST_OBJ, obj.Definition.Name, values, hashing)
+	case *Map:
+		if !IsFrozen(obj) {
+			return HashKey{}, false
+		}
+		// Pairs have no order, so their hashes are combined with an order-independent sum
+		var sum uint64
+		for key, pair := range obj.Entries() {
+			value, ok := hashElements(MAP_OBJ, "", []Object{pair.Value}, hashing)
+			if !ok {
+				return HashKey{}, false
+			}
+			sum += key.Value*31 + value.Value
+		}
+		return HashKey{Type: MAP_OBJ, Value: sum}, true
+	}
+	hashable, ok := obj.(Hashable)
+	if !ok {
+		return HashKey{}, false
+	}
+	return hashable.HashKey(), true
+}
+
+// hashElements hashes a sequence of values under a type and a name, failing if any
+// value is not hashable.
+func hashElements(t ObjectType, name string, values []Object, hashing map[Object]bool) (HashKey, bool) {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	for _, v := range values {
+		key, ok := hashKeyOf(v, hashing)
+		if !ok {
+			return HashKey{}, false
+		}
+		fmt.Fprintf(h, "|%s:%d", key.Type, key.Value)
+	}
+	return HashKey{Type: t, Value: h.Sum64()}, true
+}
+
+// isContainer reports whether obj is an array, map or struct instance: a value that can be
+// changed in place, and so come to contain itself through an element or field pointer.
+func isContainer(obj Object) bool {
+	switch obj.(type) {
+	case *Array, *Map, *StructInstance:
+		return true
+	}
+	return false
+}
+
+// Freeze marks arrays, maps and struct instances read-only, recursing into their contents.
+// Other values are immutable already and are left alone.
+func Freeze(obj Object) {
+	freeze(obj, make(map[Object]bool))
+}
+
+// freeze is Freeze, skipping the containers in seen so a value that contains itself ends.
+func freeze(obj Object, seen map[Object]bool) {
+	if isContainer(obj) {
+		if seen[obj] {
+			return
+		}
+		seen[obj] = true
+	}
+	switch obj := obj.(type) {
+	case *Array:
+		obj.mu.Lock()
+		obj.Frozen = true
+		obj.mu.Unlock()
+		for _, el := range obj.Values() {
+			freeze(el, seen)
+		}
+	case *Tuple:
+		for _, el := range obj.Elements {
+			freeze(el, seen)
+		}
+	case *Map:
+		obj.mu.Lock()
+		obj.Frozen = true
+		obj.mu.Unlock()
+		for _, pair := range obj.Entries() {
+			freeze(pair.Value, seen)
+		}
+	case *StructInstance:
+		obj.mu.Lock()
+		obj.Frozen = true
+		obj.mu.Unlock()
+		for _, v := range obj.FieldValues() {
+			freeze(v, seen)
+		}
+	case *EnumValue:
+		for _, v := range obj.Values {
+			freeze(v, seen)
+		}
+	}
+}
+
+// IsFrozen reports whether a value has been frozen and must not be modified in place.
+func IsFrozen(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		obj.mu.RLock()
+		defer obj.mu.RUnlock()
+		return obj.Frozen
+	case *Map:
+		obj.mu.RLock()
+		defer obj.mu.RUnlock()
+		return obj.Frozen
+	case *StructInstance:
+		obj.mu.RLock()
+		defer obj.mu.RUnlock()
+		return obj.Frozen
+	}
+	return false
+}
+
+// Equal reports whether two objects hold the same value.
+// Primitives compare by value, Arrays, Maps and Struct Instances compare element by element,
+// and everything else (functions, pointers, builtins) compares by identity.
+func Equal(a, b Object) bool {
+	return equal(a, b, nil)
+}
+
+// objectPair is two containers being compared.
+type objectPair struct{ a, b Object }
+
+// equal is Equal for values inside the containers being compared, in comparing. Meeting a
+// pair again means both values contain themselves in the same way: that pair is assumed
+// equal, and the comparison is decided by the rest of the values.
+func equal(a, b Object, comparing map[objectPair]bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if isContainer(a) {
+		pair := objectPair{a, b}
+		if comparing[pair] {
+			return true
+		}
+		if comparing == nil {
+			comparing = make(map[objectPair]bool)
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+	}
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Float:
+		return a.Value == b.(*Float).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Char:
+		return a.Value == b.(*Char).Value
+	case *Null:
+		return true
+	case *Array:
+		return equalElements(a.Values(), b.(*Array).Values(), comparing)
+	case *Tuple:
+		return equalElements(a.Elements, b.(*Tuple).Elements, comparing)
+	case *Map:
+		pairs, others := a.Entries(), b.(*Map).Entries()
+		if len(pairs) != len(others) {
+			return false
+		}
+		for key, pair := range pairs {
+			otherPair, ok := others[key]
+			if !ok || !equal(pair.Value, otherPair.Value, comparing) {
+				return false
+			}
+		}
+		return true
+	case *EnumValue:
+		other := b.(*EnumValue)
+		if a.Variant != other.Variant {
+			return false
+		}
+		for i := range a.Values {
+			if !equal(a.Values[i], other.Values[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *Pointer:
+		return a.Same(b.(*Pointer))
+	case *StructInstance:
+		other := b.(*StructInstance)
+		fields, others := a.FieldValues(), other.FieldValues()
+		if a.Definition != other.Definition || len(fields) != len(others) {
+			return false
+		}
+		for name, val := range fields {
+			if !equal(val, others[name], comparing) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func equalElements(a, b []Object, comparing map[objectPair]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !equal(a[i], b[i], comparing) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare orders two values, returning -1, 0 or 1. Numbers compare numerically (an Integer
+// with a Float included), strings and chars by code point, and arrays and tuples
+// lexicographically, element by element. The second result is false for values without
+// an order, such as maps or a number and a string.
+func Compare(a, b Object) (int, bool) {
+	return compare(a, b, nil)
+}
+
+// compare is Compare for values inside the arrays being compared, in comparing. Like equal,
+// it takes a pair of arrays met again to be equal.
+func compare(a, b Object, comparing map[objectPair]bool) (int, bool) {
+	if _, ok := a.(*Array); ok {
+		pair := objectPair{a, b}
+		if comparing[pair] {
+			return 0, true
+		}
+		if comparing == nil {
+			comparing = make(map[objectPair]bool)
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+	}
+	switch a := a.(type) {
+	case *Integer:
+		switch b := b.(type) {
+		case *Integer:
+			return cmp.Compare(a.Value, b.Value), true
+		case *Float:
+			return cmp.Compare(float64(a.Value), b.Value), true
+		}
+	case *Float:
+		switch b := b.(type) {
+		case *Integer:
+			return cmp.Compare(a.Value, float64(b.Value)), true
+		case *Float:
+			return cmp.Compare(a.Value, b.Value), true
+		}
+	case *String, *Char:
+		if b.Type() == STRING_OBJ || b.Type() == CHAR_OBJ {
+			return strings.Compare(a.Inspect(), b.Inspect()), true
+		}
+	case *Array:
+		if b, ok := b.(*Array); ok {
+			return compareElements(a.Values(), b.Values(), comparing)
+		}
+	case *Tuple:
+		if b, ok := b.(*Tuple); ok {
+			return compareElements(a.Elements, b.Elements, comparing)
+		}
+	}
+	return 0, false
+}
+
+func compareElements(a, b []Object, comparing map[objectPair]bool) (int, bool) {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		c, ok := compare(a[i], b[i], comparing)
+		if !ok || c != 0 {
+			return c, ok
+		}
+	}
+	return cmp.Compare(len(a), len(b)), true
+}
+
+// Map holds values by key. Like an Array it may be shared by tasks: its entries are read
+// through Get, Len and Entries.
 type Map struct {
-	Pairs map[HashKey]HashPair
+	Pairs  map[HashKey]HashPair
+	Frozen bool // Set by freeze(); frozen maps are read-only and hashable
+	mu     sync.RWMutex
 }
 
 func (m *Map) Type() ObjectType { return MAP_OBJ }
-func (m *Map) Inspect() string {
-	var out bytes.Buffer
-	pairs := []string{}
-	for _, pair := range m.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(),
-			pair.Value.Inspect(),
-		))
+func (m *Map) Inspect() string  { return inspect(m, nil) }
+
+// Get returns the entry under a key.
+func (m *Map) Get(key HashKey) (HashPair, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	pair, ok := m.Pairs[key]
+	return pair, ok
+}
+
+// Len returns the number of entries.
+func (m *Map) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.Pairs)
+}
+
+// Entries returns a copy of the entries.
+func (m *Map) Entries() map[HashKey]HashPair {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make(map[HashKey]HashPair, len(m.Pairs))
+	for key, pair := range m.Pairs {
+		entries[key] = pair
 	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-	return out.String()
+	return entries
 }
 
 // ==============================================================================================
 // POINTERS
 // ==============================================================================================
 
+// Pointer refers to a storage location. Variable pointers hold the variable's name and the
+// scope it lives in; pointers to struct fields, array elements, map entries and heap cells
+// hold the location itself, so they keep referring to the same container whatever happens
+// to the names that led to it.
 type Pointer struct {
-	Name string       // The name of the variable being pointed to
-	Env  *Environment // The specific scope where that variable lives
+	Name    string       // The variable pointed to, or a description of the location ("user.age")
+	Env     *Environment // The scope where the variable lives; nil for other locations
+	Version int          // The variable's binding when the pointer was taken (see Environment.Version)
+	Target  Location     // The field, element, entry or cell pointed to; nil for variables
 }
 
 func (p *Pointer) Type() ObjectType { return POINTER_OBJ }
 func (p *Pointer) Inspect() string  { return "pointing to " + p.Name }
 
+// NewPointer creates a pointer to a location other than a variable. The name is only
+// used to show the pointer.
+func NewPointer(name string, target Location) *Pointer {
+	return &Pointer{Name: name, Target: target}
+}
+
+// Load reads the value the pointer refers to. A map entry that does not exist reads as nil.
+func (p *Pointer) Load() (Object, error) {
+	if p.Target != nil {
+		return p.Target.Load(), nil
+	}
+	if err := p.dangling(); err != nil {
+		return nil, err
+	}
+	val, _ := p.Env.Get(p.Name)
+	return val, nil
+}
+
+// dangling reports a variable pointer whose variable is gone or was declared again.
+func (p *Pointer) dangling() error {
+	if p.Env == nil || p.Env.Resolve(p.Name) != p.Env {
+		return fmt.Errorf("dangling pointer: %s", p.Name)
+	}
+	if p.Env.Version(p.Name) != p.Version {
+		return fmt.Errorf("dangling pointer: %s was declared again after the pointer was taken", p.Name)
+	}
+	return nil
+}
+
+// Store writes through the pointer. Constants and frozen containers refuse the write.
+func (p *Pointer) Store(val Object) error {
+	if p.Target != nil {
+		return p.Target.Store(val)
+	}
+	if err := p.dangling(); err != nil {
+		return err
+	}
+	if err := p.Env.Assign(p.Name, val); err != nil {
+		return fmt.Errorf("%s through a pointer", err)
+	}
+	return nil
+}
+
+// DeclaredType returns the type the pointed-to variable or struct field was declared with.
+func (p *Pointer) DeclaredType() (string, bool) {
+	switch t := p.Target.(type) {
+	case nil:
+		return p.Env.DeclaredType(p.Name)
+	case FieldLocation:
+		declared, ok := t.Instance.Definition.FieldTypes[t.Field]
+		return declared, ok
+	}
+	return "", false
+}
+
+// Same reports whether two pointers refer to the same location.
+func (p *Pointer) Same(q *Pointer) bool {
+	if p.Target == nil || q.Target == nil {
+		return p.Target == nil && q.Target == nil && p.Env == q.Env && p.Name == q.Name && p.Version == q.Version
+	}
+	if a, ok := p.Target.(EntryLocation); ok {
+		b, ok := q.Target.(EntryLocation)
+		if !ok || a.Map != b.Map {
+			return false
+		}
+		ka, _ := HashKeyOf(a.Key)
+		kb, _ := HashKeyOf(b.Key)
+		return ka == kb
+	}
+	return p.Target == q.Target
+}
+
+// Location is a place a pointer can read and write, other than a variable.
+type Location interface {
+	Load() Object
+	Store(val Object) error
+}
+
+// FieldLocation is a field of a struct instance (pointing to user.age).
+type FieldLocation struct {
+	Instance *StructInstance
+	Field    string
+}
+
+func (l FieldLocation) Load() Object {
+	val, _ := l.Instance.Field(l.Field)
+	return val
+}
+func (l FieldLocation) Store(val Object) error {
+	l.Instance.mu.Lock()
+	defer l.Instance.mu.Unlock()
+	if l.Instance.Frozen {
+		return fmt.Errorf("cannot modify frozen %s", l.Instance.Definition.Name)
+	}
+	l.Instance.Fields[l.Field] = val
+	return nil
+}
+
+// ElementLocation is an element of an array (pointing to list[0]).
+type ElementLocation struct {
+	Array *Array
+	Index int
+}
+
+func (l ElementLocation) Load() Object {
+	val, _ := l.Array.At(l.Index)
+	return val
+}
+func (l ElementLocation) Store(val Object) error {
+	l.Array.mu.Lock()
+	defer l.Array.mu.Unlock()
+	if l.Array.Frozen {
+		return fmt.Errorf("cannot modify frozen array")
+	}
+	l.Array.Elements[l.Index] = val
+	return nil
+}
+
+// EntryLocation is the entry of a map under a key, which need not exist yet
+// (pointing to counts["a"]). Reading a missing entry gives nil; writing creates it.
+type EntryLocation struct {
+	Map *Map
+	Key Object
+}
+
+func (l EntryLocation) Load() Object {
+	key, _ := HashKeyOf(l.Key)
+	if pair, ok := l.Map.Get(key); ok {
+		return pair.Value
+	}
+	return nil
+}
+func (l EntryLocation) Store(val Object) error {
+	key, _ := HashKeyOf(l.Key)
+	l.Map.mu.Lock()
+	defer l.Map.mu.Unlock()
+	if l.Map.Frozen {
+		return fmt.Errorf("cannot modify frozen map")
+	}
+	l.Map.Pairs[key] = HashPair{Key: l.Key, Value: val}
+	return nil
+}
+
+// Cell is an anonymous storage location created by new(value).
+type Cell struct {
+	Value Object
+	mu    sync.Mutex
+}
+
+func (c *Cell) Load() Object {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Value
+}
+func (c *Cell) Store(val Object) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Value = val
+	return nil
+}
+
 // ==============================================================================================
 // STRUCTS
 // ==============================================================================================
 
 type StructDefinition struct {
-	Name   string
-	Fields []string
+	Name       string
+	Fields     []string                // Every field in order, promoted fields of embedded structs first
+	FieldTypes map[string]string       // Declared field types; unannotated fields are absent
+	Defaults   map[string]FieldDefault // Default values; fields without one are required
+	Embedded   []*StructDefinition     // Structs embedded with "...Name" whose fields are promoted
+}
+
+// FieldDefault is the expression that initialises an omitted field, evaluated afresh for
+// every instance in the scope of the definition that declared it.
+type FieldDefault struct {
+	Value ast.Expression
+	Env   *Environment
 }
 
 func (sd *StructDefinition) Type() ObjectType { return STRUCT_DEF_OBJ }
@@ -236,23 +915,116 @@ func (sd *StructDefinition) Inspect() string {
 	return "struct " + sd.Name
 }
 
+// HasField reports whether the struct has a field with the given name (own or promoted).
+func (sd *StructDefinition) HasField(name string) bool {
+	for _, f := range sd.Fields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes reports whether the struct is the named struct or embeds it, directly or indirectly.
+// An instance can be used wherever one of the structs it includes is expected.
+func (sd *StructDefinition) Includes(name string) bool {
+	if sd.Name == name {
+		return true
+	}
+	for _, e := range sd.Embedded {
+		if e.Includes(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// StructInstance is a value of a struct. Its fields are read through Field and FieldValues,
+// since tasks may share the instance.
 type StructInstance struct {
 	Definition *StructDefinition
 	Fields     map[string]Object
+	Frozen     bool // Set by freeze(); frozen instances are read-only and hashable
+	mu         sync.RWMutex
 }
 
 func (si *StructInstance) Type() ObjectType { return STRUCT_INST_OBJ }
-func (si *StructInstance) Inspect() string {
-	var out bytes.Buffer
-	parts := []string{}
-	for k, v := range si.Fields {
-		parts = append(parts, fmt.Sprintf("%s: %s", k, v.Inspect()))
+func (si *StructInstance) Inspect() string  { return inspect(si, nil) }
+
+// Field returns the value of a field, and false when the instance has no such field.
+func (si *StructInstance) Field(name string) (Object, bool) {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	val, ok := si.Fields[name]
+	return val, ok
+}
+
+// FieldValues returns a copy of the fields.
+func (si *StructInstance) FieldValues() map[string]Object {
+	si.mu.RLock()
+	defer si.mu.RUnlock()
+	fields := make(map[string]Object, len(si.Fields))
+	for name, val := range si.Fields {
+		fields[name] = val
+	}
+	return fields
+}
+
+// ==============================================================================================
+// ENUMS
+// ==============================================================================================
+
+// EnumDefinition is the type created by `define Color as enum { ... }`.
+type EnumDefinition struct {
+	Name     string
+	Variants []*EnumVariant // In declaration order
+}
+
+func (ed *EnumDefinition) Type() ObjectType { return ENUM_DEF_OBJ }
+func (ed *EnumDefinition) Inspect() string  { return "enum " + ed.Name }
+
+// Variant looks a variant up by name.
+func (ed *EnumDefinition) Variant(name string) (*EnumVariant, bool) {
+	for _, v := range ed.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// EnumVariant describes one variant. A plain variant has a single shared Value;
+// a variant with associated values is called like a function to build a new EnumValue.
+type EnumVariant struct {
+	Enum       *EnumDefinition
+	Name       string
+	Fields     []string          // Names of the associated values (nil for plain variants)
+	FieldTypes map[string]string // Declared field types; unannotated fields are absent
+	Value      *EnumValue        // The one value of a plain variant (nil when it has fields)
+}
+
+func (ev *EnumVariant) Type() ObjectType { return ENUM_VARIANT }
+func (ev *EnumVariant) Inspect() string {
+	return ev.Enum.Name + "." + ev.Name + "(" + strings.Join(ev.Fields, ", ") + ")"
+}
+
+// EnumValue is a variant as a value. Plain variants are singletons, so they compare by identity.
+type EnumValue struct {
+	Variant *EnumVariant
+	Values  []Object // Associated values, in the order of Variant.Fields
+}
+
+func (e *EnumValue) Type() ObjectType { return ENUM_OBJ }
+func (e *EnumValue) Inspect() string  { return inspect(e, nil) }
+
+// Field returns an associated value by name.
+func (e *EnumValue) Field(name string) (Object, bool) {
+	for i, f := range e.Variant.Fields {
+		if f == name {
+			return e.Values[i], true
+		}
 	}
-	out.WriteString(si.Definition.Name)
-	out.WriteString("{")
-	out.WriteString(strings.Join(parts, ", "))
-	out.WriteString("}")
-	return out.String()
+	return nil, false
 }
 
 // ==============================================================================================
@@ -261,6 +1033,9 @@ func (si *StructInstance) Inspect() string {
 
 type Builtin struct {
 	Fn func(args ...Object) Object
+	// FnAt replaces Fn for builtins that call functions back: it is given the call depth of the
+	// code calling the builtin, to pass on to ApplyFunction.
+	FnAt func(depth int, args ...Object) Object
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -32,6 +32,8 @@ func TestObjectInspect(t *testing.T) {
 
 		// Complex
 		{&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}}, "[1, 2]"},
+		{&Tuple{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}, "(1, a)"},
+		{&Tuple{Elements: []Object{&Integer{Value: 1}}}, "(1,)"},
 		{&Function{}, "takes(...) { ... }"},
 		{&StructDefinition{Name: "User"}, "struct User"},
 		{&Pointer{Name: "ptr"}, "pointing to ptr"},
@@ -54,6 +56,7 @@ func TestObjectType(t *testing.T) {
 		{&String{Value: "x"}, STRING_OBJ},
 		{&Null{}, NULL_OBJ},
 		{&Array{}, ARRAY_OBJ},
+		{&Tuple{}, TUPLE_OBJ},
 		{&Map{}, MAP_OBJ},
 		{&StructInstance{}, STRUCT_INST_OBJ},
 	}
@@ -91,3 +94,273 @@ func TestHashKeys(t *testing.T) {
 		t.Errorf("different integers have same hash key")
 	}
 }
+
+func TestTupleHashKeys(t *testing.T) {
+	tuple := func(els ...Object) *Tuple { return &Tuple{Elements: els} }
+
+	a, ok1 := HashKeyOf(tuple(&Integer{Value: 1}, &String{Value: "x"}))
+	b, ok2 := HashKeyOf(tuple(&Integer{Value: 1}, &String{Value: "x"}))
+	if !ok1 || !ok2 || a != b {
+		t.Errorf("equal tuples have different hash keys: %v %v", a, b)
+	}
+	if c, _ := HashKeyOf(tuple(&String{Value: "x"}, &Integer{Value: 1})); c == a {
+		t.Errorf("tuples in a different order have the same hash key")
+	}
+	if nested, ok := HashKeyOf(tuple(tuple(&Integer{Value: 1}))); !ok || nested == a {
+		t.Errorf("nested tuples should be hashable with their own key, got %v %v", nested, ok)
+	}
+	if _, ok := HashKeyOf(tuple(&Array{})); ok {
+		t.Errorf("a tuple holding an array must not be hashable")
+	}
+	if _, ok := HashKeyOf(&Array{}); ok {
+		t.Errorf("arrays must not be hashable")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	arr := func(els ...Object) *Array { return &Array{Elements: els} }
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	tests := []struct {
+		a, b     Object
+		expected int
+		ok       bool
+	}{
+		{one, two, -1, true},
+		{two, &Float{Value: 1.5}, 1, true},
+		{&String{Value: "apple"}, &String{Value: "banana"}, -1, true},
+		{&Char{Value: 'b'}, &String{Value: "b"}, 0, true},
+		{arr(one, two), arr(one, two), 0, true},
+		{arr(one, two), arr(one), 1, true},
+		{arr(one), arr(two, one), -1, true},
+		{&Tuple{Elements: []Object{two}}, &Tuple{Elements: []Object{one}}, 1, true},
+		{arr(one), arr(&String{Value: "a"}), 0, false},
+		{arr(one), &Tuple{Elements: []Object{one}}, 0, false},
+		{&Map{}, &Map{}, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := Compare(tt.a, tt.b)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("Compare(%s, %s): expected (%d, %t), got (%d, %t)",
+				tt.a.Inspect(), tt.b.Inspect(), tt.expected, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	inner := &Array{Elements: []Object{&Integer{Value: 2}}}
+	m := &Map{Pairs: map[HashKey]HashPair{}}
+	key := (&String{Value: "k"}).HashKey()
+	m.Pairs[key] = HashPair{Key: &String{Value: "k"}, Value: inner}
+	arr := &Array{Elements: []Object{&Integer{Value: 1}, m}}
+
+	if _, ok := HashKeyOf(arr); ok {
+		t.Fatalf("an unfrozen array must not be hashable")
+	}
+	Freeze(arr)
+	for _, obj := range []Object{arr, m, inner} {
+		if !IsFrozen(obj) {
+			t.Errorf("freeze did not reach %s", obj.Inspect())
+		}
+	}
+
+	a, ok1 := HashKeyOf(arr)
+	copyArr := &Array{Elements: []Object{&Integer{Value: 1}, m}, Frozen: true}
+	b, ok2 := HashKeyOf(copyArr)
+	if !ok1 || !ok2 || a != b {
+		t.Errorf("equal frozen arrays have different hash keys: %v %v", a, b)
+	}
+
+	def := &StructDefinition{Name: "P", Fields: []string{"x"}}
+	inst := &StructInstance{Definition: def, Fields: map[string]Object{"x": &Array{}}, Frozen: true}
+	if _, ok := HashKeyOf(inst); ok {
+		t.Errorf("a frozen instance holding an unfrozen array must not be hashable")
+	}
+	Freeze(inst)
+	if _, ok := HashKeyOf(inst); !ok {
+		t.Errorf("a frozen instance should be hashable")
+	}
+}
+
+// TestCyclicValues checks that values which contain themselves, as element and field
+// pointers allow, can still be shown, compared, frozen and hashed.
+func TestCyclicValues(t *testing.T) {
+	// a is [a, 1], b is [[b, 1], 1], m is {"self": m}, p is P { next: p }
+	a := &Array{Elements: []Object{nil, &Integer{Value: 1}}}
+	a.Elements[0] = a
+	b := &Array{Elements: []Object{nil, &Integer{Value: 1}}}
+	b.Elements[0] = &Array{Elements: []Object{b, &Integer{Value: 1}}}
+	c := &Array{Elements: []Object{nil, &Integer{Value: 2}}}
+	c.Elements[0] = c
+	m := &Map{Pairs: map[HashKey]HashPair{}}
+	key := &String{Value: "self"}
+	m.Pairs[key.HashKey()] = HashPair{Key: key, Value: m}
+	def := &StructDefinition{Name: "P", Fields: []string{"next"}}
+	p := &StructInstance{Definition: def, Fields: map[string]Object{}}
+	p.Fields["next"] = p
+
+	inspects := []struct {
+		obj      Object
+		expected string
+	}{
+		{a, "[[...], 1]"},
+		{b, "[[[...], 1], 1]"},
+		{m, "{self: {...}}"},
+		{p, "P{next: P{...}}"},
+		{&Tuple{Elements: []Object{a, a}}, "([[...], 1], [[...], 1])"}, // Shared, not cyclic, inside the tuple
+	}
+	for _, tt := range inspects {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, got)
+		}
+	}
+
+	if !Equal(a, a) || !Equal(a, b) || Equal(a, c) || !Equal(m, m) || !Equal(p, p) {
+		t.Errorf("cyclic values compare wrongly: a=a %v, a=b %v, a=c %v", Equal(a, a), Equal(a, b), Equal(a, c))
+	}
+	if order, ok := Compare(a, c); !ok || order != -1 {
+		t.Errorf("expected a to order before c, got %d %v", order, ok)
+	}
+
+	Freeze(a)
+	Freeze(m)
+	Freeze(p)
+	for _, obj := range []Object{a, m, p} {
+		if !IsFrozen(obj) {
+			t.Errorf("freeze did not reach %s", obj.Inspect())
+		}
+		if _, ok := HashKeyOf(obj); ok {
+			t.Errorf("a value that contains itself must not be hashable: %s", obj.Inspect())
+		}
+	}
+}
+
+func TestPointerLocations(t *testing.T) {
+	def := &StructDefinition{Name: "U", Fields: []string{"age"}, FieldTypes: map[string]string{"age": "Integer"}}
+	inst := &StructInstance{Definition: def, Fields: map[string]Object{"age": &Integer{Value: 1}}}
+	field := NewPointer("u.age", FieldLocation{Instance: inst, Field: "age"})
+	if err := field.Store(&Integer{Value: 2}); err != nil || inst.Fields["age"].Inspect() != "2" {
+		t.Errorf("field store failed: %v", err)
+	}
+	if declared, ok := field.DeclaredType(); !ok || declared != "Integer" {
+		t.Errorf("field declared type wrong: %q", declared)
+	}
+
+	m := &Map{Pairs: map[HashKey]HashPair{}}
+	entry := NewPointer("m[k]", EntryLocation{Map: m, Key: &String{Value: "k"}})
+	if val, _ := entry.Load(); val != nil {
+		t.Errorf("a missing entry should load as nil, got %v", val)
+	}
+	entry.Store(&Integer{Value: 3})
+	if val, _ := entry.Load(); val == nil || val.Inspect() != "3" {
+		t.Errorf("entry store did not create the entry")
+	}
+	same := NewPointer("m[k]", EntryLocation{Map: m, Key: &String{Value: "k"}})
+	if !Equal(entry, same) {
+		t.Errorf("pointers to the same entry should be equal")
+	}
+
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}, Frozen: true}
+	elem := NewPointer("xs[0]", ElementLocation{Array: arr, Index: 0})
+	if err := elem.Store(&Integer{Value: 2}); err == nil {
+		t.Errorf("storing into a frozen array should fail")
+	}
+
+	a, b := NewPointer("new cell", &Cell{Value: &Null{}}), NewPointer("new cell", &Cell{Value: &Null{}})
+	if Equal(a, b) || !Equal(a, a) {
+		t.Errorf("cells should only equal themselves")
+	}
+
+	env := NewEnvironment()
+	env.Set("x", &Integer{Value: 1})
+	v := &Pointer{Name: "x", Env: env, Version: env.Version("x")}
+	env.Let("x", &Integer{Value: 2})
+	if _, err := v.Load(); err == nil {
+		t.Errorf("a pointer to a redeclared variable should be dangling")
+	}
+}
+
+func TestIteratorProtocol(t *testing.T) {
+	ints := func(values ...int64) []Object {
+		out := []Object{}
+		for _, v := range values {
+			out = append(out, &Integer{Value: v})
+		}
+		return out
+	}
+	drain := func(it Iterator) string {
+		return (&Array{Elements: collectValues(it)}).Inspect()
+	}
+
+	if _, ok := Iterate(&Integer{Value: 1}); ok {
+		t.Errorf("integers should not be iterable")
+	}
+	arr, _ := Iterate(&Array{Elements: ints(1, 2, 3, 4)})
+	if got := drain(SkipValues(TakeValues(arr, 3), 1)); got != "[2, 3]" {
+		t.Errorf("skip(take(...)) wrong: %s", got)
+	}
+
+	closed := false
+	source := &Generator{
+		NextFn:  func() (Object, bool) { return &Integer{Value: 7}, true }, // Endless
+		CloseFn: func() { closed = true },
+	}
+	double := MapValues(source, func(v Object) Object { return &Integer{Value: v.(*Integer).Value * 2} })
+	if got := drain(TakeValues(double, 2)); got != "[14, 14]" {
+		t.Errorf("take(map(...)) wrong: %s", got)
+	}
+	if !closed {
+		t.Errorf("take should close its source once it has produced its values")
+	}
+	if _, ok := source.Next(); ok {
+		t.Errorf("a closed generator should produce nothing")
+	}
+
+	fails := &Generator{NextFn: func() (Object, bool) { return &Error{Message: "boom"}, true }}
+	if val, _ := FilterValues(fails, func(Object) Object { return &Boolean{Value: true} }).Next(); val.Inspect() != "ERROR: boom" {
+		t.Errorf("errors should pass through filter, got %s", val.Inspect())
+	}
+	if _, ok := fails.Next(); ok {
+		t.Errorf("a generator that failed should be closed")
+	}
+}
+
+func collectValues(it Iterator) []Object {
+	values := []Object{}
+	for val, ok := it.Next(); ok; val, ok = it.Next() {
+		values = append(values, val)
+	}
+	return values
+}
+
+func TestTasksAndChannels(t *testing.T) {
+	task := NewTask()
+	if task.Inspect() != "task (running)" {
+		t.Errorf("unfinished task shows %q", task.Inspect())
+	}
+	go task.Finish(&Integer{Value: 3})
+	if got := task.Wait(); got.Inspect() != "3" {
+		t.Errorf("wait returned %s", got.Inspect())
+	}
+
+	ch := NewChannel(1)
+	if err := ch.Send(&String{Value: "a"}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if err := ch.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	it, ok := Iterate(ch)
+	if !ok {
+		t.Fatalf("channels should be iterable")
+	}
+	if got := collectValues(it); len(got) != 1 || got[0].Inspect() != "a" {
+		t.Errorf("iterating a closed channel should give what was sent, got %v", got)
+	}
+	if err := ch.Send(&Null{}); err == nil {
+		t.Errorf("sending on a closed channel should fail")
+	}
+	if err := ch.Close(); err == nil {
+		t.Errorf("closing a channel twice should fail")
+	}
+}
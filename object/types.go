@@ -0,0 +1,86 @@
+// ==============================================================================================
+// FILE: object/types.go
+// ==============================================================================================
+// PACKAGE: object
+// PURPOSE: Maps runtime values to the type names programs write in annotations
+//          (`age as Integer`, `returns String`) and decides whether a value satisfies one.
+// ==============================================================================================
+
+package object
+
+// AnyType accepts every value. It is also what an unannotated binding has.
+const AnyType = "Any"
+
+// typeNames maps the builtin annotation names to the runtime types they accept.
+// "Number" accepts both numeric types; struct names are resolved separately.
+var typeNames = map[string][]ObjectType{
+	"Integer":   {INTEGER_OBJ},
+	"Float":     {FLOAT_OBJ},
+	"Number":    {INTEGER_OBJ, FLOAT_OBJ},
+	"String":    {STRING_OBJ},
+	"Char":      {CHAR_OBJ},
+	"Boolean":   {BOOLEAN_OBJ},
+	"Array":     {ARRAY_OBJ},
+	"Tuple":     {TUPLE_OBJ},
+	"Map":       {MAP_OBJ},
+	"Function":  {FUNCTION_OBJ, BUILTIN_OBJ, ENUM_VARIANT},
+	"Pointer":   {POINTER_OBJ},
+	"Generator": {GENERATOR_OBJ},
+	"Task":      {TASK_OBJ},
+	"Channel":   {CHANNEL_OBJ},
+	"None":      {NULL_OBJ},
+}
+
+// IsBuiltinType reports whether name is one of the predefined annotation types (including Any).
+func IsBuiltinType(name string) bool {
+	_, ok := typeNames[name]
+	return ok || name == AnyType
+}
+
+// TypeName returns the annotation name of a value's type: "Integer", "String", or the
+// struct's or enum's own name for struct instances and enum variants.
+func TypeName(obj Object) string {
+	switch obj := obj.(type) {
+	case *StructInstance:
+		return obj.Definition.Name
+	case *EnumValue:
+		return obj.Variant.Enum.Name
+	case *StructDefinition:
+		return "Struct"
+	case *EnumDefinition:
+		return "Enum"
+	case *Error:
+		return "Error"
+	}
+	for name, types := range typeNames {
+		if len(types) == 1 && types[0] == obj.Type() {
+			return name
+		}
+	}
+	switch obj.Type() {
+	case FUNCTION_OBJ, BUILTIN_OBJ, ENUM_VARIANT:
+		return "Function"
+	}
+	return string(obj.Type())
+}
+
+// Conforms reports whether a value satisfies the named type.
+// Names that are not builtin types are struct or enum names and match values of that type;
+// a struct instance also satisfies the structs its definition embeds.
+func Conforms(obj Object, typeName string) bool {
+	if typeName == AnyType {
+		return true
+	}
+	if types, ok := typeNames[typeName]; ok {
+		for _, t := range types {
+			if obj.Type() == t {
+				return true
+			}
+		}
+		return false
+	}
+	if inst, ok := obj.(*StructInstance); ok {
+		return inst.Definition.Includes(typeName)
+	}
+	return TypeName(obj) == typeName
+}
@@ -11,6 +11,9 @@ package parser
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"eloquence/ast"
 	"eloquence/lexer"
@@ -75,6 +78,11 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	functionDepth int                    // How many function literals enclose the current token
+	yielded       bool                   // Whether the innermost function literal being parsed contains yield
+	tryDepth      int                    // How many try statements of the innermost function enclose the current token
+	tails         []*ast.ReturnStatement // Tail calls of the innermost function literal being parsed
 }
 
 // New initializes the parser and fills the lookahead buffer.
@@ -90,6 +98,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
 	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.RAW_STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
 	p.registerPrefix(token.CHAR, p.parseCharLiteral)
 	p.registerPrefix(token.BOOL, p.parseBooleanLiteral)
 	p.registerPrefix(token.NIL, p.parseNilLiteral)
@@ -97,11 +107,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 	p.registerPrefix(token.TAKES, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral) // Maps { key: val }
 	p.registerPrefix(token.POINTING_TO, p.parsePointerReference)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
 	p.registerPrefix(token.POINTING_FROM, p.parsePointerDereference)
+	p.registerPrefix(token.ILLEGAL, p.parseIllegal)
 
 	// Register Infix Parsers (for tokens that sit between expressions)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -212,48 +225,134 @@ func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.YIELD:
+		return p.parseYieldStatement()
 	case token.DEFINE:
+		if p.peekTokenAt(1).Type == token.AS && p.peekTokenAt(2).Type == token.ENUM {
+			return p.parseEnumDefinition()
+		}
 		return p.parseStructDefinition()
 	case token.WHILE, token.REPEAT:
 		return p.parseLoopStatement()
 	case token.FOR:
 		return p.parseRangeLoopStatement()
 	case token.POINTING_FROM:
-		if p.isPointerAssignment() {
-			return p.parsePointerAssignment()
-		}
-		return p.parseExpressionStatement()
+		return p.parsePointerStatement()
 	case token.TRY:
 		return p.parseTryCatchStatement()
 	case token.INCLUDE:
 		return p.parseIncludeStatement()
+	case token.LET, token.CONSTANT, token.REDEFINE:
+		return p.parseModifiedAssignment()
 	default:
-		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.IS) {
+		if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.IS) || p.isTypedAssignment()) {
 			return p.parseAssignmentStatement()
 		}
+		if p.isDestructuring() {
+			return p.parseDestructuringStatement()
+		}
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) isPointerAssignment() bool {
-	if p.peekTokenIs(token.IDENT) && p.peekTokenAt(1).Type == token.IS {
+// isTypedAssignment looks ahead for "name as Type is ...".
+func (p *Parser) isTypedAssignment() bool {
+	return p.peekTokenIs(token.AS) && p.peekTokenAt(1).Type == token.IDENT && p.peekTokenAt(2).Type == token.IS
+}
+
+// isDestructuring looks ahead for "pattern is ...", where the pattern is a comma-separated
+// list of names, bracketed or braced groups and "...rest". Groups can be arbitrarily long,
+// so the scan runs on a fork of the lexer past the fixed lookahead buffer.
+func (p *Parser) isDestructuring() bool {
+	switch {
+	case p.curTokenIs(token.IDENT):
+		if !p.peekTokenIs(token.COMMA) && !p.peekTokenIs(token.LBRACE) {
+			return false
+		}
+	case !p.curTokenIs(token.LBRACKET) && !p.curTokenIs(token.LBRACE):
+		return false
+	}
+
+	fork := p.l.Fork()
+	i := -1
+	next := func() token.Token {
+		i++
+		if i == 0 {
+			return p.curToken
+		}
+		if i <= len(p.peekTokens) {
+			return p.peekTokens[i-1]
+		}
+		return fork.NextToken()
+	}
+	skipGroup := func(open, close token.TokenType) bool {
+		for depth := 1; depth > 0; {
+			switch next().Type {
+			case open:
+				depth++
+			case close:
+				depth--
+			case token.EOF:
+				return false
+			}
+		}
 		return true
 	}
-	return false
-}
 
-func (p *Parser) parsePointerAssignment() ast.Statement {
-	stmt := &ast.PointerAssignmentStatement{Token: p.curToken}
-	p.nextToken() // eat 'pointing from'
+	for {
+		var after token.Token
+		switch next().Type {
+		case token.IDENT:
+			// A name, or a struct pattern: Name { ... }
+			if after = next(); after.Type == token.LBRACE {
+				if !skipGroup(token.LBRACE, token.RBRACE) {
+					return false
+				}
+				after = next()
+			}
+		case token.ELLIPSIS:
+			if next().Type != token.IDENT {
+				return false
+			}
+			after = next()
+		case token.LBRACKET:
+			if !skipGroup(token.LBRACKET, token.RBRACKET) {
+				return false
+			}
+			after = next()
+		case token.LBRACE:
+			if !skipGroup(token.LBRACE, token.RBRACE) {
+				return false
+			}
+			after = next()
+		default:
+			return false
+		}
 
-	if !p.curTokenIs(token.IDENT) {
-		return nil
+		switch after.Type {
+		case token.IS:
+			return true
+		case token.COMMA:
+			continue
+		}
+		return false
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+}
 
-	if !p.expectPeek(token.IS) {
-		return nil
+// parsePointerStatement parses a statement starting with 'pointing from'. Followed by 'is'
+// it writes through the pointer (pointing from p.next is 3); otherwise it is an expression.
+// The pointer is any operand of a dereference, so chains work: pointing from pointing from pp is 5
+func (p *Parser) parsePointerStatement() ast.Statement {
+	expr := p.parseExpressionStatement()
+	deref, ok := expr.Expression.(*ast.PointerDereferenceExpression)
+	if !ok || !p.peekTokenIs(token.IS) {
+		return expr
+	}
+	stmt := &ast.PointerAssignmentStatement{Token: deref.Token, Target: deref.Value}
+	if ident, ok := deref.Value.(*ast.Identifier); ok {
+		stmt.Name = ident
 	}
+	p.nextToken() // move to 'is'
 	p.nextToken() // eat 'is'
 
 	stmt.Value = p.parseExpression(LOWEST)
@@ -263,6 +362,7 @@ func (p *Parser) parsePointerAssignment() ast.Statement {
 func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 	stmt := &ast.AssignmentStatement{Token: p.curToken}
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Type = p.parseTypeAnnotation()
 
 	if !p.expectPeek(token.IS) {
 		return nil
@@ -273,16 +373,95 @@ func (p *Parser) parseAssignmentStatement() *ast.AssignmentStatement {
 	return stmt
 }
 
+// parseModifiedAssignment parses "let NAME is value", "constant NAME is value" and
+// "redefine NAME is value".
+func (p *Parser) parseModifiedAssignment() ast.Statement {
+	modifier := p.curToken
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt := p.parseAssignmentStatement()
+	if stmt == nil {
+		return nil
+	}
+	stmt.Modifier = modifier
+	return stmt
+}
+
+// parseDestructuringStatement parses "pattern is value[, value...]".
+// Without brackets, "a, b" (and "head, ...tail") is read as an array pattern.
+func (p *Parser) parseDestructuringStatement() *ast.DestructuringStatement {
+	stmt := &ast.DestructuringStatement{Token: p.curToken}
+
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COMMA) {
+		pattern := &ast.ArrayPattern{Token: p.curToken}
+		for {
+			if p.curTokenIs(token.ELLIPSIS) {
+				if !p.expectPeek(token.IDENT) {
+					return nil
+				}
+				pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+				break
+			}
+			pattern.Elements = append(pattern.Elements, p.parsePattern())
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+			p.nextToken()
+		}
+		stmt.Pattern = pattern
+	} else {
+		stmt.Pattern = p.parsePattern()
+	}
+
+	if !p.expectPeek(token.IS) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Values = append(stmt.Values, p.parseExpression(LOWEST))
+	for p.peekTokenIs(token.COMMA) {
+		// A comma before the next match arm separates arms, not values
+		if after := p.peekTokenAt(1).Type; after == token.WHEN || after == token.OTHERWISE {
+			break
+		}
+		p.nextToken()
+		p.nextToken()
+		stmt.Values = append(stmt.Values, p.parseExpression(LOWEST))
+	}
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
-	p.nextToken()
 
-	// Allow return; (void return)
-	if p.curTokenIs(token.EOF) || p.curTokenIs(token.END) || p.curTokenIs(token.ELSE) {
+	// A bare return (void return) is followed directly by whatever closes the block
+	if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.END) ||
+		p.peekTokenIs(token.ELSE) || p.peekTokenIs(token.CATCH) || p.peekTokenIs(token.FINALLY) {
 		stmt.ReturnValue = nil
 		return stmt
 	}
+	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	// A try block must see the call finish (to catch its errors, or to run finally afterwards)
+	if _, ok := stmt.ReturnValue.(*ast.CallExpression); ok && p.functionDepth > 0 && p.tryDepth == 0 {
+		stmt.Tail = true
+		p.tails = append(p.tails, stmt)
+	}
+	return stmt
+}
+
+// parseYieldStatement parses "yield value" and marks the enclosing function as a generator.
+func (p *Parser) parseYieldStatement() ast.Statement {
+	stmt := &ast.YieldStatement{Token: p.curToken}
+	if p.functionDepth == 0 {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - yield outside a function",
+			p.curToken.Line, p.curToken.Column))
+	}
+	p.yielded = true
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 	return stmt
 }
 
@@ -300,22 +479,85 @@ func (p *Parser) parseStructDefinition() *ast.StructDefinitionStatement {
 	if !p.expectPeek(token.STRUCT) {
 		return nil
 	}
-	if !p.expectPeek(token.LBRACE) {
-		return nil
+
+	// Fields are listed either in braces or up to a closing 'end'
+	closer := token.TokenType(token.END)
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		closer = token.RBRACE
 	}
 
+	// Each entry is "...Embedded" or "name [as Type] [is default]"
 	stmt.Attributes = []*ast.Identifier{}
-	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+	for !p.peekTokenIs(closer) && !p.peekTokenIs(token.EOF) {
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		stmt.Attributes = append(stmt.Attributes, ident)
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			stmt.Embeds = append(stmt.Embeds, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		} else {
+			ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			stmt.Attributes = append(stmt.Attributes, ident)
+			stmt.AttributeTypes = append(stmt.AttributeTypes, p.parseTypeAnnotation())
+			var def ast.Expression
+			if p.peekTokenIs(token.IS) {
+				p.nextToken()
+				p.nextToken()
+				def = p.parseExpression(LOWEST)
+			}
+			stmt.Defaults = append(stmt.Defaults, def)
+		}
 		if p.peekTokenIs(token.COMMA) {
 			p.nextToken()
 		}
 	}
-	if !p.expectPeek(token.RBRACE) {
+	if !p.expectPeek(closer) {
 		return nil
 	}
+	stmt.Close = p.curToken
+	return stmt
+}
+
+func (p *Parser) parseEnumDefinition() *ast.EnumDefinitionStatement {
+	stmt := &ast.EnumDefinitionStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken() // 'as'
+	p.nextToken() // 'enum'
+
+	// Variants are listed either in braces or up to a closing 'end'
+	closer := token.TokenType(token.END)
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		closer = token.RBRACE
+	}
+
+	for !p.peekTokenIs(closer) && !p.peekTokenIs(token.EOF) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		variant := ast.EnumVariant{Name: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}}
+		// Associated values: Circle(radius)
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			variant.Fields, variant.FieldTypes = p.parseFunctionParameters()
+			if variant.Fields == nil {
+				return nil
+			}
+		}
+		stmt.Variants = append(stmt.Variants, variant)
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+	if !p.expectPeek(closer) {
+		return nil
+	}
+	stmt.Close = p.curToken
 	return stmt
 }
 
@@ -324,11 +566,7 @@ func (p *Parser) parseLoopStatement() *ast.LoopStatement {
 	p.nextToken()
 
 	stmt.Condition = p.parseExpression(LOWEST)
-
-	if !p.expectPeek(token.LBRACE) {
-		return nil
-	}
-	stmt.Body = p.parseBlockStatement()
+	stmt.Body = p.parseBody()
 	return stmt
 }
 
@@ -346,35 +584,24 @@ func (p *Parser) parseRangeLoopStatement() *ast.RangeLoopStatement {
 	p.nextToken()
 
 	stmt.Iterable = p.parseExpression(LOWEST)
-
-	if !p.expectPeek(token.LBRACE) {
-		return nil
-	}
-	stmt.Body = p.parseBlockStatement()
+	stmt.Body = p.parseBody()
 	return stmt
 }
 
 func (p *Parser) parseTryCatchStatement() *ast.TryCatchStatement {
 	stmt := &ast.TryCatchStatement{Token: p.curToken}
-	if !p.expectPeek(token.LBRACE) {
-		return nil
-	}
-	stmt.TryBlock = p.parseBlockStatement()
+	p.tryDepth++
+	defer func() { p.tryDepth-- }()
+	stmt.TryBlock = p.parseBody(token.CATCH, token.FINALLY)
 
 	if p.peekTokenIs(token.CATCH) {
 		p.nextToken()
-		if !p.expectPeek(token.LBRACE) {
-			return nil
-		}
-		stmt.CatchBlock = p.parseBlockStatement()
+		stmt.CatchBlock = p.parseBody(token.FINALLY)
 	}
 
 	if p.peekTokenIs(token.FINALLY) {
 		p.nextToken()
-		if !p.expectPeek(token.LBRACE) {
-			return nil
-		}
-		stmt.FinallyBlock = p.parseBlockStatement()
+		stmt.FinallyBlock = p.parseBody()
 	}
 	return stmt
 }
@@ -383,6 +610,11 @@ func (p *Parser) parseIncludeStatement() *ast.IncludeStatement {
 	stmt := &ast.IncludeStatement{Token: p.curToken}
 	p.nextToken()
 	stmt.Path = p.parseExpression(LOWEST)
+	// Files are found before the program runs, so the path must be written out in full
+	if _, ok := stmt.Path.(*ast.StringLiteral); !ok && stmt.Path != nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - include expects a plain string path",
+			stmt.Token.Line, stmt.Token.Column))
+	}
 	return stmt
 }
 
@@ -392,6 +624,50 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	return stmt
 }
 
+// parseBody parses the block that follows a construct's header (condition, parameters, ...).
+// A block either opens with '{' and runs to the matching '}', or starts right after the
+// header and runs to 'end'. In the 'end' form the `clauses` that may follow the block
+// (else, catch, finally) also close it, so a whole if/else or try/catch chain shares one 'end'.
+func (p *Parser) parseBody(clauses ...token.TokenType) *ast.BlockStatement {
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		return p.parseBlockStatement()
+	}
+	return p.parseEndBlock(clauses)
+}
+
+// parseEndBlock parses statements up to 'end' or one of the clause keywords.
+// 'end' is consumed; a clause keyword is left for the caller as the next token.
+func (p *Parser) parseEndBlock(clauses []token.TokenType) *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.peekTokens[0]}
+	block.Statements = []ast.Statement{}
+
+	for !p.peekTokenIs(token.END) && !p.peekTokenIs(token.EOF) && !p.peekTokenIsAny(clauses) {
+		p.nextToken()
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+	}
+
+	if p.peekTokenIs(token.EOF) {
+		p.errors = append(p.errors, "unterminated block: expected 'end', got EOF")
+	} else if p.peekTokenIs(token.END) {
+		p.nextToken()
+		block.Close = p.curToken
+	}
+	return block
+}
+
+func (p *Parser) peekTokenIsAny(types []token.TokenType) bool {
+	for _, t := range types {
+		if p.peekTokenIs(t) {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
@@ -409,6 +685,8 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	// If we hit EOF instead of RBRACE, we report an error.
 	if p.curTokenIs(token.EOF) {
 		p.errors = append(p.errors, "unterminated block: expected '}', got EOF")
+	} else {
+		block.Close = p.curToken
 	}
 
 	return block
@@ -428,7 +706,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 
 	for !p.peekTokenIs(token.EOF) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekTokens[0].Type]
-		if infix == nil {
+		if infix == nil || p.startsLine(token.LBRACKET) {
 			return leftExp
 		}
 		p.nextToken()
@@ -458,7 +736,7 @@ func (p *Parser) curPrecedence() int {
 func (p *Parser) parseIdentifier() ast.Expression {
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
-	if p.peekTokenIs(token.LBRACE) {
+	if p.peekTokenIs(token.LBRACE) && !p.startsLine(token.LBRACE) {
 		peek1 := p.peekTokenAt(1)
 		peek2 := p.peekTokenAt(2)
 
@@ -474,16 +752,45 @@ func (p *Parser) parseIdentifier() ast.Expression {
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
-	var value int64
-	fmt.Sscanf(p.curToken.Literal, "%d", &value)
+	value, err := parseIntLiteral(p.curToken.Literal)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - integer literal %s is out of range",
+			p.curToken.Line, p.curToken.Column, p.curToken.Literal))
+		return nil
+	}
 	lit.Value = value
 	return lit
 }
 
+// parseIntLiteral converts the spelling of an integer literal (e.g. 1_000, 0xFF, 0b101) to its value.
+// A leading 0 without a base letter is still decimal, so 010 is ten.
+func parseIntLiteral(lit string) (int64, error) {
+	digits := strings.ReplaceAll(lit, "_", "")
+	base := 10
+	if len(digits) > 1 && digits[0] == '0' {
+		switch digits[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+		if base != 10 {
+			digits = digits[2:]
+		}
+	}
+	return strconv.ParseInt(digits, base, 64)
+}
+
 func (p *Parser) parseFloatLiteral() ast.Expression {
 	lit := &ast.FloatLiteral{Token: p.curToken}
-	var value float64
-	fmt.Sscanf(p.curToken.Literal, "%f", &value)
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - float literal %s is out of range",
+			p.curToken.Line, p.curToken.Column, p.curToken.Literal))
+		return nil
+	}
 	lit.Value = value
 	return lit
 }
@@ -492,10 +799,94 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// parseTemplateLiteral desugars an interpolated string into concatenation:
+// "Hello {name}!" becomes "Hello " adds str(name) adds "!".
+// Every node of the chain keeps the TEMPLATE token, so tools can print the original string,
+// and spans the whole string; only the interpolated expressions have positions inside it.
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	tok := p.curToken
+	var result ast.Expression
+	appendPart := func(part ast.Expression) {
+		if result == nil {
+			result = part
+			return
+		}
+		result = &ast.InfixExpression{Token: tok, Left: result, Operator: "adds", Right: part}
+	}
+
+	for i, part := range lexer.SplitTemplate(tok.Literal) {
+		if !part.IsExpr {
+			// Keep a leading text part even when empty, so the result is always a String
+			if part.Text != "" || i == 0 {
+				appendPart(&ast.StringLiteral{Token: tok, Value: part.Text})
+			}
+			continue
+		}
+		expr := p.parseInterpolation(tok, part)
+		if expr == nil {
+			return nil
+		}
+		// The TEMPLATE token marks the builtin str, which a variable of that name cannot replace
+		strTok := tok
+		strTok.Literal = "str"
+		str := &ast.Identifier{Token: strTok, Value: "str"}
+		appendPart(&ast.CallExpression{Token: tok, Function: str, Arguments: []ast.Expression{expr}, Close: tok})
+	}
+	return result
+}
+
+// parseInterpolation parses the source of one {expression} inside a string.
+func (p *Parser) parseInterpolation(tok token.Token, part lexer.TemplatePart) ast.Expression {
+	src := part.Text
+	if strings.TrimSpace(src) == "" {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - empty {} in string literal (write \\{ for a literal brace)",
+			tok.Line, tok.Column))
+		return nil
+	}
+
+	sub := New(lexer.NewAt(src, templatePosition(tok, part.Offset)))
+	expr := sub.parseExpression(LOWEST)
+	if len(sub.errors) == 0 && !sub.peekTokenIs(token.EOF) {
+		sub.errors = append(sub.errors, fmt.Sprintf("unexpected %s after expression", sub.peekTokens[0].Type))
+	}
+	for _, msg := range sub.errors {
+		// The inner parser's EOF is just the closing brace
+		msg = strings.ReplaceAll(msg, string(token.EOF), "'}'")
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - in string interpolation {%s}: %s",
+			tok.Line, tok.Column, src, msg))
+	}
+	if len(sub.errors) > 0 {
+		return nil
+	}
+	return expr
+}
+
+// templatePosition returns the place in the source of the byte at offset in the literal of a
+// TEMPLATE token, which starts just after the opening quote.
+func templatePosition(tok token.Token, offset int) token.Position {
+	before := tok.Literal[:offset]
+	pos := token.Position{Offset: tok.Offset + 1 + offset, Line: tok.Line, Column: tok.Column + 1}
+	if i := strings.LastIndexByte(before, '\n'); i >= 0 {
+		pos.Line += strings.Count(before, "\n")
+		pos.Column = 1
+		before = before[i+1:]
+	}
+	pos.Column += utf8.RuneCountInString(before)
+	return pos
+}
+
 func (p *Parser) parseCharLiteral() ast.Expression {
 	return &ast.CharLiteral{Token: p.curToken, Value: []rune(p.curToken.Literal)[0]}
 }
 
+// parseIllegal reports a token the lexer could not make sense of.
+// The token's literal carries the lexer's description (e.g. "unterminated char literal").
+func (p *Parser) parseIllegal() ast.Expression {
+	msg := fmt.Sprintf("line %d:%d - %s", p.curToken.Line, p.curToken.Column, p.curToken.Literal)
+	p.errors = append(p.errors, msg)
+	return nil
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curToken.Type == token.BOOL && p.curToken.Literal == "true"}
 }
@@ -504,6 +895,13 @@ func (p *Parser) parseNilLiteral() ast.Expression {
 	return &ast.NilLiteral{Token: p.curToken}
 }
 
+// startsLine reports whether the next token is t at the start of a new line.
+// Such a '[' begins a new statement ("[first, ...rest] is list") rather than indexing the
+// expression before it, and such a '{' is not the body of a struct instantiation.
+func (p *Parser) startsLine(t token.TokenType) bool {
+	return p.peekTokenIs(t) && p.peekTokens[0].Line > p.curToken.Line
+}
+
 func (p *Parser) parsePrefixExpression() ast.Expression {
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -514,39 +912,134 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// parseGroupedExpression parses "(x)" as x itself, and "(x, y)" or "(x,)" as a tuple.
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken
 	p.nextToken()
 	exp := p.parseExpression(LOWEST)
+	if !p.peekTokenIs(token.COMMA) {
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		return exp
+	}
+
+	tuple := &ast.TupleLiteral{Token: lparen, Elements: []ast.Expression{exp}}
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if p.peekTokenIs(token.RPAREN) {
+			break // Trailing comma: (x,)
+		}
+		p.nextToken()
+		tuple.Elements = append(tuple.Elements, p.parseExpression(LOWEST))
+	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
-	return exp
+	tuple.Close = p.curToken
+	return tuple
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST)
+	expression.Consequence = p.parseBody(token.ELSE)
+
+	if p.peekTokenIs(token.ELSE) {
+		p.nextToken()
+		if !p.peekTokenIs(token.IF) {
+			expression.Alternative = p.parseBody()
+			return expression
+		}
+
+		// "else if" nests the next if as the only statement of the alternative;
+		// in the 'end' form the nested if consumes the chain's single 'end'.
+		p.nextToken()
+		ifToken := p.curToken
+		nested := p.parseIfExpression()
+		if nested == nil {
+			return nil
+		}
+		expression.Alternative = &ast.BlockStatement{
+			Token:      ifToken,
+			Statements: []ast.Statement{&ast.ExpressionStatement{Token: ifToken, Expression: nested}},
+		}
+	}
+	return expression
+}
+
+// parseMatchExpression parses "match subject { when patterns [if guard] then body ... otherwise body }".
+// As with other blocks the arms may instead run to 'end'. Arm bodies need no braces: each runs
+// until the next 'when', 'otherwise' or the closer, and may be followed by a separating comma.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.curToken}
+	p.nextToken()
+	expression.Subject = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.LBRACE) {
+	closer := token.TokenType(token.END)
+	if p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		closer = token.RBRACE
+	}
+
+	for p.peekTokenIs(token.WHEN) {
+		p.nextToken()
+		arm := &ast.MatchArm{Token: p.curToken}
+
+		p.nextToken()
+		arm.Patterns = append(arm.Patterns, p.parsePattern())
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			arm.Patterns = append(arm.Patterns, p.parsePattern())
+		}
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.THEN) {
+			return nil
+		}
+		arm.Body = p.parseArmBody(closer)
+		expression.Arms = append(expression.Arms, arm)
+	}
+
+	if p.peekTokenIs(token.OTHERWISE) {
+		p.nextToken()
+		expression.Otherwise = p.parseArmBody(closer)
+	}
+
+	if !p.expectPeek(closer) {
 		return nil
 	}
-	expression.Consequence = p.parseBlockStatement()
+	expression.Close = p.curToken
+	return expression
+}
 
-	if p.peekTokenIs(token.ELSE) {
+// parseArmBody parses the statements of one match arm, stopping before the next arm or the closer.
+func (p *Parser) parseArmBody(closer token.TokenType) *ast.BlockStatement {
+	block := &ast.BlockStatement{Token: p.peekTokens[0]}
+	block.Statements = []ast.Statement{}
+	stops := []token.TokenType{token.WHEN, token.OTHERWISE, closer, token.EOF}
+
+	for !p.peekTokenIsAny(stops) {
 		p.nextToken()
-		if !p.peekTokenIs(token.LBRACE) && !p.peekTokenIs(token.IF) {
-			if !p.expectPeek(token.LBRACE) {
-				return nil
-			}
-		} else {
-			if p.peekTokenIs(token.LBRACE) {
+		stmt := p.parseStatement()
+		if stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+		// Arms written on one line may be separated by commas: when 1 then "one", when 2 ...
+		if p.peekTokenIs(token.COMMA) {
+			next := p.peekTokenAt(1).Type
+			if next == token.WHEN || next == token.OTHERWISE {
 				p.nextToken()
 			}
 		}
-		expression.Alternative = p.parseBlockStatement()
 	}
-	return expression
+	return block
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
@@ -555,43 +1048,83 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
-	lit.Parameters = p.parseFunctionParameters()
+	lit.Parameters, lit.ParameterTypes = p.parseFunctionParameters()
 
-	if !p.expectPeek(token.LBRACE) {
-		return nil
+	// Optional declared result: takes(x) returns Integer
+	if p.peekTokenIs(token.RETURNS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		lit.ReturnType = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	}
-	lit.Body = p.parseBlockStatement()
+
+	// A yield makes this function a generator, but not the functions around it.
+	// Try blocks and tail calls also belong to the innermost function.
+	outerYielded, outerTry, outerTails := p.yielded, p.tryDepth, p.tails
+	p.yielded, p.tryDepth, p.tails = false, 0, nil
+	p.functionDepth++
+	lit.Body = p.parseBody()
+	p.functionDepth--
+	lit.Generator = p.yielded
+	if lit.Generator {
+		for _, ret := range p.tails {
+			ret.Tail = false // A generator's return only ends it; nobody receives the call
+		}
+	}
+	p.yielded, p.tryDepth, p.tails = outerYielded, outerTry, outerTails
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// parseFunctionParameters parses "(a, b as Integer)".
+// It returns the names and, in a parallel list, their declared types (nil when unannotated).
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []*ast.Identifier) {
 	identifiers := []*ast.Identifier{}
+	types := []*ast.Identifier{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return identifiers, types
 	}
 
 	p.nextToken()
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 	identifiers = append(identifiers, ident)
+	types = append(types, p.parseTypeAnnotation())
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 		identifiers = append(identifiers, ident)
+		types = append(types, p.parseTypeAnnotation())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
+		return nil, nil
+	}
+	return identifiers, types
+}
+
+// parseTypeAnnotation parses an optional "as Type" after a name.
+// It returns nil (and consumes nothing) when the next token is not 'as'.
+func (p *Parser) parseTypeAnnotation() *ast.Identifier {
+	if !p.peekTokenIs(token.AS) {
+		return nil
+	}
+	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
-	return identifiers
+	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.curTokenIs(token.RBRACKET) {
+		array.Close = p.curToken
+	}
 	return array
 }
 
@@ -608,6 +1141,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
@@ -615,9 +1149,147 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Close = p.curToken
 	return hash
 }
 
+// ----------------------------------------------------------------------------------------------
+// PATTERNS
+// ----------------------------------------------------------------------------------------------
+
+// parsePattern parses the pattern starting at the current token.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.INT, token.FLOAT, token.STRING, token.RAW_STRING, token.CHAR, token.BOOL, token.NIL, token.MINUS:
+		pattern := &ast.LiteralPattern{Token: p.curToken}
+		pattern.Value = p.parseExpression(PREFIX)
+		return pattern
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		pattern := &ast.MapPattern{Token: p.curToken}
+		pattern.Entries = p.parsePatternEntries(true)
+		if p.curTokenIs(token.RBRACE) {
+			pattern.Close = p.curToken
+		}
+		return pattern
+	case token.IDENT:
+		name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(token.LBRACE) {
+			p.nextToken()
+			pattern := &ast.StructPattern{Token: p.curToken, Name: name}
+			pattern.Fields = p.parsePatternEntries(false)
+			if p.curTokenIs(token.RBRACE) {
+				pattern.Close = p.curToken
+			}
+			return pattern
+		}
+		if p.peekTokenIs(token.DOT) {
+			return p.parseEnumPattern(name)
+		}
+		return &ast.BindingPattern{Token: p.curToken, Name: name}
+	}
+	p.errors = append(p.errors, fmt.Sprintf("line %d:%d - invalid pattern: unexpected %s",
+		p.curToken.Line, p.curToken.Column, p.curToken.Type))
+	return nil
+}
+
+// parseArrayPattern parses "[a, b, ...rest]"; the rest element must come last.
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			break
+		}
+		pattern.Elements = append(pattern.Elements, p.parsePattern())
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	pattern.Close = p.curToken
+	return pattern
+}
+
+// parsePatternEntries parses "{ name, key: pattern }" with the current token on '{'.
+// Struct patterns only take field names as keys; map patterns also take literal keys.
+func (p *Parser) parsePatternEntries(literalKeys bool) []ast.PatternEntry {
+	entries := []ast.PatternEntry{}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		var key ast.Expression
+		switch {
+		case p.curTokenIs(token.IDENT):
+			key = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		case literalKeys && (p.curTokenIs(token.STRING) || p.curTokenIs(token.INT) ||
+			p.curTokenIs(token.CHAR) || p.curTokenIs(token.BOOL)):
+			key = p.parseExpression(PREFIX)
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("line %d:%d - invalid pattern key: unexpected %s",
+				p.curToken.Line, p.curToken.Column, p.curToken.Type))
+			return nil
+		}
+
+		entry := ast.PatternEntry{Key: key}
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			entry.Value = p.parsePattern()
+		} else if ident, ok := key.(*ast.Identifier); ok {
+			entry.Value = &ast.BindingPattern{Token: ident.Token, Name: ident}
+		} else {
+			p.peekError(token.COLON)
+			return nil
+		}
+		entries = append(entries, entry)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return entries
+}
+
+// parseEnumPattern parses "Enum.Variant" with an optional "(patterns)" for associated values.
+func (p *Parser) parseEnumPattern(enum *ast.Identifier) ast.Pattern {
+	pattern := &ast.EnumPattern{Token: enum.Token, Enum: enum}
+	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	pattern.Variant = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return pattern
+	}
+	p.nextToken()
+	pattern.Args = []ast.Pattern{}
+	for !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		pattern.Args = append(pattern.Args, p.parsePattern())
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	pattern.Close = p.curToken
+	return pattern
+}
+
 // ----------------------------------------------------------------------------------------------
 // INFIX FUNCTIONS
 // ----------------------------------------------------------------------------------------------
@@ -637,6 +1309,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseCallArguments()
+	if p.curTokenIs(token.RPAREN) {
+		exp.Close = p.curToken
+	}
 	return exp
 }
 
@@ -690,6 +1365,7 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	exp.Close = p.curToken
 	return exp
 }
 
@@ -727,6 +1403,21 @@ func (p *Parser) parseStructInstantiation(name *ast.Identifier) ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	exp.Close = p.curToken
+	return exp
+}
+
+// parseSpawnExpression parses "spawn f(args)". Only a call can be spawned.
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	exp := &ast.SpawnExpression{Token: p.curToken}
+	p.nextToken()
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		p.errors = append(p.errors, fmt.Sprintf("line %d:%d - spawn expects a function call",
+			exp.Token.Line, exp.Token.Column))
+		return nil
+	}
+	exp.Call = call
 	return exp
 }
 
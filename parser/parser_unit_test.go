@@ -7,10 +7,14 @@
 package parser
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"eloquence/ast"
 	"eloquence/lexer"
+	"eloquence/token"
 )
 
 func newParser(input string) *Parser {
@@ -238,6 +242,338 @@ func TestStructDefinition(t *testing.T) {
 	}
 }
 
+func TestStructDefaultsAndEmbedding(t *testing.T) {
+	input := `define Point as struct { x is 0, y as Integer is 1 minus 2 }
+define Employee as struct
+  ...Person
+  salary as Float is 0.0, tags is []
+end`
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{
+		"define Point as struct { x is 0, y as Integer is (1 minus 2) }",
+		"define Employee as struct { ...Person, salary as Float is 0.0, tags is [] }",
+	}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(program.Statements))
+	}
+	for i, want := range expected {
+		if got := program.Statements[i].String(); got != want {
+			t.Errorf("statement %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	def := program.Statements[1].(*ast.StructDefinitionStatement)
+	if len(def.Embeds) != 1 || def.Embeds[0].Value != "Person" {
+		t.Errorf("expected Person to be embedded, got %v", def.Embeds)
+	}
+	if len(def.Defaults) != len(def.Attributes) || def.Defaults[0] == nil {
+		t.Errorf("expected defaults parallel to attributes, got %v", def.Defaults)
+	}
+}
+
+func TestTupleLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		size     int // Number of tuple elements, or -1 for a plain grouped expression
+	}{
+		{"(1, 2)", "(1, 2)", 2},
+		{"(x,)", "(x,)", 1},
+		{"(1 adds 2, (3, 4), [5])", "((1 adds 2), (3, 4), [5])", 3},
+		{"(1 adds 2)", "(1 adds 2)", -1},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		exp := program.Statements[0].(*ast.ExpressionStatement).Expression
+		if got := exp.String(); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+		tuple, ok := exp.(*ast.TupleLiteral)
+		if tt.size < 0 {
+			if ok {
+				t.Errorf("%q: a grouped expression should not be a tuple", tt.input)
+			}
+			continue
+		}
+		if !ok || len(tuple.Elements) != tt.size {
+			t.Errorf("%q: expected a tuple of %d elements, got %T", tt.input, tt.size, exp)
+		}
+	}
+}
+
+func TestModifiedAssignments(t *testing.T) {
+	input := `constant PI as Float is 3.14
+redefine show is takes(x) { x }
+let total is 0
+constant`
+	p := newParser(input)
+	program := p.ParseProgram()
+
+	expected := []string{"constant PI as Float is 3.14", "redefine show is takes (x) x", "let total is 0"}
+	for i, want := range expected {
+		stmt, ok := program.Statements[i].(*ast.AssignmentStatement)
+		if !ok {
+			t.Fatalf("statement %d: expected AssignmentStatement, got %T", i, program.Statements[i])
+		}
+		if got := stmt.String(); got != want {
+			t.Errorf("statement %d: expected %q, got %q", i, want, got)
+		}
+	}
+	if errs := p.Errors(); len(errs) != 1 || !strings.Contains(errs[0], "expected next token to be IDENT") {
+		t.Errorf("expected a missing name error, got %v", errs)
+	}
+}
+
+func TestEndClosedBlocks(t *testing.T) {
+	input := `define Point as struct
+  x, y
+end
+f is takes(n) returns Integer
+  if n less 0
+    return 0
+  else if n equals 0
+    return 1
+  else
+    return n
+  end
+end
+for i in list
+  show(i)
+end
+while flag
+  flag is false
+end
+try
+  x is 5
+catch
+  show("error")
+finally
+  show("done")
+end`
+
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 5 {
+		t.Fatalf("expected 5 statements, got %d", len(program.Statements))
+	}
+	def := program.Statements[0].(*ast.StructDefinitionStatement)
+	if len(def.Attributes) != 2 {
+		t.Errorf("expected 2 struct fields, got %d", len(def.Attributes))
+	}
+
+	fn := program.Statements[1].(*ast.AssignmentStatement).Value.(*ast.FunctionLiteral)
+	if fn.ReturnType == nil || fn.ReturnType.Value != "Integer" {
+		t.Errorf("expected return type Integer, got %v", fn.ReturnType)
+	}
+	ifExp := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	nested, ok := ifExp.Alternative.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if !ok || nested.Alternative == nil {
+		t.Fatalf("expected else if to nest an IfExpression with its own else")
+	}
+
+	try := program.Statements[4].(*ast.TryCatchStatement)
+	if try.CatchBlock == nil || try.FinallyBlock == nil {
+		t.Errorf("expected catch and finally blocks")
+	}
+}
+
+func TestElseIfWithBraces(t *testing.T) {
+	input := `if a { 1 } else if b { 2 } else { 3 }
+show(a)`
+
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(program.Statements))
+	}
+	ifExp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if ifExp.Alternative.String() != "if b 2 else 3" {
+		t.Errorf("unexpected alternative %q", ifExp.Alternative.String())
+	}
+}
+
+func TestUnterminatedEndBlock(t *testing.T) {
+	p := newParser("while x less 5\n  show(x)")
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != "unterminated block: expected 'end', got EOF" {
+		t.Errorf("expected unterminated block error, got %v", errors)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	input := `define Person as struct { name as String, age as Integer, tags }
+greet is takes(p as Person, loud) returns String { return p.name }
+count as Integer is 0`
+
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{
+		"define Person as struct { name as String, age as Integer, tags }",
+		"greet is takes (p as Person, loud) returns String return (p.name)",
+		"count as Integer is 0",
+	}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %d", len(expected), len(program.Statements))
+	}
+	for i, want := range expected {
+		if got := program.Statements[i].String(); got != want {
+			t.Errorf("statement %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	fn := program.Statements[1].(*ast.AssignmentStatement).Value.(*ast.FunctionLiteral)
+	if len(fn.ParameterTypes) != 2 || fn.ParameterTypes[1] != nil {
+		t.Errorf("expected an unannotated second parameter, got %v", fn.ParameterTypes)
+	}
+}
+
+func TestEnumDefinition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"define Color as enum { Red, Green, Blue }", "define Color as enum { Red, Green, Blue }"},
+		{"define Shape as enum\n  Empty\n  Circle(radius as Number)\n  Rect(w, h)\nend",
+			"define Shape as enum { Empty, Circle(radius as Number), Rect(w, h) }"},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("expected 1 statement, got %d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.EnumDefinitionStatement)
+		if !ok {
+			t.Fatalf("expected EnumDefinitionStatement, got %T", program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { when 1, 2 then \"small\" otherwise \"big\" }",
+			"match x { when 1, 2 then \"small\" otherwise \"big\" }"},
+		{"match x { when 1 then a, when 2 then b, otherwise c }",
+			"match x { when 1 then a when 2 then b otherwise c }"},
+		{"match u\n when User { name: n, age } if age greater 17 then n\n when [first, ...rest] then first\nend",
+			"match u { when User { name: n, age } if (age greater 17) then n when [first, ...rest] then first }"},
+		{"match m { when { \"kind\": k, x } then k when Shape.Circle(_) then 1 when Color.Red, -1 then 2 }",
+			"match m { when { \"kind\": k, x } then k when Shape.Circle(_) then 1 when Color.Red, (- 1) then 2 }"},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		match, ok := stmt.Expression.(*ast.MatchExpression)
+		if !ok {
+			t.Fatalf("expected MatchExpression, got %T", stmt.Expression)
+		}
+		if match.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, match.String())
+		}
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { when f(1) then 1 }", "line 1:17 - expected next token to be THEN, got ( instead"},
+		{"match x { when (1) then 1 }", "line 1:16 - invalid pattern: unexpected ("},
+		{"match x { when [...rest, last] then 1 }", "line 1:24 - expected next token to be ], got , instead"},
+		{"match x { when 1 then 1", "line 1:23 - expected next token to be }, got EOF instead"},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("%q: expected first error %q, got %q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestDestructuringStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a, b is pair", "a, b is pair"},
+		{"a, b is b, a", "a, b is b, a"},
+		{"head, ...tail is list", "head, ...tail is list"},
+		{"[first, ...rest] is list", "[first, ...rest] is list"},
+		{"{ name, age } is user", "{ name, age } is user"},
+		{"{ name: n, \"x\": [x, _] } is m", "{ name: n, \"x\": [x, _] } is m"},
+		{"User { name } is u", "User { name } is u"},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got %d", tt.input, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.DestructuringStatement)
+		if !ok {
+			t.Fatalf("%q: expected DestructuringStatement, got %T", tt.input, program.Statements[0])
+		}
+		if stmt.String() != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestStatementsStartingWithBrackets(t *testing.T) {
+	// A '[' or '{' on a new line starts a statement instead of continuing the previous one
+	input := "x is y\n[a, b] is pair\nz is w\n{ name: n } is m\n[1, 2]\nxs[0]"
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	expected := []string{"x is y", "[a, b] is pair", "z is w", "{ name: n } is m", "[1, 2]", "(xs[0])"}
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("expected %d statements, got %d: %s", len(expected), len(program.Statements), program.String())
+	}
+	for i, stmt := range program.Statements {
+		if stmt.String() != expected[i] {
+			t.Errorf("statement %d: expected %q, got %q", i, expected[i], stmt.String())
+		}
+	}
+}
+
 func TestPointerAssignmentStatement(t *testing.T) {
 	input := `pointing from ptr is 10`
 	p := newParser(input)
@@ -256,6 +592,152 @@ func TestPointerAssignmentStatement(t *testing.T) {
 	}
 }
 
+func TestPointerTargets(t *testing.T) {
+	tests := []struct {
+		input  string
+		target string // String() of the pointer expression written through
+		named  bool   // Whether the target is a plain identifier
+	}{
+		{"pointing from ptr is 10", "ptr", true},
+		{"pointing from pointing from pp is 5", "(pointing from pp)", false},
+		{"pointing from node.next is 3", "(node.next)", false},
+		{"pointing from ptrs[0] is 1", "(ptrs[0])", false},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.PointerAssignmentStatement)
+		if !ok {
+			t.Fatalf("%q: expected PointerAssignmentStatement, got %T", tt.input, program.Statements[0])
+		}
+		if stmt.Target.String() != tt.target {
+			t.Errorf("%q: expected target %q, got %q", tt.input, tt.target, stmt.Target.String())
+		}
+		if (stmt.Name != nil) != tt.named {
+			t.Errorf("%q: expected Name set=%v", tt.input, tt.named)
+		}
+	}
+
+	// Without 'is' a dereference is an ordinary expression statement
+	p := newParser("pointing from p adds 1")
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if _, ok := program.Statements[0].(*ast.ExpressionStatement); !ok {
+		t.Errorf("expected ExpressionStatement, got %T", program.Statements[0])
+	}
+}
+
+func TestYieldMarksGenerators(t *testing.T) {
+	input := `outer is takes() {
+    inner is takes() { yield 1 }
+    yield inner
+}
+plain is takes() { helper is takes() { yield 2 }
+ return helper }`
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	literal := func(stmt ast.Statement) *ast.FunctionLiteral {
+		return stmt.(*ast.AssignmentStatement).Value.(*ast.FunctionLiteral)
+	}
+	outer := literal(program.Statements[0])
+	inner := literal(outer.Body.Statements[0])
+	plain := literal(program.Statements[1])
+	helper := literal(plain.Body.Statements[0])
+	if !outer.Generator || !inner.Generator || !helper.Generator {
+		t.Errorf("functions containing yield should be generators")
+	}
+	if plain.Generator {
+		t.Errorf("a yield in a nested function must not make the enclosing function a generator")
+	}
+	if y, ok := outer.Body.Statements[1].(*ast.YieldStatement); !ok || y.String() != "yield inner" {
+		t.Errorf("expected yield statement, got %v", outer.Body.Statements[1])
+	}
+
+	p = newParser("yield 1")
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) != 1 || errs[0] != "line 1:1 - yield outside a function" {
+		t.Errorf("expected a yield outside a function error, got %q", errs)
+	}
+}
+
+func TestTailCallReturns(t *testing.T) {
+	input := `f is takes(n) {
+    if n equals 0 { return g(n) }
+    try { return g(n) } catch { return g(n) }
+    return n adds g(n)
+}
+gen is takes() { yield 1
+ return g(1) }
+return g(1)`
+	p := newParser(input)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	var tails []bool
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		switch node := node.(type) {
+		case *ast.ReturnStatement:
+			tails = append(tails, node.Tail)
+		case *ast.AssignmentStatement:
+			visit(node.Value)
+		case *ast.FunctionLiteral:
+			visit(node.Body)
+		case *ast.BlockStatement:
+			for _, stmt := range node.Statements {
+				visit(stmt)
+			}
+		case *ast.ExpressionStatement:
+			visit(node.Expression)
+		case *ast.IfExpression:
+			visit(node.Consequence)
+		case *ast.TryCatchStatement:
+			visit(node.TryBlock)
+			visit(node.CatchBlock)
+		}
+	}
+	for _, stmt := range program.Statements {
+		visit(stmt)
+	}
+
+	// Only the return in the if block is a tail call: not inside try/catch, not an expression
+	// around a call, not in a generator and not outside a function
+	expected := []bool{true, false, false, false, false, false}
+	if len(tails) != len(expected) {
+		t.Fatalf("expected %d return statements, got %d", len(expected), len(tails))
+	}
+	for i, tail := range expected {
+		if tails[i] != tail {
+			t.Errorf("return %d: expected Tail=%t, got %t", i, tail, tails[i])
+		}
+	}
+}
+
+func TestSpawnExpression(t *testing.T) {
+	p := newParser("t is spawn fetch(url, 3)")
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	spawn, ok := program.Statements[0].(*ast.AssignmentStatement).Value.(*ast.SpawnExpression)
+	if !ok {
+		t.Fatalf("expected SpawnExpression, got %T", program.Statements[0].(*ast.AssignmentStatement).Value)
+	}
+	if spawn.Call.Function.String() != "fetch" || len(spawn.Call.Arguments) != 2 {
+		t.Errorf("wrong spawned call: %s", spawn.Call.String())
+	}
+
+	p = newParser("t is spawn fetch")
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) == 0 || errs[0] != "line 1:6 - spawn expects a function call" {
+		t.Errorf("expected a spawn error, got %q", errs)
+	}
+}
+
 func TestStructInstantiation(t *testing.T) {
 	input := `user is User { name: "John", age: 25 }`
 	p := newParser(input)
@@ -294,4 +776,233 @@ func TestIncludeStatement(t *testing.T) {
 	if inc.Path.String() != `"math.eq"` {
 		t.Errorf("expected path string")
 	}
+
+	// The path is read before the program runs, so it cannot be computed
+	for _, input := range []string{`include "lib{n}.eq"`, "include name", `include "a" adds ".eq"`} {
+		p := newParser(input)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != "line 1:1 - include expects a plain string path" {
+			t.Errorf("%q: expected a plain string path error, got %v", input, p.Errors())
+		}
+	}
+}
+
+func TestNumberLiteralValues(t *testing.T) {
+	ints := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"010", 10}, // A leading zero is still decimal
+	}
+	for _, tt := range ints {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if !ok || lit.Value != tt.expected {
+			t.Errorf("%s: expected IntegerLiteral %d, got %+v", tt.input, tt.expected, program.Statements[0])
+		}
+	}
+
+	floats := []struct {
+		input    string
+		expected float64
+	}{
+		{"1e-9", 1e-9},
+		{"6.02E23", 6.02e23},
+		{"1_000.5", 1000.5},
+	}
+	for _, tt := range floats {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		lit, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FloatLiteral)
+		if !ok || lit.Value != tt.expected {
+			t.Errorf("%s: expected FloatLiteral %g, got %+v", tt.input, tt.expected, program.Statements[0])
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"Hello {name}!"`, `(("Hello " adds str(name)) adds "!")`},
+		{`"{a adds 1}"`, `("" adds str((a adds 1)))`},
+		{`"x{upper("y")}z"`, `(("x" adds str(upper("y"))) adds "z")`},
+	}
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x is 0b12", "line 1:6 - invalid digit '2' in binary literal 0b12"},
+		{"x is 99999999999999999999", "line 1:6 - integer literal 99999999999999999999 is out of range"},
+		{"x is\n\"{}\"", "line 2:1 - empty {} in string literal"},
+		{`x is "{a adds}"`, "line 1:6 - in string interpolation {a adds}: no prefix parse function for '}'"},
+		{`x is "{a b}"`, "line 1:6 - in string interpolation {a b}: unexpected IDENT after expression"},
+		{"x is 'ab'", "line 1:6 - char literal must contain exactly one character"},
+		{"x is @", "line 1:6 - unexpected character '@'"},
+	}
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || !strings.HasPrefix(p.Errors()[0], tt.expected) {
+			t.Errorf("%q: expected first error %q, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+// TestNodeSpans checks that every node spans exactly its own source text.
+func TestNodeSpans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // "NodeType: text" for some of the nodes, in walking order
+	}{
+		{"let x as Integer is 1 adds f(2, [3])", []string{
+			"AssignmentStatement: let x as Integer is 1 adds f(2, [3])",
+			"InfixExpression: 1 adds f(2, [3])",
+			"CallExpression: f(2, [3])",
+			"ArrayLiteral: [3]",
+		}},
+		{"if a { b } else if c { d } else { e }", []string{
+			"IfExpression: if a { b } else if c { d } else { e }",
+			"BlockStatement: { b }",
+			"BlockStatement: if c { d } else { e }",
+			"IfExpression: if c { d } else { e }",
+		}},
+		{"while n greater 0\n  n is n minus 1\nend", []string{
+			"LoopStatement: while n greater 0\n  n is n minus 1\nend",
+			"BlockStatement: n is n minus 1\nend",
+		}},
+		{"define P as struct { x, y is 0 }\np is P { x: 1 }.x\nm is { \"k\": (1, 2) }[\"k\"]", []string{
+			"StructDefinitionStatement: define P as struct { x, y is 0 }",
+			"FieldAccessExpression: P { x: 1 }.x",
+			"StructInstantiationExpression: P { x: 1 }",
+			"IndexExpression: { \"k\": (1, 2) }[\"k\"]",
+			"MapLiteral: { \"k\": (1, 2) }",
+			"TupleLiteral: (1, 2)",
+		}},
+		{"match v { when [a, ...r], { k } then a when S.C(_) if ok then 1 otherwise 2 }", []string{
+			"MatchExpression: match v { when [a, ...r], { k } then a when S.C(_) if ok then 1 otherwise 2 }",
+			"ArrayPattern: [a, ...r]",
+			"MapPattern: { k }",
+			"EnumPattern: S.C(_)",
+		}},
+		{"match u { when -1 then 0 when User { name: \"x\" } then 1 }", []string{
+			"LiteralPattern: -1",
+			"StructPattern: User { name: \"x\" }",
+			"LiteralPattern: \"x\"",
+		}},
+		{"f is takes(n) { return n }\nh, ...t is \"día {n adds 1}!\"", []string{
+			"FunctionLiteral: takes(n) { return n }",
+			"ReturnStatement: return n",
+			"ArrayPattern: h, ...t",
+			"InfixExpression: \"día {n adds 1}!\"",
+			"InfixExpression: n adds 1",
+		}},
+		{"define Shape as enum { Dot, Circle(r as Float) }\ng is takes() { yield 'c' }\ninclude \"lib.eq\"\nt is spawn g()\nq is pointing to xs[0]\nw is [1.5, none, true, {}]", []string{
+			"EnumDefinitionStatement: define Shape as enum { Dot, Circle(r as Float) }",
+			"YieldStatement: yield 'c'",
+			"IncludeStatement: include \"lib.eq\"",
+			"SpawnExpression: spawn g()",
+			"PointerReferenceExpression: pointing to xs[0]",
+			"ArrayLiteral: [1.5, none, true, {}]",
+			"MapLiteral: {}",
+		}},
+		{"if a\n  b\nelse\n  c\nend\ntry\n  d\ncatch\nend\nx is match 1 when 1 then 2 end", []string{
+			"IfExpression: if a\n  b\nelse\n  c\nend",
+			"BlockStatement: b",
+			"BlockStatement: c\nend",
+			"TryCatchStatement: try\n  d\ncatch\nend",
+			"MatchExpression: match 1 when 1 then 2 end",
+		}},
+		{"try { x } catch { y } finally { z }\nfor i in xs { pointing from p is -i }", []string{
+			"TryCatchStatement: try { x } catch { y } finally { z }",
+			"RangeLoopStatement: for i in xs { pointing from p is -i }",
+			"PointerAssignmentStatement: pointing from p is -i",
+			"PrefixExpression: -i",
+		}},
+	}
+
+	for _, tt := range tests {
+		p := newParser(tt.input)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		checker := &spanChecker{t: t, src: tt.input}
+		ast.Walk(checker, program)
+		got := checker.texts
+
+		i := 0
+		for _, g := range got {
+			if i < len(tt.expected) && g == tt.expected[i] {
+				i++
+			}
+		}
+		if i < len(tt.expected) {
+			t.Errorf("%q: missing %q in\n%s", tt.input, tt.expected[i], strings.Join(got, "\n"))
+		}
+	}
+}
+
+// spanChecker walks a tree checking that each node's span is consistent and lies within its
+// parent's, and collects the text of every node.
+type spanChecker struct {
+	t       *testing.T
+	src     string
+	parents []ast.Node
+	texts   []string
+}
+
+func (c *spanChecker) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		c.parents = c.parents[:len(c.parents)-1]
+		return nil
+	}
+	pos, end := node.Pos(), node.End()
+	if !pos.IsValid() || pos.Offset > end.Offset || end.Offset > len(c.src) {
+		c.t.Errorf("%q: %T has the span %v-%v", c.src, node, pos, end)
+		return nil
+	}
+	if n := len(c.parents); n > 0 {
+		parent := c.parents[n-1]
+		if pos.Offset < parent.Pos().Offset || end.Offset > parent.End().Offset {
+			c.t.Errorf("%q: %T %q lies outside %T %q", c.src, node, c.src[pos.Offset:end.Offset],
+				parent, c.src[parent.Pos().Offset:parent.End().Offset])
+		}
+	}
+	if want := positionOf(c.src, pos.Offset); pos != want {
+		c.t.Errorf("%q: %T starts at %+v, expected %+v", c.src, node, pos, want)
+	}
+	if want := positionOf(c.src, end.Offset); end != want {
+		c.t.Errorf("%q: %T ends at %+v, expected %+v", c.src, node, end, want)
+	}
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	c.texts = append(c.texts, name+": "+c.src[pos.Offset:end.Offset])
+	c.parents = append(c.parents, node)
+	return c
+}
+
+// positionOf computes the line and column of a byte offset.
+func positionOf(src string, offset int) token.Position {
+	before := src[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return token.Position{Offset: offset, Line: line, Column: column}
 }
@@ -0,0 +1,185 @@
+// ==============================================================================================
+// FILE: profiler/pprof.go
+// ==============================================================================================
+// PACKAGE: profiler
+// PURPOSE: Writes a profile in the gzipped protocol buffer format read by `go tool pprof`.
+//          The few messages of profile.proto that are needed are encoded by hand, so the
+//          interpreter does not depend on a protobuf library.
+// ==============================================================================================
+
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Field numbers from github.com/google/pprof/proto/profile.proto.
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+// WritePprof writes the profile for `go tool pprof`. Every call stack is a sample holding
+// the calls of its innermost function, the values it created and its exclusive time (the last
+// sample type, which pprof shows by default).
+func (p *Profiler) WritePprof(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var msg protoBuffer
+	stringIDs := map[string]int{"": 0}
+	str := func(s string) uint64 {
+		if _, ok := stringIDs[s]; !ok {
+			stringIDs[s] = len(stringIDs)
+		}
+		return uint64(stringIDs[s])
+	}
+
+	for _, vt := range [][2]string{{"calls", "count"}, {"objects", "count"}, {"time", "nanoseconds"}} {
+		var t protoBuffer
+		t.uint64(valueTypeType, str(vt[0]))
+		t.uint64(valueTypeUnit, str(vt[1]))
+		msg.message(profileSampleType, &t)
+	}
+
+	// Every function has one location, numbered like the function
+	ids := make(map[*FunctionStats]uint64)
+	var order []*FunctionStats
+	for _, key := range p.sortedStacks() {
+		stack := p.stacks[key]
+		var sample protoBuffer
+		var locations []uint64
+		for i := len(stack.frames) - 1; i >= 0; i-- { // Innermost first
+			fn := stack.frames[i]
+			if _, ok := ids[fn]; !ok {
+				ids[fn] = uint64(len(ids) + 1)
+				order = append(order, fn)
+			}
+			locations = append(locations, ids[fn])
+		}
+		sample.packedUint64(sampleLocationID, locations)
+		sample.packedInt64(sampleValue, []int64{int64(stack.calls), int64(stack.objects), stack.self.Nanoseconds()})
+		msg.message(profileSample, &sample)
+	}
+
+	for _, fn := range order {
+		var line, loc, function protoBuffer
+		line.uint64(lineFunctionID, ids[fn])
+		line.int64(lineLine, int64(fn.Line))
+		loc.uint64(locationID, ids[fn])
+		loc.message(locationLine, &line)
+		msg.message(profileLocation, &loc)
+
+		function.uint64(functionID, ids[fn])
+		function.uint64(functionName, str(fn.Name))
+		function.uint64(functionSystemName, str(fn.label()))
+		function.uint64(functionFilename, str(p.file))
+		function.int64(functionStartLine, int64(fn.Line))
+		msg.message(profileFunction, &function)
+	}
+
+	var period protoBuffer
+	period.uint64(valueTypeType, str("calls"))
+	period.uint64(valueTypeUnit, str("count"))
+	msg.message(profilePeriodType, &period)
+	msg.int64(profilePeriod, 1)
+	msg.int64(profileTimeNanos, p.started.UnixNano())
+	msg.int64(profileDurationNanos, p.elapsed.Nanoseconds())
+
+	table := make([]string, len(stringIDs))
+	for s, i := range stringIDs {
+		table[i] = s
+	}
+	for _, s := range table {
+		msg.bytes(profileStringTable, []byte(s))
+	}
+
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(msg.data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// protoBuffer encodes protocol buffer fields.
+type protoBuffer struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protoBuffer) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (b *protoBuffer) uint64(field int, x uint64) {
+	b.key(field, wireVarint)
+	b.varint(x)
+}
+
+func (b *protoBuffer) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protoBuffer) bytes(field int, data []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(data)))
+	b.data = append(b.data, data...)
+}
+
+func (b *protoBuffer) message(field int, m *protoBuffer) {
+	b.bytes(field, m.data)
+}
+
+func (b *protoBuffer) packedUint64(field int, xs []uint64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytes(field, packed.data)
+}
+
+func (b *protoBuffer) packedInt64(field int, xs []int64) {
+	var packed protoBuffer
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	b.bytes(field, packed.data)
+}
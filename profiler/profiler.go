@@ -0,0 +1,479 @@
+// ==============================================================================================
+// FILE: profiler/profiler.go
+// ==============================================================================================
+// PACKAGE: profiler
+// PURPOSE: Implements the execution profiler behind `eloquence run -profile`.
+//          A Profiler is installed as the evaluator's hook. It counts calls and measures the
+//          inclusive and exclusive time of every function and source line, counts the values
+//          created by each type (builtins such as collect included), and reports them as text,
+//          folded stacks or a pprof profile.
+// ==============================================================================================
+
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/object"
+	"eloquence/token"
+)
+
+// MainName is the name given to code outside any function.
+const MainName = "main"
+
+// FunctionStats is what the profile knows about one function.
+type FunctionStats struct {
+	Name      string        // The name the function was assigned to, or "anonymous"
+	Line      int           // Where the function body starts
+	Calls     int           // How many times it was called
+	Inclusive time.Duration // Time spent in the function, including the calls it made
+	Exclusive time.Duration // Time spent in the function's own code
+	active    int           // Calls of this function currently running (recursion is timed once)
+}
+
+// LineStats is what the profile knows about one source line.
+type LineStats struct {
+	File      string // The program, or the included file, the line is in
+	Line      int
+	Count     int           // How many times a statement on the line ran
+	Inclusive time.Duration // Time spent in the line's statements, including what they called
+	Exclusive time.Duration // Time not spent in nested statements or calls
+	active    int
+}
+
+// Profiler collects a profile while installed as an evaluator.Hook.
+type Profiler struct {
+	mu        sync.Mutex
+	file      string // The program being profiled, recorded in pprof output
+	started   time.Time
+	elapsed   time.Duration
+	root      *frame                         // Code outside any function
+	frames    map[*object.Environment]*frame // Running calls by the scope of the call
+	functions map[*object.Function]*FunctionStats
+	byName    map[string]*FunctionStats // Functions are reported by name and line
+	lines     map[lineKey]*LineStats
+	files     map[ast.Node]string // The file of each included statement; others are in file
+	objects   map[object.ObjectType]int
+	stacks    map[string]*stackStats // Keyed by folded stack ("main;walk;visit")
+}
+
+// lineKey identifies a source line: included files have lines of their own.
+type lineKey struct {
+	file string
+	line int
+}
+
+// frame is a running function call.
+type frame struct {
+	parent *frame // The frame the call was made from (nil for tasks and builtin callbacks)
+	fn     *FunctionStats
+	stack  string // Folded stack up to and including this frame
+	start  time.Time
+	inner  time.Duration // Time spent in calls made from this frame
+	stmts  []*statement  // Statements of this frame being run, innermost last
+}
+
+// statement is a statement being run.
+type statement struct {
+	line  *LineStats
+	start time.Time
+	inner time.Duration // Time spent in nested statements and calls
+}
+
+// stackStats is the profile of one call stack, as used for flame graphs and pprof.
+type stackStats struct {
+	frames  []*FunctionStats // Outermost first
+	calls   int              // Calls of the innermost function with this stack
+	self    time.Duration    // Exclusive time of the innermost function with this stack
+	objects int              // Values created with this stack
+}
+
+// New creates a profiler for the program in file and starts its clock.
+func New(file string) *Profiler {
+	p := &Profiler{
+		file:      file,
+		started:   time.Now(),
+		frames:    make(map[*object.Environment]*frame),
+		functions: make(map[*object.Function]*FunctionStats),
+		byName:    make(map[string]*FunctionStats),
+		lines:     make(map[lineKey]*LineStats),
+		files:     make(map[ast.Node]string),
+		objects:   make(map[object.ObjectType]int),
+		stacks:    make(map[string]*stackStats),
+	}
+	main := &FunctionStats{Name: MainName, Calls: 1}
+	p.byName[MainName] = main
+	p.root = &frame{fn: main, stack: MainName, start: p.started}
+	p.stackOf(p.root).calls = 1
+	return p
+}
+
+// Stop ends the profile: the time of code outside functions is settled and reports can be written.
+func (p *Profiler) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.elapsed = time.Since(p.started)
+	p.root.fn.Inclusive = p.elapsed
+	p.root.fn.Exclusive = p.elapsed - p.root.inner
+	p.stackOf(p.root).self += p.elapsed - p.root.inner
+}
+
+// ----------------------------------------------------------------------------------------------
+// HOOK
+// ----------------------------------------------------------------------------------------------
+
+var _ evaluator.LoadHook = (*Profiler)(nil)
+
+// Load records which file the statements of an included program are in.
+func (p *Profiler) Load(file string, program *ast.Program) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ast.Inspect(program, func(node ast.Node) bool {
+		if isTimed(node) {
+			p.files[node] = file
+		}
+		return true
+	})
+}
+
+func (p *Profiler) Enter(node ast.Node, env *object.Environment) {
+	if !isTimed(node) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.frameOf(env)
+	if f == nil {
+		return
+	}
+	file, ok := p.files[node]
+	if !ok {
+		file = p.file
+	}
+	key := lineKey{file, node.Pos().Line}
+	stats := p.lines[key]
+	if stats == nil {
+		stats = &LineStats{File: key.file, Line: key.line}
+		p.lines[key] = stats
+	}
+	stats.Count++
+	stats.active++
+	f.stmts = append(f.stmts, &statement{line: stats, start: time.Now()})
+}
+
+func (p *Profiler) Leave(node ast.Node, env *object.Environment, result object.Object) {
+	if (createsValue(node) || callsMaker(node, env)) && result != nil && result != evaluator.NULL && result != evaluator.TRUE && result != evaluator.FALSE && result.Type() != object.ERROR_OBJ {
+		p.mu.Lock()
+		p.objects[result.Type()]++
+		if f := p.frameOf(env); f != nil {
+			p.stackOf(f).objects++
+		}
+		p.mu.Unlock()
+	}
+	if !isTimed(node) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.frameOf(env)
+	if f == nil || len(f.stmts) == 0 {
+		return
+	}
+	s := f.stmts[len(f.stmts)-1]
+	f.stmts = f.stmts[:len(f.stmts)-1]
+	took := time.Since(s.start)
+	s.line.Exclusive += took - s.inner
+	if s.line.active--; s.line.active == 0 {
+		s.line.Inclusive += took
+	}
+	if len(f.stmts) > 0 {
+		f.stmts[len(f.stmts)-1].inner += took
+	}
+}
+
+func (p *Profiler) Call(fn *object.Function, args []object.Object, env, caller *object.Environment) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var parent *frame
+	if caller != nil {
+		parent = p.frameOf(caller)
+	}
+	stats := p.function(fn)
+	stats.Calls++
+	stats.active++
+	f := &frame{parent: parent, fn: stats, stack: stats.label(), start: time.Now()}
+	if parent != nil {
+		f.stack = parent.stack + ";" + f.stack
+	}
+	p.frames[env] = f
+	p.stackOf(f).calls++
+}
+
+func (p *Profiler) Return(fn *object.Function, result object.Object, env *object.Environment) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f := p.frames[env]
+	if f == nil {
+		return
+	}
+	delete(p.frames, env)
+	took := time.Since(f.start)
+	f.fn.Exclusive += took - f.inner
+	if f.fn.active--; f.fn.active == 0 {
+		f.fn.Inclusive += took
+	}
+	p.stackOf(f).self += took - f.inner
+	if f.parent != nil {
+		f.parent.inner += took
+		if len(f.parent.stmts) > 0 {
+			f.parent.stmts[len(f.parent.stmts)-1].inner += took
+		}
+	}
+}
+
+// frameOf finds the call running code in env: the root frame outside functions, nil for code
+// whose call is no longer running (the body of a generator).
+func (p *Profiler) frameOf(env *object.Environment) *frame {
+	scope := env.CallScope()
+	if scope == nil {
+		return p.root
+	}
+	return p.frames[scope]
+}
+
+func (p *Profiler) function(fn *object.Function) *FunctionStats {
+	if stats, ok := p.functions[fn]; ok {
+		return stats
+	}
+	name := fn.Name
+	if name == "" {
+		name = "anonymous"
+	}
+	line := fn.Body.Token.Line
+	key := fmt.Sprintf("%s:%d", name, line)
+	stats, ok := p.byName[key]
+	if !ok {
+		stats = &FunctionStats{Name: name, Line: line}
+		p.byName[key] = stats
+	}
+	p.functions[fn] = stats // Closures made by the same literal share their stats
+	return stats
+}
+
+func (p *Profiler) stackOf(f *frame) *stackStats {
+	stats, ok := p.stacks[f.stack]
+	if !ok {
+		stats = &stackStats{}
+		for fr := f; fr != nil; fr = fr.parent {
+			stats.frames = append([]*FunctionStats{fr.fn}, stats.frames...)
+		}
+		p.stacks[f.stack] = stats
+	}
+	return stats
+}
+
+// label names a function in stacks. Functions sharing a name are told apart by their line.
+func (s *FunctionStats) label() string {
+	if s.Line == 0 {
+		return s.Name
+	}
+	return fmt.Sprintf("%s:%d", s.Name, s.Line)
+}
+
+// isTimed reports whether node is a statement whose line is profiled. Blocks only hold
+// statements, so timing them would count their lines twice.
+func isTimed(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.BlockStatement:
+		return false
+	case ast.Statement:
+		return true
+	}
+	return false
+}
+
+// createsValue reports whether evaluating node makes a new value (rather than reading one).
+func createsValue(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.CharLiteral,
+		*ast.ArrayLiteral, *ast.MapLiteral, *ast.TupleLiteral, *ast.FunctionLiteral,
+		*ast.StructInstantiationExpression, *ast.InfixExpression, *ast.PrefixExpression,
+		*ast.PointerReferenceExpression:
+		return true
+	}
+	return false
+}
+
+// makers lists the builtins whose result is always a value they made (rather than one passed
+// to them, like freeze or wait). The evaluator never sees those values being created.
+var makers = map[string]bool{
+	"count": true, "append": true, "ask": true, "upper": true, "lower": true, "split": true,
+	"join": true, "str": true, "ord": true, "chr": true, "new": true, "collect": true,
+	"take": true, "skip": true, "map": true, "filter": true, "wait_all": true, "channel": true,
+}
+
+// callsMaker reports whether node is a call of one of the makers builtins, in env.
+func callsMaker(node ast.Node, env *object.Environment) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+	name, ok := call.Function.(*ast.Identifier)
+	if !ok || !makers[name.Value] {
+		return false
+	}
+	if name.Token.Type == token.TEMPLATE {
+		return true // Interpolation calls the builtin str, whatever str is in env
+	}
+	val, ok := env.Get(name.Value)
+	if !ok {
+		return true
+	}
+	builtin, _ := object.GetBuiltin(name.Value)
+	return val == builtin // A redefined name is a function of the program's own
+}
+
+// ----------------------------------------------------------------------------------------------
+// REPORTS
+// ----------------------------------------------------------------------------------------------
+
+// Functions returns the profile of every function called, slowest (by exclusive time) first.
+// Code outside any function is included as MainName.
+func (p *Profiler) Functions() []FunctionStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []FunctionStats
+	for _, stats := range p.byName {
+		out = append(out, *stats)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Exclusive != out[j].Exclusive {
+			return out[i].Exclusive > out[j].Exclusive
+		}
+		return out[i].label() < out[j].label()
+	})
+	return out
+}
+
+// Lines returns the profile of every line that ran, slowest (by exclusive time) first.
+func (p *Profiler) Lines() []LineStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []LineStats
+	for _, stats := range p.lines {
+		out = append(out, *stats)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Exclusive != out[j].Exclusive {
+			return out[i].Exclusive > out[j].Exclusive
+		}
+		if out[i].File != out[j].File {
+			return out[i].File < out[j].File
+		}
+		return out[i].Line < out[j].Line
+	})
+	return out
+}
+
+// Objects returns how many values of each type the program created.
+func (p *Profiler) Objects() map[object.ObjectType]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[object.ObjectType]int, len(p.objects))
+	for typ, n := range p.objects {
+		out[typ] = n
+	}
+	return out
+}
+
+// maxTextLines is how many of the slowest lines the text report lists.
+const maxTextLines = 20
+
+// WriteText writes a human readable summary of the profile.
+func (p *Profiler) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Profile of %s: %s\n", p.file, p.elapsed.Round(time.Microsecond))
+
+	fmt.Fprintf(&b, "\nFunctions (by exclusive time):\n")
+	fmt.Fprintf(&b, "  %8s %12s %12s  %s\n", "calls", "inclusive", "exclusive", "function")
+	for _, f := range p.Functions() {
+		fmt.Fprintf(&b, "  %8d %12s %12s  %s\n", f.Calls, round(f.Inclusive), round(f.Exclusive), f.describe())
+	}
+
+	lines := p.Lines()
+	fmt.Fprintf(&b, "\nLines (by exclusive time):\n")
+	fmt.Fprintf(&b, "  %8s %12s %12s  %s\n", "count", "inclusive", "exclusive", "file:line")
+	for i, l := range lines {
+		if i == maxTextLines {
+			fmt.Fprintf(&b, "  ... %d more lines\n", len(lines)-maxTextLines)
+			break
+		}
+		fmt.Fprintf(&b, "  %8d %12s %12s  %s\n", l.Count, round(l.Inclusive), round(l.Exclusive), l.describe())
+	}
+
+	objects := p.Objects()
+	types := make([]string, 0, len(objects))
+	for typ := range objects {
+		types = append(types, string(typ))
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if objects[object.ObjectType(types[i])] != objects[object.ObjectType(types[j])] {
+			return objects[object.ObjectType(types[i])] > objects[object.ObjectType(types[j])]
+		}
+		return types[i] < types[j]
+	})
+	fmt.Fprintf(&b, "\nValues created (by type):\n")
+	for _, typ := range types {
+		fmt.Fprintf(&b, "  %8d  %s\n", objects[object.ObjectType(typ)], typ)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteFolded writes the profile as folded stacks ("main;walk:3;visit:9 1200", one stack per
+// line, with the exclusive time of the innermost function in nanoseconds), the input format
+// of flame graph tools.
+func (p *Profiler) WriteFolded(w io.Writer) error {
+	p.mu.Lock()
+	var b strings.Builder
+	for _, key := range p.sortedStacks() {
+		if self := p.stacks[key].self; self > 0 {
+			fmt.Fprintf(&b, "%s %d\n", key, self.Nanoseconds())
+		}
+	}
+	p.mu.Unlock()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (p *Profiler) sortedStacks() []string {
+	keys := make([]string, 0, len(p.stacks))
+	for key := range p.stacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *FunctionStats) describe() string {
+	if s.Line == 0 {
+		return s.Name
+	}
+	return fmt.Sprintf("%s (line %d)", s.Name, s.Line)
+}
+
+func (l *LineStats) describe() string {
+	return fmt.Sprintf("%s:%d", l.File, l.Line)
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
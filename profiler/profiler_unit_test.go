@@ -0,0 +1,197 @@
+// ==============================================================================================
+// FILE: profiler/profiler_unit_test.go
+// ==============================================================================================
+// PURPOSE: Unit tests for the execution profiler.
+//          Verifies call counts, line counts, included files, value counts and the three report
+//          formats.
+// ==============================================================================================
+
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/lexer"
+	"eloquence/object"
+	"eloquence/parser"
+)
+
+const sample = `fact is takes(n) {
+    if n less 2 { return 1 }
+    return n times fact(n minus 1)
+}
+total is 0
+for i in [3, 4] { total is total adds fact(i) }
+double is map([1, 2], takes(x) { x times 2 })
+collect(double)
+`
+
+func profile(t *testing.T, input string) *Profiler {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	prof := New("sample.eq")
+	evaluator.SetHook(prof)
+	result := evaluator.Eval(program, object.NewEnvironment())
+	evaluator.SetHook(nil)
+	prof.Stop()
+	if errObj, ok := result.(*object.Error); ok {
+		t.Fatalf("runtime error: %s", errObj.Message)
+	}
+	return prof
+}
+
+func TestProfilerCounts(t *testing.T) {
+	prof := profile(t, sample)
+
+	calls := map[string]int{}
+	for _, f := range prof.Functions() {
+		calls[f.label()] = f.Calls
+		if f.Exclusive > f.Inclusive {
+			t.Errorf("%s: exclusive time %s exceeds inclusive time %s", f.Name, f.Exclusive, f.Inclusive)
+		}
+	}
+	expected := map[string]int{"main": 1, "fact:1": 7, "anonymous:7": 2}
+	for name, n := range expected {
+		if calls[name] != n {
+			t.Errorf("expected %d calls of %s, got %d (all: %v)", n, name, calls[name], calls)
+		}
+	}
+
+	lines := map[int]int{}
+	for _, l := range prof.Lines() {
+		lines[l.Line] = l.Count
+	}
+	// Line 2 holds the if and, for the two calls with n of 1, its return; line 6 a loop run twice
+	if lines[2] != 7+2 || lines[3] != 5 || lines[6] != 1+2 {
+		t.Errorf("unexpected line counts: %v", lines)
+	}
+
+	// Two array literals and the array made by collect; the generator made by map
+	if objects := prof.Objects(); objects[object.ARRAY_OBJ] != 3 || objects[object.GENERATOR_OBJ] != 1 || objects[object.FUNCTION_OBJ] != 2 {
+		t.Errorf("unexpected value counts: %v", objects)
+	}
+}
+
+func TestProfilerCountsValuesMadeByBuiltins(t *testing.T) {
+	prof := profile(t, `xs is collect(map([1, 2, 3], takes(x) { x times 2 }))
+for i in [1, 2, 3, 4, 5, 6, 7, 8] { firsts is collect(take(xs, 2)) }
+words is split("a b", " ")
+same is freeze(words)
+redefine upper is takes(s) { s }
+loud is upper("a")`)
+
+	objects := prof.Objects()
+	// Two literals, nine collects and a split; freeze returns the array it was given
+	if objects[object.ARRAY_OBJ] != 2+9+1 {
+		t.Errorf("expected 12 arrays, got %d (all: %v)", objects[object.ARRAY_OBJ], objects)
+	}
+	if objects[object.GENERATOR_OBJ] != 1+8 {
+		t.Errorf("expected 9 generators, got %d (all: %v)", objects[object.GENERATOR_OBJ], objects)
+	}
+	// The literals "a b", " " and "a"; the redefined upper makes nothing
+	if objects[object.STRING_OBJ] != 3 {
+		t.Errorf("expected 3 strings, got %d (all: %v)", objects[object.STRING_OBJ], objects)
+	}
+}
+
+func TestProfilerIncludedLines(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.eq")
+	if err := os.WriteFile(lib, []byte("a is 1\nb is 2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	evaluator.ParserFunc = func(input string) *ast.Program { return parser.New(lexer.New(input)).ParseProgram() }
+	defer func() { evaluator.ParserFunc = nil }()
+
+	// Line 2 of the program and line 2 of the library must not be counted together
+	prof := profile(t, "include \""+lib+"\"\nc is 3\n")
+	counts := map[string]int{}
+	for _, l := range prof.Lines() {
+		counts[l.describe()] = l.Count
+	}
+	expected := map[string]int{"sample.eq:1": 1, "sample.eq:2": 1, lib + ":1": 1, lib + ":2": 1}
+	if len(counts) != len(expected) {
+		t.Errorf("expected lines %v, got %v", expected, counts)
+	}
+	for line, n := range expected {
+		if counts[line] != n {
+			t.Errorf("expected %s to run %d times, got %d (all: %v)", line, n, counts[line], counts)
+		}
+	}
+
+	var text bytes.Buffer
+	if err := prof.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), lib+":2") {
+		t.Errorf("text report is missing %s:2:\n%s", lib, text.String())
+	}
+}
+
+func TestProfilerReports(t *testing.T) {
+	prof := profile(t, sample)
+
+	var text bytes.Buffer
+	if err := prof.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Profile of sample.eq", "fact (line 1)", "Values created (by type):", "INTEGER"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report is missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var folded bytes.Buffer
+	if err := prof.WriteFolded(&folded); err != nil {
+		t.Fatal(err)
+	}
+	stacks := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(folded.String()), "\n") {
+		stacks[line[:strings.LastIndex(line, " ")]] = true
+	}
+	// The callback is called by the map builtin, so it starts a stack of its own
+	for _, want := range []string{"main", "main;fact:1", "main;fact:1;fact:1;fact:1;fact:1", "anonymous:7"} {
+		if !stacks[want] {
+			t.Errorf("folded stacks are missing %q:\n%s", want, folded.String())
+		}
+	}
+
+	var pprof bytes.Buffer
+	if err := prof.WritePprof(&pprof); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&pprof)
+	if err != nil {
+		t.Fatalf("pprof output is not gzipped: %s", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"nanoseconds", "fact", "sample.eq"} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("pprof string table is missing %q", want)
+		}
+	}
+}
+
+func TestProtoBufferVarint(t *testing.T) {
+	var b protoBuffer
+	b.uint64(1, 300)
+	if want := []byte{0x08, 0xac, 0x02}; !bytes.Equal(b.data, want) {
+		t.Errorf("expected % x, got % x", want, b.data)
+	}
+}
@@ -0,0 +1,346 @@
+// ==============================================================================================
+// FILE: repl/commands.go
+// ==============================================================================================
+// PACKAGE: repl
+// PURPOSE: Session commands that take an argument: .load, .save, .env, .type, .time, .trace and .ast.
+//          Each one works on the REPL's persistent environment and writes its report to `out`.
+// ==============================================================================================
+
+package repl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/lexer"
+	"eloquence/object"
+	"eloquence/parser"
+	"eloquence/token"
+	"eloquence/tracer"
+)
+
+// splitCommand separates ".name argument" into its two parts.
+func splitCommand(line string) (name, arg string) {
+	name, arg, _ = strings.Cut(line, " ")
+	return name, strings.TrimSpace(arg)
+}
+
+// parseSnippet parses the argument of a command, printing any syntax errors.
+func parseSnippet(out io.Writer, code string) (*ast.Program, bool) {
+	if code == "" {
+		fmt.Fprintln(out, Red+"Missing expression."+Reset)
+		return nil, false
+	}
+	p := parser.New(lexer.New(code))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Errors())
+		return nil, false
+	}
+	return program, true
+}
+
+// isError reports whether evaluation failed.
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
+
+// succeeded reports whether code ran without errors (nil means it did not run at all).
+func succeeded(obj object.Object) bool {
+	return obj != nil && !isError(obj)
+}
+
+// ----------------------------------------------------------------------------
+// .load / .save
+// ----------------------------------------------------------------------------
+
+// loadFile evaluates a file into the session environment.
+// It returns the source and the result of evaluating it (nil when it did not run),
+// so the session can record the file when it ran without errors.
+func loadFile(out io.Writer, env *object.Environment, path string) (string, object.Object) {
+	if path == "" {
+		fmt.Fprintln(out, Red+"Usage: .load file.eq"+Reset)
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(out, Red+"Cannot load %s: %s\n"+Reset, path, err)
+		return "", nil
+	}
+
+	program, ok := parseSnippet(out, string(data))
+	if !ok {
+		return "", nil
+	}
+	evaluated := evaluator.Eval(program, env)
+	if isError(evaluated) {
+		printEvalResult(out, evaluated)
+		return "", evaluated
+	}
+
+	fmt.Fprintf(out, Green+"Loaded %s\n"+Reset, path)
+	return string(data), evaluated
+}
+
+// saveInputs writes the inputs that ran successfully in this session to a file.
+func saveInputs(out io.Writer, path string, inputs []string) {
+	if path == "" {
+		fmt.Fprintln(out, Red+"Usage: .save file.eq"+Reset)
+		return
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(inputs, "")), 0o644); err != nil {
+		fmt.Fprintf(out, Red+"Cannot save %s: %s\n"+Reset, path, err)
+		return
+	}
+	fmt.Fprintf(out, Green+"Saved %d inputs to %s\n"+Reset, len(inputs), path)
+}
+
+// ----------------------------------------------------------------------------
+// .env / .type / .time
+// ----------------------------------------------------------------------------
+
+// printEnv lists every binding in the session with its runtime type and value.
+func printEnv(out io.Writer, env *object.Environment) {
+	names := env.Names()
+	if len(names) == 0 {
+		fmt.Fprintln(out, Gray+"(no bindings)"+Reset)
+		return
+	}
+	for _, name := range names {
+		value, _ := env.Get(name)
+		fmt.Fprintf(out, "  %-16s "+Cyan+"%-10s"+Reset+" %s\n", name, value.Type(), preview(value))
+	}
+}
+
+// preview shortens a value's representation to a single line.
+func preview(obj object.Object) string {
+	const maxWidth = 48
+	str := strings.ReplaceAll(obj.Inspect(), "\n", " ")
+	if len([]rune(str)) > maxWidth {
+		str = string([]rune(str)[:maxWidth-3]) + "..."
+	}
+	return str
+}
+
+// printType evaluates an expression and shows its runtime type.
+// It returns the value (nil when the code did not parse).
+func printType(out io.Writer, env *object.Environment, code string) object.Object {
+	program, ok := parseSnippet(out, code)
+	if !ok {
+		return nil
+	}
+	evaluated := unwrap(evaluator.Eval(program, env))
+	if isError(evaluated) {
+		printEvalResult(out, evaluated)
+		return evaluated
+	}
+	fmt.Fprintln(out, Cyan+string(evaluated.Type())+Reset)
+	return evaluated
+}
+
+// timeEval evaluates code and reports the wall time and heap allocations it took.
+// It returns the result (nil when the code did not parse).
+func timeEval(out io.Writer, env *object.Environment, code string) object.Object {
+	program, ok := parseSnippet(out, code)
+	if !ok {
+		return nil
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	evaluated := evaluator.Eval(program, env)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	printEvalResult(out, evaluated)
+	fmt.Fprintf(out, Gray+"Time: %s, %d allocations (%d bytes)\n"+Reset,
+		elapsed, after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc)
+	return evaluated
+}
+
+// unwrap returns the value inside a ReturnValue and treats "no value" as NULL.
+func unwrap(obj object.Object) object.Object {
+	if rv, ok := obj.(*object.ReturnValue); ok {
+		obj = rv.Value
+	}
+	if obj == nil {
+		return &object.Null{}
+	}
+	return obj
+}
+
+// ----------------------------------------------------------------------------
+// .trace
+// ----------------------------------------------------------------------------
+
+// setTrace handles ".trace on [pattern]", ".trace file <path> [pattern]" and ".trace off".
+// The pattern limits the trace to functions whose name matches. traceFile holds the file
+// being traced to, so it can be closed when the trace stops.
+func setTrace(out io.Writer, arg string, traceFile **os.File) {
+	mode, rest := splitCommand(arg)
+	switch mode {
+	case "off":
+		stopTrace(traceFile)
+		fmt.Fprintln(out, Gray+"Trace off."+Reset)
+		return
+	case "on", "file":
+	default:
+		fmt.Fprintln(out, Red+"Usage: .trace on [function pattern] | .trace file <path> [function pattern] | .trace off"+Reset)
+		return
+	}
+
+	opts := tracer.Options{Out: out}
+	pattern := rest
+	var file *os.File
+	if mode == "file" {
+		var path string
+		path, pattern = splitCommand(rest)
+		if path == "" {
+			fmt.Fprintln(out, Red+"Usage: .trace file <path> [function pattern]"+Reset)
+			return
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintf(out, Red+"Cannot trace to %s: %s\n"+Reset, path, err)
+			return
+		}
+		file, opts.Out = f, f
+	}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			fmt.Fprintf(out, Red+"Invalid function pattern: %s\n"+Reset, err)
+			if file != nil {
+				file.Close()
+			}
+			return
+		}
+		opts.Filter = re
+	}
+
+	stopTrace(traceFile)
+	*traceFile = file
+	evaluator.SetHook(tracer.New(opts))
+	fmt.Fprintln(out, Gray+"Trace on."+Reset)
+}
+
+// stopTrace removes the tracer and closes the file it wrote to.
+func stopTrace(traceFile **os.File) {
+	evaluator.SetHook(nil)
+	if *traceFile != nil {
+		(*traceFile).Close()
+		*traceFile = nil
+	}
+}
+
+// ----------------------------------------------------------------------------
+// .ast
+// ----------------------------------------------------------------------------
+
+// printTree pretty-prints a syntax tree, one node per line, children indented under their parent.
+// Scalar fields and the node's span (line:column-line:column) are shown next to the node name;
+// child nodes are labelled with their field name.
+func printTree(out io.Writer, node ast.Node) {
+	printNode(out, "", "", reflect.ValueOf(node))
+}
+
+func printNode(out io.Writer, indent, label string, v reflect.Value) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	// Header: label, node name and scalar fields
+	var header strings.Builder
+	header.WriteString(indent)
+	if label != "" {
+		header.WriteString(Gray + label + ": " + Reset)
+	}
+	header.WriteString(Purple + v.Type().Name() + Reset)
+
+	t := v.Type()
+	var children []int
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if tok, ok := fv.Interface().(token.Token); ok {
+			// Tokens only locate the node, which its span shows; a modifier keyword is shown
+			if field.Name == "Modifier" && tok.Literal != "" {
+				fmt.Fprintf(&header, " %s%q", scalarLabel(field.Name), tok.Literal)
+			}
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			fmt.Fprintf(&header, " %s%q", scalarLabel(field.Name), fv.String())
+		case reflect.Int32:
+			fmt.Fprintf(&header, " %s%q", scalarLabel(field.Name), rune(fv.Int()))
+		case reflect.Int, reflect.Int64, reflect.Float64, reflect.Bool:
+			fmt.Fprintf(&header, " %s%v", scalarLabel(field.Name), fv.Interface())
+		default:
+			children = append(children, i)
+		}
+	}
+	if node, ok := v.Addr().Interface().(ast.Node); ok && node.Pos().IsValid() {
+		fmt.Fprintf(&header, " %s%s-%s%s", Gray, node.Pos(), node.End(), Reset)
+	}
+	fmt.Fprintln(out, header.String())
+
+	// Children: nodes, lists of nodes and map pairs
+	indent += "  "
+	for _, i := range children {
+		name := t.Field(i).Name
+		fv := v.Field(i)
+		switch fv.Kind() {
+		case reflect.Slice:
+			if name == "Keys" && fv.Type().Elem() == reflect.TypeOf((*ast.Expression)(nil)).Elem() {
+				continue // Printed together with Pairs
+			}
+			for j := 0; j < fv.Len(); j++ {
+				printNode(out, indent, fmt.Sprintf("%s[%d]", name, j), fv.Index(j))
+			}
+		case reflect.Map:
+			printPairs(out, indent, v)
+		default:
+			printNode(out, indent, name, fv)
+		}
+	}
+}
+
+// printPairs prints map literal entries in source order.
+func printPairs(out io.Writer, indent string, v reflect.Value) {
+	m, ok := v.Addr().Interface().(*ast.MapLiteral)
+	if !ok {
+		return
+	}
+	for i, key := range m.Keys {
+		printNode(out, indent, fmt.Sprintf("Key[%d]", i), reflect.ValueOf(key))
+		printNode(out, indent, fmt.Sprintf("Value[%d]", i), reflect.ValueOf(m.Pairs[key]))
+	}
+}
+
+// scalarLabel shows "Value" fields bare and every other scalar as "Name=".
+func scalarLabel(name string) string {
+	if name == "Value" {
+		return ""
+	}
+	return name + "="
+}
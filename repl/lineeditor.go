@@ -0,0 +1,526 @@
+// ==============================================================================================
+// FILE: repl/lineeditor.go
+// ==============================================================================================
+// PACKAGE: repl
+// PURPOSE: Line input for the REPL.
+//          On a terminal, a small raw-mode editor provides cursor movement, persistent history,
+//          reverse search (Ctrl-R) and tab completion. Everywhere else (pipes, files, tests)
+//          the plain reader keeps the classic "print prompt, read a line" behaviour.
+// ==============================================================================================
+
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// errInterrupt is returned by ReadLine when the user presses Ctrl-C.
+var errInterrupt = errors.New("interrupt")
+
+// lineReader is the source of REPL input lines.
+type lineReader interface {
+	// ReadLine shows the prompt and returns the next line without its newline.
+	// It returns io.EOF at the end of input and errInterrupt on Ctrl-C.
+	ReadLine(prompt string) (string, error)
+	// AddHistory records a line the user entered.
+	AddHistory(line string)
+}
+
+// completer returns the candidates for the word ending at pos, and where that word starts.
+type completer func(line []rune, pos int) (candidates []string, start int)
+
+// newLineReader picks the raw-mode editor when `in` is a terminal and the plain reader otherwise.
+func newLineReader(in io.Reader, out io.Writer, complete completer) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(f.Fd()) {
+		editor := newLineEditor(in, out)
+		editor.complete = complete
+		editor.rawMode = func() (func(), error) { return enableRawMode(f.Fd()) }
+		editor.loadHistory(historyPath())
+		return editor
+	}
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// ----------------------------------------------------------------------------
+// PLAIN READER
+// ----------------------------------------------------------------------------
+
+// plainReader reads whole lines with a bufio.Scanner. It is used when stdin is not a TTY.
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *plainReader) AddHistory(line string) {}
+
+// ----------------------------------------------------------------------------
+// LINE EDITOR
+// ----------------------------------------------------------------------------
+
+const (
+	historyFileName = ".eloquence_history"
+	maxHistory      = 1000
+)
+
+// Control keys understood by the editor.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// Pseudo keys produced by decoding escape sequences.
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// LineEditor is a minimal readline replacement driven by raw terminal input.
+type LineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	history     []string
+	historyFile string // Lines are appended here as they are entered ("" disables saving)
+
+	complete completer
+	rawMode  func() (restore func(), err error) // nil when the input is already raw (tests)
+
+	// State of the line being edited
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func newLineEditor(in io.Reader, out io.Writer) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(in), out: out}
+}
+
+// historyPath returns the location of the persistent history file in the user's home directory.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+// loadHistory reads previously saved lines and remembers the file for future appends.
+func (e *LineEditor) loadHistory(path string) {
+	e.historyFile = path
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// AddHistory records a line, skipping blanks and immediate repeats, and appends it to the history file.
+func (e *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// ReadLine edits a single line in raw mode.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if e.rawMode != nil {
+		restore, err := e.rawMode()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt = prompt
+	e.buf = e.buf[:0]
+	e.pos = 0
+	historyIndex := len(e.history)
+	pending := "" // The unfinished line while browsing history
+
+	fmt.Fprint(e.out, prompt)
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			if err == io.EOF && len(e.buf) > 0 {
+				return e.finish(), nil
+			}
+			return "", err
+		}
+
+		switch key {
+		case keyCR, keyLF:
+			return e.finish(), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				fmt.Fprint(e.out, "\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyDelete:
+			e.deleteAt(e.pos)
+		case keyLeft, keyCtrlB:
+			if e.pos > 0 {
+				e.pos--
+			}
+		case keyRight, keyCtrlF:
+			if e.pos < len(e.buf) {
+				e.pos++
+			}
+		case keyHome, keyCtrlA:
+			e.pos = 0
+		case keyEnd, keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlU:
+			e.buf = append(e.buf[:0], e.buf[e.pos:]...)
+			e.pos = 0
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyUp, keyCtrlP:
+			if historyIndex > 0 {
+				if historyIndex == len(e.history) {
+					pending = string(e.buf)
+				}
+				historyIndex--
+				e.setLine(e.history[historyIndex])
+			}
+		case keyDown, keyCtrlN:
+			if historyIndex < len(e.history) {
+				historyIndex++
+				if historyIndex == len(e.history) {
+					e.setLine(pending)
+				} else {
+					e.setLine(e.history[historyIndex])
+				}
+			}
+		case keyCtrlR:
+			done, err := e.reverseSearch()
+			if err != nil {
+				return "", err
+			}
+			if done {
+				return e.finish(), nil
+			}
+			historyIndex = len(e.history)
+		case keyTab:
+			e.completeWord()
+		default:
+			if key >= ' ' && unicode.IsPrint(key) {
+				e.insert(key)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// finish moves to a new line and returns the edited text.
+func (e *LineEditor) finish() string {
+	fmt.Fprint(e.out, "\n")
+	return string(e.buf)
+}
+
+func (e *LineEditor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+}
+
+func (e *LineEditor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+func (e *LineEditor) setLine(line string) {
+	e.buf = append(e.buf[:0], []rune(line)...)
+	e.pos = len(e.buf)
+}
+
+// refresh redraws the current line and places the cursor.
+func (e *LineEditor) refresh() {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// readKey reads one key press, decoding the common VT100/xterm escape sequences.
+func (e *LineEditor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	next, _, err := e.in.ReadRune()
+	if err != nil {
+		return keyEscape, nil
+	}
+	switch next {
+	case 'O': // SS3 sequences sent by some terminals for Home/End and arrows
+		final, _, err := e.in.ReadRune()
+		if err != nil {
+			return keyUnknown, nil
+		}
+		return decodeFinal(final, ""), nil
+	case '[': // CSI: parameters followed by a final byte
+		var params strings.Builder
+		for {
+			c, _, err := e.in.ReadRune()
+			if err != nil {
+				return keyUnknown, nil
+			}
+			if c >= 0x40 && c <= 0x7e {
+				return decodeFinal(c, params.String()), nil
+			}
+			params.WriteRune(c)
+		}
+	}
+	return keyUnknown, nil
+}
+
+func decodeFinal(final rune, params string) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+	return keyUnknown
+}
+
+// ----------------------------------------------------------------------------
+// REVERSE SEARCH
+// ----------------------------------------------------------------------------
+
+// reverseSearch runs an incremental search through history (Ctrl-R).
+// Enter accepts the match and submits it (done = true); Ctrl-G cancels;
+// any other editing key accepts the match and returns to normal editing.
+func (e *LineEditor) reverseSearch() (done bool, err error) {
+	original := string(e.buf)
+	var query []rune
+	match := len(e.history) // Index of the current match
+
+	find := func(from int) {
+		q := string(query)
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], q) {
+				match = i
+				e.setLine(e.history[i])
+				return
+			}
+		}
+	}
+
+	for {
+		fmt.Fprintf(e.out, "\r(reverse-i-search)'%s': %s\x1b[K", string(query), string(e.buf))
+
+		key, err := e.readKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case keyCR, keyLF:
+			fmt.Fprintf(e.out, "\r%s%s\x1b[K", e.prompt, string(e.buf))
+			return true, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\n")
+			return false, errInterrupt
+		case keyCtrlG:
+			e.setLine(original)
+			return false, nil
+		case keyCtrlR:
+			find(match - 1)
+		case keyBackspace, keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		default:
+			if key >= ' ' && unicode.IsPrint(key) {
+				query = append(query, key)
+				find(min(match, len(e.history)-1))
+				continue
+			}
+			return false, nil
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+// TAB COMPLETION
+// ----------------------------------------------------------------------------
+
+// completeWord completes the word before the cursor.
+// A single candidate is inserted; several candidates are extended to their common
+// prefix, or listed below the prompt when there is nothing left to extend.
+func (e *LineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	candidates, start := e.complete(e.buf, e.pos)
+	if len(candidates) == 0 {
+		return
+	}
+
+	typed := string(e.buf[start:e.pos])
+	prefix := commonPrefix(candidates)
+	if len(candidates) > 1 && prefix == typed {
+		fmt.Fprintf(e.out, "\n%s\n", strings.Join(candidates, "  "))
+		return
+	}
+
+	rest := append([]rune(prefix), e.buf[e.pos:]...)
+	e.buf = append(e.buf[:start], rest...)
+	e.pos = start + len([]rune(prefix))
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// wordCompleter completes identifiers from the given name sources, and
+// dot-commands when the line starts with ".".
+func wordCompleter(commands []string, names func() []string) completer {
+	return func(line []rune, pos int) ([]string, int) {
+		start := pos
+		for start > 0 && isWordRune(line[start-1]) {
+			start--
+		}
+		word := string(line[start:pos])
+
+		var pool []string
+		if start == 1 && line[0] == '.' {
+			start, word, pool = 0, "."+word, commands
+		} else if word == "" {
+			return nil, pos
+		} else {
+			pool = names()
+		}
+
+		var candidates []string
+		seen := make(map[string]bool)
+		for _, name := range pool {
+			if strings.HasPrefix(name, word) && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+		return candidates, start
+	}
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
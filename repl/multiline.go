@@ -0,0 +1,73 @@
+// ==============================================================================================
+// FILE: repl/multiline.go
+// ==============================================================================================
+// PACKAGE: repl
+// PURPOSE: Decides whether the code typed so far is a complete program or needs more lines.
+//          The decision is made on real tokens and parser errors, so brackets inside strings
+//          and comments are ignored and unclosed ( [ { all keep the prompt in continuation mode.
+// ==============================================================================================
+
+package repl
+
+import (
+	"strings"
+
+	"eloquence/ast"
+	"eloquence/lexer"
+	"eloquence/parser"
+	"eloquence/token"
+)
+
+// parseInput parses the buffered code.
+// It returns complete == false when the input ends in the middle of a construct:
+// an unclosed bracket, string or comment, or a parse error caused by reaching EOF.
+// With force set, only open brackets keep the input pending; EOF errors are reported.
+func parseInput(code string, force bool) (program *ast.Program, errs []string, complete bool) {
+	if bracketDepth(code) > 0 {
+		return nil, nil, false
+	}
+
+	p := parser.New(lexer.New(code))
+	program = p.ParseProgram()
+	errs = p.Errors()
+
+	// Only the first error matters: later ones are usually knock-on effects.
+	// If parsing first went wrong at EOF, more input may still fix it.
+	if !force && len(errs) > 0 && isEOFError(errs[0]) {
+		return nil, nil, false
+	}
+	return program, errs, true
+}
+
+// bracketDepth counts open brackets over the token stream.
+// An unterminated string or comment counts as an open bracket. Any other illegal token cannot
+// be fixed by more lines, so the brackets are not counted past it.
+// A negative result means there are more closers than openers.
+func bracketDepth(code string) int {
+	depth := 0
+	l := lexer.New(code)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			depth--
+		case token.ILLEGAL:
+			switch tok.Literal {
+			case "unterminated string", "unterminated raw string", "unterminated comment":
+				return depth + 1
+			}
+			return 0
+		}
+		if depth < 0 {
+			return depth
+		}
+	}
+	return depth
+}
+
+// isEOFError reports whether a parser error was caused by running out of input.
+func isEOFError(msg string) bool {
+	return strings.Contains(msg, "got "+string(token.EOF)) ||
+		strings.HasSuffix(msg, "for "+string(token.EOF))
+}
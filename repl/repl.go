@@ -9,15 +9,15 @@
 package repl
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"sort"
 	"strings"
 
 	"eloquence/evaluator"
 	"eloquence/lexer"
 	"eloquence/object"
-	"eloquence/parser"
 	"eloquence/token"
 )
 
@@ -60,11 +60,32 @@ const (
 // REPL LOGIC
 // ----------------------------------------------------------------------------
 
+// replCommands lists the dot-commands, used by tab completion.
+var replCommands = []string{
+	".exit", ".clear", ".cancel", ".debug", ".help", ".helper",
+	".load", ".save", ".env", ".type", ".time", ".trace", ".ast",
+}
+
 // Start launches the Read-Eval-Print Loop.
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+// When `in` is a terminal, input goes through the line editor (history, completion);
+// otherwise lines are read plainly, which keeps piped input and tests working.
+// It returns the exit code of the session: the code given to exit(), or 0.
+func Start(in io.Reader, out io.Writer) int {
 	env := object.NewEnvironment() // Persistent memory for the session
 	debugMode := false
+	var traceFile *os.File // Set while .trace writes to a file
+	defer stopTrace(&traceFile)
+
+	// Completion offers keywords, builtins and everything bound in the current session
+	reader := newLineReader(in, out, wordCompleter(replCommands, func() []string {
+		names := token.Keywords()
+		for _, def := range object.Builtins {
+			names = append(names, def.Name)
+		}
+		names = append(names, env.Names()...)
+		sort.Strings(names)
+		return names
+	}))
 
 	// Print Welcome Header
 	fmt.Fprint(out, LOGO)
@@ -72,32 +93,49 @@ func Start(in io.Reader, out io.Writer) {
 
 	// Buffer to store code across multiple lines (for loops/functions)
 	var codeBuffer strings.Builder
-	braceCount := 0
 
-	// Initial Prompt
-	fmt.Fprint(out, Cyan+PROMPT+Reset)
+	// Inputs that ran without errors, written out by .save
+	var inputs []string
 
 	for {
-		scanned := scanner.Scan()
-		if !scanned {
-			return
+		prompt := Cyan + PROMPT + Reset
+		if codeBuffer.Len() > 0 {
+			prompt = Gray + CONT_PROMPT + Reset
+		}
+
+		line, err := reader.ReadLine(prompt)
+		if err == errInterrupt {
+			// Ctrl-C abandons the block being typed
+			codeBuffer.Reset()
+			continue
+		}
+		if err != nil {
+			return 0
 		}
 
-		line := scanner.Text()
+		reader.AddHistory(line)
 		trimmedLine := strings.TrimSpace(line)
 
+		// .cancel works at any point, including in the middle of a block
+		if trimmedLine == ".cancel" {
+			if codeBuffer.Len() > 0 {
+				codeBuffer.Reset()
+				fmt.Fprintln(out, Gray+"Input cancelled."+Reset)
+			}
+			continue
+		}
+
 		// --- COMMAND HANDLING (Only if not inside a code block) ---
-		if braceCount == 0 && strings.HasPrefix(trimmedLine, ".") {
-			switch trimmedLine {
+		if codeBuffer.Len() == 0 && strings.HasPrefix(trimmedLine, ".") {
+			command, arg := splitCommand(trimmedLine)
+			switch command {
 			case ".exit":
 				fmt.Fprintln(out, Yellow+"Goodbye!"+Reset)
-				return
+				return 0
 			case ".clear":
 				env = object.NewEnvironment() // Reset environment
-				codeBuffer.Reset()
+				inputs = nil
 				fmt.Fprintln(out, Green+"Environment cleared (memory reset)."+Reset)
-				fmt.Fprint(out, Cyan+PROMPT+Reset)
-				continue
 			case ".debug":
 				debugMode = !debugMode
 				status := "DISABLED"
@@ -105,38 +143,59 @@ func Start(in io.Reader, out io.Writer) {
 					status = "ENABLED"
 				}
 				fmt.Fprintf(out, Gray+"Debug mode %s\n"+Reset, status)
-				fmt.Fprint(out, Cyan+PROMPT+Reset)
-				continue
 			case ".help", ".helper":
 				printHelp(out)
-				fmt.Fprint(out, Cyan+PROMPT+Reset)
-				continue
+			case ".load":
+				code, evaluated := loadFile(out, env, arg)
+				if exit, ok := object.ExitCode(evaluated); ok {
+					return exit
+				}
+				if succeeded(evaluated) {
+					inputs = append(inputs, code)
+				}
+			case ".save":
+				saveInputs(out, arg, inputs)
+			case ".env":
+				printEnv(out, env)
+			case ".type", ".time":
+				run := printType
+				if command == ".time" {
+					run = timeEval
+				}
+				evaluated := run(out, env, arg)
+				if exit, ok := object.ExitCode(evaluated); ok {
+					return exit
+				}
+				if succeeded(evaluated) {
+					inputs = append(inputs, arg+"\n")
+				}
+			case ".trace":
+				setTrace(out, arg, &traceFile)
+			case ".ast":
+				if program, ok := parseSnippet(out, arg); ok {
+					printTree(out, program)
+				}
 			default:
 				fmt.Fprintf(out, Red+"Unknown command: %s. Type .help for info.\n"+Reset, trimmedLine)
-				fmt.Fprint(out, Cyan+PROMPT+Reset)
-				continue
 			}
+			continue
 		}
 
 		// --- MULTILINE DETECTION ---
-		// We count open/close braces to know if the user is finished typing a block.
-		braceCount += strings.Count(line, "{")
-		braceCount -= strings.Count(line, "}")
-
-		// Append current line to buffer
+		// The lexer and parser decide whether the input is finished: open brackets,
+		// strings or comments, and errors at EOF (e.g. "x is") wait for more lines.
+		// A blank line submits input that only the parser is waiting on, so its errors show.
+		pending := codeBuffer.Len() > 0
 		codeBuffer.WriteString(line + "\n")
+		fullCode := codeBuffer.String()
 
-		// If braces are unbalanced (e.g., "while x < 10 {"), wait for more input
-		if braceCount > 0 {
-			fmt.Fprint(out, Gray+CONT_PROMPT+Reset)
+		program, errs, complete := parseInput(fullCode, pending && trimmedLine == "")
+		if !complete {
 			continue
 		}
 
 		// --- EXECUTION PHASE ---
-		// User is done typing (braces balanced), let's run the code.
-		fullCode := codeBuffer.String()
 		codeBuffer.Reset() // Clear buffer for next command
-		braceCount = 0     // Reset count safety
 
 		// 1. LEXER DEBUG (Optional)
 		if debugMode {
@@ -144,14 +203,8 @@ func Start(in io.Reader, out io.Writer) {
 		}
 
 		// 2. PARSER
-		l := lexer.New(fullCode)
-		p := parser.New(l)
-		program := p.ParseProgram()
-
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
-			// Reset prompt and continue loop
-			fmt.Fprint(out, Cyan+PROMPT+Reset)
+		if len(errs) != 0 {
+			printParserErrors(out, errs)
 			continue
 		}
 
@@ -162,12 +215,15 @@ func Start(in io.Reader, out io.Writer) {
 
 		// 4. EVALUATOR
 		evaluated := evaluator.Eval(program, env)
+		if exit, ok := object.ExitCode(evaluated); ok {
+			return exit // exit() ends the session; the deferred cleanup closes any trace file
+		}
 		if evaluated != nil {
 			printEvalResult(out, evaluated)
 		}
-
-		// Ready for next input
-		fmt.Fprint(out, Cyan+PROMPT+Reset)
+		if !isError(evaluated) && strings.TrimSpace(fullCode) != "" {
+			inputs = append(inputs, fullCode)
+		}
 	}
 }
 
@@ -181,7 +237,17 @@ func printHelp(out io.Writer) {
 	fmt.Fprintln(out, Cyan+"\n[ REPL Commands ]"+Reset)
 	fmt.Fprintln(out, "  .exit           Quit the REPL")
 	fmt.Fprintln(out, "  .clear          Reset variables/memory")
+	fmt.Fprintln(out, "  .cancel         Drop a half-entered block")
 	fmt.Fprintln(out, "  .debug          Toggle detailed AST/Token view")
+	fmt.Fprintln(out, "  .load <file>    Run a file in this session")
+	fmt.Fprintln(out, "  .save <file>    Write this session's successful inputs to a file")
+	fmt.Fprintln(out, "  .env            List variables with their types")
+	fmt.Fprintln(out, "  .type <expr>    Show the runtime type of an expression")
+	fmt.Fprintln(out, "  .time <expr>    Measure evaluation time and allocations")
+	fmt.Fprintln(out, "  .trace on|off   Log statements, calls and assignments as they run")
+	fmt.Fprintln(out, "                  (.trace on <pattern> for matching functions, .trace file <path>)")
+	fmt.Fprintln(out, "  .ast <expr>     Pretty-print the syntax tree of an expression")
+	fmt.Fprintln(out, "  Keys            Up/Down history, Ctrl-R search, Tab complete, Ctrl-C cancel")
 
 	fmt.Fprintln(out, Cyan+"\n[ Variables & Math ]"+Reset)
 	fmt.Fprintln(out, "  Assignment      "+Green+"x is 10"+Reset)
@@ -244,6 +310,9 @@ func printEvalResult(out io.Writer, obj object.Object) {
 	if obj == nil || obj.Type() == object.NULL_OBJ {
 		return
 	}
+	if _, ok := object.ExitCode(obj); ok {
+		return // Not an error to show: the session ends
+	}
 
 	str := obj.Inspect()
 
@@ -258,7 +327,7 @@ func printEvalResult(out io.Writer, obj object.Object) {
 			color = Red
 		}
 		fmt.Fprintf(out, color+"%s\n"+Reset, str)
-	case *object.String:
+	case *object.String, *object.Char:
 		fmt.Fprintf(out, Green+"%s\n"+Reset, str)
 	case *object.ReturnValue:
 		printEvalResult(out, obj.Value)
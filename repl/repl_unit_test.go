@@ -8,9 +8,15 @@
 package repl
 
 import (
+	"bufio"
 	"bytes"
+	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"eloquence/object"
 )
 
 // Helper to simulate a REPL session
@@ -66,3 +72,391 @@ func TestREPL_Commands(t *testing.T) {
 		t.Error("Environment was not cleared correctly")
 	}
 }
+
+// ----------------------------------------------------------------------------
+// LINE EDITOR
+// ----------------------------------------------------------------------------
+
+// editLine feeds raw key presses to a line editor and returns the submitted line.
+func editLine(t *testing.T, e *LineEditor, keys string) string {
+	t.Helper()
+	e.in = bufio.NewReader(strings.NewReader(keys))
+	line, err := e.ReadLine(PROMPT)
+	if err != nil {
+		t.Fatalf("ReadLine(%q) returned error: %v", keys, err)
+	}
+	return line
+}
+
+func TestLineEditor_CursorMovement(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x1b[D\x1b[DX\r", "aXbc"},                 // Left arrow twice, insert
+		{"abc\x01X\x05Y\r", "XabcY"},                   // Ctrl-A / Ctrl-E
+		{"abc\x1b[H\x1b[3~\r", "bc"},                   // Home, Delete
+		{"abcd\x7f\x7f\r", "ab"},                       // Backspace
+		{"x is 10\x17\x1775\r", "x 75"},                // Ctrl-W deletes words
+		{"hello\x1b[D\x1b[D\x0b\r", "hel"},             // Ctrl-K kills to end
+		{"hello\x1b[D\x1b[D\x15\r", "lo"},              // Ctrl-U kills to start
+		{"héllo\x1b[D\x1b[D\x1b[D\x1b[DE\r", "hEéllo"}, // Multi-byte runes
+	}
+
+	for _, tt := range tests {
+		e := newLineEditor(strings.NewReader(""), io.Discard)
+		if got := editLine(t, e, tt.keys); got != tt.expected {
+			t.Errorf("keys %q: expected %q, got %q", tt.keys, tt.expected, got)
+		}
+	}
+}
+
+func TestLineEditor_HistoryNavigation(t *testing.T) {
+	e := newLineEditor(strings.NewReader(""), io.Discard)
+	e.AddHistory("first")
+	e.AddHistory("second")
+	e.AddHistory("second") // Immediate repeats are skipped
+	e.AddHistory("   ")    // Blank lines are skipped
+
+	if len(e.history) != 2 {
+		t.Fatalf("expected 2 history entries, got %v", e.history)
+	}
+	if got := editLine(t, e, "\x1b[A\r"); got != "second" {
+		t.Errorf("Up: expected %q, got %q", "second", got)
+	}
+	if got := editLine(t, e, "\x1b[A\x1b[A\x1b[A\r"); got != "first" {
+		t.Errorf("Up past the oldest entry: expected %q, got %q", "first", got)
+	}
+	if got := editLine(t, e, "draft\x1b[A\x1b[B\r"); got != "draft" {
+		t.Errorf("Down should restore the unfinished line, got %q", got)
+	}
+}
+
+func TestLineEditor_ReverseSearch(t *testing.T) {
+	e := newLineEditor(strings.NewReader(""), io.Discard)
+	e.AddHistory(`show("one")`)
+	e.AddHistory("x is 2")
+	e.AddHistory(`show("three")`)
+
+	if got := editLine(t, e, "\x12show\r"); got != `show("three")` {
+		t.Errorf("expected most recent match, got %q", got)
+	}
+	if got := editLine(t, e, "\x12show\x12\r"); got != `show("one")` {
+		t.Errorf("Ctrl-R again should find an older match, got %q", got)
+	}
+	if got := editLine(t, e, "keep\x12show\x07\r"); got != "keep" {
+		t.Errorf("Ctrl-G should cancel the search, got %q", got)
+	}
+	if got := editLine(t, e, "\x12x is\x05 adds 1\r"); got != "x is 2 adds 1" {
+		t.Errorf("editing keys should accept the match, got %q", got)
+	}
+}
+
+func TestLineEditor_PersistentHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+
+	e := newLineEditor(strings.NewReader(""), io.Discard)
+	e.loadHistory(path)
+	e.AddHistory("x is 1")
+	e.AddHistory("show(x)")
+
+	next := newLineEditor(strings.NewReader(""), io.Discard)
+	next.loadHistory(path)
+	if got := editLine(t, next, "\x1b[A\x1b[A\r"); got != "x is 1" {
+		t.Errorf("history was not restored from %s, got %q", path, got)
+	}
+}
+
+func TestLineEditor_ControlKeys(t *testing.T) {
+	e := newLineEditor(strings.NewReader("abc\x03"), io.Discard)
+	if _, err := e.ReadLine(PROMPT); err != errInterrupt {
+		t.Errorf("Ctrl-C: expected errInterrupt, got %v", err)
+	}
+
+	e = newLineEditor(strings.NewReader("\x04"), io.Discard)
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl-D on an empty line: expected io.EOF, got %v", err)
+	}
+}
+
+func TestLineEditor_TabCompletion(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("counter", &object.Integer{Value: 1})
+	env.Set("country", &object.String{Value: "IN"})
+
+	names := func() []string { return append([]string{"count", "show", "while"}, env.Names()...) }
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"sh\t(1)\r", "show(1)"},              // Builtin
+		{"wh\t\r", "while"},                   // Keyword
+		{"x is cou\t\r", "x is count"},        // Extends to the common prefix
+		{"x is count\te\t\r", "x is counter"}, // Ambiguous, then narrowed
+		{"cou\tr\t\r", "country"},
+		{".cl\t\r", ".clear"}, // Dot-commands
+		{"zzz\t\r", "zzz"},    // No candidates
+	}
+
+	for _, tt := range tests {
+		e := newLineEditor(strings.NewReader(""), io.Discard)
+		e.complete = wordCompleter(replCommands, names)
+		if got := editLine(t, e, tt.keys); got != tt.expected {
+			t.Errorf("keys %q: expected %q, got %q", tt.keys, tt.expected, got)
+		}
+	}
+}
+
+// ----------------------------------------------------------------------------
+// MULTILINE INPUT
+// ----------------------------------------------------------------------------
+
+func TestParseInput_Completeness(t *testing.T) {
+	tests := []struct {
+		input    string
+		complete bool
+	}{
+		{"x is 10", true},
+		{`show("\{")`, true},              // Brace inside a string
+		{"s is `raw", false},              // Open raw string
+		{`show("{x")`, true},              // Interpolations close on their line: submit and report
+		{`x is "{"`, true},                // A stray brace does not open a string
+		{"x is 1 // {", true},             // Brace inside a comment
+		{"/* { */ x is 1", true},          // Brace inside a block comment
+		{"while x less 10 {", false},      // Open block
+		{"x is [1, 2,", false},            // Open array
+		{"show(1,", false},                // Open call
+		{`s is "unterminated`, false},     // Open string
+		{"/* still a comment", false},     // Open comment
+		{"x is", false},                   // Parser error at EOF
+		{"if x less 10 { }\nelse", false}, // else without a block yet
+		{"x is )", true},                  // Too many closers: submit and report
+		{"if x less\n.exit", true},        // Error before EOF: submit and report
+	}
+
+	for _, tt := range tests {
+		_, _, complete := parseInput(tt.input+"\n", false)
+		if complete != tt.complete {
+			t.Errorf("parseInput(%q): expected complete=%t, got %t", tt.input, tt.complete, complete)
+		}
+	}
+}
+
+func TestREPL_MultilineInput(t *testing.T) {
+	input := `
+	s is "\{ not a block"
+	s
+	nums is [1,
+	    2,
+	    3]
+	add is takes(a,
+	    b) {
+	    return a adds b
+	}
+	add(count(nums), 10)
+	.exit`
+	output := runSession(input)
+
+	if !strings.Contains(output, "{ not a block") {
+		t.Errorf("brace inside a string kept the REPL waiting. Output:\n%s", output)
+	}
+	if !strings.Contains(output, "13") {
+		t.Errorf("multiline array/function input was not evaluated. Output:\n%s", output)
+	}
+	if strings.Contains(output, "Parser Errors") {
+		t.Errorf("multiline input was submitted too early. Output:\n%s", output)
+	}
+}
+
+func TestREPL_Cancel(t *testing.T) {
+	input := `
+	x is 1
+	while true {
+	    x is x adds 1
+	.cancel
+	x
+	x is
+	.cancel
+	.cancel
+	x adds 100
+	.exit`
+	output := runSession(input)
+
+	if strings.Count(output, "Input cancelled.") != 2 {
+		t.Errorf("expected two cancellations. Output:\n%s", output)
+	}
+	if !strings.Contains(output, "101") {
+		t.Errorf("REPL did not recover after .cancel. Output:\n%s", output)
+	}
+}
+
+func TestREPL_BlankLineSubmitsIncompleteInput(t *testing.T) {
+	output := runSession("x is\n\n42\n.exit")
+
+	if !strings.Contains(output, "Parser Errors") {
+		t.Errorf("blank line did not submit the pending input. Output:\n%s", output)
+	}
+	if !strings.Contains(output, "42") {
+		t.Errorf("REPL did not recover after the parse error. Output:\n%s", output)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// SESSION COMMANDS
+// ----------------------------------------------------------------------------
+
+func TestREPL_LoadCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.eq")
+	os.WriteFile(path, []byte("double is takes(n) { return n times 2 }\nbase is 21\n"), 0o644)
+
+	output := runSession(".load " + path + "\ndouble(base)\n.load missing.eq\n.exit")
+
+	if !strings.Contains(output, "Loaded "+path) {
+		t.Errorf("file was not loaded. Output:\n%s", output)
+	}
+	if !strings.Contains(output, "42") {
+		t.Errorf("loaded definitions are not in the session. Output:\n%s", output)
+	}
+	if !strings.Contains(output, "Cannot load missing.eq") {
+		t.Errorf("missing file was not reported. Output:\n%s", output)
+	}
+}
+
+func TestREPL_SaveCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.eq")
+	input := `
+	x is 10
+	y is undefined_name
+	inc is takes(n) {
+	    return n adds 1
+	}
+	x is inc(x)
+	.save ` + path + `
+	.exit`
+	output := runSession(input)
+
+	if !strings.Contains(output, "Saved 3 inputs") {
+		t.Errorf("expected three successful inputs to be saved. Output:\n%s", output)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("session file was not written: %v", err)
+	}
+	saved := string(data)
+	if strings.Contains(saved, "undefined_name") {
+		t.Errorf("failed input was saved:\n%s", saved)
+	}
+
+	// Loading the saved session reproduces its state
+	output = runSession(".load " + path + "\nx\n.exit")
+	if !strings.Contains(output, "11") {
+		t.Errorf("saved session did not replay. File:\n%s\nOutput:\n%s", saved, output)
+	}
+}
+
+func TestREPL_EnvCommand(t *testing.T) {
+	output := runSession(".env\ncount_me is 3\nname is \"Ada\"\n.env\n.exit")
+
+	if !strings.Contains(output, "(no bindings)") {
+		t.Errorf("empty environment was not reported. Output:\n%s", output)
+	}
+	for _, want := range []string{"count_me", "INTEGER", "name", "STRING", "Ada"} {
+		if !strings.Contains(output, want) {
+			t.Errorf(".env output is missing %q. Output:\n%s", want, output)
+		}
+	}
+}
+
+func TestREPL_TypeCommand(t *testing.T) {
+	output := runSession("x is 1.5\n.type x\n.type [1, 2]\n.type takes(a) { return a }\n.type nope\n.exit")
+
+	for _, want := range []string{"FLOAT", "ARRAY", "FUNCTION", "identifier not found: nope"} {
+		if !strings.Contains(output, want) {
+			t.Errorf(".type output is missing %q. Output:\n%s", want, output)
+		}
+	}
+}
+
+func TestREPL_TimeCommand(t *testing.T) {
+	output := runSession(".time 6 times 7\n.exit")
+
+	if !strings.Contains(output, "42") {
+		t.Errorf(".time did not print the result. Output:\n%s", output)
+	}
+	if !strings.Contains(output, "Time: ") || !strings.Contains(output, "allocations") {
+		t.Errorf(".time did not report timing. Output:\n%s", output)
+	}
+}
+
+func TestREPL_ASTCommand(t *testing.T) {
+	output := runSession(".ast x is 1 adds 2\n.ast x is\n.exit")
+
+	expected := []string{
+		"Program",
+		"Statements[0]: ",
+		"AssignmentStatement",
+		`Name: ` + Reset + Purple + `Identifier` + Reset + ` "x"`,
+		`InfixExpression` + Reset + ` Operator="adds"`,
+		`Left: ` + Reset + Purple + `IntegerLiteral` + Reset + ` 1`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(output, want) {
+			t.Errorf(".ast output is missing %q. Output:\n%s", want, output)
+		}
+	}
+	if !strings.Contains(output, "Parser Errors") {
+		t.Errorf(".ast did not report a parse error. Output:\n%s", output)
+	}
+}
+
+func TestREPL_TraceCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.log")
+	output := runSession("double is takes(n) { n times 2 }\n.trace on\nx is double(4)\n.trace off\ny is 1\n" +
+		".trace file " + path + " doub\nz is double(1)\n.trace off\n.trace sideways\n.exit")
+
+	for _, want := range []string{"Trace on.", "1:1     x is double(4)", "        call double(4)", "        return double: 8",
+		"        x: (unset) -> 8", "Trace off.", "Usage: .trace"} {
+		if !strings.Contains(output, want) {
+			t.Errorf(".trace output is missing %q. Output:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "y is 1") || strings.Contains(output, "z is") {
+		t.Errorf("statements after .trace off (or traced to a file) were printed. Output:\n%s", output)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only double is traced: the top-level statement calling it is left out
+	if log := string(data); !strings.Contains(log, "call double(1)") || strings.Contains(log, "z is") {
+		t.Errorf("unexpected trace file:\n%s", log)
+	}
+}
+
+func TestREPL_Exit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.log")
+	in := strings.NewReader(".trace file " + path + "\nx is 1\nexit(3)\nshow(\"after\")\n")
+	var out bytes.Buffer
+	if code := Start(in, &out); code != 3 {
+		t.Errorf("expected exit code 3, got %d", code)
+	}
+	if strings.Contains(out.String(), "after") || strings.Contains(out.String(), "ERROR") {
+		t.Errorf("the session went on after exit(). Output:\n%s", out.String())
+	}
+	// The trace file is flushed and closed before the session ends
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "x is 1") {
+		t.Errorf("expected the trace file to hold the session so far, got %q (%v)", data, err)
+	}
+
+	for _, input := range []string{".type exit(4)\n", ".time exit(4)\n"} {
+		if code := Start(strings.NewReader(input), &out); code != 4 {
+			t.Errorf("%q: expected exit code 4, got %d", input, code)
+		}
+	}
+	if code := Start(strings.NewReader("1\n.exit\n"), &out); code != 0 {
+		t.Errorf(".exit: expected exit code 0, got %d", code)
+	}
+}
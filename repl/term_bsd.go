@@ -0,0 +1,16 @@
+//go:build darwin || freebsd || netbsd || openbsd || dragonfly
+
+// ==============================================================================================
+// FILE: repl/term_bsd.go
+// ==============================================================================================
+// PURPOSE: termios ioctl request numbers for macOS and the BSDs.
+// ==============================================================================================
+
+package repl
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TIOCGETA
+	ioctlSetTermios = syscall.TIOCSETA
+)
@@ -0,0 +1,14 @@
+// ==============================================================================================
+// FILE: repl/term_linux.go
+// ==============================================================================================
+// PURPOSE: termios ioctl request numbers for Linux.
+// ==============================================================================================
+
+package repl
+
+import "syscall"
+
+const (
+	ioctlGetTermios = syscall.TCGETS
+	ioctlSetTermios = syscall.TCSETS
+)
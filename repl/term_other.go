@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+// ==============================================================================================
+// FILE: repl/term_other.go
+// ==============================================================================================
+// PURPOSE: Fallback for platforms without termios: the REPL always uses plain line input.
+// ==============================================================================================
+
+package repl
+
+import "errors"
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
+
+func enableRawMode(fd uintptr) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
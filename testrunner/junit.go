@@ -0,0 +1,89 @@
+// ==============================================================================================
+// FILE: testrunner/junit.go
+// ==============================================================================================
+// PURPOSE: Serialises a test Report as JUnit XML so CI systems can consume the results.
+// ==============================================================================================
+
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr"`
+	Line      int           `xml:"line,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report to w in the JUnit XML format.
+func WriteJUnit(w io.Writer, report *Report) error {
+	doc := junitTestSuites{
+		Tests:    report.Total(),
+		Failures: report.Failures(),
+		Time:     seconds(report.Duration.Seconds()),
+	}
+
+	for _, s := range report.Suites {
+		suite := junitTestSuite{Name: s.File, Tests: len(s.Results), Time: seconds(s.Duration.Seconds())}
+		for _, res := range s.Results {
+			tc := junitTestCase{
+				Name:      res.Name,
+				ClassName: s.File,
+				File:      res.File,
+				Line:      res.Line,
+				Time:      seconds(res.Duration.Seconds()),
+			}
+			if !res.Passed {
+				suite.Failures++
+				tc.Failure = &junitFailure{
+					Message: res.Message,
+					Body:    fmt.Sprintf("%s:%d:%d: %s", res.File, res.Line, res.Column, res.Message),
+				}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		doc.Suites = append(doc.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
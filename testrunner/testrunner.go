@@ -0,0 +1,277 @@
+// ==============================================================================================
+// FILE: testrunner/testrunner.go
+// ==============================================================================================
+// PACKAGE: testrunner
+// PURPOSE: Implements the native test runner behind `eloquence test`.
+//          It discovers *_test.eq files, runs every top-level `test_*` function in an
+//          isolated environment, and reports pass/fail results with source positions.
+// ==============================================================================================
+
+package testrunner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/lexer"
+	"eloquence/object"
+	"eloquence/parser"
+	"eloquence/token"
+)
+
+const (
+	FileSuffix = "_test.eq" // Files ending with this suffix are test files
+	TestPrefix = "test_"    // Top-level functions starting with this prefix are tests
+)
+
+// Options controls a test run.
+type Options struct {
+	Filter  *regexp.Regexp // Only tests whose name matches are run (nil runs everything)
+	Verbose bool           // Print a line for passing tests as well as failing ones
+	Out     io.Writer      // Destination for the human readable summary
+}
+
+// Result is the outcome of a single test function.
+type Result struct {
+	Name     string
+	File     string
+	Line     int
+	Column   int
+	Passed   bool
+	Message  string // Failure message (empty when the test passed)
+	Duration time.Duration
+}
+
+// Suite groups the results of one test file.
+type Suite struct {
+	File     string
+	Results  []Result
+	Duration time.Duration
+}
+
+// Report is the outcome of a whole test run.
+type Report struct {
+	Suites   []Suite
+	Duration time.Duration
+}
+
+// Passed reports whether every test in the run passed.
+func (r *Report) Passed() bool {
+	return r.Failures() == 0
+}
+
+// Total returns the number of tests that were run.
+func (r *Report) Total() int {
+	n := 0
+	for _, s := range r.Suites {
+		n += len(s.Results)
+	}
+	return n
+}
+
+// Failures returns the number of tests that failed.
+func (r *Report) Failures() int {
+	n := 0
+	for _, s := range r.Suites {
+		for _, res := range s.Results {
+			if !res.Passed {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// ----------------------------------------------------------------------------------------------
+// DISCOVERY
+// ----------------------------------------------------------------------------------------------
+
+// Discover expands the given paths into a sorted list of test files.
+// Directories are walked recursively; files are accepted as-is.
+func Discover(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), FileSuffix) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// testFunction is a `test_*` function found at the top level of a test file.
+type testFunction struct {
+	name  string
+	token token.Token
+}
+
+// findTests returns the test functions of a program in source order.
+func findTests(program *ast.Program) []testFunction {
+	var tests []testFunction
+	for _, stmt := range program.Statements {
+		assign, ok := stmt.(*ast.AssignmentStatement)
+		if !ok || !strings.HasPrefix(assign.Name.Value, TestPrefix) {
+			continue
+		}
+		if _, ok := assign.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+		tests = append(tests, testFunction{name: assign.Name.Value, token: assign.Token})
+	}
+	return tests
+}
+
+// ----------------------------------------------------------------------------------------------
+// EXECUTION
+// ----------------------------------------------------------------------------------------------
+
+// Run executes every test in the given files and prints a summary to opts.Out.
+func Run(files []string, opts Options) *Report {
+	out := opts.Out
+	if out == nil {
+		out = io.Discard
+	}
+
+	report := &Report{}
+	start := time.Now()
+	for _, file := range files {
+		suite := runFile(file, opts)
+		for _, res := range suite.Results {
+			printResult(out, res, opts.Verbose)
+		}
+		report.Suites = append(report.Suites, suite)
+	}
+	report.Duration = time.Since(start)
+
+	printSummary(out, report)
+	return report
+}
+
+func runFile(file string, opts Options) Suite {
+	suite := Suite{File: file}
+	start := time.Now()
+	defer func() { suite.Duration = time.Since(start) }()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		suite.Results = append(suite.Results, Result{Name: file, File: file, Message: err.Error()})
+		return suite
+	}
+
+	p := parser.New(lexer.New(string(data)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		suite.Results = append(suite.Results, Result{
+			Name:    file,
+			File:    file,
+			Message: "parser errors:\n" + strings.Join(p.Errors(), "\n"),
+		})
+		return suite
+	}
+
+	for _, tf := range findTests(program) {
+		if opts.Filter != nil && !opts.Filter.MatchString(tf.name) {
+			continue
+		}
+		suite.Results = append(suite.Results, runTest(file, program, tf))
+	}
+	return suite
+}
+
+// runTest evaluates the whole file in a fresh environment, so that no state leaks
+// between tests, and then calls the test function.
+func runTest(file string, program *ast.Program, tf testFunction) Result {
+	res := Result{Name: tf.name, File: file, Line: tf.token.Line, Column: tf.token.Column}
+	start := time.Now()
+	defer func() { res.Duration = time.Since(start) }()
+
+	env := object.NewEnvironment()
+	env.SetDir(filepath.Dir(file)) // Includes are relative to the test file
+	if setup := evaluator.Eval(program, env); failed(setup) {
+		res.fail(setup.(*object.Error), "setup failed: ")
+		return res
+	}
+
+	call := &ast.CallExpression{
+		Token:    tf.token,
+		Function: &ast.Identifier{Token: tf.token, Value: tf.name},
+	}
+	if result := evaluator.Eval(call, env); failed(result) {
+		res.fail(result.(*object.Error), "")
+		return res
+	}
+
+	res.Passed = true
+	return res
+}
+
+// fail records an error, preferring the position where the error was raised.
+func (r *Result) fail(err *object.Error, prefix string) {
+	r.Message = prefix + err.Message
+	if err.Line != 0 {
+		r.Line = err.Line
+		r.Column = err.Column
+	}
+}
+
+// failed reports whether evaluation ended in an error. exit() only ends the test that calls
+// it, which passes with code 0 and fails with any other.
+func failed(obj object.Object) bool {
+	if code, ok := object.ExitCode(obj); ok {
+		return code != 0
+	}
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+// ----------------------------------------------------------------------------------------------
+// REPORTING
+// ----------------------------------------------------------------------------------------------
+
+func printResult(out io.Writer, res Result, verbose bool) {
+	if res.Passed {
+		if verbose {
+			fmt.Fprintf(out, "--- PASS: %s (%.3fs)\n", res.Name, res.Duration.Seconds())
+		}
+		return
+	}
+	fmt.Fprintf(out, "--- FAIL: %s (%.3fs)\n", res.Name, res.Duration.Seconds())
+	fmt.Fprintf(out, "    %s:%d:%d: %s\n", res.File, res.Line, res.Column, res.Message)
+}
+
+func printSummary(out io.Writer, report *Report) {
+	status := "PASS"
+	if !report.Passed() {
+		status = "FAIL"
+	}
+	fmt.Fprintf(out, "%s: %d passed, %d failed, %d total (%.3fs)\n",
+		status, report.Total()-report.Failures(), report.Failures(), report.Total(), report.Duration.Seconds())
+}
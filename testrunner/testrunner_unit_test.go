@@ -0,0 +1,158 @@
+// ==============================================================================================
+// FILE: testrunner/testrunner_unit_test.go
+// ==============================================================================================
+// PURPOSE: Unit tests for the native test runner.
+//          Verifies discovery, includes from nested directories, isolation between tests,
+//          filtering and JUnit output.
+// ==============================================================================================
+
+package testrunner
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/lexer"
+	"eloquence/parser"
+)
+
+const sampleTests = `
+counter is 0
+
+test_pass is takes() {
+	assert_equals(3, 1 adds 2)
+}
+
+test_fail is takes() {
+	assert_equals(4, 1 adds 2)
+}
+
+helper is takes() { return 1 }
+`
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %s", path, err)
+	}
+	return path
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a_test.eq", sampleTests)
+	writeTestFile(t, dir, "lib.eq", "x is 1")
+	os.Mkdir(filepath.Join(dir, "nested"), 0o755)
+	writeTestFile(t, filepath.Join(dir, "nested"), "b_test.eq", sampleTests)
+
+	files, err := Discover([]string{dir})
+	if err != nil {
+		t.Fatalf("Discover failed: %s", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 test files, got %d: %v", len(files), files)
+	}
+}
+
+func TestRun_IncludesFromTheTestFileDirectory(t *testing.T) {
+	evaluator.ParserFunc = func(input string) *ast.Program { return parser.New(lexer.New(input)).ParseProgram() }
+	defer func() { evaluator.ParserFunc = nil }()
+
+	sub := filepath.Join(t.TempDir(), "sub")
+	os.Mkdir(sub, 0o755)
+	writeTestFile(t, sub, "lib.eq", "double is takes(n) { n times 2 }")
+	writeTestFile(t, sub, "lib_test.eq", "include \"lib.eq\"\ntest_double is takes() { assert_equals(4, double(2)) }\n")
+
+	// The working directory is this package, not sub
+	files, err := Discover([]string{filepath.Dir(sub)})
+	if err != nil {
+		t.Fatalf("Discover failed: %s", err)
+	}
+	report := Run(files, Options{})
+	if report.Total() != 1 || !report.Passed() {
+		t.Errorf("expected the nested test to pass, got %+v", report.Suites)
+	}
+}
+
+func TestRun_ReportsPassAndFail(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "math_test.eq", sampleTests)
+
+	var out bytes.Buffer
+	report := Run([]string{path}, Options{Out: &out})
+
+	if report.Total() != 2 || report.Failures() != 1 {
+		t.Fatalf("expected 2 tests with 1 failure, got %d/%d", report.Total(), report.Failures())
+	}
+	failed := report.Suites[0].Results[1]
+	if failed.Name != "test_fail" || failed.Line != 9 {
+		t.Errorf("unexpected failure record: %+v", failed)
+	}
+	if !strings.Contains(out.String(), "math_test.eq:9:") {
+		t.Errorf("summary is missing the failure position:\n%s", out.String())
+	}
+}
+
+func TestRun_IsolatesEnvironments(t *testing.T) {
+	input := `
+counter is 0
+bump is takes() {
+	ptr is pointing to counter
+	pointing from ptr is (pointing from ptr) adds 1
+	return pointing from ptr
+}
+test_first is takes() { assert_equals(1, bump()) }
+test_second is takes() { assert_equals(1, bump()) }
+`
+	path := writeTestFile(t, t.TempDir(), "state_test.eq", input)
+	report := Run([]string{path}, Options{})
+	if !report.Passed() {
+		t.Errorf("state leaked between tests: %+v", report.Suites[0].Results)
+	}
+}
+
+func TestRun_Exit(t *testing.T) {
+	input := `
+test_exit_fails is takes() { exit(3) }
+test_exit_zero_passes is takes() { exit(0) }
+test_runs_after_exit is takes() { assert(true) }
+`
+	path := writeTestFile(t, t.TempDir(), "exit_test.eq", input)
+	report := Run([]string{path}, Options{})
+	if report.Total() != 3 || report.Failures() != 1 {
+		t.Fatalf("expected 3 tests with 1 failure, got %d/%d: %+v", report.Total(), report.Failures(), report.Suites[0].Results)
+	}
+	if res := report.Suites[0].Results[0]; res.Passed || !strings.Contains(res.Message, "exited with code 3") {
+		t.Errorf("expected test_exit_fails to fail with its exit code, got %+v", res)
+	}
+}
+
+func TestRun_Filter(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "math_test.eq", sampleTests)
+	report := Run([]string{path}, Options{Filter: regexp.MustCompile("pass")})
+	if report.Total() != 1 || !report.Passed() {
+		t.Errorf("filter did not select only test_pass: %+v", report.Suites[0].Results)
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "math_test.eq", sampleTests)
+	report := Run([]string{path}, Options{})
+
+	var out bytes.Buffer
+	if err := WriteJUnit(&out, report); err != nil {
+		t.Fatalf("WriteJUnit failed: %s", err)
+	}
+	xml := out.String()
+	for _, want := range []string{`<testsuites tests="2" failures="1"`, `name="test_pass"`, `<failure message=`} {
+		if !strings.Contains(xml, want) {
+			t.Errorf("JUnit output missing %q:\n%s", want, xml)
+		}
+	}
+}
@@ -47,11 +47,11 @@ func BenchmarkSystem_DeepRecursion(b *testing.B) {
 
 func BenchmarkSystem_StringConcatenation(b *testing.B) {
 	var sb strings.Builder
-	sb.WriteString(`str is "" `)
+	sb.WriteString(`text is "" `)
 	for i := 0; i < 100; i++ {
-		sb.WriteString(`str is str adds "a" `)
+		sb.WriteString(`text is text adds "a" `)
 	}
-	sb.WriteString("str")
+	sb.WriteString("text")
 	input := sb.String()
 
 	b.ResetTimer()
@@ -65,8 +65,9 @@ func TestSystem_Fibonacci_Recursion(t *testing.T) {
 }
 
 func TestSystem_MapReduce_HigherOrderFunctions(t *testing.T) {
+	// map is a builtin, so the program replaces it explicitly
 	input := `
-	map is takes(arr, func) {
+	redefine map is takes(arr, func) {
 		// Simulating iteration for the test case
 		val1 is func(arr[0])
 		val2 is func(arr[1])
@@ -124,6 +125,7 @@ func TestSystem_PointerMutation(t *testing.T) {
 }
 
 func TestSystem_ShadowingAndScope(t *testing.T) {
+	// Assignment updates the outer variable; only `let` shadows it
 	input := `
 	x is 10
 	if true {
@@ -133,9 +135,62 @@ func TestSystem_ShadowingAndScope(t *testing.T) {
 	x`
 
 	result := runCode(input)
+	assertInteger(t, result, 21)
+
+	input = `
+	x is 10
+	if true {
+		let x is 20
+		x is x adds 1
+	}
+	x`
+
+	result = runCode(input)
 	assertInteger(t, result, 10)
 }
 
+func TestSystem_ClosureCounter(t *testing.T) {
+	input := `
+	make_counter is takes() {
+		n is 0
+		return takes() {
+			n is n adds 1
+			return n
+		}
+	}
+	a is make_counter()
+	b is make_counter()
+	a()
+	a()
+	b()
+	total is 0
+	for i in [1, 2, 3] {
+		if i greater 1 { total is total adds i }
+	}
+	a() times 100 adds b() times 10 adds total`
+
+	result := runCode(input)
+	assertInteger(t, result, 325)
+}
+
+func TestSystem_DestructuringFibonacci(t *testing.T) {
+	input := `
+	divmod is takes(a, b) { return [a divides b, a modulo b] }
+	q, r is divmod(47, 10)
+
+	a, b is 0, 1
+	i is 0
+	while i less 10 {
+		a, b is b, a adds b
+		i is i adds 1
+	}
+	[first, ...rest] is [a, q, r]
+	first adds count(rest)`
+
+	result := runCode(input)
+	assertInteger(t, result, 57)
+}
+
 func TestSystem_EdgeCase_DivisionByZero(t *testing.T) {
 	input := `10 divides 0`
 	result := runCode(input)
@@ -145,6 +200,103 @@ func TestSystem_EdgeCase_DivisionByZero(t *testing.T) {
 	}
 }
 
+func TestSystem_PointersIntoData(t *testing.T) {
+	// Field, element and cell pointers keep their container, whatever the names do later
+	input := `
+	define Account as struct { balance as Integer }
+	deposit is takes(target, amount) {
+		pointing from target is pointing from target adds amount
+	}
+
+	acct is Account { balance: 100 }
+	bal is pointing to acct.balance
+	acct is Account { balance: 0 }
+	deposit(bal, 50)
+
+	totals is [0, 0]
+	deposit(pointing to totals[1], 7)
+
+	counter is new(1)
+	ref is pointing to counter
+	deposit(pointing from ref, 2)
+
+	pointing from bal adds totals[1] adds pointing from counter adds acct.balance`
+
+	result := runCode(input)
+	assertInteger(t, result, 160) // 150 + 7 + 3 + 0
+}
+
+func TestSystem_GeneratorPipeline(t *testing.T) {
+	// An endless generator is only run as far as the pipeline asks, and cleans up when dropped
+	input := `
+	opened is 0
+	closed is 0
+	primes is takes() {
+		opened is opened adds 1
+		found is []
+		n is 2
+		try {
+			while true {
+				is_prime is true
+				for p in found {
+					if n modulo p equals 0 { is_prime is false }
+				}
+				if is_prime {
+					found is append(found, n)
+					yield n
+				}
+				n is n adds 1
+			}
+		} finally {
+			closed is closed adds 1
+		}
+	}
+
+	squares is map(skip(primes(), 2), takes(p) { p times p })
+	sum_below is takes(limit) {
+		total is 0
+		for sq in squares {
+			if sq greater limit { return total }
+			total is total adds sq
+		}
+	}
+	sum_below(200) adds opened times 1000 adds closed times 100`
+
+	result := runCode(input)
+	assertInteger(t, result, 1464) // 25 + 49 + 121 + 169, one generator opened and closed
+}
+
+func TestSystem_WorkerPool(t *testing.T) {
+	// Workers share one job channel and report to one result channel
+	input := `
+	jobs is channel()
+	results is channel(10)
+
+	worker is takes(id) {
+		handled is 0
+		for n in jobs {
+			send(results, n times n)
+			handled is handled adds 1
+		}
+		return handled
+	}
+
+	workers is [spawn worker(1), spawn worker(2), spawn worker(3)]
+	for n in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10] { send(jobs, n) }
+	close(jobs)
+
+	handled is 0
+	for h in wait_all(workers) { handled is handled adds h }
+	close(results)
+
+	total is 0
+	for r in results { total is total adds r }
+	total adds handled times 1000`
+
+	result := runCode(input)
+	assertInteger(t, result, 10385) // Sum of squares 1..10, and all 10 jobs handled
+}
+
 func TestSystem_EdgeCase_DanglingPointer(t *testing.T) {
 	input := `
 	ptr is pointing to nothing
@@ -9,6 +9,12 @@
 
 package token
 
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
 // TokenType is a string type alias that represents the category of a token.
 // We use strings (instead of integers) for easier debugging and readability
 // during the development of the language core.
@@ -21,6 +27,31 @@ type Token struct {
 	Literal string    // The actual text found in the source code (e.g., "myVar", "10")
 	Line    int       // The line number where the token was found (for error reporting)
 	Column  int       // The column number where the token starts (for precise error pointing)
+	Offset  int       // The byte offset where the token starts in the source
+	End     Position  // The place just past the token's last character
+}
+
+// Position is a place in the source code. Lines and columns count from 1; columns count
+// characters, offsets count bytes from the start of the source.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Pos returns the place where the token starts.
+func (t Token) Pos() Position {
+	return Position{Offset: t.Offset, Line: t.Line, Column: t.Column}
+}
+
+// IsValid reports whether the position was set (a zero Position has no line).
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String formats the position as "line:column".
+func (p Position) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
 }
 
 // ----------------------------------------------------------------------------------------------
@@ -34,6 +65,7 @@ const (
 	// ----------------
 	ILLEGAL = "ILLEGAL" // Represents any character or sequence that the Lexer cannot recognize
 	EOF     = "EOF"     // End Of File - signals the Parser to stop processing
+	COMMENT = "COMMENT" // A source comment (recorded by the Lexer, never handed to the Parser)
 
 	// Identifiers & Literals
 	// ----------------------
@@ -45,6 +77,9 @@ const (
 	BOOL   = "BOOL"   // Boolean values (true, false)
 	NIL    = "NIL"    // Represents the absence of value (syntax: "none")
 
+	RAW_STRING = "RAW_STRING" // Raw strings in backticks: no escapes, may span lines
+	TEMPLATE   = "TEMPLATE"   // Interpolated strings (e.g., "Hello {name}"); literal is the raw source
+
 	// Operators (Natural Language)
 	// ----------------------------
 	// Eloquence replaces cryptic symbols with English words to lower the barrier to entry.
@@ -68,15 +103,16 @@ const (
 	// Delimiters
 	// ----------
 	// Standard punctuation to structure the code.
-	LPAREN   = "(" // Start of function parameters or grouping
-	RPAREN   = ")" // End of function parameters or grouping
-	LBRACKET = "[" // Start of array definition or index
-	RBRACKET = "]" // End of array definition or index
-	LBRACE   = "{" // Start of hash map or struct definition
-	RBRACE   = "}" // End of hash map or struct definition
-	COMMA    = "," // Separator for elements
-	COLON    = ":" // Separator for key-value pairs
-	DOT      = "." // Accessor for struct fields or methods
+	LPAREN   = "("   // Start of function parameters or grouping
+	RPAREN   = ")"   // End of function parameters or grouping
+	LBRACKET = "["   // Start of array definition or index
+	RBRACKET = "]"   // End of array definition or index
+	LBRACE   = "{"   // Start of hash map or struct definition
+	RBRACE   = "}"   // End of hash map or struct definition
+	COMMA    = ","   // Separator for elements
+	COLON    = ":"   // Separator for key-value pairs
+	DOT      = "."   // Accessor for struct fields or methods
+	ELLIPSIS = "..." // Rest marker in patterns (e.g., [first, ...rest])
 
 	// Keywords (Control Flow & Definitions)
 	// -------------------------------------
@@ -95,6 +131,21 @@ const (
 	THROW   = "THROW"   // Raise errors
 	FINALLY = "FINALLY" // Always execute block
 	IN      = "IN"      // Used in range loops (for x IN list)
+	YIELD   = "YIELD"   // Hands one value of a generator to its consumer
+	SPAWN   = "SPAWN"   // Runs a function call concurrently (spawn f(x))
+
+	// Pattern Matching Keywords
+	// -------------------------
+	MATCH     = "MATCH"     // Start of a match expression
+	WHEN      = "WHEN"      // Starts a match arm (when <patterns> then ...)
+	THEN      = "THEN"      // Separates an arm's patterns from its body
+	OTHERWISE = "OTHERWISE" // Fallback arm of a match expression
+
+	// Binding Keywords
+	// ----------------
+	CONSTANT = "CONSTANT" // Declares a binding that can never be reassigned (constant PI is 3.14)
+	REDEFINE = "REDEFINE" // Deliberately replaces a builtin function (redefine show is ...)
+	LET      = "LET"      // Creates a new binding in the current scope, shadowing outer ones (let x is 1)
 
 	// Pointer Keywords
 	// ----------------
@@ -105,6 +156,7 @@ const (
 	// Data Structure & Module Keywords
 	// --------------------------------
 	STRUCT  = "STRUCT"  // Defines a composite data type
+	ENUM    = "ENUM"    // Defines a type with a fixed set of variants
 	DEFINE  = "DEFINE"  // Starts a definition statement
 	AS      = "AS"      // Linking word for definitions
 	INCLUDE = "INCLUDE" // Imports code from another file
@@ -147,6 +199,19 @@ var keywords = map[string]TokenType{
 	"throw":   THROW,
 	"finally": FINALLY,
 	"in":      IN,
+	"yield":   YIELD,
+	"spawn":   SPAWN,
+
+	// Pattern Matching
+	"match":     MATCH,
+	"when":      WHEN,
+	"then":      THEN,
+	"otherwise": OTHERWISE,
+
+	// Bindings
+	"constant": CONSTANT,
+	"redefine": REDEFINE,
+	"let":      LET,
 
 	// Complex Keywords (Handled via specific lexer logic usually, but mapped here for consistency)
 	"pointing to":   POINTING_TO,
@@ -159,6 +224,7 @@ var keywords = map[string]TokenType{
 
 	// Structs & Modules
 	"struct":  STRUCT,
+	"enum":    ENUM,
 	"define":  DEFINE,
 	"as":      AS,
 	"include": INCLUDE,
@@ -181,3 +247,16 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// Keywords returns every single-word reserved keyword, sorted.
+// Compound keywords such as "pointing to" are omitted. Used by tooling such as REPL completion.
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		if !strings.Contains(word, " ") {
+			words = append(words, word)
+		}
+	}
+	sort.Strings(words)
+	return words
+}
@@ -53,9 +53,21 @@ func TestTokenConstants(t *testing.T) {
 		// 7. Check Structs & Modules
 		{"define", DEFINE},
 		{"struct", STRUCT},
+		{"enum", ENUM},
 		{"include", INCLUDE},
 
-		// 8. Check Non-Keywords (Standard Identifiers)
+		// 8. Check Pattern Matching
+		{"match", MATCH},
+		{"when", WHEN},
+		{"then", THEN},
+		{"otherwise", OTHERWISE},
+
+		// 9. Check Binding Keywords
+		{"constant", CONSTANT},
+		{"redefine", REDEFINE},
+		{"let", LET},
+
+		// 10. Check Non-Keywords (Standard Identifiers)
 		{"myVariable", IDENT},
 		{"calculateSum", IDENT},
 		{"x", IDENT},
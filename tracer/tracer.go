@@ -0,0 +1,186 @@
+// ==============================================================================================
+// FILE: tracer/tracer.go
+// ==============================================================================================
+// PACKAGE: tracer
+// PURPOSE: Implements the execution trace behind `eloquence run -trace` and the REPL's .trace.
+//          A Tracer is installed as the evaluator's hook and logs every statement it sees with
+//          its position, every function call with its arguments and result, and every
+//          assignment with the old and new value. It can be limited to some functions.
+// ==============================================================================================
+
+package tracer
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"eloquence/ast"
+	"eloquence/evaluator"
+	"eloquence/object"
+)
+
+// MainName is the function name matched by Options.Filter for code outside any function.
+const MainName = "main"
+
+// maxWidth limits how much of a statement or value a trace line shows.
+const maxWidth = 60
+
+// Options configures a Tracer.
+type Options struct {
+	Out    io.Writer      // Destination of the trace
+	Filter *regexp.Regexp // Only trace functions whose name matches (nil traces everything)
+}
+
+// Tracer logs a running program while installed as an evaluator.Hook.
+type Tracer struct {
+	mu      sync.Mutex
+	out     io.Writer
+	filter  *regexp.Regexp
+	calls   map[*object.Environment]string // Names of the running calls, by the scope of the call
+	pending map[assignment]string          // Old values of assignments being evaluated
+}
+
+type assignment struct {
+	node *ast.AssignmentStatement
+	env  *object.Environment
+}
+
+// New creates a tracer.
+func New(opts Options) *Tracer {
+	return &Tracer{
+		out:     opts.Out,
+		filter:  opts.Filter,
+		calls:   make(map[*object.Environment]string),
+		pending: make(map[assignment]string),
+	}
+}
+
+var _ evaluator.Hook = (*Tracer)(nil)
+
+// Enter logs statements as they start and remembers the value an assignment replaces.
+func (t *Tracer) Enter(node ast.Node, env *object.Environment) {
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		return
+	}
+	if _, block := stmt.(*ast.BlockStatement); block {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.traced(env) {
+		return
+	}
+	t.printf(env.CallDepth(), stmt.Pos().String(), "%s", shorten(stmt.String()))
+	if assign, ok := stmt.(*ast.AssignmentStatement); ok {
+		old := "(unset)"
+		if val, ok := env.Get(assign.Name.Value); ok {
+			old = shorten(val.Inspect())
+		}
+		t.pending[assignment{assign, env}] = old
+	}
+}
+
+// Leave logs the new value of an assignment.
+func (t *Tracer) Leave(node ast.Node, env *object.Environment, result object.Object) {
+	assign, ok := node.(*ast.AssignmentStatement)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := assignment{assign, env}
+	old, ok := t.pending[key]
+	if !ok {
+		return
+	}
+	delete(t.pending, key)
+	if result != nil && result.Type() == object.ERROR_OBJ {
+		return
+	}
+	if val, ok := env.Get(assign.Name.Value); ok {
+		t.printf(env.CallDepth(), "", "%s: %s -> %s", assign.Name.Value, old, shorten(val.Inspect()))
+	}
+}
+
+func (t *Tracer) Call(fn *object.Function, args []object.Object, env, caller *object.Environment) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name := functionName(fn)
+	t.calls[env] = name
+	if !t.matches(name) {
+		return
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = shorten(arg.Inspect())
+	}
+	t.printf(env.CallDepth()-1, "", "call %s(%s)", name, strings.Join(values, ", "))
+}
+
+func (t *Tracer) Return(fn *object.Function, result object.Object, env *object.Environment) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name := t.calls[env]
+	delete(t.calls, env)
+	if !t.matches(name) {
+		return
+	}
+	value := "none"
+	switch result := result.(type) {
+	case nil:
+	case *object.TailCall:
+		value = "(tail call follows)"
+	case *object.Error:
+		value = "error: " + result.Message
+	default:
+		value = shorten(result.Inspect())
+	}
+	t.printf(env.CallDepth()-1, "", "return %s: %s", name, value)
+}
+
+// traced reports whether code running in env is traced: the function it runs in must match.
+func (t *Tracer) traced(env *object.Environment) bool {
+	if t.filter == nil {
+		return true
+	}
+	scope := env.CallScope()
+	if scope == nil {
+		return t.matches(MainName)
+	}
+	name, ok := t.calls[scope]
+	return ok && t.matches(name) // The body of a generator outlives its call and is left out
+}
+
+func (t *Tracer) matches(name string) bool {
+	return t.filter == nil || t.filter.MatchString(name)
+}
+
+// printf writes one trace line: the position (if any), then the message indented by call depth.
+func (t *Tracer) printf(depth int, pos, format string, a ...interface{}) {
+	if depth < 0 {
+		depth = 0
+	}
+	fmt.Fprintf(t.out, "%-8s%s%s\n", pos, strings.Repeat("  ", depth), fmt.Sprintf(format, a...))
+}
+
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "anonymous"
+	}
+	return fn.Name
+}
+
+// shorten keeps the first line of s, cut to maxWidth characters.
+func shorten(s string) string {
+	if line, _, found := strings.Cut(s, "\n"); found {
+		s = line + " ..."
+	}
+	if runes := []rune(s); len(runes) > maxWidth {
+		s = string(runes[:maxWidth-3]) + "..."
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+// ==============================================================================================
+// FILE: tracer/tracer_unit_test.go
+// ==============================================================================================
+// PURPOSE: Unit tests for the execution tracer.
+//          Verifies the logged statements, calls and assignments, and function filtering.
+// ==============================================================================================
+
+package tracer
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"eloquence/evaluator"
+	"eloquence/lexer"
+	"eloquence/object"
+	"eloquence/parser"
+)
+
+const sample = `square is takes(n) { return n times n }
+apply is takes(f, x) { return f(x) }
+total is 1
+total is apply(square, 3)
+`
+
+func trace(t *testing.T, input string, filter *regexp.Regexp) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	var out bytes.Buffer
+	evaluator.SetHook(New(Options{Out: &out, Filter: filter}))
+	defer evaluator.SetHook(nil)
+	evaluator.Eval(program, object.NewEnvironment())
+	return out.String()
+}
+
+func TestTrace(t *testing.T) {
+	expected := `1:1     square is takes (n) return (n times n)
+        square: (unset) -> takes(...) { ... }
+2:1     apply is takes (f, x) return f(x)
+        apply: (unset) -> takes(...) { ... }
+3:1     total is 1
+        total: (unset) -> 1
+4:1     total is apply(square, 3)
+        call apply(takes(...) { ... }, 3)
+2:24      return f(x)
+        return apply: (tail call follows)
+        call square(3)
+1:22      return (n times n)
+        return square: 9
+        total: 1 -> 9
+`
+	if got := trace(t, sample, nil); got != expected {
+		t.Errorf("expected trace:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestTraceFilter(t *testing.T) {
+	expected := `        call square(3)
+1:22      return (n times n)
+        return square: 9
+`
+	if got := trace(t, sample, regexp.MustCompile("^square$")); got != expected {
+		t.Errorf("expected trace:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Code outside functions is traced as main
+	got := trace(t, sample, regexp.MustCompile("^main$"))
+	if !strings.Contains(got, "4:1     total is apply(square, 3)") || strings.Contains(got, "call") {
+		t.Errorf("expected only top-level statements, got:\n%s", got)
+	}
+}
+
+func TestShorten(t *testing.T) {
+	if got := shorten("a\nb"); got != "a ..." {
+		t.Errorf("expected the first line, got %q", got)
+	}
+	if got := shorten(strings.Repeat("x", 100)); len(got) != maxWidth || !strings.HasSuffix(got, "...") {
+		t.Errorf("expected %d characters ending in ..., got %q", maxWidth, got)
+	}
+}
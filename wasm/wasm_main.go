@@ -31,6 +31,7 @@ func main() {
 
 	// Expose the function to JavaScript
 	js.Global().Set("runEloquence", js.FuncOf(runCode))
+	js.Global().Set("parseEloquence", js.FuncOf(parseCode))
 
 	fmt.Println("Eloquence WASM Engine Loaded.")
 
@@ -39,7 +40,7 @@ func main() {
 }
 
 // runCode is the bridge between JS and Go
-func runCode(this js.Value, p []js.Value) interface{} {
+func runCode(this js.Value, p []js.Value) (response interface{}) {
 	// Safety check for arguments
 	if len(p) < 1 {
 		return map[string]interface{}{
@@ -82,10 +83,18 @@ func runCode(this js.Value, p []js.Value) interface{} {
 	defer func() {
 		if r := recover(); r != nil {
 			outputBuffer.WriteString(fmt.Sprintf("\nRUNTIME PANIC: %v", r))
+			response = map[string]interface{}{
+				"logs":   outputBuffer.String(),
+				"result": "",
+			}
 		}
 	}()
 
 	result := evaluator.Eval(program, env)
+	if code, ok := object.ExitCode(result); ok {
+		outputBuffer.WriteString(fmt.Sprintf("[exited with code %d]\n", code))
+		result = nil
+	}
 
 	// 5. Prepare Result
 	finalResult := ""
@@ -106,6 +115,37 @@ func runCode(this js.Value, p []js.Value) interface{} {
 	}
 }
 
+// parseCode returns the syntax tree of the code as JSON, for the visualiser
+func parseCode(this js.Value, p []js.Value) interface{} {
+	if len(p) < 1 {
+		return map[string]interface{}{
+			"error": []interface{}{"No code provided to parse"},
+		}
+	}
+
+	pObj := parser.New(lexer.New(p[0].String()))
+	program := pObj.ParseProgram()
+	if len(pObj.Errors()) > 0 {
+		var errs []interface{}
+		for _, msg := range pObj.Errors() {
+			errs = append(errs, "PARSER ERROR: "+msg)
+		}
+		return map[string]interface{}{
+			"error": errs,
+		}
+	}
+
+	data, err := ast.ToJSON(program)
+	if err != nil {
+		return map[string]interface{}{
+			"error": []interface{}{err.Error()},
+		}
+	}
+	return map[string]interface{}{
+		"ast": string(data), // JSON.parse() it on the JS side
+	}
+}
+
 // overrideBuiltinsForWeb modifies the 'show' and 'ask' commands to work in browser
 func overrideBuiltinsForWeb() {
 	// Find and replace "show"